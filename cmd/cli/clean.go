@@ -0,0 +1,28 @@
+package main
+
+import (
+	"log"
+
+	"github.com/clems4ever/big-context/internal/cli"
+	"github.com/spf13/cobra"
+)
+
+var cleanCacheLabel string
+
+var cleanCmd = &cobra.Command{
+	Use:   "clean <data-file-path>",
+	Short: "Remove the cached chunks and results of a file, e.g. before rerunning with another prompt or model",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := cli.CleanCacheLabel(args[0], cleanCacheLabel); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	flags := cleanCmd.Flags()
+	flags.StringVar(&cleanCacheLabel, "cache-label", cleanCacheLabel, "only remove the cache with this label")
+
+	rootCmd.AddCommand(cleanCmd)
+}
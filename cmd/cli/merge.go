@@ -0,0 +1,34 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/clems4ever/big-context/internal/cli"
+	"github.com/spf13/cobra"
+)
+
+var (
+	mergeOutput string
+	mergeSort   bool
+)
+
+var mergeCmd = &cobra.Command{
+	Use:   "merge <combined-results-path>...",
+	Short: "Merge the combined outputs of several runs into one output without duplicate lines",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		err := cli.MergeOutputs(os.Stdout, os.Stderr, args, mergeOutput, mergeSort)
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	flags := mergeCmd.Flags()
+	flags.StringVarP(&mergeOutput, "output", "o", mergeOutput, "file the merged output is written to, stdout when empty")
+	flags.BoolVar(&mergeSort, "sort", mergeSort, "sort the merged lines instead of keeping the order they first appear in")
+
+	rootCmd.AddCommand(mergeCmd)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strings"
+
+	"github.com/clems4ever/big-context/internal/cli"
+	"github.com/spf13/cobra"
+)
+
+var (
+	patchChunk   int
+	patchFrom    string
+	patchReducer string
+
+	patchCacheLabel string
+)
+
+var patchCmd = &cobra.Command{
+	Use:   "patch <data-file-path>",
+	Short: "Replace the cached result of a chunk with a corrected one and rebuild the combined results",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		content, err := os.ReadFile(patchFrom)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		patchOpts := cli.DefaultOptions()
+		patchOpts.CacheLabel = patchCacheLabel
+		if patchReducer != "" {
+			patchOpts.Reducer, err = cli.GetReducer(patchReducer)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		err = cli.PatchChunk(cmd.Context(), args[0], patchChunk, string(content), patchOpts)
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	flags := patchCmd.Flags()
+	flags.IntVar(&patchChunk, "chunk", patchChunk, "number of the chunk to patch, starting at 1")
+	flags.StringVar(&patchFrom, "from", patchFrom, "file containing the corrected result of the chunk")
+	flags.StringVar(&patchReducer, "reducer", patchReducer, "how chunk results are combined, the reducer of the run that filled the cache by default: "+strings.Join(cli.ReducerNames(), ", "))
+	flags.StringVar(&patchCacheLabel, "cache-label", patchCacheLabel, "label of the cache to patch")
+	patchCmd.MarkFlagRequired("chunk")
+	patchCmd.MarkFlagRequired("from")
+
+	rootCmd.AddCommand(patchCmd)
+}
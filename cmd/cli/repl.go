@@ -0,0 +1,56 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/clems4ever/big-context/internal/cli"
+	myopenai "github.com/clems4ever/big-context/internal/openai"
+	"github.com/spf13/cobra"
+)
+
+var replChunk = 1
+
+var replCmd = &cobra.Command{
+	Use:   "repl <data-file-path>",
+	Short: "Run prompts typed interactively against one chunk of a file to iterate on them",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		apiKey := os.Getenv("OPENAI_API_KEY")
+		if apiKey == "" {
+			log.Fatal(cli.ErrMissingAPIKey)
+		}
+
+		var err error
+		opts.Headers, err = cli.ParseHeaders(headers)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		client, err := myopenai.NewClient(apiKey, nil, opts.Headers)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// The first chunk is loaded by default, whatever its number
+		if opts.ZeroIndex && !cmd.Flags().Changed("chunk") {
+			replChunk = 0
+		}
+
+		err = cli.RunREPL(cmd.Context(), client, args[0], replChunk, os.Stdin, os.Stdout, opts)
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	flags := replCmd.Flags()
+	flags.IntVar(&replChunk, "chunk", replChunk, "number of the chunk to load, starting at 1, or at 0 with --zero-index")
+	flags.BoolVar(&opts.ZeroIndex, "zero-index", opts.ZeroIndex, "number the chunks from 0")
+	flags.StringArrayVar(&headers, "header", headers, "header added to every API request as key=value (repeatable)")
+	flags.IntVar(&opts.ChunkSize, "chunk-size", opts.ChunkSize, "maximum number of tokens of a chunk")
+	flags.StringVar(&opts.DeveloperPrompt, "developer-prompt", opts.DeveloperPrompt, "instructions sent as a developer message with each prompt")
+
+	rootCmd.AddCommand(replCmd)
+}
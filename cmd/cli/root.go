@@ -2,30 +2,382 @@ package main
 
 import (
 	"log"
+	"net"
+	"net/http"
 	"os"
+	"regexp"
+	"strings"
 
 	"github.com/clems4ever/big-context/internal/cli"
 	"github.com/spf13/cobra"
 )
 
+var (
+	opts         = cli.DefaultOptions()
+	ifExists     = string(opts.IfExists)
+	onRefusal    = string(opts.OnRefusal)
+	onOverflow   = string(opts.OnRequestOverflow)
+	promptSuffix = string(opts.PromptSuffix)
+	schedule     = string(opts.Schedule)
+	choicePolicy = string(opts.ChoicePolicy)
+	packing      = string(opts.Packing)
+	splitBy      = string(opts.SplitStrategy)
+	reducer      = cli.ReducerConcat
+	outputFormat = string(cli.OutputText)
+
+	reduceStrategy string
+
+	outputExample string
+	headers       []string
+	tasks         []string
+	logitBias     []string
+	stopSequences []string
+	compareModels []string
+
+	recordDelimiter string
+	lineDelimiter   string
+
+	cachePerms     = "0755"
+	cacheFilePerms = "0644"
+
+	metricsAddr string
+
+	outputFilter string
+	chunkFilter  string
+
+	maxOutputFileSize string
+
+	noEditor bool
+
+	preset     string
+	presetsDir = cli.DefaultPresetsDir()
+)
+
 var rootCmd = &cobra.Command{
-	Use:   "mapred-llm <prompt> <data-file-path>",
+	Use:   "mapred-llm [prompt] <data-file-or-directory-path>",
 	Short: "Command that performs a sort of map reduce on data in a file and using ChatGPT as the filter and reducer",
-	Args:  cobra.ExactArgs(2),
+	Args: func(cmd *cobra.Command, args []string) error {
+		// The file list replaces the path
+		if opts.FilesFrom != "" {
+			if len(tasks) > 0 {
+				return cobra.NoArgs(cmd, args)
+			}
+			return cobra.MaximumNArgs(1)(cmd, args)
+		}
+		// The tasks replace the prompt
+		if len(tasks) > 0 {
+			return cobra.ExactArgs(1)(cmd, args)
+		}
+		// Without prompt argument, the prompt comes from the preset or is
+		// composed in the editor
+		return cobra.RangeArgs(1, 2)(cmd, args)
+	},
 	Run: func(cmd *cobra.Command, args []string) {
-		prompt, dataFilePath := args[0], args[1]
+		var prompt, dataFilePath string
+		if opts.FilesFrom == "" {
+			dataFilePath = args[len(args)-1]
+			args = args[:len(args)-1]
+		}
+		if len(args) == 1 {
+			prompt = args[0]
+		}
 		apiKey := os.Getenv("OPENAI_API_KEY")
-		if apiKey == "" {
-			log.Panic("OPENAI_API_KEY environment variable must be set")
+
+		var err error
+		if preset != "" {
+			p, err := cli.LoadPreset(preset, presetsDir)
+			if err != nil {
+				log.Fatal(err)
+			}
+			// The prompt argument and the flags take precedence over the preset
+			if prompt == "" {
+				prompt = p.Prompt
+			}
+			if p.ReduceStrategy != "" && !cmd.Flags().Changed("reduce-strategy") && !cmd.Flags().Changed("reducer") && !cmd.Flags().Changed("reduce-prompt") {
+				reduceStrategy = p.ReduceStrategy
+			}
+		}
+
+		if len(args) == 0 && len(tasks) == 0 && preset == "" {
+			if noEditor || !cli.IsTerminal(os.Stdin) {
+				log.Fatal("missing prompt: pass it as the first argument")
+			}
+			prompt, err = cli.EditPrompt()
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		for _, s := range tasks {
+			task, err := cli.ParseTask(s)
+			if err != nil {
+				log.Fatal(err)
+			}
+			opts.Tasks = append(opts.Tasks, task)
+		}
+
+		opts.IfExists, err = cli.ParseIfExistsPolicy(ifExists)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		opts.OutputFormats, err = cli.ParseOutputFormats(outputFormat)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		opts.OnRefusal, err = cli.ParseRefusalPolicy(onRefusal)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		opts.OnRequestOverflow, err = cli.ParseOverflowPolicy(onOverflow)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		opts.PromptSuffix, err = cli.ParsePromptSuffixMode(promptSuffix)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		opts.Schedule, err = cli.ParseSchedule(schedule)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		opts.ChoicePolicy, err = cli.ParseChoicePolicy(choicePolicy)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		opts.Packing, err = cli.ParsePacking(packing)
+		if err != nil {
+			log.Fatal(err)
 		}
 
-		err := cli.Process(cmd.Context(), apiKey, cli.ModelGPT5Nano, prompt, dataFilePath)
+		opts.SplitStrategy, err = cli.ParseSplitStrategy(splitBy)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if outputExample != "" {
+			opts.OutputSchema, err = cli.LoadSchemaFromExample(outputExample)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		opts.Reducer, err = cli.GetReducer(reducer)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if reduceStrategy != "" {
+			if err := cli.ApplyReduceStrategy(&opts, reduceStrategy); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		opts.Headers, err = cli.ParseHeaders(headers)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if maxOutputFileSize != "" {
+			opts.MaxOutputFileSize, err = cli.ParseSize(maxOutputFileSize)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		if chunkFilter != "" {
+			opts.ChunkFilter, err = regexp.Compile(chunkFilter)
+			if err != nil {
+				log.Fatalf("invalid chunk filter: %v", err)
+			}
+		}
+
+		if outputFilter != "" {
+			opts.OutputFilter, err = regexp.Compile(outputFilter)
+			if err != nil {
+				log.Fatalf("invalid output filter: %v", err)
+			}
+		}
+
+		for _, model := range compareModels {
+			opts.CompareModels = append(opts.CompareModels, cli.Model(strings.TrimSpace(model)))
+		}
+
+		opts.LogitBias, err = cli.ParseLogitBias(logitBias, opts.Model)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for _, sequence := range stopSequences {
+			unescaped, err := cli.UnescapeDelimiter(sequence)
+			if err != nil {
+				log.Fatal(err)
+			}
+			opts.StopSequences = append(opts.StopSequences, unescaped)
+		}
+
+		opts.RecordDelimiter, err = cli.UnescapeDelimiter(recordDelimiter)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		opts.LineDelimiter, err = cli.UnescapeDelimiter(lineDelimiter)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		opts.CacheDirPerm, err = cli.ParsePerm(cachePerms)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts.CacheFilePerm, err = cli.ParsePerm(cacheFilePerms)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if metricsAddr != "" {
+			listener, err := net.Listen("tcp", metricsAddr)
+			if err != nil {
+				log.Fatal(err)
+			}
+			opts.Metrics = cli.NewMetrics()
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", opts.Metrics)
+			// The endpoint lives as long as the process, it goes away with
+			// the end of the run
+			go func() {
+				if err := http.Serve(listener, mux); err != nil {
+					log.Printf("metrics endpoint stopped: %v", err)
+				}
+			}()
+		}
+
+		// The live transcript owns stdout, the progress messages go to stderr
+		if opts.Sequential && opts.Stream {
+			opts.Log = os.Stderr
+		}
+
+		err = cli.ProcessWithOptions(cmd.Context(), apiKey, prompt, dataFilePath, opts)
 		if err != nil {
 			log.Fatal(err)
 		}
 	},
 }
 
+func init() {
+	opts.StatsFile = cli.DefaultStatsFile()
+
+	flags := rootCmd.Flags()
+	flags.StringArrayVar(&headers, "header", headers, "header added to every API request as key=value, e.g. for API versions or beta features (repeatable)")
+	flags.StringSliceVar(&opts.Extensions, "ext", opts.Extensions, "in directory mode, only process files with these comma-separated extensions, e.g. .txt,.md")
+	flags.StringVar(&preset, "preset", preset, "named prompt used when no prompt argument is given: a user preset from --presets-dir or a built-in one (extract-action-items, extract-entities, find-errors, find-personal-data, summarize)")
+	flags.StringVar(&presetsDir, "presets-dir", presetsDir, "directory of the user presets, each stored as <name>.txt")
+	flags.BoolVar(&noEditor, "no-editor", noEditor, "fail instead of composing the prompt in $EDITOR when no prompt argument is given")
+	flags.StringArrayVar(&tasks, "task", tasks, "task run over the chunks as name=prompt, in place of the prompt argument, each with its own cache and <file>.<name>.combined_results.txt (repeatable)")
+	flags.BoolVar(&opts.Force, "force", opts.Force, "reuse the cached results computed with another prompt, model or request settings and, in directory mode, reprocess the files whose combined output is up to date instead of skipping them")
+	flags.StringVar(&opts.FilesFrom, "files-from", opts.FilesFrom, "file listing the files to process, one path per line relative to it, in place of the path argument")
+	flags.BoolVar(&opts.Strict, "strict", opts.Strict, "with --files-from, fail before any request when a listed file is missing instead of skipping it")
+	flags.StringVar(&opts.PromptOverridesDir, "prompt-overrides", opts.PromptOverridesDir, "in directory mode, directory of per-file prompts replacing the prompt argument, e.g. prompts/notes.md.txt for notes.md")
+	flags.StringVar(&opts.DeveloperPrompt, "developer-prompt", opts.DeveloperPrompt, "instructions sent as a developer message with each chunk, outranking the user content")
+	flags.IntVar(&opts.Choices, "n", opts.Choices, "number of completions requested for each chunk, turned into its result with --choice-policy")
+	flags.StringVar(&choicePolicy, "choice-policy", choicePolicy, "how the completions of a chunk are turned into its result: first, longest, concat or vote")
+	flags.StringArrayVar(&logitBias, "logit-bias", logitBias, "bias between -100 and 100 of a token ID or of the tokens of a string, as token=bias (repeatable)")
+	flags.StringArrayVar(&stopSequences, "stop", stopSequences, `sequence at which the model stops the output of a chunk, with Go escapes, e.g. "\n---\n" (repeatable, at most 4)`)
+	flags.BoolVar(&opts.AutoPrompt, "auto-prompt", opts.AutoPrompt, "treat the prompt as a plain-English task description expanded by the model into the instruction used for every chunk")
+	flags.IntVar(&opts.Concurrency, "concurrency", opts.Concurrency, "number of chunks processed in parallel (defaults to a per-model value)")
+	flags.StringVar(&schedule, "schedule", schedule, "order in which the chunks are sent: input or largest-first (the output keeps the order of the input)")
+	flags.BoolVar(&opts.Sequential, "sequential", opts.Sequential, "process the chunks one at a time in order; with --stream, print their output to stdout as each one completes")
+	flags.BoolVar(&opts.RunningContext, "running-context", opts.RunningContext, "process the chunks in order, each one with a running summary of the previous ones (disables parallelism)")
+	flags.StringVar(&opts.StopSentinel, "stop-sentinel", opts.StopSentinel, "token, e.g. STOP, that the model emits once it found what it looks for to stop dispatching the remaining chunks")
+	flags.DurationVar(&opts.MaxRuntime, "max-runtime", opts.MaxRuntime, "stop sending new chunks after this duration, let in-flight ones finish and combine the completed ones")
+	flags.DurationVar(&opts.Deadline, "deadline", opts.Deadline, "cancel the job after this duration, every file and task included, and combine the completed chunks into a partial output")
+	flags.BoolVar(&opts.EstimateOnly, "estimate-only", opts.EstimateOnly, "print the JSON estimation (tokens, chunks, per-model costs) and exit without prompting nor calling the API")
+	flags.Float64Var(&opts.ExpectedOutputRatio, "expected-output-ratio", opts.ExpectedOutputRatio, "expected output tokens per input token used to estimate the output cost of each model (0 uses the average of the past runs of the prompt, or 1)")
+	flags.StringVar(&opts.StatsFile, "stats-file", opts.StatsFile, "file recording the output ratio of the past runs of each prompt (empty disables)")
+	flags.BoolVar(&opts.Explain, "explain", opts.Explain, "print in plain language what the run would do (tokens, chunks, requests, cost, cache and output paths) and exit")
+	flags.StringSliceVar(&compareModels, "compare-models", compareModels, "send a sample of the chunks to each of these comma-separated models and print their outputs and costs side by side instead of processing the file")
+	flags.IntVar(&opts.CompareSample, "compare-sample", opts.CompareSample, "number of chunks, spread over the input, sent to each model of --compare-models (0 uses 3)")
+	flags.BoolVar(&opts.ZeroIndex, "zero-index", opts.ZeroIndex, "number the chunks from 0 in the cache files (chunk0.txt, result0.txt) and in the messages and outputs, renumbering an existing cache")
+	flags.BoolVar(&opts.Echo, "echo", opts.Echo, "make each chunk its own result instead of calling the API, to benchmark the chunking, cache and outputs (cached under the echo label)")
+	flags.BoolVar(&opts.NoChunkFiles, "no-chunk-files", opts.NoChunkFiles, "don't write the raw chunk%d.txt files, only the results")
+	flags.Int64Var(&opts.SinceOffset, "since-offset", opts.SinceOffset, "process only the input after this byte offset, e.g. the lines appended to a log since a previous run")
+	flags.StringVar(&opts.SinceMarker, "since-marker", opts.SinceMarker, "file recording the size of the input processed by the last complete run, the next run processing only what was appended since")
+	flags.BoolVar(&opts.SinceLast, "since-last", opts.SinceLast, "process only the input appended since the last complete run, whose offset is recorded in the cache manifest, and append its results to the combined output")
+	flags.StringVar(&opts.CacheLabel, "cache-label", opts.CacheLabel, "nest the cache under a labeled subdirectory so that prompt variants don't clobber each other")
+	flags.BoolVar(&opts.PackedCache, "packed-cache", opts.PackedCache, "store the chunks and results in a single compressed cache.pack archive instead of one file each, e.g. for a cache on a network filesystem")
+	flags.BoolVar(&opts.CacheReadOnly, "cache-readonly", opts.CacheReadOnly, "use the cached results without writing to the chunk directory, e.g. a shared read-only cache")
+	flags.StringVar(&cachePerms, "cache-perms", cachePerms, "octal permission of the chunk directory when it is created, e.g. 0700 for sensitive data")
+	flags.StringVar(&cacheFilePerms, "cache-file-perms", cacheFilePerms, "octal permission of the chunk, result and state files of the chunk directory, e.g. 0600")
+	flags.BoolVar(&opts.PrefetchOnly, "prefetch-only", opts.PrefetchOnly, "process and cache all chunks without writing the combined output")
+	flags.BoolVar(&opts.CombinedCache, "combined-cache", opts.CombinedCache, "also cache the results of all the chunks in one file keyed by the file, prompt and model, serving an identical run without reading the result files")
+	flags.BoolVar(&opts.IncrementalOutput, "incremental-output", opts.IncrementalOutput, "append the results in input order to <file>.combined_results.partial.txt as they complete, removed once the combined output is written")
+	flags.IntVar(&opts.SyncEvery, "sync-every", opts.SyncEvery, "number of results appended to the incremental output between two fsyncs (0 never syncs)")
+	flags.StringVar(&opts.ReportCSV, "report-csv", opts.ReportCSV, "write a CSV with the index, tokens, cost, latency and cache hit of each chunk")
+	flags.BoolVar(&opts.VerifyTokens, "verify-tokens", opts.VerifyTokens, "compare the estimated prompt tokens of each chunk with the ones billed by the API and report the discrepancies")
+	flags.StringVar(&metricsAddr, "metrics-addr", metricsAddr, "address, e.g. :9090, serving Prometheus metrics of the run on /metrics (chunks, cache hits, errors, retries, tokens) until the process exits")
+	flags.BoolVar(&opts.Quiet, "quiet", opts.Quiet, "hide the per-chunk and progress messages")
+	flags.BoolVar(&opts.TUI, "tui", opts.TUI, "show a live view of the chunk statuses, spend and ETA instead of progress messages (when the output is a terminal)")
+	flags.BoolVar(&opts.PreserveInputStructure, "preserve-input-structure", opts.PreserveInputStructure, "split the input so that chunks reconstruct it byte for byte (blank lines, spacing)")
+	flags.IntVar(&opts.ChunkSize, "chunk-size", opts.ChunkSize, "maximum number of tokens of a chunk")
+	flags.StringVar(&splitBy, "split-strategy", splitBy, "unit the chunks are cut between: lines, or sentences for prose whose line breaks don't follow the sentences")
+	flags.StringVar(&packing, "packing", packing, "how lines are packed into chunks: greedy (fill each chunk) or balanced (same number of chunks with even sizes)")
+	flags.IntVar(&opts.MaxChunkSize, "max-chunk-size", opts.MaxChunkSize, "hard ceiling of the tokens of a chunk: above --chunk-size, a chunk grows up to it to end at a paragraph boundary (0 keeps --chunk-size strict)")
+	flags.Int64Var(&opts.MaxOutputTokens, "max-output-tokens", opts.MaxOutputTokens, "maximum number of output tokens of each chunk request (defaults to the model limit)")
+	flags.BoolVar(&opts.VerifyChunks, "verify-chunks", opts.VerifyChunks, "debug: check that the chunks cover the whole input with no gap nor overlap and report the first divergence")
+	flags.IntVar(&opts.MaxChunks, "max-chunks", opts.MaxChunks, "fail before any request when the input splits into more chunks than this (0 disables)")
+	flags.IntVar(&opts.MaxRequestTokens, "max-request-tokens", opts.MaxRequestTokens, "ceiling of the tokens of the request of a chunk with its prompts, checked before any request (0 disables)")
+	flags.StringVar(&onOverflow, "on-request-overflow", onOverflow, "what to do with a chunk whose request exceeds --max-request-tokens: split or fail")
+	flags.IntVar(&opts.MinChunkSize, "min-chunk-size", opts.MinChunkSize, "merge the last chunk into the previous one when it has fewer tokens than this (0 disables)")
+	flags.BoolVar(&opts.NormalizeUnicode, "normalize-unicode", opts.NormalizeUnicode, "apply the NFC unicode normalization to the input before chunking")
+	flags.StringVar(&lineDelimiter, "line-delimiter", lineDelimiter, `delimiter of the lines of the input, never split across chunks, and of the combined output, e.g. "\0" or ";" (defaults to a newline)`)
+	flags.StringVar(&recordDelimiter, "record-delimiter", recordDelimiter, `delimiter inserted between the records (lines) of a chunk and expected between their outputs, e.g. "\n---\n"`)
+	flags.BoolVar(&opts.Scored, "scored", opts.Scored, "ask the model for a relevance score between 0 and 1 for each chunk")
+	flags.StringVar(&outputExample, "output-example", outputExample, "JSON file whose structure defines the schema every chunk output must follow")
+	flags.StringVar(&promptSuffix, "prompt-suffix", promptSuffix, `whether "Return the lines that you want to keep." is appended to the prompt: auto (unless --output-example is used), always or never`)
+	flags.Float64Var(&opts.MinScore, "min-score", opts.MinScore, "in scored mode, drop chunks scored below this threshold")
+	flags.BoolVar(&opts.SortByScore, "sort-by-score", opts.SortByScore, "in scored mode, order the combined output by decreasing score")
+	flags.BoolVar(&opts.OmitEmpty, "omit-empty", opts.OmitEmpty, "leave chunks whose result is blank out of the combined output")
+	flags.BoolVar(&opts.FailOnEmpty, "fail-on-empty", opts.FailOnEmpty, "fail instead of warning when the combined output is empty")
+	flags.StringVar(&reducer, "reducer", reducer, "how chunk results are combined: "+strings.Join(cli.ReducerNames(), ", "))
+	flags.StringVar(&reduceStrategy, "reduce-strategy", reduceStrategy, "reduce semantics: concat, summarize (synthesis by the reduce model) or vote (majority label across chunks)")
+	flags.StringVar(&opts.ReducePrompt, "reduce-prompt", opts.ReducePrompt, "prompt used to synthesize all chunk results with a model (replaces --reducer)")
+	flags.StringVar((*string)(&opts.ReduceModel), "reduce-model", string(opts.ReduceModel), "model used by the reduce step (defaults to the map model)")
+	flags.BoolVar(&opts.Justify, "justify", opts.Justify, "ask the model for a brief reason for each kept line, written to <file>.explanations.txt while the combined output keeps only the lines")
+	flags.BoolVar(&opts.Citations, "citations", opts.Citations, "reduce with a model answer annotated with the chunks supporting each segment (uses --reduce-prompt as instructions)")
+	flags.StringVar(&chunkFilter, "chunk-filter", chunkFilter, "regular expression a chunk must match to be sent to the model, the other chunks are kept unchanged in the combined output")
+	flags.StringVar(&outputFilter, "output-filter", outputFilter, "regular expression the lines of the combined output must match to be kept")
+	flags.BoolVar(&opts.ChangesOnly, "changes-only", opts.ChangesOnly, "only combine the chunks whose result differs from their input")
+	flags.BoolVar(&opts.SideBySide, "side-by-side", opts.SideBySide, "also write the input of each chunk next to its result to <file>.side_by_side.txt for review")
+	flags.StringVar(&maxOutputFileSize, "max-output-file-size", maxOutputFileSize, "rotate the combined output into <file>.combined_results.partN.txt files of at most this size, e.g. 50MB, cut between lines")
+	flags.StringVarP(&opts.Output, "output", "o", opts.Output, "file the combined output is written to, or directory it is written in under its default name, instead of next to the input; the cache stays by the input")
+	flags.BoolVar(&opts.ResultJSON, "result-json", opts.ResultJSON, "print the summary of the run as a single JSON object to stdout once done, the progress messages going to stderr")
+	flags.StringVar(&outputFormat, "output-format", outputFormat, "comma-separated formats the combined output is written in, each to its own file: text (.combined_results.txt) and json (.combined_results.json)")
+	flags.BoolVar(&opts.OutputHeader, "output-header", opts.OutputHeader, "start the combined output with a # comment block recording the prompt, model, chunk size, timestamp and tool version")
+	flags.StringVar(&ifExists, "if-exists", ifExists, "what to do when the combined output already exists: overwrite, skip, error or backup")
+	flags.StringVar(&onRefusal, "on-refusal", onRefusal, "what to do when the model refuses a chunk: fail, skip or keep-input")
+	flags.BoolVar(&opts.Stream, "stream", opts.Stream, "receive the completions as a stream of events, the token usage being reported in the final event")
+	flags.Float64Var(&opts.ConfirmAbove, "confirm-above", opts.ConfirmAbove, "only ask for confirmation when the estimated cost of the run exceeds this many USD (0 always asks)")
+	flags.IntVar(&opts.MaxRetries, "max-retries", opts.MaxRetries, "number of retries for a failed chunk request")
+	flags.IntVar(&opts.MaxRetriesNetwork, "max-retries-network", opts.MaxRetriesNetwork, "number of retries for a network error, --max-retries when negative")
+	flags.IntVar(&opts.MaxRetriesRateLimit, "max-retries-ratelimit", opts.MaxRetriesRateLimit, "number of retries for a rate limit (429), --max-retries when negative")
+	flags.IntVar(&opts.MaxRetriesEmpty, "max-retries-empty", opts.MaxRetriesEmpty, "number of times a chunk is requested again when the response has no content")
+	flags.DurationVar(&opts.RetryBackoff, "retry-backoff", opts.RetryBackoff, "initial delay between retries, doubled on each attempt")
+	flags.DurationVar(&opts.MaxRetryAfter, "max-retry-after", opts.MaxRetryAfter, "cap of the delay the API asks to wait before retrying in its Retry-After header, which replaces the backoff (0 disables the cap)")
+	flags.IntSliceVar(&opts.RetryOnStatus, "retry-on-status", opts.RetryOnStatus, "comma-separated HTTP statuses to retry in addition to 408, 409, 429, 500, 502, 503 and 504")
+	flags.IntSliceVar(&opts.NoRetryOnStatus, "no-retry-on-status", opts.NoRetryOnStatus, "comma-separated HTTP statuses not to retry")
+	flags.Float64Var(&opts.StragglerAfter, "straggler-after", opts.StragglerAfter, "fraction of completed chunks, e.g. 0.9, after which slow requests are cancelled and retried (0 disables)")
+	flags.DurationVar(&opts.StragglerTimeout, "straggler-timeout", opts.StragglerTimeout, "how long a request may run once --straggler-after of the chunks are complete")
+	flags.StringVar((*string)(&opts.StragglerModel), "straggler-model", string(opts.StragglerModel), "model the straggler requests are retried with (defaults to the map model)")
+	flags.IntVar(&opts.BreakerThreshold, "breaker-threshold", opts.BreakerThreshold, "consecutive failures across chunks after which requests are held back (0 disables)")
+	flags.DurationVar(&opts.BreakerCooldown, "breaker-cooldown", opts.BreakerCooldown, "how long requests wait before a probe request is sent")
+}
+
 func Execute() error {
 	return rootCmd.Execute()
 }
@@ -7,6 +7,7 @@ require (
 	github.com/spf13/cobra v1.10.1
 	github.com/tiktoken-go/tokenizer v0.7.0
 	golang.org/x/sync v0.17.0
+	golang.org/x/text v0.21.0
 )
 
 require (
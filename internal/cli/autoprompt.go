@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/shared"
+)
+
+const autoPromptFileName = "auto_prompt.json"
+
+// metaPrompt asks the model to turn a plain-English task description into
+// the instruction applied to every chunk.
+const metaPrompt = `You write instructions for a model that processes a large document one chunk at a time, without seeing the other chunks.
+Rewrite the task description given by the user into a precise and unambiguous instruction telling that model what to keep, remove or transform in its chunk and what format to answer in.
+Respond with the instruction only.`
+
+// autoPrompt is the cached expansion of a task description.
+type autoPrompt struct {
+	Description string `json:"description"`
+	Model       Model  `json:"model"`
+	Prompt      string `json:"prompt"`
+}
+
+// expandPrompt asks the model to expand the task description into the prompt
+// of the chunks. The expansion is cached in the chunk directory so that
+// reruns use the same prompt, and thus the same cached results. The usage of
+// the expansion is returned along with it.
+func (p *processor) expandPrompt(ctx context.Context, description string) (string, Usage, error) {
+	path := filepath.Join(p.chunkDir, autoPromptFileName)
+
+	if b, err := os.ReadFile(path); err == nil {
+		var cached autoPrompt
+		if err := json.Unmarshal(b, &cached); err == nil && cached.Description == description && cached.Model == p.opts.Model {
+			fmt.Fprintf(p.out, "Using cached expanded prompt -> %s:\n%s\n", path, cached.Prompt)
+			return cached.Prompt, Usage{}, nil
+		}
+	}
+
+	fmt.Fprintf(p.out, "Expanding the task description with %s...\n", p.opts.Model)
+	res, err := p.generateWithFallback(ctx, openai.ChatCompletionNewParams{
+		Messages: []openai.ChatCompletionMessageParamUnion{
+			openai.SystemMessage(metaPrompt),
+			openai.UserMessage(description),
+		},
+		Model:       shared.ChatModel(p.opts.Model),
+		ServiceTier: p.serviceTier(),
+	})
+	if err != nil {
+		return "", Usage{}, fmt.Errorf("failed to expand the prompt: %w", err)
+	}
+	usage := responseUsage(p.opts.Model, res)
+	if len(res.Choices) == 0 || strings.TrimSpace(res.Choices[0].Message.Content) == "" {
+		return "", usage, withCategory(ErrAPI, fmt.Errorf("no content in response for the prompt expansion"))
+	}
+
+	expanded := strings.TrimSpace(res.Choices[0].Message.Content)
+	fmt.Fprintf(p.out, "Expanded prompt:\n%s\n", expanded)
+	fmt.Fprintf(p.out, "Prompt expansion usage: %d prompt + %d completion tokens ($%.4f)\n", usage.PromptTokens, usage.CompletionTokens, usage.Cost)
+	if p.opts.CacheReadOnly {
+		return expanded, usage, nil
+	}
+
+	b, err := json.MarshalIndent(autoPrompt{Description: description, Model: p.opts.Model, Prompt: expanded}, "", "  ")
+	if err != nil {
+		return "", usage, fmt.Errorf("failed to marshal expanded prompt: %w", err)
+	}
+	if err := writeFileAtomic(path, b, p.opts.cacheFilePerm()); err != nil {
+		fmt.Fprintf(p.out, "Warning: failed to cache expanded prompt: %v\n", err)
+	}
+
+	return expanded, usage, nil
+}
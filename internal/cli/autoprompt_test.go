@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/openai/openai-go"
+)
+
+func TestProcessWithClient_AutoPrompt(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "auto_prompt_test.txt")
+	if err := os.WriteFile(testFile, []byte(strings.Repeat("word ", 3000)), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	const description = "only the fruit stuff"
+	const expanded = "Keep only the lines mentioning a fruit."
+
+	var log bytes.Buffer
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.AutoPrompt = true
+	opts.Log = &log
+
+	mock := &mockChatGenerator{
+		requestFunc: func(params openai.ChatCompletionNewParams) string {
+			if systemContent(params) == metaPrompt {
+				return expanded
+			}
+			return "chunk result"
+		},
+	}
+	if err := ProcessWithClientOptions(context.Background(), mock, description, testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	if userContent(mock.params[0]) != description {
+		t.Errorf("Expected the first call to expand the description, got %q", userContent(mock.params[0]))
+	}
+	for _, params := range mock.params[1:] {
+		if !strings.HasPrefix(systemContent(params), expanded+"\n") {
+			t.Errorf("Expected the chunks to receive the expanded prompt, got %q", systemContent(params))
+		}
+	}
+	if !strings.Contains(log.String(), "Expanded prompt:\n"+expanded) {
+		t.Errorf("Expected the expanded prompt to be shown, got:\n%s", log.String())
+	}
+
+	// A rerun uses the cached expansion and results
+	rerun := &mockChatGenerator{}
+	if err := ProcessWithClientOptions(context.Background(), rerun, description, testFile, opts); err != nil {
+		t.Fatalf("Rerun failed: %v", err)
+	}
+	if rerun.callCount != 0 {
+		t.Errorf("Expected no API call on rerun, got %d", rerun.callCount)
+	}
+}
@@ -0,0 +1,304 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+)
+
+const cacheMetaFileName = "cache_meta.json"
+
+// cacheMeta is the manifest of a cache directory. It records how the input was
+// split since the cached results are keyed by chunk index and are only valid
+// for the chunk boundaries they were computed with, as well as the prompt,
+// model and request settings that produced them.
+type cacheMeta struct {
+	ChunkSize              int    `json:"chunk_size"`
+	MinChunkSize           int    `json:"min_chunk_size,omitempty"`
+	MaxChunkSize           int    `json:"max_chunk_size,omitempty"`
+	BalancedPacking        bool   `json:"balanced_packing,omitempty"`
+	SentenceSplit          bool   `json:"sentence_split,omitempty"`
+	LineDelimiter          string `json:"line_delimiter,omitempty"`
+	PreserveInputStructure bool   `json:"preserve_input_structure,omitempty"`
+	NormalizeUnicode       bool   `json:"normalize_unicode,omitempty"`
+	ZeroIndex              bool   `json:"zero_index,omitempty"`
+	MaxRequestTokens       int    `json:"max_request_tokens,omitempty"`
+	Prompt                 string `json:"prompt,omitempty"`
+	Model                  Model  `json:"model,omitempty"`
+	requestSettings
+	// OutputParts are the files of the combined output when it is rotated.
+	OutputParts []string `json:"output_parts,omitempty"`
+	// Chunks are the byte ranges of the chunks in the input file, in order.
+	Chunks []textChunk `json:"chunks,omitempty"`
+	// ProcessedOffset is the size of the input once all its chunks were
+	// processed by the last complete run with Options.SinceLast.
+	ProcessedOffset int64 `json:"processed_offset,omitempty"`
+	// Combine are the settings of the combined output of the last run.
+	Combine combineSettings `json:"combine"`
+}
+
+// combineSettings are the settings turning the cached results into the
+// combined output, so that patching a result rebuilds the same output.
+type combineSettings struct {
+	// Reducer is the name of the built-in reducer, empty for the default
+	// or a custom one.
+	Reducer           string         `json:"reducer,omitempty"`
+	ReducePrompt      string         `json:"reduce_prompt,omitempty"`
+	Citations         bool           `json:"citations,omitempty"`
+	RecordDelimiter   string         `json:"record_delimiter,omitempty"`
+	Scored            bool           `json:"scored,omitempty"`
+	MinScore          float64        `json:"min_score,omitempty"`
+	SortByScore       bool           `json:"sort_by_score,omitempty"`
+	OmitEmpty         bool           `json:"omit_empty,omitempty"`
+	Justify           bool           `json:"justify,omitempty"`
+	StopSentinel      string         `json:"stop_sentinel,omitempty"`
+	ChunkFilter       string         `json:"chunk_filter,omitempty"`
+	ChangesOnly       bool           `json:"changes_only,omitempty"`
+	OutputFilter      string         `json:"output_filter,omitempty"`
+	Output            string         `json:"output,omitempty"`
+	OutputFormats     []OutputFormat `json:"output_formats,omitempty"`
+	OutputHeader      bool           `json:"output_header,omitempty"`
+	MaxOutputFileSize int64          `json:"max_output_file_size,omitempty"`
+}
+
+func newCombineSettings(opts Options) combineSettings {
+	settings := combineSettings{
+		Reducer:           reducerName(opts.Reducer),
+		ReducePrompt:      opts.ReducePrompt,
+		Citations:         opts.Citations,
+		RecordDelimiter:   opts.RecordDelimiter,
+		Scored:            opts.Scored,
+		MinScore:          opts.MinScore,
+		SortByScore:       opts.SortByScore,
+		OmitEmpty:         opts.OmitEmpty,
+		Justify:           opts.Justify,
+		StopSentinel:      opts.StopSentinel,
+		ChangesOnly:       opts.ChangesOnly,
+		Output:            opts.Output,
+		OutputFormats:     opts.OutputFormats,
+		OutputHeader:      opts.OutputHeader,
+		MaxOutputFileSize: opts.MaxOutputFileSize,
+	}
+	if opts.ChunkFilter != nil {
+		settings.ChunkFilter = opts.ChunkFilter.String()
+	}
+	if opts.OutputFilter != nil {
+		settings.OutputFilter = opts.OutputFilter.String()
+	}
+	return settings
+}
+
+// apply sets the recorded settings in the options, but for the reducer the
+// options already have.
+func (s combineSettings) apply(opts *Options) error {
+	if s.Reducer != "" && opts.Reducer == nil {
+		reducer, err := GetReducer(s.Reducer)
+		if err != nil {
+			return err
+		}
+		opts.Reducer = reducer
+	}
+	opts.ChunkFilter = nil
+	if s.ChunkFilter != "" {
+		filter, err := regexp.Compile(s.ChunkFilter)
+		if err != nil {
+			return fmt.Errorf("invalid chunk filter in the cache manifest: %w", err)
+		}
+		opts.ChunkFilter = filter
+	}
+	opts.OutputFilter = nil
+	if s.OutputFilter != "" {
+		filter, err := regexp.Compile(s.OutputFilter)
+		if err != nil {
+			return fmt.Errorf("invalid output filter in the cache manifest: %w", err)
+		}
+		opts.OutputFilter = filter
+	}
+	opts.ReducePrompt = s.ReducePrompt
+	opts.Citations = s.Citations
+	opts.RecordDelimiter = s.RecordDelimiter
+	opts.Scored = s.Scored
+	opts.MinScore = s.MinScore
+	opts.SortByScore = s.SortByScore
+	opts.OmitEmpty = s.OmitEmpty
+	opts.Justify = s.Justify
+	opts.StopSentinel = s.StopSentinel
+	opts.ChangesOnly = s.ChangesOnly
+	opts.Output = s.Output
+	opts.OutputFormats = s.OutputFormats
+	opts.OutputHeader = s.OutputHeader
+	opts.MaxOutputFileSize = s.MaxOutputFileSize
+	return nil
+}
+
+// requestSettings are the settings of the chunk requests besides the prompt
+// and model that change their output.
+type requestSettings struct {
+	DeveloperPrompt string           `json:"developer_prompt,omitempty"`
+	LogitBias       map[string]int64 `json:"logit_bias,omitempty"`
+	Choices         int              `json:"choices,omitempty"`
+	ChoicePolicy    ChoicePolicy     `json:"choice_policy,omitempty"`
+	OutputSchema    map[string]any   `json:"output_schema,omitempty"`
+	MaxOutputTokens int64            `json:"max_output_tokens,omitempty"`
+	StopSequences   []string         `json:"stop_sequences,omitempty"`
+	// RunningContext tells whether the summary of the previous chunks was
+	// sent with each chunk.
+	RunningContext bool `json:"running_context,omitempty"`
+}
+
+func newRequestSettings(opts Options) requestSettings {
+	settings := requestSettings{
+		DeveloperPrompt: opts.DeveloperPrompt,
+		LogitBias:       opts.LogitBias,
+		OutputSchema:    opts.OutputSchema,
+		MaxOutputTokens: opts.MaxOutputTokens,
+		StopSequences:   opts.StopSequences,
+		RunningContext:  opts.RunningContext,
+	}
+	// The policy only matters with several completions
+	if opts.Choices > 1 {
+		settings.Choices = opts.Choices
+		settings.ChoicePolicy = opts.ChoicePolicy
+	}
+	return settings
+}
+
+// recorded returns the settings as JSON, the form they are recorded in.
+func (s requestSettings) recorded() string {
+	// The settings are plain data, they always marshal
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+func newCacheMeta(prompt string, opts Options) cacheMeta {
+	return cacheMeta{
+		Prompt:                 chunkPrompt(prompt, opts),
+		Model:                  opts.Model,
+		requestSettings:        newRequestSettings(opts),
+		ChunkSize:              opts.chunkSize(),
+		MinChunkSize:           opts.MinChunkSize,
+		MaxChunkSize:           opts.maxChunkSize(),
+		BalancedPacking:        opts.Packing == PackingBalanced,
+		SentenceSplit:          opts.SplitStrategy == SplitSentences,
+		LineDelimiter:          opts.LineDelimiter,
+		PreserveInputStructure: opts.PreserveInputStructure,
+		NormalizeUnicode:       opts.NormalizeUnicode,
+		ZeroIndex:              opts.ZeroIndex,
+		MaxRequestTokens:       opts.MaxRequestTokens,
+		Combine:                newCombineSettings(opts),
+	}
+}
+
+// legacyCacheMeta is the chunking of the caches written before the manifest
+// existed, when the chunk size was not configurable.
+var legacyCacheMeta = cacheMeta{ChunkSize: defaultChunkSize}
+
+// loadCacheMeta reads the manifest of a cache directory, if any.
+func loadCacheMeta(chunkDir string) (*cacheMeta, error) {
+	b, err := os.ReadFile(filepath.Join(chunkDir, cacheMetaFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read cache manifest: %w", err)
+	}
+
+	var meta cacheMeta
+	if err := json.Unmarshal(b, &meta); err != nil {
+		return nil, fmt.Errorf("failed to parse cache manifest: %w", err)
+	}
+	return &meta, nil
+}
+
+func saveCacheMeta(chunkDir string, meta cacheMeta, perm os.FileMode) error {
+	b, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache manifest: %w", err)
+	}
+	return writeFileAtomic(filepath.Join(chunkDir, cacheMetaFileName), b, perm)
+}
+
+// chunking returns the manifest without the prompt, model, request and combine
+// settings, outputs, chunk ranges and processed offset, which depend on the
+// input.
+func (m cacheMeta) chunking() cacheMeta {
+	m.Prompt = ""
+	m.Model = ""
+	m.requestSettings = requestSettings{}
+	m.Combine = combineSettings{}
+	m.OutputParts = nil
+	m.Chunks = nil
+	m.ProcessedOffset = 0
+	// The manifests of older runs recorded the ceiling as set, the chunk size
+	// standing for it when it was unset or below
+	m.MaxChunkSize = max(m.MaxChunkSize, m.ChunkSize)
+	return m
+}
+
+// checkCacheMeta refuses to reuse cached results computed with different
+// chunking settings or chunk byte ranges, or with another prompt, model or
+// request settings unless forced, and records the manifest of the current run
+// with the byte ranges of its chunks.
+func checkCacheMeta(out io.Writer, chunkDir, prompt string, chunks []textChunk, opts Options, cachedCount int) error {
+	previous, err := loadCacheMeta(chunkDir)
+	if err != nil {
+		return err
+	}
+	if previous == nil && cachedCount > 0 {
+		previous = &legacyCacheMeta
+	}
+
+	current := newCacheMeta(prompt, opts)
+	if previous != nil && cachedCount > 0 && !reflect.DeepEqual(previous.chunking(), current.chunking()) {
+		return fmt.Errorf("cached results in %s/ were computed with a different chunking (chunk size %d, min chunk size %d, preserve input structure %v) than this run (chunk size %d, min chunk size %d, preserve input structure %v): rerun with the same chunking or clean the cache",
+			chunkDir,
+			previous.ChunkSize, previous.MinChunkSize, previous.PreserveInputStructure,
+			current.ChunkSize, current.MinChunkSize, current.PreserveInputStructure)
+	}
+	// The same settings split an edited input, or a request split to fit the
+	// ceiling, differently: the results cached by index are not the chunks'
+	if previous != nil && cachedCount > 0 {
+		for i := 0; i < min(len(previous.Chunks), len(chunks)); i++ {
+			was, is := previous.Chunks[i], chunks[i]
+			if was.Start != is.Start || was.End != is.End {
+				return fmt.Errorf("cached results in %s/ were computed for other chunk boundaries than this run (chunk %d spanned bytes %d-%d, it spans %d-%d): the input changed or a chunk was split differently, rerun with the same input or clean the cache",
+					chunkDir, opts.chunkNumber(i), was.Start, was.End, is.Start, is.End)
+			}
+		}
+	}
+
+	// The manifests written before the prompt and model were recorded can't
+	// tell. The settings are compared in their recorded form, the schema
+	// numbers of a parsed manifest not having the types of the options.
+	sameSettings := previous != nil && previous.recorded() == current.recorded()
+	if previous != nil && cachedCount > 0 && previous.Prompt != "" && (previous.Prompt != current.Prompt || previous.Model != current.Model || !sameSettings) {
+		fmt.Fprintf(out, "WARNING: the %d cached results in %s/ were computed with another prompt, model or request settings, reusing them would serve stale output\n", cachedCount, chunkDir)
+		if previous.Model != current.Model {
+			fmt.Fprintf(out, "WARNING: cached model %s, this run uses %s\n", previous.Model, current.Model)
+		}
+		if previous.Prompt != current.Prompt {
+			fmt.Fprintf(out, "WARNING: cached prompt %q\nWARNING: this run uses %q\n", previous.Prompt, current.Prompt)
+		}
+		if !sameSettings {
+			fmt.Fprintf(out, "WARNING: cached request settings %s\nWARNING: this run uses %s\n", previous.recorded(), current.recorded())
+		}
+		if !opts.Force {
+			return fmt.Errorf("cached results in %s/ were computed with another prompt, model or request settings: rerun with --force to reuse them anyway or clean the cache", chunkDir)
+		}
+		fmt.Fprintln(out, "WARNING: --force given, reusing the cached results anyway")
+	}
+
+	if opts.CacheReadOnly {
+		return nil
+	}
+	current.Chunks = chunks
+	// The offset is recorded by the incremental runs, a full run keeps it
+	if previous != nil {
+		current.ProcessedOffset = previous.ProcessedOffset
+	}
+	return saveCacheMeta(chunkDir, current, opts.cacheFilePerm())
+}
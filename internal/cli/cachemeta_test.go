@@ -0,0 +1,321 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProcessWithClient_RefusesCacheWithDifferentChunkSize(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "chunk_size_test.txt")
+	var content strings.Builder
+	for i := 0; i < 600; i++ {
+		fmt.Fprintf(&content, "line %d with a few words to fill the chunk\n", i)
+	}
+	if err := os.WriteFile(testFile, []byte(content.String()), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.Log = &bytes.Buffer{}
+
+	if err := ProcessWithClientOptions(context.Background(), &mockChatGenerator{}, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	// Rerunning with another chunk size must not reuse the results
+	opts.ChunkSize = 500
+	mock := &mockChatGenerator{}
+	err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts)
+	if err == nil {
+		t.Fatal("Expected the run to refuse the cache computed with another chunk size")
+	}
+	if !strings.Contains(err.Error(), "chunk size 2000") || !strings.Contains(err.Error(), "chunk size 500") {
+		t.Errorf("Expected both chunk sizes in the error, got: %v", err)
+	}
+	if mock.callCount != 0 {
+		t.Errorf("Expected no API call, got %d", mock.callCount)
+	}
+
+	// Once the cache is cleaned the new chunk size is used
+	if err := os.RemoveAll(filepath.Join(tmpDir, "chunk_size_test")); err != nil {
+		t.Fatalf("Failed to clean cache: %v", err)
+	}
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+	chunks, err := splitChunks(content.String(), opts)
+	if err != nil {
+		t.Fatalf("splitChunks failed: %v", err)
+	}
+	if mock.callCount != len(chunks) {
+		t.Errorf("Expected %d API calls with the new chunk size, got %d", len(chunks), mock.callCount)
+	}
+}
+
+func TestProcessWithClient_ReusesCacheWithTheSameEffectiveCeiling(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "ceiling_test.txt")
+	var content strings.Builder
+	for i := 0; i < 600; i++ {
+		fmt.Fprintf(&content, "line %d with a few words to fill the chunk\n", i)
+	}
+	if err := os.WriteFile(testFile, []byte(content.String()), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.Log = &bytes.Buffer{}
+
+	if err := ProcessWithClientOptions(context.Background(), &mockChatGenerator{}, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	// A ceiling below the chunk size is the chunk size, the chunks are the same
+	opts.MaxChunkSize = opts.ChunkSize / 2
+	mock := &mockChatGenerator{}
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("Expected the cache to be reused, got: %v", err)
+	}
+	if mock.callCount != 0 {
+		t.Errorf("Expected no API call, got %d", mock.callCount)
+	}
+}
+
+func TestProcessWithClient_RefusesCacheWithDifferentPrompt(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "prompt_change_test.txt")
+	if err := os.WriteFile(testFile, []byte(strings.Repeat("word ", 3000)), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.Log = &bytes.Buffer{}
+
+	if err := ProcessWithClientOptions(context.Background(), &mockChatGenerator{}, "keep the fruits", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	meta, err := loadCacheMeta(filepath.Join(tmpDir, "prompt_change_test"))
+	if err != nil || meta == nil {
+		t.Fatalf("Expected a cache manifest, got %v, %v", meta, err)
+	}
+	if !strings.HasPrefix(meta.Prompt, "keep the fruits") || meta.Model != opts.Model {
+		t.Errorf("Expected the prompt and model in the manifest, got %q and %q", meta.Prompt, meta.Model)
+	}
+
+	// Another prompt is refused with a warning
+	var log bytes.Buffer
+	opts.Log = &log
+	mock := &mockChatGenerator{}
+	err = ProcessWithClientOptions(context.Background(), mock, "keep the vegetables", testFile, opts)
+	if err == nil || !strings.Contains(err.Error(), "--force") {
+		t.Fatalf("Expected the run to refuse the cache computed with another prompt, got %v", err)
+	}
+	if !strings.Contains(log.String(), "WARNING: the 3 cached results") || !strings.Contains(log.String(), `"keep the vegetables`) {
+		t.Errorf("Expected a warning naming both prompts, got log:\n%s", log.String())
+	}
+	if mock.callCount != 0 {
+		t.Errorf("Expected no API call, got %d", mock.callCount)
+	}
+
+	// So is another model
+	opts.Model = ModelGPT5Mini
+	if err := ProcessWithClientOptions(context.Background(), mock, "keep the fruits", testFile, opts); err == nil {
+		t.Error("Expected the run to refuse the cache computed with another model")
+	}
+
+	// --force reuses the cache anyway
+	opts.Force = true
+	log.Reset()
+	if err := ProcessWithClientOptions(context.Background(), mock, "keep the vegetables", testFile, opts); err != nil {
+		t.Fatalf("Expected --force to reuse the cache, got %v", err)
+	}
+	if mock.callCount != 0 {
+		t.Errorf("Expected the cached results to be reused, got %d API calls", mock.callCount)
+	}
+	if !strings.Contains(log.String(), "--force given") {
+		t.Errorf("Expected the forced reuse to be reported, got log:\n%s", log.String())
+	}
+}
+
+func TestProcessWithClient_RefusesCacheWithDifferentRequestSettings(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "settings_change_test.txt")
+	if err := os.WriteFile(testFile, []byte(strings.Repeat("word ", 3000)), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.MaxOutputTokens = 500
+	opts.StopSequences = []string{"END"}
+	opts.Log = &bytes.Buffer{}
+
+	if err := ProcessWithClientOptions(context.Background(), &mockChatGenerator{}, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	// The same settings reuse the cache, the choice policy only matters with
+	// several choices
+	mock := &mockChatGenerator{}
+	opts.ChoicePolicy = ChoiceLongest
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("Expected the cache to be reused, got %v", err)
+	}
+	if mock.callCount != 0 {
+		t.Errorf("Expected the cached results to be reused, got %d API calls", mock.callCount)
+	}
+
+	// A developer prompt changes the output
+	var log bytes.Buffer
+	opts.Log = &log
+	opts.DeveloperPrompt = "answer in French"
+	err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts)
+	if err == nil || !strings.Contains(err.Error(), "request settings") {
+		t.Fatalf("Expected the run to refuse the cache computed with other request settings, got %v", err)
+	}
+	if !strings.Contains(log.String(), `"developer_prompt":"answer in French"`) {
+		t.Errorf("Expected a warning naming both settings, got log:\n%s", log.String())
+	}
+	if mock.callCount != 0 {
+		t.Errorf("Expected no API call, got %d", mock.callCount)
+	}
+}
+
+func TestProcessWithClient_RefusesCacheWithDifferentChunkRanges(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "ranges_change_test.txt")
+	lines := make([]string, 200)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line %d with a few words", i)
+	}
+	if err := os.WriteFile(testFile, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.ChunkSize = 200
+	opts.Log = &bytes.Buffer{}
+
+	if err := ProcessWithClientOptions(context.Background(), &mockChatGenerator{}, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	// Editing the start of the input shifts every chunk after it
+	lines[0] = "line 0 with many more words than before, enough to move the boundaries"
+	if err := os.WriteFile(testFile, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		t.Fatalf("Failed to rewrite test file: %v", err)
+	}
+	mock := &mockChatGenerator{}
+	err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts)
+	if err == nil || !strings.Contains(err.Error(), "other chunk boundaries") {
+		t.Fatalf("Expected the run to refuse the cache computed for other chunk boundaries, got %v", err)
+	}
+	if mock.callCount != 0 {
+		t.Errorf("Expected no API call, got %d", mock.callCount)
+	}
+}
+
+func TestProcessWithClient_RecordsChunkOffsets(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "offsets_test.txt")
+	var content strings.Builder
+	for i := 0; i < 50; i++ {
+		fmt.Fprintf(&content, "ligne %d — café ✓\n", i)
+	}
+	if err := os.WriteFile(testFile, []byte(content.String()), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.ChunkSize = 40
+	opts.Log = &bytes.Buffer{}
+
+	if err := ProcessWithClientOptions(context.Background(), &mockChatGenerator{}, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	meta, err := loadCacheMeta(filepath.Join(tmpDir, "offsets_test"))
+	if err != nil || meta == nil {
+		t.Fatalf("Expected a cache manifest, got %v (%v)", meta, err)
+	}
+	if len(meta.Chunks) < 2 {
+		t.Fatalf("Expected the ranges of several chunks, got %v", meta.Chunks)
+	}
+	for i, chunk := range meta.Chunks {
+		stored, err := os.ReadFile(filepath.Join(tmpDir, "offsets_test", fmt.Sprintf("chunk%d.txt", i+1)))
+		if err != nil {
+			t.Fatalf("Failed to read chunk %d: %v", i+1, err)
+		}
+		if covered := content.String()[chunk.Start:chunk.End]; covered != string(stored) {
+			t.Errorf("Chunk %d: the range [%d, %d) holds %q, expected %q", i+1, chunk.Start, chunk.End, covered, stored)
+		}
+	}
+}
+
+func TestProcessWithClient_RecordsFileOffsetsOfNormalizedInput(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "normalized_offsets_test.txt")
+	// Mixed line endings and decomposed accents, after a header skipped by
+	// the offset
+	header := "already processed\r\n"
+	var content strings.Builder
+	content.WriteString(header)
+	for i := 0; i < 50; i++ {
+		ending := "\n"
+		if i%3 == 0 {
+			ending = "\r\n"
+		}
+		fmt.Fprintf(&content, "ligne %d — café ✓%s", i, ending)
+	}
+	if err := os.WriteFile(testFile, []byte(content.String()), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.ChunkSize = 40
+	opts.NormalizeUnicode = true
+	opts.SinceOffset = int64(len(header))
+	opts.Log = &bytes.Buffer{}
+
+	if err := ProcessWithClientOptions(context.Background(), &mockChatGenerator{}, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	chunkDir, err := chunkDirPath(testFile, sinceCacheLabel("", opts.SinceOffset))
+	if err != nil {
+		t.Fatalf("chunkDirPath failed: %v", err)
+	}
+	meta, err := loadCacheMeta(chunkDir)
+	if err != nil || meta == nil {
+		t.Fatalf("Expected a cache manifest, got %v (%v)", meta, err)
+	}
+	if len(meta.Chunks) < 2 {
+		t.Fatalf("Expected the ranges of several chunks, got %v", meta.Chunks)
+	}
+	if meta.Chunks[0].Start != len(header) || meta.Chunks[len(meta.Chunks)-1].End != content.Len() {
+		t.Errorf("Expected the chunks to span [%d, %d) of the file, got %v", len(header), content.Len(), meta.Chunks)
+	}
+	for i, chunk := range meta.Chunks {
+		stored, err := os.ReadFile(filepath.Join(chunkDir, fmt.Sprintf("chunk%d.txt", i+1)))
+		if err != nil {
+			t.Fatalf("Failed to read chunk %d: %v", i+1, err)
+		}
+		covered := normalizeUnicode(strings.ReplaceAll(content.String()[chunk.Start:chunk.End], "\r\n", "\n"))
+		if covered != string(stored) {
+			t.Errorf("Chunk %d: the range [%d, %d) holds %q, expected %q", i+1, chunk.Start, chunk.End, covered, stored)
+		}
+	}
+}
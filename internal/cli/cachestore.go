@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// cacheStore holds the chunks and the results of a run, indexed by kind, e.g.
+// "result", and zero-based chunk index.
+type cacheStore interface {
+	// Read returns the entry, or an error satisfying os.IsNotExist when it
+	// is not cached.
+	Read(kind string, i int) ([]byte, error)
+	Write(kind string, i int, data []byte) error
+	Has(kind string, i int) bool
+	// Path tells where the entry is stored, for the messages.
+	Path(kind string, i int) string
+	Close() error
+}
+
+// openCacheStore opens the store of the chunk directory: the packed archive
+// when requested or when the directory already has one, one file per entry
+// otherwise.
+func openCacheStore(chunkDir string, opts Options) (cacheStore, error) {
+	path := filepath.Join(chunkDir, packFileName)
+	if !opts.PackedCache {
+		if _, err := os.Stat(path); err != nil {
+			return dirStore{dir: chunkDir, opts: opts}, nil
+		}
+	}
+	return openPackStore(path, opts)
+}
+
+// dirStore stores each entry in its own file of the chunk directory, e.g.
+// result1.txt.
+type dirStore struct {
+	dir  string
+	opts Options
+}
+
+func (s dirStore) Path(kind string, i int) string {
+	return filepath.Join(s.dir, s.opts.chunkFileName(kind, i))
+}
+
+func (s dirStore) Read(kind string, i int) ([]byte, error) {
+	return os.ReadFile(s.Path(kind, i))
+}
+
+// Write replaces the entry atomically, an interrupted write must not leave a
+// truncated result that a later run would take for a cached one.
+func (s dirStore) Write(kind string, i int, data []byte) error {
+	return writeFileAtomic(s.Path(kind, i), data, s.opts.cacheFilePerm())
+}
+
+func (s dirStore) Has(kind string, i int) bool {
+	_, err := os.Stat(s.Path(kind, i))
+	return err == nil
+}
+
+func (s dirStore) Close() error {
+	return nil
+}
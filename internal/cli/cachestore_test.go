@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// failingTempFile writes half of the first write, as a crash or a full disk
+// would, then fails.
+type failingTempFile struct {
+	*os.File
+}
+
+func (f failingTempFile) Write(p []byte) (int, error) {
+	n, _ := f.File.Write(p[:len(p)/2])
+	return n, errors.New("no space left on device")
+}
+
+func TestProcessWithClient_InterruptedResultWrite(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "interrupted_test.txt")
+	if err := os.WriteFile(testFile, []byte("some content"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	original := createTempFile
+	t.Cleanup(func() { createTempFile = original })
+	createTempFile = func(dir, pattern string) (tempFile, error) {
+		f, err := os.CreateTemp(dir, pattern)
+		if err != nil || !strings.HasPrefix(pattern, "result") {
+			return f, err
+		}
+		return failingTempFile{f}, nil
+	}
+
+	var log bytes.Buffer
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.Log = &log
+
+	mock := &mockChatGenerator{responseFunc: func(int) string { return "a result long enough to be cut" }}
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+	if !strings.Contains(log.String(), "failed to cache result for chunk 1") {
+		t.Errorf("Expected the failed write to be reported, got:\n%s", log.String())
+	}
+
+	chunkDir := filepath.Join(tmpDir, "interrupted_test")
+	if _, err := os.Stat(filepath.Join(chunkDir, "result1.txt")); !os.IsNotExist(err) {
+		t.Fatalf("Expected no truncated result in the cache, got %v", err)
+	}
+	leftovers, _ := filepath.Glob(filepath.Join(chunkDir, "*.tmp*"))
+	if len(leftovers) > 0 {
+		t.Errorf("Expected the temporary files to be removed, got %v", leftovers)
+	}
+	if b, err := os.ReadFile(filepath.Join(chunkDir, "chunk1.txt")); err != nil || string(b) != "some content" {
+		t.Errorf("Expected the chunk to be written whole, got %q (%v)", b, err)
+	}
+
+	// The next run requests the chunk again instead of serving a corrupt result
+	createTempFile = original
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+	if mock.callCount != 2 {
+		t.Errorf("Expected the chunk to be requested again, got %d requests", mock.callCount)
+	}
+	if b, err := os.ReadFile(filepath.Join(chunkDir, "result1.txt")); err != nil || string(b) != "a result long enough to be cut" {
+		t.Errorf("Expected the whole result cached, got %q (%v)", b, err)
+	}
+}
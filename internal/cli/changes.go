@@ -0,0 +1,16 @@
+package cli
+
+import "strings"
+
+// changedResults keeps the results that differ from the input of their
+// chunk. Surrounding whitespace is ignored since the models don't reliably
+// reproduce it.
+func changedResults(chunks []string, results []chunkResult) []chunkResult {
+	changed := make([]chunkResult, 0, len(results))
+	for _, result := range results {
+		if strings.TrimSpace(result.Content) != strings.TrimSpace(chunks[result.Index]) {
+			changed = append(changed, result)
+		}
+	}
+	return changed
+}
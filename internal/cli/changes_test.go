@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/openai/openai-go"
+)
+
+func TestProcessWithClient_ChangesOnly(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "changes_test.txt")
+	var lines []string
+	for i := 0; i < 1000; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	text := strings.Join(lines, "\n")
+	if err := os.WriteFile(testFile, []byte(text), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.ChunkSize = 1000
+	opts.ChangesOnly = true
+
+	chunks, err := splitChunks(text, opts)
+	if err != nil {
+		t.Fatalf("splitChunks failed: %v", err)
+	}
+	if len(chunks) < 3 {
+		t.Fatalf("Expected at least 3 chunks, got %d", len(chunks))
+	}
+
+	// The second chunk is transformed, the others are returned unchanged
+	// give or take the trailing newline
+	mock := &mockChatGenerator{
+		requestFunc: func(params openai.ChatCompletionNewParams) string {
+			chunk := userContent(params)
+			if chunk == chunks[1] {
+				return strings.ToUpper(chunk)
+			}
+			return strings.TrimSuffix(chunk, "\n")
+		},
+	}
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, "changes_test.combined_results.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read combined results: %v", err)
+	}
+	if string(content) != strings.ToUpper(chunks[1]) {
+		t.Errorf("Expected only the changed chunk in the output, got %q", string(content))
+	}
+}
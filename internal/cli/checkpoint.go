@@ -0,0 +1,219 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+const checkpointFileName = "checkpoint.json"
+
+// Usage accumulates the tokens billed by the API and their cost.
+type Usage struct {
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+// Add returns the sum of both usages.
+func (u Usage) Add(other Usage) Usage {
+	return Usage{
+		PromptTokens:     u.PromptTokens + other.PromptTokens,
+		CompletionTokens: u.CompletionTokens + other.CompletionTokens,
+		Cost:             u.Cost + other.Cost,
+	}
+}
+
+// checkpoint records the overall state of a run so that a restarted run
+// resumes the accounting where the previous one stopped.
+type checkpoint struct {
+	Model      Model  `json:"model"`
+	Prompt     string `json:"prompt"`
+	ChunkCount int    `json:"chunk_count"`
+	// Completed lists the numbers (starting at 1) of the completed chunks.
+	Completed []int `json:"completed"`
+	// Attempted lists the numbers of the chunks sent to the API that did not
+	// complete, because they failed or the run was interrupted.
+	Attempted []int `json:"attempted,omitempty"`
+	Usage     Usage `json:"usage"`
+}
+
+// checkpointer updates the checkpoint file of a run as chunks complete.
+type checkpointer struct {
+	mu   sync.Mutex
+	path string
+	perm os.FileMode
+	// readOnly keeps the checkpoint in memory only.
+	readOnly  bool
+	state     checkpoint
+	completed map[int]struct{}
+	attempted map[int]struct{}
+}
+
+// loadCheckpoint reads the checkpoint of a previous run, if any.
+func loadCheckpoint(chunkDir string) (*checkpoint, error) {
+	b, err := os.ReadFile(filepath.Join(chunkDir, checkpointFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+
+	var state checkpoint
+	if err := json.Unmarshal(b, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint: %w", err)
+	}
+	return &state, nil
+}
+
+// newCheckpointer resumes the checkpoint of a previous run when it was made
+// with the same model, prompt and chunking, and starts a new one otherwise.
+func newCheckpointer(chunkDir string, model Model, prompt string, chunkCount int, perm os.FileMode) (*checkpointer, bool, error) {
+	previous, err := loadCheckpoint(chunkDir)
+	if err != nil {
+		return nil, false, err
+	}
+
+	c := &checkpointer{
+		path: filepath.Join(chunkDir, checkpointFileName),
+		perm: perm,
+		state: checkpoint{
+			Model:      model,
+			Prompt:     prompt,
+			ChunkCount: chunkCount,
+		},
+		completed: make(map[int]struct{}),
+		attempted: make(map[int]struct{}),
+	}
+
+	resumed := previous != nil && previous.Model == model && previous.Prompt == prompt && previous.ChunkCount == chunkCount
+	if resumed {
+		c.state.Usage = previous.Usage
+		for _, chunk := range previous.Completed {
+			c.completed[chunk] = struct{}{}
+		}
+		for _, chunk := range previous.Attempted {
+			c.attempted[chunk] = struct{}{}
+		}
+	}
+
+	return c, resumed, nil
+}
+
+// Complete marks a chunk as completed, adds the usage it incurred and
+// persists the checkpoint.
+func (c *checkpointer) Complete(i int, usage Usage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.completed[i+1] = struct{}{}
+	delete(c.attempted, i+1)
+	c.state.Usage = c.state.Usage.Add(usage)
+	return c.save()
+}
+
+// Spend adds the usage of a request that is not a chunk's, e.g. the reduce
+// step, and persists the checkpoint.
+func (c *checkpointer) Spend(usage Usage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.state.Usage = c.state.Usage.Add(usage)
+	return c.save()
+}
+
+// Attempt records that a chunk is being sent to the API, so that a rerun can
+// tell it apart from the chunks never started if it doesn't complete.
+func (c *checkpointer) Attempt(i int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.attempted[i+1] = struct{}{}
+	return c.save()
+}
+
+// Attempted tells whether a chunk was sent to the API without completing.
+func (c *checkpointer) Attempted(i int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, ok := c.attempted[i+1]
+	return ok
+}
+
+// Usage returns the usage accumulated over the current and resumed runs.
+func (c *checkpointer) Usage() Usage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state.Usage
+}
+
+func (c *checkpointer) save() error {
+	if c.readOnly {
+		return nil
+	}
+
+	c.state.Completed = c.state.Completed[:0]
+	for chunk := range c.completed {
+		c.state.Completed = append(c.state.Completed, chunk)
+	}
+	sort.Ints(c.state.Completed)
+
+	c.state.Attempted = c.state.Attempted[:0]
+	for chunk := range c.attempted {
+		c.state.Attempted = append(c.state.Attempted, chunk)
+	}
+	sort.Ints(c.state.Attempted)
+
+	b, err := json.MarshalIndent(c.state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoint: %w", err)
+	}
+	return writeFileAtomic(c.path, b, c.perm)
+}
+
+// tempFile is a temporary file written before being renamed.
+type tempFile interface {
+	io.WriteCloser
+	Name() string
+}
+
+// createTempFile creates a uniquely named temporary file so that concurrent
+// writers of the same path don't share it, replaced in tests.
+var createTempFile = func(dir, pattern string) (tempFile, error) {
+	return os.CreateTemp(dir, pattern)
+}
+
+// writeFileAtomic writes the file to a temporary path and renames it so that
+// readers never observe a partially written file.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := createTempFile(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Chmod(tmpPath, perm); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/openai/openai-go"
+)
+
+func TestProcessWithClient_CheckpointResumesUsage(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "checkpoint_test.txt")
+
+	content := ""
+	for i := 0; i < 600; i++ {
+		content += fmt.Sprintf("line %d with a few words to fill the chunk\n", i)
+	}
+	if err := os.WriteFile(testFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	chunks, err := splitIntoTokenChunks(content, 2000)
+	if err != nil {
+		t.Fatalf("splitIntoTokenChunks failed: %v", err)
+	}
+	if len(chunks) < 3 {
+		t.Fatalf("Expected at least 3 chunks, got %d", len(chunks))
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.Concurrency = 1
+
+	usage := openai.CompletionUsage{PromptTokens: 100, CompletionTokens: 10}
+
+	// The first run is interrupted after the first chunk.
+	interrupted := &mockChatGenerator{
+		usage: usage,
+		errorFunc: func(callCount int) error {
+			if callCount > 1 {
+				return errors.New("process killed")
+			}
+			return nil
+		},
+	}
+	if err := ProcessWithClientOptions(context.Background(), interrupted, "test prompt", testFile, opts); err == nil {
+		t.Fatal("Expected the first run to be interrupted")
+	}
+
+	chunkDir := filepath.Join(tmpDir, "checkpoint_test")
+	state, err := loadCheckpoint(chunkDir)
+	if err != nil || state == nil {
+		t.Fatalf("Expected a checkpoint after the first run, got %v (err=%v)", state, err)
+	}
+	if state.Usage.PromptTokens != 100 || len(state.Completed) != 1 {
+		t.Errorf("Expected 1 completed chunk and 100 prompt tokens, got %+v", state)
+	}
+
+	// The restarted run only processes the remaining chunks and continues the totals.
+	resumed := &mockChatGenerator{usage: usage}
+	if err := ProcessWithClientOptions(context.Background(), resumed, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("Resumed run failed: %v", err)
+	}
+
+	if resumed.callCount != len(chunks)-1 {
+		t.Errorf("Expected %d API calls on resume, got %d", len(chunks)-1, resumed.callCount)
+	}
+
+	state, err = loadCheckpoint(chunkDir)
+	if err != nil {
+		t.Fatalf("Failed to load checkpoint: %v", err)
+	}
+
+	expectedPrompt := int64(100 * len(chunks))
+	expectedCompletion := int64(10 * len(chunks))
+	if state.Usage.PromptTokens != expectedPrompt || state.Usage.CompletionTokens != expectedCompletion {
+		t.Errorf("Expected usage %d/%d, got %d/%d", expectedPrompt, expectedCompletion,
+			state.Usage.PromptTokens, state.Usage.CompletionTokens)
+	}
+
+	expectedCost := usageCost(ModelGPT5Nano, expectedPrompt, expectedCompletion)
+	if diff := state.Usage.Cost - expectedCost; diff > 1e-12 || diff < -1e-12 {
+		t.Errorf("Expected cost %f, got %f", expectedCost, state.Usage.Cost)
+	}
+
+	if len(state.Completed) != len(chunks) {
+		t.Errorf("Expected %d completed chunks, got %v", len(chunks), state.Completed)
+	}
+}
+
+func TestNewCheckpointer_DifferentPromptStartsOver(t *testing.T) {
+	chunkDir := t.TempDir()
+
+	c, resumed, err := newCheckpointer(chunkDir, ModelGPT5Nano, "first prompt", 2, 0644)
+	if err != nil || resumed {
+		t.Fatalf("Expected a new checkpoint, got resumed=%v err=%v", resumed, err)
+	}
+	if err := c.Complete(0, Usage{PromptTokens: 50}); err != nil {
+		t.Fatalf("Complete failed: %v", err)
+	}
+
+	c, resumed, err = newCheckpointer(chunkDir, ModelGPT5Nano, "second prompt", 2, 0644)
+	if err != nil {
+		t.Fatalf("newCheckpointer failed: %v", err)
+	}
+	if resumed || c.Usage().PromptTokens != 0 {
+		t.Errorf("Expected accounting to start over with a different prompt, got resumed=%v usage=%+v", resumed, c.Usage())
+	}
+}
+
+func TestProcessWithClient_RerunReportsChunkProgress(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "interrupted_test.txt")
+	var content strings.Builder
+	for i := 0; i < 600; i++ {
+		fmt.Fprintf(&content, "line %d with a few words to fill the chunk\n", i)
+	}
+	if err := os.WriteFile(testFile, []byte(content.String()), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.Concurrency = 1
+	opts.Log = &bytes.Buffer{}
+
+	chunks, err := splitChunks(content.String(), opts)
+	if err != nil {
+		t.Fatalf("splitChunks failed: %v", err)
+	}
+	if len(chunks) < 3 {
+		t.Fatalf("Expected at least 3 chunks, got %d", len(chunks))
+	}
+
+	// The second chunk fails, interrupting the run before the others start
+	interrupted := &mockChatGenerator{
+		errorFunc: func(callCount int) error {
+			if callCount == 2 {
+				return errors.New("interrupted")
+			}
+			return nil
+		},
+	}
+	if err := ProcessWithClientOptions(context.Background(), interrupted, "test prompt", testFile, opts); err == nil {
+		t.Fatal("Expected the first run to fail")
+	}
+
+	var log bytes.Buffer
+	opts.Log = &log
+	if err := ProcessWithClientOptions(context.Background(), &mockChatGenerator{}, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("Rerun failed: %v", err)
+	}
+
+	expected := fmt.Sprintf("Previous run: 1 chunks completed, 1 attempted but not completed, %d never started", len(chunks)-2)
+	if !strings.Contains(log.String(), expected) {
+		t.Errorf("Expected the rerun to report %q, got:\n%s", expected, log.String())
+	}
+
+	state, err := loadCheckpoint(filepath.Join(tmpDir, "interrupted_test"))
+	if err != nil {
+		t.Fatalf("Failed to load checkpoint: %v", err)
+	}
+	if len(state.Attempted) != 0 {
+		t.Errorf("Expected no pending attempt once all chunks completed, got %v", state.Attempted)
+	}
+}
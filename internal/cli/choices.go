@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/openai/openai-go"
+)
+
+// ChoicePolicy tells how the completions of a chunk are turned into its
+// result when several are requested.
+type ChoicePolicy string
+
+// Choice policies
+const (
+	// ChoiceFirst keeps the first completion.
+	ChoiceFirst ChoicePolicy = "first"
+	// ChoiceLongest keeps the longest completion.
+	ChoiceLongest ChoicePolicy = "longest"
+	// ChoiceConcat concatenates the completions.
+	ChoiceConcat ChoicePolicy = "concat"
+	// ChoiceVote keeps the most frequent completion, the first one on ties.
+	ChoiceVote ChoicePolicy = "vote"
+)
+
+// ParseChoicePolicy parses a choice policy name.
+func ParseChoicePolicy(s string) (ChoicePolicy, error) {
+	switch policy := ChoicePolicy(s); policy {
+	case ChoiceFirst, ChoiceLongest, ChoiceConcat, ChoiceVote:
+		return policy, nil
+	}
+	return "", invalidConfig(fmt.Errorf("unknown choice policy %q (expected first, longest, concat or vote)", s))
+}
+
+// usableChoice tells whether a completion is an answer: an empty content is
+// one when the model stopped on its own.
+func usableChoice(choice openai.ChatCompletionChoice) bool {
+	return choice.Message.Refusal == "" && (choice.Message.Content != "" || choice.FinishReason == "stop")
+}
+
+// selectChoice applies the policy to the completions of a chunk. The refused
+// and truncated completions are ignored unless they all are, in which case
+// the first one is returned as is.
+func selectChoice(choices []openai.ChatCompletionChoice, policy ChoicePolicy) openai.ChatCompletionChoice {
+	var usable []openai.ChatCompletionChoice
+	for _, choice := range choices {
+		if usableChoice(choice) {
+			usable = append(usable, choice)
+		}
+	}
+	if len(usable) == 0 {
+		return choices[0]
+	}
+
+	switch policy {
+	case ChoiceLongest:
+		longest := usable[0]
+		for _, choice := range usable[1:] {
+			if len(choice.Message.Content) > len(longest.Message.Content) {
+				longest = choice
+			}
+		}
+		return longest
+	case ChoiceConcat:
+		contents := make([]string, len(usable))
+		for i, choice := range usable {
+			contents[i] = strings.TrimRight(choice.Message.Content, "\n")
+		}
+		concat := usable[0]
+		concat.Message.Content = strings.Join(contents, "\n")
+		return concat
+	case ChoiceVote:
+		// The first completion of each answer represents it
+		votes := make(map[string]int)
+		first := make(map[string]openai.ChatCompletionChoice)
+		bestKey := strings.TrimSpace(usable[0].Message.Content)
+		for _, choice := range usable {
+			key := strings.TrimSpace(choice.Message.Content)
+			if _, ok := first[key]; !ok {
+				first[key] = choice
+			}
+			votes[key]++
+			if votes[key] > votes[bestKey] {
+				bestKey = key
+			}
+		}
+		return first[bestKey]
+	}
+	return usable[0]
+}
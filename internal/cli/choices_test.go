@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/openai/openai-go"
+)
+
+func TestProcessWithClient_ChoicePolicies(t *testing.T) {
+	tests := []struct {
+		policy   ChoicePolicy
+		expected string
+	}{
+		{ChoiceFirst, "banana"},
+		{ChoiceLongest, "apple\ncarrot "},
+		{ChoiceConcat, "banana\napple\ncarrot\napple\ncarrot "},
+		{ChoiceVote, "apple\ncarrot"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			tmpDir := t.TempDir()
+			testFile := filepath.Join(tmpDir, "choices_test.txt")
+			if err := os.WriteFile(testFile, []byte("apple\nbanana\ncarrot"), 0644); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+
+			opts := DefaultOptions()
+			opts.RequireConfirmation = false
+			opts.Choices = 3
+			opts.ChoicePolicy = tt.policy
+
+			mock := &mockChatGenerator{
+				choicesFunc: func(int) []string {
+					return []string{"banana", "apple\ncarrot", "apple\ncarrot "}
+				},
+			}
+			if err := ProcessWithClientOptions(context.Background(), mock, "Keep the fruits", testFile, opts); err != nil {
+				t.Fatalf("ProcessWithClientOptions failed: %v", err)
+			}
+
+			if len(mock.params) != 1 || mock.params[0].N != openai.Int(3) {
+				t.Errorf("Expected 3 choices to be requested")
+			}
+
+			content, err := os.ReadFile(filepath.Join(tmpDir, "choices_test.combined_results.txt"))
+			if err != nil {
+				t.Fatalf("Failed to read combined results: %v", err)
+			}
+			if string(content) != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, string(content))
+			}
+		})
+	}
+}
+
+func TestSelectChoice_IgnoresRefusedChoices(t *testing.T) {
+	choices := []openai.ChatCompletionChoice{
+		{FinishReason: "stop", Message: openai.ChatCompletionMessage{Refusal: "I can't"}},
+		{FinishReason: "length", Message: openai.ChatCompletionMessage{}},
+		{FinishReason: "stop", Message: openai.ChatCompletionMessage{Content: "kept"}},
+	}
+	for _, policy := range []ChoicePolicy{ChoiceFirst, ChoiceLongest, ChoiceConcat, ChoiceVote} {
+		if got := selectChoice(choices, policy).Message.Content; got != "kept" {
+			t.Errorf("%s: expected the only usable choice, got %q", policy, got)
+		}
+	}
+
+	// Without usable choice, the refusal is reported
+	if got := selectChoice(choices[:1], ChoiceVote); got.Message.Refusal != "I can't" {
+		t.Errorf("Expected the refused choice, got %+v", got)
+	}
+
+	if _, err := ParseChoicePolicy("random"); err == nil {
+		t.Error("Expected an error for an unknown policy")
+	}
+}
@@ -0,0 +1,28 @@
+package cli
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// matchesChunkFilter tells whether the chunk is sent to the model, every
+// chunk is when there is no filter.
+func matchesChunkFilter(chunk string, filter *regexp.Regexp) bool {
+	return filter == nil || filter.MatchString(chunk)
+}
+
+// passthroughResult keeps a chunk left out by the chunk filter unchanged.
+func (p *processor) passthroughResult(i int, chunk string) chunkResult {
+	fmt.Fprintf(p.out, "Chunk %d: doesn't match the chunk filter, kept unchanged\n", p.opts.chunkNumber(i))
+	return chunkResult{Index: i, Content: p.wholeLines(chunk)}
+}
+
+// wholeLines returns a chunk as it appears in the input: the chunks are cut
+// between lines, the line they end is restored.
+func (p *processor) wholeLines(chunk string) string {
+	if !p.opts.PreserveInputStructure && p.opts.lineDelimiter() == "\n" && chunk != "" && !strings.HasSuffix(chunk, "\n") {
+		chunk += "\n"
+	}
+	return chunk
+}
@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/openai/openai-go"
+)
+
+func TestProcessWithClient_ChunkFilter(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "chunk_filter_test.txt")
+
+	// Blocks of info lines, every third one with an error
+	var content strings.Builder
+	for block := 0; block < 9; block++ {
+		for line := 0; line < 20; line++ {
+			level := "INFO"
+			if block%3 == 0 && line == 10 {
+				level = "ERROR"
+			}
+			fmt.Fprintf(&content, "%s block %d line %d: request served\n", level, block, line)
+		}
+	}
+	if err := os.WriteFile(testFile, []byte(content.String()), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.ChunkSize = 200
+	opts.ChunkFilter = regexp.MustCompile(`ERROR`)
+
+	chunks, err := splitChunks(content.String(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	matching := 0
+	for _, chunk := range chunks {
+		if strings.Contains(chunk, "ERROR") {
+			matching++
+		}
+	}
+	if matching == 0 || matching == len(chunks) {
+		t.Fatalf("Expected some chunks to match the filter, %d/%d match", matching, len(chunks))
+	}
+
+	var mu sync.Mutex
+	var sent []string
+	mock := &mockChatGenerator{
+		requestFunc: func(params openai.ChatCompletionNewParams) string {
+			mu.Lock()
+			defer mu.Unlock()
+			sent = append(sent, userContent(params))
+			return "processed\n"
+		},
+	}
+	if err := ProcessWithClientOptions(context.Background(), mock, "explain the errors", testFile, opts); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+
+	if len(sent) != matching {
+		t.Errorf("Expected the %d matching chunks to reach the model, got %d", matching, len(sent))
+	}
+	for _, chunk := range sent {
+		if !strings.Contains(chunk, "ERROR") {
+			t.Errorf("Expected only matching chunks to reach the model, got %q", chunk)
+		}
+	}
+
+	// The other chunks pass through verbatim, in place
+	var expected strings.Builder
+	for _, chunk := range chunks {
+		if strings.Contains(chunk, "ERROR") {
+			expected.WriteString("processed\n")
+		} else {
+			expected.WriteString(strings.TrimSuffix(chunk, "\n") + "\n")
+		}
+	}
+	combined, err := os.ReadFile(filepath.Join(tmpDir, "chunk_filter_test.combined_results.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read combined results: %v", err)
+	}
+	if string(combined) != expected.String() {
+		t.Errorf("Expected %q, got %q", expected.String(), combined)
+	}
+}
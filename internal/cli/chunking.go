@@ -0,0 +1,405 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/tiktoken-go/tokenizer"
+)
+
+// textChunk is a chunk with the byte range [Start, End) of the input it
+// covers. Text is the input in this range, except for the lines split on
+// words whose spacing is collapsed and for the record delimiters. Once split,
+// processFile maps the range to the one of the file, before normalization.
+type textChunk struct {
+	Text  string `json:"-"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+// chunkTexts returns the texts of the chunks.
+func chunkTexts(chunks []textChunk) []string {
+	texts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		texts[i] = chunk.Text
+	}
+	return texts
+}
+
+// partitionChunks locates chunks whose concatenation is the input.
+func partitionChunks(texts []string) []textChunk {
+	chunks := make([]textChunk, len(texts))
+	offset := 0
+	for i, text := range texts {
+		chunks[i] = textChunk{Text: text, Start: offset, End: offset + len(text)}
+		offset += len(text)
+	}
+	return chunks
+}
+
+// splitChunks splits the text with the splitter selected by the options.
+func splitChunks(text string, opts Options) ([]string, error) {
+	chunks, err := splitTextChunks(text, opts)
+	if err != nil {
+		return nil, err
+	}
+	return chunkTexts(chunks), nil
+}
+
+// splitTextChunks is splitChunks keeping the byte range of each chunk.
+func splitTextChunks(text string, opts Options) ([]textChunk, error) {
+	delimiter := opts.lineDelimiter()
+	separator := delimiter
+	split := func(limit, ceiling int) ([]textChunk, error) {
+		return splitIntoTokenChunksWithCeiling(text, delimiter, limit, ceiling)
+	}
+	if opts.PreserveInputStructure {
+		// The chunks are an exact partition of the input
+		separator = ""
+		split = func(limit, ceiling int) ([]textChunk, error) {
+			chunks, err := splitPreservingStructureWithCeiling(text, delimiter, limit, ceiling)
+			return partitionChunks(chunks), err
+		}
+	}
+	if opts.SplitStrategy == SplitSentences {
+		if opts.RecordDelimiter != "" || delimiter != "\n" {
+			return nil, invalidConfig(fmt.Errorf("splitting on sentences cannot be combined with a record or line delimiter"))
+		}
+		if !opts.PreserveInputStructure {
+			separator = " "
+		}
+		// The paragraphs don't matter to sentences, the ceiling doesn't apply
+		split = func(limit, _ int) ([]textChunk, error) {
+			texts, err := splitIntoSentenceChunks(text, limit)
+			chunks := partitionChunks(texts)
+			if err != nil || opts.PreserveInputStructure {
+				return chunks, err
+			}
+			for i, chunk := range chunks {
+				chunks[i].Text = strings.TrimRightFunc(chunk.Text, unicode.IsSpace)
+				chunks[i].End = chunk.Start + len(chunks[i].Text)
+			}
+			return chunks, nil
+		}
+	}
+
+	chunks, err := split(opts.chunkSize(), opts.maxChunkSize())
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Packing == PackingBalanced {
+		if opts.maxChunkSize() > opts.chunkSize() {
+			return nil, invalidConfig(fmt.Errorf("balanced packing cannot be combined with a max chunk size"))
+		}
+		chunks, err = balanceChunks(text, chunks, opts.chunkSize(), func(limit int) ([]textChunk, error) {
+			return split(limit, limit)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.MinChunkSize > 0 {
+		chunks, err = mergeTinyTail(chunks, opts.MinChunkSize, separator)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.VerifyChunks {
+		if err := verifyChunks(text, chunkTexts(chunks), delimiter, opts.PreserveInputStructure); err != nil {
+			return nil, err
+		}
+	}
+
+	// Each line is a record, delimited so that the outputs map back to them
+	if opts.RecordDelimiter != "" && !opts.PreserveInputStructure {
+		for i, chunk := range chunks {
+			chunks[i].Text = strings.ReplaceAll(chunk.Text, delimiter, opts.RecordDelimiter)
+		}
+	}
+	return chunks, nil
+}
+
+// mergeTinyTail merges the last chunk into the previous one when it has fewer
+// than minTokens tokens, saving a request at the cost of a slightly oversized chunk.
+func mergeTinyTail(chunks []textChunk, minTokens int, separator string) ([]textChunk, error) {
+	if len(chunks) < 2 {
+		return chunks, nil
+	}
+
+	enc, err := tokenizer.Get(tokenizer.Cl100kBase)
+	if err != nil {
+		return nil, withCategory(ErrTokenizer, fmt.Errorf("failed to get tokenizer: %w", err))
+	}
+
+	last := len(chunks) - 1
+	if countTokens(enc, chunks[last].Text) >= minTokens {
+		return chunks, nil
+	}
+
+	chunks[last-1].Text += separator + chunks[last].Text
+	chunks[last-1].End = chunks[last].End
+	return chunks[:last], nil
+}
+
+func splitIntoTokenChunks(text string, maxTokensPerChunk int) ([]textChunk, error) {
+	return splitIntoTokenChunksWithCeiling(text, "\n", maxTokensPerChunk, maxTokensPerChunk)
+}
+
+// splitIntoTokenChunksWithCeiling splits the text, made of lines separated by
+// the delimiter, in chunks of about maxTokensPerChunk tokens. A chunk in the
+// middle of a paragraph may grow up to ceiling tokens so that it is cut at the
+// next blank line rather than in the middle of the paragraph.
+func splitIntoTokenChunksWithCeiling(text, delimiter string, maxTokensPerChunk, ceiling int) ([]textChunk, error) {
+	// Get the tokenizer
+	enc, err := tokenizer.Get(tokenizer.Cl100kBase)
+	if err != nil {
+		return nil, withCategory(ErrTokenizer, fmt.Errorf("failed to get tokenizer: %w", err))
+	}
+
+	var chunks []textChunk
+	lines := strings.Split(text, delimiter)
+
+	currentChunk := ""
+	currentTokens := 0
+	// afterBlankLine tells whether the current chunk ends a paragraph
+	afterBlankLine := false
+	// Byte ranges of the current chunk and of the line in the input
+	chunkStart, chunkEnd := 0, 0
+	lineStart := 0
+
+	for _, line := range lines {
+		lineEnd := lineStart + len(line)
+		lineWithNewline := line + delimiter
+		tokens, _, _ := enc.Encode(lineWithNewline)
+		lineTokenCount := len(tokens)
+
+		// If adding this line would exceed the limit, start a new chunk unless
+		// the paragraph can be completed below the ceiling
+		midParagraph := currentTokens+lineTokenCount <= ceiling && !afterBlankLine
+		if currentTokens+lineTokenCount > maxTokensPerChunk && currentChunk != "" && !midParagraph {
+			chunks = append(chunks, textChunk{Text: strings.TrimSuffix(currentChunk, delimiter), Start: chunkStart, End: chunkEnd})
+			currentChunk = lineWithNewline
+			currentTokens = lineTokenCount
+			chunkStart = lineStart
+		} else {
+			currentChunk += lineWithNewline
+			currentTokens += lineTokenCount
+		}
+		chunkEnd = lineEnd
+		afterBlankLine = isBlankLine(line, delimiter)
+
+		// Handle case where a single line exceeds the token limit, the lines
+		// below the ceiling are kept whole in their own chunk
+		if lineTokenCount > ceiling {
+			// Split the line into smaller parts
+			wordChunk := ""
+			wordTokens := 0
+			wordStart, wordEnd := 0, 0
+			offset := lineStart
+
+			for _, word := range strings.Fields(line) {
+				offset += strings.Index(text[offset:], word)
+				wordWithSpace := word + " "
+				tokens, _, _ := enc.Encode(wordWithSpace)
+				wordTokenCount := len(tokens)
+
+				// A word without spaces can exceed the limit on its own (e.g. a
+				// base64 blob or minified JSON), split it by character ranges
+				if wordTokenCount > maxTokensPerChunk {
+					if wordChunk != "" {
+						chunks = append(chunks, textChunk{Text: strings.TrimSpace(wordChunk), Start: wordStart, End: wordEnd})
+					}
+					pieces := splitWordByTokens(enc, word, maxTokensPerChunk)
+					for _, piece := range pieces[:len(pieces)-1] {
+						chunks = append(chunks, textChunk{Text: piece, Start: offset, End: offset + len(piece)})
+						offset += len(piece)
+					}
+					wordChunk = pieces[len(pieces)-1] + " "
+					wordTokens = countTokens(enc, wordChunk)
+					wordStart = offset
+					offset += len(pieces[len(pieces)-1])
+					wordEnd = offset
+					continue
+				}
+
+				if wordTokens+wordTokenCount > maxTokensPerChunk && wordChunk != "" {
+					chunks = append(chunks, textChunk{Text: strings.TrimSpace(wordChunk), Start: wordStart, End: wordEnd})
+					wordChunk = wordWithSpace
+					wordTokens = wordTokenCount
+					wordStart = offset
+				} else {
+					if wordChunk == "" {
+						wordStart = offset
+					}
+					wordChunk += wordWithSpace
+					wordTokens += wordTokenCount
+				}
+				offset += len(word)
+				wordEnd = offset
+			}
+
+			if wordChunk != "" {
+				currentChunk = strings.TrimSpace(wordChunk) + delimiter
+				tokens, _, _ := enc.Encode(currentChunk)
+				currentTokens = len(tokens)
+				chunkStart, chunkEnd = wordStart, wordEnd
+			}
+		}
+
+		lineStart = lineEnd + len(delimiter)
+	}
+
+	// Add the last chunk if it's not empty
+	if currentChunk != "" {
+		chunks = append(chunks, textChunk{Text: strings.TrimSuffix(currentChunk, delimiter), Start: chunkStart, End: chunkEnd})
+	}
+
+	return chunks, nil
+}
+
+// splitPreservingStructure splits text into chunks of at most maxTokensPerChunk
+// tokens whose concatenation is exactly the original text: blank lines,
+// trailing whitespace and line endings are kept as-is.
+func splitPreservingStructure(text string, maxTokensPerChunk int) ([]string, error) {
+	return splitPreservingStructureWithCeiling(text, "\n", maxTokensPerChunk, maxTokensPerChunk)
+}
+
+// splitPreservingStructureWithCeiling is splitPreservingStructure for lines
+// separated by the delimiter, where a chunk in the middle of a paragraph may
+// grow up to ceiling tokens to be cut at the next blank line.
+func splitPreservingStructureWithCeiling(text, delimiter string, maxTokensPerChunk, ceiling int) ([]string, error) {
+	enc, err := tokenizer.Get(tokenizer.Cl100kBase)
+	if err != nil {
+		return nil, withCategory(ErrTokenizer, fmt.Errorf("failed to get tokenizer: %w", err))
+	}
+
+	var chunks []string
+	var currentChunk strings.Builder
+	currentTokens := 0
+	// afterBlankLine tells whether the current chunk ends a paragraph
+	afterBlankLine := false
+
+	appendSegment := func(segment string, segmentTokens int) {
+		midParagraph := currentTokens+segmentTokens <= ceiling && !afterBlankLine
+		if currentTokens+segmentTokens > maxTokensPerChunk && currentChunk.Len() > 0 && !midParagraph {
+			chunks = append(chunks, currentChunk.String())
+			currentChunk.Reset()
+			currentTokens = 0
+		}
+		currentChunk.WriteString(segment)
+		currentTokens += segmentTokens
+	}
+
+	for _, line := range strings.SplitAfter(text, delimiter) {
+		if line == "" {
+			continue
+		}
+
+		lineTokenCount := countTokens(enc, line)
+		if lineTokenCount <= maxTokensPerChunk {
+			appendSegment(line, lineTokenCount)
+			afterBlankLine = isBlankLine(line, delimiter)
+			continue
+		}
+		afterBlankLine = false
+
+		// The line is too long, split it after each run of whitespace so that
+		// the spacing is kept in the segments.
+		for _, word := range splitAfterSpaces(line) {
+			wordTokenCount := countTokens(enc, word)
+			if wordTokenCount <= maxTokensPerChunk {
+				appendSegment(word, wordTokenCount)
+				continue
+			}
+
+			for _, piece := range splitWordByTokens(enc, word, maxTokensPerChunk) {
+				appendSegment(piece, countTokens(enc, piece))
+			}
+		}
+	}
+
+	if currentChunk.Len() > 0 {
+		chunks = append(chunks, currentChunk.String())
+	}
+
+	return chunks, nil
+}
+
+// isBlankLine tells whether the line, with or without its delimiter, is a
+// blank line ending a paragraph, spaces and the \r of a \r\n line ending
+// included.
+func isBlankLine(line, delimiter string) bool {
+	return strings.TrimSpace(strings.TrimSuffix(line, delimiter)) == ""
+}
+
+func countTokens(enc tokenizer.Codec, text string) int {
+	tokens, _, _ := enc.Encode(text)
+	return len(tokens)
+}
+
+// splitAfterSpaces splits a line after each run of whitespace, keeping the
+// whitespace at the end of the segments.
+func splitAfterSpaces(line string) []string {
+	var segments []string
+	start := 0
+	inSpace := false
+
+	for i, r := range line {
+		isSpace := unicode.IsSpace(r)
+		if inSpace && !isSpace {
+			segments = append(segments, line[start:i])
+			start = i
+		}
+		inSpace = isSpace
+	}
+
+	if start < len(line) {
+		segments = append(segments, line[start:])
+	}
+
+	return segments
+}
+
+// splitWordByTokens splits a word that exceeds maxTokens on its own (e.g. a
+// base64 blob) into pieces of at most maxTokens tokens, cutting between runes.
+func splitWordByTokens(enc tokenizer.Codec, word string, maxTokens int) []string {
+	var pieces []string
+
+	for word != "" {
+		// Binary search the longest rune-aligned prefix that fits.
+		low, high := 1, utf8.RuneCountInString(word)
+		best := 1
+		for low <= high {
+			mid := (low + high) / 2
+			if countTokens(enc, prefixRunes(word, mid)) <= maxTokens {
+				best = mid
+				low = mid + 1
+			} else {
+				high = mid - 1
+			}
+		}
+
+		piece := prefixRunes(word, best)
+		pieces = append(pieces, piece)
+		word = word[len(piece):]
+	}
+
+	return pieces
+}
+
+// prefixRunes returns the first n runes of s.
+func prefixRunes(s string, n int) string {
+	i := 0
+	for j := range s {
+		if i == n {
+			return s[:j]
+		}
+		i++
+	}
+	return s
+}
@@ -0,0 +1,411 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/openai/openai-go"
+	"github.com/tiktoken-go/tokenizer"
+)
+
+func TestSplitPreservingStructure_ExactRoundTrip(t *testing.T) {
+	input := "Title  \n\n\nFirst paragraph with trailing spaces   \n\t indented line\n\n" +
+		strings.Repeat("a long line made of many words   ", 40) + "\n" +
+		"\n  \nlast line without newline  "
+
+	for _, maxTokens := range []int{5, 20, 1000} {
+		chunks, err := splitPreservingStructure(input, maxTokens)
+		if err != nil {
+			t.Fatalf("splitPreservingStructure failed: %v", err)
+		}
+
+		if got := strings.Join(chunks, ""); got != input {
+			t.Errorf("max %d: round trip mismatch\nexpected: %q\ngot:      %q", maxTokens, input, got)
+		}
+
+		if maxTokens == 5 && len(chunks) < 2 {
+			t.Errorf("Expected multiple chunks with a small limit, got %d", len(chunks))
+		}
+	}
+}
+
+func TestSplitPreservingStructure_LongWord(t *testing.T) {
+	input := strings.Repeat("x9Y", 500)
+
+	chunks, err := splitPreservingStructure(input, 50)
+	if err != nil {
+		t.Fatalf("splitPreservingStructure failed: %v", err)
+	}
+
+	if got := strings.Join(chunks, ""); got != input {
+		t.Error("round trip mismatch for a space-free line")
+	}
+
+	for i, chunk := range chunks {
+		est, err := estimateTokens(chunk)
+		if err != nil {
+			t.Fatalf("Failed to estimate tokens for chunk %d: %v", i, err)
+		}
+		if est.TokensCount > 50 {
+			t.Errorf("Chunk %d has %d tokens, exceeding limit of 50", i, est.TokensCount)
+		}
+	}
+}
+
+func TestProcessWithClient_PreserveInputStructure(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "structure_test.txt")
+	testContent := "first line  \n\n\nsecond line\n"
+
+	if err := os.WriteFile(testFile, []byte(testContent), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.PreserveInputStructure = true
+
+	mock := &mockChatGenerator{}
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	chunk, err := os.ReadFile(filepath.Join(tmpDir, "structure_test", "chunk1.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read chunk: %v", err)
+	}
+
+	if string(chunk) != testContent {
+		t.Errorf("Expected chunk to match the input exactly, got: %q", string(chunk))
+	}
+}
+
+func TestSplitChunks_MinChunkSizeMergesTinyTail(t *testing.T) {
+	// Add lines until the last one spills over into a tiny second chunk
+	var lines []string
+	var text string
+	for {
+		lines = append(lines, fmt.Sprintf("line %d with a few words to fill the chunk", len(lines)+1))
+		text = strings.Join(lines, "\n")
+		chunks, err := splitChunks(text, DefaultOptions())
+		if err != nil {
+			t.Fatalf("splitChunks failed: %v", err)
+		}
+		if len(chunks) == 2 {
+			break
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.MinChunkSize = 50
+	chunks, err := splitChunks(text, opts)
+	if err != nil {
+		t.Fatalf("splitChunks failed: %v", err)
+	}
+	if len(chunks) != 1 {
+		t.Fatalf("Expected the tiny tail to be merged into a single chunk, got %d chunks", len(chunks))
+	}
+	if chunks[0] != text {
+		t.Error("Expected the merged chunk to contain the whole input")
+	}
+
+	// A tail above the minimum is kept on its own
+	opts.MinChunkSize = 5
+	chunks, err = splitChunks(text, opts)
+	if err != nil {
+		t.Fatalf("splitChunks failed: %v", err)
+	}
+	if len(chunks) != 2 {
+		t.Errorf("Expected the tail to be kept, got %d chunks", len(chunks))
+	}
+}
+
+func TestSplitIntoTokenChunks_LongWordRespectsLimit(t *testing.T) {
+	// A single space-free line, e.g. a base64 blob
+	var sb strings.Builder
+	for sb.Len() < 10000 {
+		fmt.Fprintf(&sb, "%x", sb.Len()*7919)
+	}
+	line := sb.String()[:10000]
+
+	enc, err := tokenizer.Get(tokenizer.Cl100kBase)
+	if err != nil {
+		t.Fatalf("Failed to get tokenizer: %v", err)
+	}
+
+	const maxTokens = 500
+	if countTokens(enc, line) <= maxTokens {
+		t.Fatalf("Expected the line to exceed %d tokens", maxTokens)
+	}
+
+	chunks, err := splitIntoTokenChunks("before\n"+line+"\nafter", maxTokens)
+	if err != nil {
+		t.Fatalf("splitIntoTokenChunks failed: %v", err)
+	}
+
+	for i, chunk := range chunks {
+		if tokens := countTokens(enc, chunk.Text); tokens > maxTokens {
+			t.Errorf("Chunk %d has %d tokens, exceeding the limit of %d", i+1, tokens, maxTokens)
+		}
+	}
+
+	joined := strings.Join(chunkTexts(chunks), "")
+	if !strings.Contains(strings.ReplaceAll(joined, "\n", ""), line) {
+		t.Error("Expected the chunks to contain the whole line")
+	}
+}
+
+func TestSplitChunks_MaxChunkSizeCutsAtParagraphs(t *testing.T) {
+	var paragraphs []string
+	for i := 0; i < 30; i++ {
+		paragraphs = append(paragraphs, fmt.Sprintf("Paragraph %d starts here.\nIt goes on for a while.\nIt keeps going a bit more.\nAnd it ends on this line.", i))
+	}
+	text := strings.Join(paragraphs, "\n\n")
+
+	// A chunk cut at a paragraph boundary ends with the blank line
+	midParagraphSplits := func(chunks []string) int {
+		count := 0
+		for _, chunk := range chunks[:len(chunks)-1] {
+			if !strings.HasSuffix(chunk, "\n") {
+				count++
+			}
+		}
+		return count
+	}
+
+	opts := DefaultOptions()
+	opts.ChunkSize = 50
+	strict, err := splitChunks(text, opts)
+	if err != nil {
+		t.Fatalf("splitChunks failed: %v", err)
+	}
+
+	opts.MaxChunkSize = 80
+	soft, err := splitChunks(text, opts)
+	if err != nil {
+		t.Fatalf("splitChunks failed: %v", err)
+	}
+
+	if got, want := midParagraphSplits(soft), midParagraphSplits(strict); got >= want {
+		t.Errorf("Expected fewer mid-paragraph splits with a ceiling, got %d (strict: %d)", got, want)
+	}
+
+	enc, err := tokenizer.Get(tokenizer.Cl100kBase)
+	if err != nil {
+		t.Fatalf("failed to get tokenizer: %v", err)
+	}
+	for i, chunk := range soft {
+		if tokens := countTokens(enc, chunk); tokens > opts.MaxChunkSize {
+			t.Errorf("Chunk %d has %d tokens, above the ceiling of %d", i+1, tokens, opts.MaxChunkSize)
+		}
+	}
+	if got := strings.Join(soft, "\n"); got != text {
+		t.Errorf("Chunks don't reconstruct the input\nexpected: %q\ngot:      %q", text, got)
+	}
+}
+
+func TestSplitChunks_MaxChunkSizeCutsAtBlankLinesWithSpaces(t *testing.T) {
+	var paragraphs []string
+	for i := 0; i < 30; i++ {
+		paragraphs = append(paragraphs, fmt.Sprintf("Paragraph %d starts here.\r\nIt goes on for a while.\r\nIt keeps going a bit more.\r\nAnd it ends on this line.", i))
+	}
+	text := strings.Join(paragraphs, "\r\n \t\r\n")
+
+	// A chunk cut at a paragraph boundary ends with the blank line
+	midParagraphSplits := func(chunks []string) int {
+		count := 0
+		for _, chunk := range chunks[:len(chunks)-1] {
+			lines := strings.Split(strings.TrimSuffix(chunk, "\n"), "\n")
+			if !isBlankLine(lines[len(lines)-1], "\n") {
+				count++
+			}
+		}
+		return count
+	}
+
+	for _, preserve := range []bool{false, true} {
+		opts := DefaultOptions()
+		opts.ChunkSize = 50
+		opts.PreserveInputStructure = preserve
+		strict, err := splitChunks(text, opts)
+		if err != nil {
+			t.Fatalf("splitChunks failed: %v", err)
+		}
+
+		opts.MaxChunkSize = 80
+		soft, err := splitChunks(text, opts)
+		if err != nil {
+			t.Fatalf("splitChunks failed: %v", err)
+		}
+
+		if got, want := midParagraphSplits(soft), midParagraphSplits(strict); got >= want {
+			t.Errorf("Expected fewer mid-paragraph splits with a ceiling (preserving the structure: %v), got %d (strict: %d)", preserve, got, want)
+		}
+	}
+}
+
+func TestProcessWithClient_MaxChunks(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "max_chunks_test.txt")
+	text := strings.Repeat("word ", 3000)
+	if err := os.WriteFile(testFile, []byte(text), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.ChunkSize = 500
+	opts.MaxChunks = 2
+	opts.Log = io.Discard
+
+	chunks, err := splitChunks(text, opts)
+	if err != nil {
+		t.Fatalf("splitChunks failed: %v", err)
+	}
+
+	mock := &mockChatGenerator{}
+	err = ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts)
+	if !errors.Is(err, ErrTooManyChunks) {
+		t.Fatalf("Expected ErrTooManyChunks, got %v", err)
+	}
+	for _, expected := range []string{fmt.Sprintf("into %d chunks", len(chunks)), "maximum of 2", "--chunk-size"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected %q in the error, got %q", expected, err.Error())
+		}
+	}
+	if mock.callCount != 0 {
+		t.Errorf("Expected no API calls, got %d", mock.callCount)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "max_chunks_test")); !os.IsNotExist(err) {
+		t.Errorf("Expected no chunk directory, got %v", err)
+	}
+
+	// Under the cap the run proceeds
+	opts.MaxChunks = len(chunks)
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+}
+
+func TestProcessWithClient_LineDelimiter(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "nul_test.txt")
+	var files []string
+	for i := 0; i < 300; i++ {
+		files = append(files, fmt.Sprintf("src/dir %d/file name %d.go", i, i))
+	}
+	text := strings.Join(files, "\x00")
+	if err := os.WriteFile(testFile, []byte(text), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.ChunkSize = 1000
+	opts.LineDelimiter = "\x00"
+	opts.VerifyChunks = true
+
+	chunks, err := splitChunks(text, opts)
+	if err != nil {
+		t.Fatalf("splitChunks failed: %v", err)
+	}
+	if len(chunks) < 2 {
+		t.Fatalf("Expected at least 2 chunks, got %d", len(chunks))
+	}
+	for i, chunk := range chunks {
+		if strings.Contains(chunk, "\n") || strings.HasPrefix(chunk, "\x00") || strings.HasSuffix(chunk, "\x00") {
+			t.Errorf("Chunk %d is not cut on a NUL boundary: %q", i+1, chunk)
+		}
+	}
+	if got := strings.Join(chunks, "\x00"); got != text {
+		t.Errorf("Expected the chunks to recombine with NUL into the input")
+	}
+
+	// The model returns the records as it received them
+	mock := &mockChatGenerator{
+		requestFunc: func(params openai.ChatCompletionNewParams) string {
+			return userContent(params)
+		},
+	}
+	if err := ProcessWithClientOptions(context.Background(), mock, "Keep the Go files", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+	if !strings.Contains(systemContent(mock.params[0]), `delimiter "\x00"`) {
+		t.Errorf("Expected the prompt to describe the delimiter, got %q", systemContent(mock.params[0]))
+	}
+
+	combined, err := os.ReadFile(filepath.Join(tmpDir, "nul_test.combined_results.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read combined results: %v", err)
+	}
+	if expected := text + "\x00"; string(combined) != expected {
+		t.Errorf("Expected the results rejoined with NUL, got %q", string(combined))
+	}
+}
+
+func TestSplitTextChunks_OffsetsReconstructInput(t *testing.T) {
+	var content strings.Builder
+	for i := 0; i < 40; i++ {
+		fmt.Fprintf(&content, "ligne %d: déjà vu, naïve café — 日本語のテキスト ✓\n", i)
+		if i%10 == 9 {
+			content.WriteString("\n")
+		}
+	}
+	// A line longer than a chunk is split on words, collapsing its spacing
+	content.WriteString(strings.Repeat("été  über ", 40) + "\n")
+	// A word longer than a chunk is cut between characters
+	content.WriteString("blob " + strings.Repeat("Zéq", 150) + " fin")
+	text := content.String()
+	longLines := strings.Index(text, "été  über")
+
+	strategies := map[string]func(*Options){
+		"lines":     func(*Options) {},
+		"preserve":  func(opts *Options) { opts.PreserveInputStructure = true },
+		"sentences": func(opts *Options) { opts.SplitStrategy = SplitSentences },
+		"balanced":  func(opts *Options) { opts.Packing = PackingBalanced },
+		"min-chunk": func(opts *Options) { opts.MinChunkSize = 60 },
+	}
+	for name, configure := range strategies {
+		t.Run(name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.ChunkSize = 50
+			configure(&opts)
+
+			chunks, err := splitTextChunks(text, opts)
+			if err != nil {
+				t.Fatalf("splitTextChunks failed: %v", err)
+			}
+			if len(chunks) < 3 {
+				t.Fatalf("Expected several chunks, got %d", len(chunks))
+			}
+
+			end := 0
+			for i, chunk := range chunks {
+				if chunk.Start < end || chunk.End < chunk.Start || chunk.End > len(text) {
+					t.Fatalf("Chunk %d has the invalid range [%d, %d) after %d", i+1, chunk.Start, chunk.End, end)
+				}
+				end = chunk.End
+
+				covered := text[chunk.Start:chunk.End]
+				if !utf8.ValidString(covered) {
+					t.Errorf("Chunk %d cuts a character: [%d, %d)", i+1, chunk.Start, chunk.End)
+				}
+				if covered == chunk.Text {
+					continue
+				}
+				if opts.PreserveInputStructure || chunk.End <= longLines {
+					t.Errorf("Chunk %d: the range [%d, %d) holds %q, expected exactly %q", i+1, chunk.Start, chunk.End, covered, chunk.Text)
+				} else if strings.Join(strings.Fields(covered), " ") != strings.Join(strings.Fields(chunk.Text), " ") {
+					t.Errorf("Chunk %d: the range [%d, %d) holds %q, expected %q", i+1, chunk.Start, chunk.End, covered, chunk.Text)
+				}
+			}
+		})
+	}
+}
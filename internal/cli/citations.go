@@ -0,0 +1,132 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/shared"
+)
+
+// defaultCitationsPrompt is the reduce prompt of the citations mode when none is provided.
+const defaultCitationsPrompt = "Answer using only the information in the chunk results."
+
+// citationsPromptSuffix asks the reduce model for an answer whose segments
+// reference the chunks supporting them.
+const citationsPromptSuffix = `
+Each chunk result is preceded by its chunk number as [chunk N].
+Respond with a JSON object of the form {"answer": [{"text": "...", "chunks": [1, 3]}]} where the answer is split into segments and "chunks" lists the numbers of the chunks supporting each segment.`
+
+// citedSegment is a segment of the answer with the chunks (starting at 1) supporting it.
+type citedSegment struct {
+	Text   string `json:"text"`
+	Chunks []int  `json:"chunks"`
+}
+
+// citationsFilePath returns the path of the JSONL citations next to the combined output.
+func citationsFilePath(combinedFileName string) string {
+	return strings.TrimSuffix(combinedFileName, ".combined_results.txt") + ".citations.jsonl"
+}
+
+// reduceWithCitations asks the reduce model for an answer annotated with the
+// chunks supporting each segment. The segments are written as JSONL to
+// citationsPath and the answer is returned as markdown.
+func (p *processor) reduceWithCitations(ctx context.Context, results []chunkResult, citationsPath string) (string, error) {
+	prompt := p.opts.ReducePrompt
+	if prompt == "" {
+		prompt = defaultCitationsPrompt
+	}
+
+	var input strings.Builder
+	for _, result := range results {
+		fmt.Fprintf(&input, "[chunk %d]\n%s\n", p.opts.chunkNumber(result.Index), result.Content)
+	}
+
+	model := p.opts.reduceModel()
+	fmt.Fprintf(p.out, "Reducing %d results with citations with %s...\n", len(results), model)
+
+	content, err := p.generateReduce(ctx, openai.ChatCompletionNewParams{
+		Messages: []openai.ChatCompletionMessageParamUnion{
+			openai.SystemMessage(prompt + citationsPromptSuffix),
+			openai.UserMessage(input.String()),
+		},
+		Model:       shared.ChatModel(model),
+		ServiceTier: p.serviceTier(),
+		ResponseFormat: openai.ChatCompletionNewParamsResponseFormatUnion{
+			OfJSONObject: &shared.ResponseFormatJSONObjectParam{},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	valid := make(map[int]bool, len(results))
+	for _, result := range results {
+		valid[p.opts.chunkNumber(result.Index)] = true
+	}
+	segments, err := parseCitations(content, valid)
+	if err != nil {
+		return "", err
+	}
+
+	if err := writeCitationsJSONL(citationsPath, segments); err != nil {
+		return "", fmt.Errorf("failed to write citations: %w", err)
+	}
+	fmt.Fprintf(p.out, "Citations written to: %s\n", citationsPath)
+
+	return formatCitationsMarkdown(segments), nil
+}
+
+// parseCitations parses the answer of the reduce model, rejecting citations of
+// chunks that were not given to it.
+func parseCitations(content string, valid map[int]bool) ([]citedSegment, error) {
+	var answer struct {
+		Answer []citedSegment `json:"answer"`
+	}
+	if err := json.Unmarshal([]byte(content), &answer); err != nil {
+		return nil, fmt.Errorf("invalid citations output: %w", err)
+	}
+
+	for _, segment := range answer.Answer {
+		for _, chunk := range segment.Chunks {
+			if !valid[chunk] {
+				return nil, fmt.Errorf("invalid citations output: chunk %d is not one of the chunk results", chunk)
+			}
+		}
+	}
+	return answer.Answer, nil
+}
+
+// formatCitationsMarkdown renders each segment followed by its chunk references.
+func formatCitationsMarkdown(segments []citedSegment) string {
+	var sb strings.Builder
+	for _, segment := range segments {
+		sb.WriteString(strings.TrimSpace(segment.Text))
+		if len(segment.Chunks) > 0 {
+			refs := make([]string, len(segment.Chunks))
+			for i, chunk := range segment.Chunks {
+				refs[i] = strconv.Itoa(chunk)
+			}
+			fmt.Fprintf(&sb, " [chunks %s]", strings.Join(refs, ", "))
+		}
+		sb.WriteString("\n\n")
+	}
+	return sb.String()
+}
+
+func writeCitationsJSONL(path string, segments []citedSegment) error {
+	var sb strings.Builder
+	for _, segment := range segments {
+		b, err := json.Marshal(segment)
+		if err != nil {
+			return err
+		}
+		sb.Write(b)
+		sb.WriteByte('\n')
+	}
+	return os.WriteFile(path, []byte(sb.String()), 0644)
+}
@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/openai/openai-go"
+)
+
+func TestProcessWithClient_Citations(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "citations_test.txt")
+	if err := os.WriteFile(testFile, []byte(strings.Repeat("word ", 3000)), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.Citations = true
+
+	mock := &mockChatGenerator{
+		requestFunc: func(params openai.ChatCompletionNewParams) string {
+			if strings.HasSuffix(systemContent(params), citationsPromptSuffix) {
+				return `{"answer": [{"text": "Words are repeated.", "chunks": [1, 3]}, {"text": "Nothing else.", "chunks": [2]}]}`
+			}
+			return "chunk result"
+		},
+	}
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	reduceParams := mock.params[len(mock.params)-1]
+	for _, label := range []string{"[chunk 1]", "[chunk 2]", "[chunk 3]"} {
+		if !strings.Contains(userContent(reduceParams), label) {
+			t.Errorf("Expected the reduce input to label %s, got %q", label, userContent(reduceParams))
+		}
+	}
+
+	combined, err := os.ReadFile(filepath.Join(tmpDir, "citations_test.combined_results.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read combined results: %v", err)
+	}
+	expected := "Words are repeated. [chunks 1, 3]\n\nNothing else. [chunks 2]\n\n"
+	if string(combined) != expected {
+		t.Errorf("Expected %q, got %q", expected, string(combined))
+	}
+
+	jsonl, err := os.ReadFile(filepath.Join(tmpDir, "citations_test.citations.jsonl"))
+	if err != nil {
+		t.Fatalf("Failed to read citations: %v", err)
+	}
+	expectedJSONL := `{"text":"Words are repeated.","chunks":[1,3]}` + "\n" + `{"text":"Nothing else.","chunks":[2]}` + "\n"
+	if string(jsonl) != expectedJSONL {
+		t.Errorf("Expected %q, got %q", expectedJSONL, string(jsonl))
+	}
+}
+
+func TestParseCitations_UnknownChunk(t *testing.T) {
+	_, err := parseCitations(`{"answer": [{"text": "a", "chunks": [4]}]}`, map[int]bool{1: true, 2: true})
+	if err == nil {
+		t.Error("Expected an error for a citation of an unknown chunk")
+	}
+}
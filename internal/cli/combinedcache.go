@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// combinedCacheEntry holds the interpreted results of all the chunks of a
+// run, so that an identical run is served from a single file instead of
+// reading every result file.
+type combinedCacheEntry struct {
+	Results []combinedCacheResult `json:"results"`
+}
+
+type combinedCacheResult struct {
+	Index   int      `json:"index"`
+	Content string   `json:"content"`
+	Score   float64  `json:"score,omitempty"`
+	Stop    bool     `json:"stop,omitempty"`
+	Records []string `json:"records,omitempty"`
+
+	Justifications []justifiedLine `json:"justifications,omitempty"`
+}
+
+// combinedCacheKey hashes what the results of a run depend on: the chunks of
+// the file, the prompt, the model and the request settings, the running context
+// included. The prompt is the one given by the user, before any expansion by
+// the model.
+func combinedCacheKey(chunks []string, prompt string, opts Options) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "auto-prompt=%v;", opts.AutoPrompt)
+	if opts.ChunkFilter != nil {
+		fmt.Fprintf(h, "chunk-filter=%d:%s;", len(opts.ChunkFilter.String()), opts.ChunkFilter)
+	}
+	fmt.Fprintf(h, "max-request-tokens=%d;", opts.MaxRequestTokens)
+	for _, s := range []string{string(opts.Model), chunkPrompt(prompt, opts), newRequestSettings(opts).recorded()} {
+		fmt.Fprintf(h, "%d:%s", len(s), s)
+	}
+	for _, chunk := range chunks {
+		fmt.Fprintf(h, "%d:%s", len(chunk), chunk)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func combinedCachePath(chunkDir, key string) string {
+	return filepath.Join(chunkDir, "combined-"+key[:16]+".json")
+}
+
+// loadCombinedCache returns the results cached for the key, if any.
+func loadCombinedCache(path string) ([]chunkResult, bool, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("failed to read combined cache: %w", err)
+	}
+
+	var entry combinedCacheEntry
+	if err := json.Unmarshal(b, &entry); err != nil {
+		return nil, false, fmt.Errorf("failed to parse combined cache %s: %w", path, err)
+	}
+
+	results := make([]chunkResult, len(entry.Results))
+	for i, r := range entry.Results {
+		results[i] = chunkResult{
+			Index:   r.Index,
+			Content: r.Content,
+			Score:   r.Score,
+			Stop:    r.Stop,
+			Records: r.Records,
+			Cached:  true,
+
+			Justifications: r.Justifications,
+		}
+	}
+	return results, true, nil
+}
+
+func saveCombinedCache(path string, results []chunkResult, perm os.FileMode) error {
+	entry := combinedCacheEntry{Results: make([]combinedCacheResult, len(results))}
+	for i, r := range results {
+		entry.Results[i] = combinedCacheResult{
+			Index:   r.Index,
+			Content: r.Content,
+			Score:   r.Score,
+			Stop:    r.Stop,
+			Records: r.Records,
+
+			Justifications: r.Justifications,
+		}
+	}
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal combined cache: %w", err)
+	}
+	return writeFileAtomic(path, b, perm)
+}
@@ -0,0 +1,127 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProcessWithClient_CombinedCache(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "combined_cache_test.txt")
+	if err := os.WriteFile(testFile, []byte(strings.Repeat("word ", 3000)), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.CombinedCache = true
+	opts.Log = &bytes.Buffer{}
+
+	first := &mockChatGenerator{
+		responseFunc: func(callCount int) string {
+			return "processed "
+		},
+	}
+	if err := ProcessWithClientOptions(context.Background(), first, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("First run failed: %v", err)
+	}
+	if first.callCount < 2 {
+		t.Fatalf("Expected several chunks, got %d calls", first.callCount)
+	}
+
+	combinedFile := filepath.Join(tmpDir, "combined_cache_test.combined_results.txt")
+	expected, err := os.ReadFile(combinedFile)
+	if err != nil {
+		t.Fatalf("Failed to read combined results: %v", err)
+	}
+
+	// The result files are gone: the second run can only be served by the
+	// combined cache, without reading any chunk file.
+	chunkDir := filepath.Join(tmpDir, "combined_cache_test")
+	results, err := filepath.Glob(filepath.Join(chunkDir, "result*.txt"))
+	if err != nil || len(results) != first.callCount {
+		t.Fatalf("Expected %d result files, got %d (%v)", first.callCount, len(results), err)
+	}
+	for _, path := range results {
+		if err := os.Remove(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Remove(combinedFile); err != nil {
+		t.Fatal(err)
+	}
+
+	var log bytes.Buffer
+	opts.Log = &log
+	second := &mockChatGenerator{}
+	if err := ProcessWithClientOptions(context.Background(), second, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("Second run failed: %v", err)
+	}
+
+	if second.callCount != 0 {
+		t.Errorf("Expected no API calls, got %d", second.callCount)
+	}
+	if !strings.Contains(log.String(), "Using the combined cache") {
+		t.Errorf("Expected the combined cache to be used, got log:\n%s", log.String())
+	}
+	if strings.Contains(log.String(), "Using cached result") {
+		t.Errorf("Expected no chunk result to be read, got log:\n%s", log.String())
+	}
+	content, err := os.ReadFile(combinedFile)
+	if err != nil {
+		t.Fatalf("Failed to read combined results: %v", err)
+	}
+	if string(content) != string(expected) {
+		t.Errorf("Expected %q, got %q", expected, content)
+	}
+
+	// Another prompt misses the combined cache
+	third := &mockChatGenerator{
+		responseFunc: func(callCount int) string {
+			return "other "
+		},
+	}
+	if err := ProcessWithClientOptions(context.Background(), third, "another prompt", testFile, opts); err != nil {
+		t.Fatalf("Third run failed: %v", err)
+	}
+	if third.callCount != first.callCount {
+		t.Errorf("Expected %d API calls for another prompt, got %d", first.callCount, third.callCount)
+	}
+}
+
+func TestProcessWithClient_CombinedCacheRunningContext(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "combined_context_test.txt")
+	if err := os.WriteFile(testFile, []byte(strings.Repeat("word ", 3000)), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.CombinedCache = true
+	opts.Log = &bytes.Buffer{}
+	chunks := []string{"first chunk", "second chunk"}
+	plainKey := combinedCacheKey(chunks, "test prompt", opts)
+
+	if err := ProcessWithClientOptions(context.Background(), &mockChatGenerator{}, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("First run failed: %v", err)
+	}
+
+	// The results of a plain run were computed without any context
+	opts.RunningContext = true
+	if key := combinedCacheKey(chunks, "test prompt", opts); key == plainKey {
+		t.Error("Expected the running context to change the combined cache key")
+	}
+	mock := &mockChatGenerator{}
+	err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts)
+	if err == nil || !strings.Contains(err.Error(), "--force") {
+		t.Errorf("Expected the results of the plain run to be refused, got %v", err)
+	}
+	if mock.callCount != 0 {
+		t.Errorf("Expected no API call, got %d", mock.callCount)
+	}
+}
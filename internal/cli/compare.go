@@ -0,0 +1,166 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	myopenai "github.com/clems4ever/big-context/internal/openai"
+	"github.com/openai/openai-go"
+	"github.com/tiktoken-go/tokenizer"
+)
+
+// modelSample is the outcome of the sampled chunks with a compared model.
+type modelSample struct {
+	Model   Model
+	Outputs []string
+	Usage   Usage
+}
+
+// sampleChunkIndexes returns the indexes of at most n chunks spread evenly
+// over the total ones.
+func sampleChunkIndexes(total, n int) []int {
+	if n > total {
+		n = total
+	}
+	indexes := make([]int, n)
+	for k := range indexes {
+		indexes[k] = k * total / n
+	}
+	return indexes
+}
+
+// writeModelComparison sends a sample of the chunks of the file to each of
+// Options.CompareModels and writes their outputs side by side with the cost
+// of the sample and the one of the full run. Nothing is cached.
+func writeModelComparison(ctx context.Context, client myopenai.ChatGenerator, w io.Writer, prompt, filePath string, opts Options) error {
+	if info, err := os.Stat(filePath); err == nil && info.IsDir() {
+		return invalidConfig(fmt.Errorf("comparing models requires a file, not a directory"))
+	}
+	if opts.AutoPrompt || len(opts.Tasks) > 0 {
+		return invalidConfig(fmt.Errorf("comparing models cannot be combined with an automatic prompt or tasks"))
+	}
+	// A model the requests would fail with or whose cost is unknown is caught
+	// before sampling the others
+	for _, model := range opts.CompareModels {
+		if model == "" {
+			return invalidConfig(fmt.Errorf("empty model in the compared models"))
+		}
+		if err := checkPricedModel("compared model", model); err != nil {
+			return err
+		}
+	}
+
+	out := &syncWriter{w: opts.log()}
+	text, _, _, err := readInput(out, filePath, opts)
+	if err != nil {
+		return err
+	}
+	chunks, err := splitChunks(text, opts)
+	if err != nil {
+		return fmt.Errorf("failed to split into chunks: %w", err)
+	}
+	sample := sampleChunkIndexes(len(chunks), opts.compareSample())
+
+	enc, err := tokenizer.Get(tokenizer.Cl100kBase)
+	if err != nil {
+		return withCategory(ErrTokenizer, fmt.Errorf("failed to get tokenizer: %w", err))
+	}
+	totalTokens := countTokens(enc, text)
+	sampleTokens := 0
+	for _, i := range sample {
+		sampleTokens += countTokens(enc, chunks[i])
+	}
+
+	fmt.Fprintf(out, "Comparing %d models on %d of the %d chunks: %d requests\n", len(opts.CompareModels), len(sample), len(chunks), len(opts.CompareModels)*len(sample))
+	if opts.RequireConfirmation && !confirmProcessing(out) {
+		return nil
+	}
+
+	prompt = chunkPrompt(prompt, opts)
+	samples := make([]modelSample, len(opts.CompareModels))
+	for m, model := range opts.CompareModels {
+		modelOpts := opts
+		modelOpts.Model = model
+		p := &processor{
+			client:  client,
+			opts:    modelOpts,
+			out:     out,
+			breaker: newCircuitBreaker(opts.BreakerThreshold, opts.BreakerCooldown),
+
+			retryableStatuses: retryableStatuses(opts.RetryOnStatus, opts.NoRetryOnStatus),
+		}
+
+		samples[m].Model = model
+		for _, i := range sample {
+			fmt.Fprintf(out, "Chunk %d: %s (processing...)\n", opts.chunkNumber(i), model)
+			params := p.chunkParams(prompt, chunks[i])
+			res, discarded, err := p.requestChunk(ctx, i, &params)
+			if err != nil {
+				return fmt.Errorf("failed to generate chat completion for chunk %d with %s: %w", opts.chunkNumber(i), model, err)
+			}
+			samples[m].Usage = samples[m].Usage.Add(discarded).Add(Usage{
+				PromptTokens:     res.Usage.PromptTokens,
+				CompletionTokens: res.Usage.CompletionTokens,
+				Cost:             usageCost(model, res.Usage.PromptTokens, res.Usage.CompletionTokens),
+			})
+			samples[m].Outputs = append(samples[m].Outputs, comparedOutput(res, opts.ChoicePolicy))
+		}
+	}
+
+	_, err = io.WriteString(w, formatModelComparison(chunks, sample, samples, sampleTokens, totalTokens, opts))
+	return err
+}
+
+// comparedOutput returns the output of a response, or what went wrong.
+func comparedOutput(res *openai.ChatCompletion, policy ChoicePolicy) string {
+	if len(res.Choices) == 0 {
+		return "[no content]"
+	}
+	choice := selectChoice(res.Choices, policy)
+	if choice.Message.Refusal != "" {
+		return "[refused: " + choice.Message.Refusal + "]"
+	}
+	if !usableChoice(choice) {
+		return "[no content]"
+	}
+	return choice.Message.Content
+}
+
+// formatModelComparison puts the input of each sampled chunk next to the
+// output of each model, followed by the cost of each model: the one of the
+// sample, the one of the full run projected from it, and the estimated one.
+func formatModelComparison(chunks []string, sample []int, samples []modelSample, sampleTokens, totalTokens int, opts Options) string {
+	var sb strings.Builder
+	section := func(title, content string) {
+		fmt.Fprintf(&sb, "=== %s ===\n%s", title, content)
+		if !strings.HasSuffix(content, "\n") {
+			sb.WriteString("\n")
+		}
+	}
+
+	for k, i := range sample {
+		section(fmt.Sprintf("Chunk %d input", opts.chunkNumber(i)), chunks[i])
+		for _, s := range samples {
+			section(fmt.Sprintf("Chunk %d %s", opts.chunkNumber(i), s.Model), s.Outputs[k])
+		}
+		sb.WriteString("\n")
+	}
+
+	estimated := make(map[Model]float64)
+	for _, cost := range compareModels(totalTokens, opts.ExpectedOutputRatio) {
+		estimated[cost.Model] = cost.Cost
+	}
+	sb.WriteString("=== Costs ===\n")
+	for _, s := range samples {
+		projected := 0.0
+		if sampleTokens > 0 {
+			projected = s.Usage.Cost * float64(totalTokens) / float64(sampleTokens)
+		}
+		fmt.Fprintf(&sb, "%s: $%.4f for the sample (%d prompt + %d completion tokens), $%.4f projected for the full run, $%.4f estimated\n",
+			s.Model, s.Usage.Cost, s.Usage.PromptTokens, s.Usage.CompletionTokens, projected, estimated[s.Model])
+	}
+	return sb.String()
+}
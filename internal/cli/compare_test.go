@@ -0,0 +1,101 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/openai/openai-go"
+)
+
+func TestProcessWithClient_CompareModels(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "compare_test.txt")
+	var lines []string
+	for i := range 5 {
+		lines = append(lines, fmt.Sprintf("line %d with a few words of content", i))
+	}
+	if err := os.WriteFile(testFile, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	mock := &mockChatGenerator{
+		requestFunc: func(params openai.ChatCompletionNewParams) string {
+			return fmt.Sprintf("%s kept %s", params.Model, userContent(params))
+		},
+		usage: openai.CompletionUsage{PromptTokens: 100000, CompletionTokens: 10000},
+	}
+
+	var stdout, log bytes.Buffer
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.ChunkSize = 10
+	opts.CompareModels = []Model{ModelGPT5Nano, ModelGPT5Mini}
+	opts.CompareSample = 2
+	opts.Stdout = &stdout
+	opts.Log = &log
+
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	// Two chunks spread over the five, for each model
+	if mock.callCount != 4 {
+		t.Errorf("Expected 4 API calls, got %d", mock.callCount)
+	}
+
+	report := stdout.String()
+	for _, want := range []string{
+		"=== Chunk 1 input ===\nline 0 with a few words of content\n",
+		"=== Chunk 1 gpt-5-nano ===\ngpt-5-nano kept line 0",
+		"=== Chunk 1 gpt-5-mini ===\ngpt-5-mini kept line 0",
+		"=== Chunk 3 gpt-5-nano ===\ngpt-5-nano kept line 2",
+		"=== Chunk 3 gpt-5-mini ===\ngpt-5-mini kept line 2",
+		"gpt-5-nano: $0.0180 for the sample (200000 prompt + 20000 completion tokens)",
+		"gpt-5-mini: $0.0900 for the sample (200000 prompt + 20000 completion tokens)",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("Expected the report to contain %q, got:\n%s", want, report)
+		}
+	}
+
+	// Nothing is cached nor combined
+	if _, err := os.Stat(combinedFilePath(testFile)); !os.IsNotExist(err) {
+		t.Errorf("Expected no combined output, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "compare_test_chunks")); !os.IsNotExist(err) {
+		t.Errorf("Expected no chunk directory, got %v", err)
+	}
+
+	// An empty or unknown model is rejected before any request
+	for _, models := range [][]Model{{ModelGPT5Nano, ""}, {ModelGPT5Nano, "gpt-unknown"}} {
+		mock.callCount = 0
+		opts.CompareModels = models
+		err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts)
+		if !errors.Is(err, ErrInvalidConfig) || mock.callCount != 0 {
+			t.Errorf("Expected %q to be rejected up front, got %v after %d calls", models, err, mock.callCount)
+		}
+	}
+}
+
+func TestSampleChunkIndexes(t *testing.T) {
+	tests := []struct {
+		total, n int
+		want     string
+	}{
+		{10, 3, "[0 3 6]"},
+		{2, 3, "[0 1]"},
+		{5, 1, "[0]"},
+		{0, 3, "[]"},
+	}
+	for _, tt := range tests {
+		if got := fmt.Sprint(sampleChunkIndexes(tt.total, tt.n)); got != tt.want {
+			t.Errorf("sampleChunkIndexes(%d, %d) = %s, want %s", tt.total, tt.n, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	myopenai "github.com/clems4ever/big-context/internal/openai"
+)
+
+// processDirectory processes each file at the top level of a directory. The
+// chunk directories created next to the files are never descended into.
+func processDirectory(ctx context.Context, client myopenai.ChatGenerator, prompt, dirPath string, opts Options) error {
+	out := &syncWriter{w: opts.log()}
+
+	files, err := listInputFiles(out, dirPath, opts.Extensions)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Found %d files to process in %s\n", len(files), dirPath)
+
+	skipped, err := processFiles(ctx, client, out, prompt, files, opts)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "\n=== Processed %d files in %s, %d skipped as up to date ===\n", len(files)-skipped, dirPath, skipped)
+	return nil
+}
+
+// processFiles processes the files of a batch in turn, skipping the ones whose
+// outputs are up to date, and returns the number of files skipped.
+func processFiles(ctx context.Context, client myopenai.ChatGenerator, out io.Writer, prompt string, files []string, opts Options) (int, error) {
+	skipped := 0
+	for i, file := range files {
+		if deadlineReached(ctx) {
+			fmt.Fprintf(out, "\nDeadline of %s reached: %d files not processed\n", opts.Deadline, len(files)-i)
+			break
+		}
+
+		filePrompt, override, err := promptOverride(opts.PromptOverridesDir, file)
+		if err != nil {
+			return skipped, err
+		}
+		if override == "" {
+			filePrompt = prompt
+		}
+
+		// Resume an interrupted batch where it stopped
+		if !opts.Force && !opts.PrefetchOnly && outputsUpToDate(file, filePrompt, opts) {
+			fmt.Fprintf(out, "Skipping %s: the combined output is up to date (use --force to reprocess)\n", file)
+			skipped++
+			continue
+		}
+
+		fmt.Fprintf(out, "\n=== Processing %s (%d/%d) ===\n", file, i+1, len(files))
+		if override != "" {
+			fmt.Fprintf(out, "Using the prompt override %s\n", override)
+		}
+		if err := processFile(ctx, client, filePrompt, file, opts); err != nil {
+			return skipped, fmt.Errorf("failed to process %s: %w", file, err)
+		}
+	}
+	return skipped, nil
+}
+
+// outputsUpToDate tells whether the combined outputs of a file, one per task
+// if any, exist, are more recent than the file and were written by a complete
+// run with the prompt, model and request settings of this one.
+func outputsUpToDate(file, prompt string, opts Options) bool {
+	input, err := os.Stat(file)
+	if err != nil {
+		return false
+	}
+
+	runs := []Task{{Prompt: prompt}}
+	if len(opts.Tasks) > 0 {
+		runs = opts.Tasks
+	}
+	for _, run := range runs {
+		output, label := combinedFilePath(file), opts.CacheLabel
+		if run.Name != "" {
+			output, label = taskCombinedFilePath(file, run.Name), taskCacheLabel(opts.CacheLabel, run.Name)
+		}
+		for _, path := range opts.outputPaths(opts.combinedOutputPath(output)) {
+			info, err := os.Stat(path)
+			if err != nil || info.ModTime().Before(input.ModTime()) {
+				return false
+			}
+		}
+		if !cacheUpToDate(file, label, run.Prompt, opts) {
+			return false
+		}
+	}
+	return true
+}
+
+// cacheUpToDate tells whether the manifest of the cache records the prompt,
+// model and request settings of the run and its checkpoint a complete run.
+func cacheUpToDate(file, label, prompt string, opts Options) bool {
+	chunkDir, err := chunkDirPath(file, label)
+	if err != nil {
+		return false
+	}
+	meta, err := loadCacheMeta(chunkDir)
+	if err != nil || meta == nil {
+		return false
+	}
+	if meta.Prompt != chunkPrompt(prompt, opts) || meta.Model != opts.Model || meta.recorded() != newRequestSettings(opts).recorded() {
+		return false
+	}
+	complete, err := runComplete(chunkDir)
+	return err == nil && complete
+}
+
+// promptOverride returns the prompt of <dir>/<file name>.txt and its path when
+// it exists, e.g. prompts/notes.md.txt for notes.md.
+func promptOverride(dir, file string) (string, string, error) {
+	if dir == "" {
+		return "", "", nil
+	}
+
+	path := filepath.Join(dir, filepath.Base(file)+".txt")
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", "", nil
+		}
+		return "", "", fmt.Errorf("failed to read prompt override: %w", err)
+	}
+
+	prompt := strings.TrimSpace(string(b))
+	if prompt == "" {
+		return "", "", fmt.Errorf("prompt override %s is empty", path)
+	}
+	return prompt, path, nil
+}
+
+// listInputFiles returns the regular files of a directory with one of the
+// allowed extensions, or any extension when none is given. The outputs of
+// previous runs are never considered inputs.
+func listInputFiles(out io.Writer, dirPath string, extensions []string) ([]string, error) {
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return nil, withCategory(ErrInput, fmt.Errorf("failed to read directory: %w", err))
+	}
+
+	allowed := make(map[string]bool, len(extensions))
+	for _, ext := range extensions {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext != "" && !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		allowed[ext] = true
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+
+		name := entry.Name()
+		if isGeneratedOutput(name) {
+			continue
+		}
+
+		if len(allowed) > 0 && !allowed[strings.ToLower(filepath.Ext(name))] {
+			fmt.Fprintf(out, "Skipping %s: extension not allowed\n", name)
+			continue
+		}
+
+		files = append(files, filepath.Join(dirPath, name))
+	}
+
+	return files, nil
+}
+
+// isGeneratedOutput tells whether a file was written by a previous run.
+func isGeneratedOutput(name string) bool {
+	return strings.HasSuffix(name, ".combined_results.txt") || strings.HasSuffix(name, ".combined_results.txt.bak") ||
+		strings.HasSuffix(name, ".combined_results.json") || strings.HasSuffix(name, ".combined_results.json.bak") ||
+		strings.HasSuffix(name, ".combined_results.partial.txt") || partPattern.MatchString(name) ||
+		strings.HasSuffix(name, ".explanations.txt") || strings.HasSuffix(name, ".citations.jsonl") ||
+		strings.HasSuffix(name, ".side_by_side.txt")
+}
@@ -0,0 +1,187 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProcessWithClient_DirectoryExtensionAllowlist(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"notes.txt":   "text notes",
+		"readme.MD":   "markdown readme",
+		"image.png":   "not really an image",
+		"archive.bin": "binary data",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	var log bytes.Buffer
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.Extensions = []string{".txt", "md"}
+	opts.Log = &log
+
+	mock := &mockChatGenerator{}
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", tmpDir, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	var processed []string
+	for _, params := range mock.params {
+		processed = append(processed, strings.TrimSpace(userContent(params)))
+	}
+	sort.Strings(processed)
+	if strings.Join(processed, ",") != "markdown readme,text notes" {
+		t.Errorf("Expected only the .txt and .md files to be processed, got %v", processed)
+	}
+
+	for _, name := range []string{"notes.combined_results.txt", "readme.combined_results.txt"} {
+		if _, err := os.Stat(filepath.Join(tmpDir, name)); err != nil {
+			t.Errorf("Expected combined output %s: %v", name, err)
+		}
+	}
+	for _, name := range []string{"image.png", "archive.bin"} {
+		if !strings.Contains(log.String(), "Skipping "+name) {
+			t.Errorf("Expected %s to be reported as skipped", name)
+		}
+	}
+
+	// The outputs of the first run are not processed as inputs on a rerun
+	opts.Extensions = nil
+	for _, name := range []string{"notes.explanations.txt", "notes.citations.jsonl", "notes.combined_results.part2.txt"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte("generated"), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+	rerun := &mockChatGenerator{}
+	if err := ProcessWithClientOptions(context.Background(), rerun, "test prompt", tmpDir, opts); err != nil {
+		t.Fatalf("Rerun failed: %v", err)
+	}
+	if rerun.callCount != 2 {
+		t.Errorf("Expected only the png and bin files to be sent on the rerun, got %d calls", rerun.callCount)
+	}
+}
+
+func TestProcessWithClient_DirectoryPromptOverrides(t *testing.T) {
+	tmpDir := t.TempDir()
+	for name, content := range map[string]string{"a.txt": "alpha", "b.txt": "beta", "c.txt": "gamma"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+	promptsDir := filepath.Join(tmpDir, "prompts")
+	if err := os.Mkdir(promptsDir, 0755); err != nil {
+		t.Fatalf("Failed to create prompts directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(promptsDir, "b.txt.txt"), []byte("override prompt\n"), 0644); err != nil {
+		t.Fatalf("Failed to create prompt override: %v", err)
+	}
+
+	var log bytes.Buffer
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.PromptOverridesDir = promptsDir
+	opts.Log = &log
+
+	mock := &mockChatGenerator{}
+	if err := ProcessWithClientOptions(context.Background(), mock, "global prompt", tmpDir, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	prompts := make(map[string]string)
+	for _, params := range mock.params {
+		prompts[strings.TrimSpace(userContent(params))] = systemContent(params)
+	}
+	if len(prompts) != 3 {
+		t.Fatalf("Expected the 3 files to be processed, got %v", prompts)
+	}
+	for content, prefix := range map[string]string{"alpha": "global prompt", "beta": "override prompt", "gamma": "global prompt"} {
+		if !strings.HasPrefix(prompts[content], prefix) {
+			t.Errorf("Expected %q to be processed with %q, got %q", content, prefix, prompts[content])
+		}
+	}
+	if !strings.Contains(log.String(), "Using the prompt override "+filepath.Join(promptsDir, "b.txt.txt")) {
+		t.Errorf("Expected the override to be reported, got:\n%s", log.String())
+	}
+}
+
+func TestProcessWithClient_DirectoryResume(t *testing.T) {
+	tmpDir := t.TempDir()
+	for name, content := range map[string]string{"a.txt": "alpha", "b.txt": "beta", "c.txt": "gamma"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	var log bytes.Buffer
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.Log = &log
+
+	// a.txt completed, b.txt was edited since its output was written
+	if err := ProcessWithClientOptions(context.Background(), &mockChatGenerator{}, "test prompt", filepath.Join(tmpDir, "a.txt"), opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+	past := time.Now().Add(-time.Hour)
+	for name, mtime := range map[string]time.Time{"a.combined_results.txt": time.Now(), "b.combined_results.txt": past} {
+		path := filepath.Join(tmpDir, name)
+		if err := os.WriteFile(path, []byte("previous output"), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatalf("Failed to set the time of %s: %v", name, err)
+		}
+	}
+
+	mock := &mockChatGenerator{}
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", tmpDir, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	var processed []string
+	for _, params := range mock.params {
+		processed = append(processed, strings.TrimSpace(userContent(params)))
+	}
+	sort.Strings(processed)
+	if strings.Join(processed, ",") != "beta,gamma" {
+		t.Errorf("Expected only the stale and missing outputs to be processed, got %v", processed)
+	}
+	if !strings.Contains(log.String(), "Processed 2 files in "+tmpDir+", 1 skipped as up to date") {
+		t.Errorf("Expected the processed and skipped counts, got:\n%s", log.String())
+	}
+	if content, _ := os.ReadFile(filepath.Join(tmpDir, "a.combined_results.txt")); string(content) != "previous output" {
+		t.Errorf("Expected the up to date output to be kept, got %q", string(content))
+	}
+
+	// An output written with another model is not up to date, its cache is
+	// refused instead
+	opts.Model = ModelGPT5Mini
+	err := ProcessWithClientOptions(context.Background(), &mockChatGenerator{}, "test prompt", tmpDir, opts)
+	if err == nil || !strings.Contains(err.Error(), "another prompt, model or request settings") {
+		t.Errorf("Expected the output written with another model to be reprocessed, got %v", err)
+	}
+	opts.Model = DefaultOptions().Model
+
+	// Forcing reprocesses every file
+	opts.Force = true
+	forced := &mockChatGenerator{}
+	if err := ProcessWithClientOptions(context.Background(), forced, "test prompt", tmpDir, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+	if content, _ := os.ReadFile(filepath.Join(tmpDir, "a.combined_results.txt")); string(content) == "previous output" {
+		t.Error("Expected the output of a.txt to be rewritten when forced")
+	}
+	if forced.callCount != 0 {
+		t.Errorf("Expected every file to be served from the cache, got %d calls", forced.callCount)
+	}
+}
@@ -0,0 +1,41 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/openai/openai-go"
+)
+
+// echoCacheLabel returns the cache label of an echo run so that the echoed
+// results never serve a run with the model, nested under the label of the run
+// if any.
+func echoCacheLabel(label string) string {
+	if label == "" {
+		return "echo"
+	}
+	return label + "-echo"
+}
+
+// checkEcho rejects the options that call the model besides the chunks, or
+// that can't interpret a chunk as its result.
+func checkEcho(opts Options) error {
+	if opts.Scored || opts.OutputSchema != nil || opts.Justify {
+		return invalidConfig(fmt.Errorf("echo mode cannot be combined with scored mode, an output schema or justified lines"))
+	}
+	if opts.AutoPrompt || opts.RunningContext || opts.ReducePrompt != "" || opts.Citations {
+		return invalidConfig(fmt.Errorf("echo mode cannot be combined with an automatic prompt, a running context, a reduce prompt or citations"))
+	}
+	return nil
+}
+
+// echoCompletion is the response of a chunk in echo mode: the chunk as it
+// appears in the input, without usage.
+func (p *processor) echoCompletion(chunk string) *openai.ChatCompletion {
+	return &openai.ChatCompletion{
+		Model: string(p.opts.Model),
+		Choices: []openai.ChatCompletionChoice{{
+			FinishReason: "stop",
+			Message:      openai.ChatCompletionMessage{Content: p.wholeLines(chunk)},
+		}},
+	}
+}
@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProcessWithClient_Echo(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "echo_test.txt")
+	var input strings.Builder
+	for i := range 200 {
+		fmt.Fprintf(&input, "line %d of a large input\n", i)
+	}
+	if err := os.WriteFile(testFile, []byte(input.String()), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	var log bytes.Buffer
+	opts := DefaultOptions()
+	opts.ChunkSize = 100
+	opts.Echo = true
+	opts.Log = &log
+
+	mock := &mockChatGenerator{}
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	if mock.callCount != 0 {
+		t.Errorf("Expected no API call, got %d", mock.callCount)
+	}
+	combined, err := os.ReadFile(combinedFilePath(testFile))
+	if err != nil {
+		t.Fatalf("Failed to read combined output: %v", err)
+	}
+	if string(combined) != input.String() {
+		t.Errorf("Expected the combined output to be the input, got:\n%s", combined)
+	}
+
+	// The echoed results are cached apart from the ones of the model
+	if _, err := os.Stat(filepath.Join(tmpDir, "echo_test", "echo", "result1.txt")); err != nil {
+		t.Errorf("Expected the echoed results under the echo label: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "echo_test", "result1.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected no result in the cache of the model, got %v", err)
+	}
+}
+
+func TestProcessWithClient_EchoRejectsModelCalls(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "echo_test.txt")
+	if err := os.WriteFile(testFile, []byte("Some content"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.Echo = true
+	opts.ReducePrompt = "summarize"
+	opts.Log = &bytes.Buffer{}
+
+	mock := &mockChatGenerator{}
+	err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts)
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("Expected an invalid config error, got %v", err)
+	}
+	if mock.callCount != 0 {
+		t.Errorf("Expected no API call, got %d", mock.callCount)
+	}
+}
@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ErrEmptyPrompt is returned when the prompt composed in the editor is empty.
+var ErrEmptyPrompt = errors.New("empty prompt, aborting")
+
+// editorTemplate is shown in the editor below the prompt being composed.
+const editorTemplate = `
+# Write the prompt applied to each chunk. Lines starting with '#' are
+# ignored and an empty prompt aborts the run.
+`
+
+// runEditor opens the file in the editor and waits for it to exit. It is a
+// variable so that tests can stub the editor.
+var runEditor = func(editor, path string) error {
+	// The editor may come with arguments, e.g. "code --wait"
+	args := strings.Fields(editor)
+	cmd := exec.Command(args[0], append(args[1:], path)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// editorCommand returns the editor of the user, like git does.
+func editorCommand() string {
+	for _, name := range []string{"VISUAL", "EDITOR"} {
+		if editor := strings.TrimSpace(os.Getenv(name)); editor != "" {
+			return editor
+		}
+	}
+	return "vi"
+}
+
+// EditPrompt composes the prompt in the editor of the user, like a git commit
+// message.
+func EditPrompt() (string, error) {
+	f, err := os.CreateTemp("", "mapred-llm-prompt-*.txt")
+	if err != nil {
+		return "", fmt.Errorf("failed to create prompt file: %w", err)
+	}
+	path := f.Name()
+	defer os.Remove(path)
+
+	_, err = f.WriteString(editorTemplate)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to write prompt file: %w", err)
+	}
+
+	editor := editorCommand()
+	if err := runEditor(editor, path); err != nil {
+		return "", fmt.Errorf("failed to run editor %q: %w", editor, err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read prompt file: %w", err)
+	}
+
+	var lines []string
+	for _, line := range strings.Split(string(b), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	prompt := strings.TrimSpace(strings.Join(lines, "\n"))
+	if prompt == "" {
+		return "", ErrEmptyPrompt
+	}
+	return prompt, nil
+}
+
+// IsTerminal tells whether the file is an interactive terminal.
+func IsTerminal(f *os.File) bool {
+	return isTerminal(f)
+}
@@ -0,0 +1,74 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// stubEditor replaces the editor with one writing the text before the
+// template, restored at the end of the test.
+func stubEditor(t *testing.T, text string) {
+	t.Helper()
+	previous := runEditor
+	t.Cleanup(func() { runEditor = previous })
+
+	runEditor = func(editor, path string) error {
+		template, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(path, append([]byte(text), template...), 0644)
+	}
+}
+
+func TestEditPrompt(t *testing.T) {
+	stubEditor(t, "Keep the lines\nmentioning fruits\n# not part of the prompt\n")
+
+	prompt, err := EditPrompt()
+	if err != nil {
+		t.Fatalf("EditPrompt failed: %v", err)
+	}
+	if prompt != "Keep the lines\nmentioning fruits" {
+		t.Errorf("Unexpected prompt %q", prompt)
+	}
+
+	// The composed prompt is the one applied to the chunks
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "editor_test.txt")
+	if err := os.WriteFile(testFile, []byte("apple\ncarrot"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	mock := &mockChatGenerator{}
+	if err := ProcessWithClientOptions(context.Background(), mock, prompt, testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+	if !strings.HasPrefix(systemContent(mock.params[0]), "Keep the lines\nmentioning fruits\n") {
+		t.Errorf("Expected the composed prompt to be sent, got %q", systemContent(mock.params[0]))
+	}
+}
+
+func TestEditPrompt_Empty(t *testing.T) {
+	stubEditor(t, "\n# only comments\n")
+
+	if _, err := EditPrompt(); !errors.Is(err, ErrEmptyPrompt) {
+		t.Errorf("Expected ErrEmptyPrompt, got %v", err)
+	}
+}
+
+func TestEditorCommand(t *testing.T) {
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", "nano -w")
+	if got := editorCommand(); got != "nano -w" {
+		t.Errorf("Expected $EDITOR, got %q", got)
+	}
+	t.Setenv("VISUAL", "code --wait")
+	if got := editorCommand(); got != "code --wait" {
+		t.Errorf("Expected $VISUAL to take precedence, got %q", got)
+	}
+}
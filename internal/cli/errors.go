@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"context"
+	"errors"
+)
+
+// Error categories. The errors returned by the package wrap the category they
+// fall in, so that callers can branch on the kind of failure with errors.Is
+// while the underlying error stays reachable with errors.Is and errors.As.
+var (
+	// ErrInput is the category of the failures to read the input.
+	ErrInput = errors.New("input error")
+	// ErrTokenizer is the category of the failures of the tokenizer.
+	ErrTokenizer = errors.New("tokenizer error")
+	// ErrAPI is the category of the failures of the requests to the model,
+	// once the retries are exhausted, and of its unusable responses.
+	ErrAPI = errors.New("API error")
+	// ErrBudgetExceeded is the category of the runs stopped because they
+	// would exceed one of their limits.
+	ErrBudgetExceeded = errors.New("budget exceeded")
+	// ErrInvalidConfig is the category of the invalid options.
+	ErrInvalidConfig = errors.New("invalid configuration")
+)
+
+// categoryError puts an error in a category without changing its message.
+type categoryError struct {
+	category error
+	err      error
+}
+
+func (e *categoryError) Error() string {
+	return e.err.Error()
+}
+
+func (e *categoryError) Unwrap() []error {
+	return []error{e.category, e.err}
+}
+
+// withCategory puts err in the category, nil stays nil.
+func withCategory(category, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &categoryError{category: category, err: err}
+}
+
+// invalidConfig puts err in the ErrInvalidConfig category.
+func invalidConfig(err error) error {
+	return withCategory(ErrInvalidConfig, err)
+}
+
+// apiError puts the failure of a request in the ErrAPI category, unless the
+// run was cancelled.
+func apiError(err error) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return withCategory(ErrAPI, err)
+}
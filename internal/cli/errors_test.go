@@ -0,0 +1,142 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/openai/openai-go"
+)
+
+func TestErrorCategories(t *testing.T) {
+	writeInput := func(t *testing.T) string {
+		path := filepath.Join(t.TempDir(), "input.txt")
+		if err := os.WriteFile(path, []byte(strings.Repeat("word ", 3000)), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+		return path
+	}
+	options := func(configure func(*Options)) Options {
+		opts := DefaultOptions()
+		opts.RequireConfirmation = false
+		opts.Log = &bytes.Buffer{}
+		if configure != nil {
+			configure(&opts)
+		}
+		return opts
+	}
+
+	tests := []struct {
+		name     string
+		run      func(t *testing.T) error
+		category error
+		cause    error
+	}{
+		{
+			name: "missing input",
+			run: func(t *testing.T) error {
+				missing := filepath.Join(t.TempDir(), "missing.txt")
+				return ProcessWithClientOptions(context.Background(), &mockChatGenerator{}, "test prompt", missing, options(nil))
+			},
+			category: ErrInput,
+			cause:    fs.ErrNotExist,
+		},
+		{
+			name: "API failure",
+			run: func(t *testing.T) error {
+				mock := &mockChatGenerator{
+					errorFunc: func(callCount int) error {
+						return newAPIError(http.StatusBadRequest)
+					},
+				}
+				return ProcessWithClientOptions(context.Background(), mock, "test prompt", writeInput(t), options(nil))
+			},
+			category: ErrAPI,
+		},
+		{
+			name: "too many chunks",
+			run: func(t *testing.T) error {
+				return ProcessWithClientOptions(context.Background(), &mockChatGenerator{}, "test prompt", writeInput(t), options(func(opts *Options) {
+					opts.MaxChunks = 1
+				}))
+			},
+			category: ErrBudgetExceeded,
+			cause:    ErrTooManyChunks,
+		},
+		{
+			name: "incompatible options",
+			run: func(t *testing.T) error {
+				return ProcessWithClientOptions(context.Background(), &mockChatGenerator{}, "test prompt", writeInput(t), options(func(opts *Options) {
+					opts.Scored = true
+					opts.Justify = true
+				}))
+			},
+			category: ErrInvalidConfig,
+		},
+		{
+			name: "missing API key",
+			run: func(t *testing.T) error {
+				return ProcessWithOptions(context.Background(), "", "test prompt", writeInput(t), options(nil))
+			},
+			category: ErrInvalidConfig,
+			cause:    ErrMissingAPIKey,
+		},
+		{
+			name: "unknown policy",
+			run: func(t *testing.T) error {
+				_, err := ParseSchedule("random")
+				return err
+			},
+			category: ErrInvalidConfig,
+		},
+	}
+
+	categories := []error{ErrInput, ErrTokenizer, ErrAPI, ErrBudgetExceeded, ErrInvalidConfig}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.run(t)
+			if err == nil {
+				t.Fatal("Expected an error")
+			}
+			for _, category := range categories {
+				if got, expected := errors.Is(err, category), category == tt.category; got != expected {
+					t.Errorf("errors.Is(%q, %v) = %v, expected %v", err, category, got, expected)
+				}
+			}
+			if tt.cause != nil && !errors.Is(err, tt.cause) {
+				t.Errorf("Expected %q to wrap %v", err, tt.cause)
+			}
+		})
+	}
+}
+
+func TestErrorCategories_KeepTheUnderlyingError(t *testing.T) {
+	apiErr := newAPIError(http.StatusBadRequest)
+	err := apiError(apiErr)
+	if err.Error() != apiErr.Error() {
+		t.Errorf("Expected the message to be unchanged, got %q", err)
+	}
+	var target *openai.Error
+	if !errors.As(err, &target) || target.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected the API error to be reachable with errors.As, got %v", err)
+	}
+
+	err = withCategory(ErrTokenizer, errors.New("failed to get tokenizer"))
+	if !errors.Is(err, ErrTokenizer) || err.Error() != "failed to get tokenizer" {
+		t.Errorf("Expected a tokenizer error with its message unchanged, got %q", err)
+	}
+
+	// A cancelled run is not a failure of the API
+	if errors.Is(apiError(context.Canceled), ErrAPI) {
+		t.Error("Expected a cancellation not to be an API error")
+	}
+	if withCategory(ErrAPI, nil) != nil {
+		t.Error("Expected no error to stay nil")
+	}
+}
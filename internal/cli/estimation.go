@@ -1,7 +1,11 @@
 package cli
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
+	"sort"
 
 	"github.com/tiktoken-go/tokenizer"
 )
@@ -10,31 +14,250 @@ type TokenEstimation struct {
 	TokensCount int
 }
 
+// Estimation is the machine-readable estimation of a run printed by the estimate-only mode.
+type Estimation struct {
+	File   string            `json:"file"`
+	Bytes  int               `json:"bytes"`
+	Tokens int               `json:"tokens"`
+	Chunks int               `json:"chunks"`
+	Costs  map[Model]float64 `json:"costs"`
+	// Comparison lists the estimated cost of the run with each model, cheapest first.
+	Comparison []ModelCost `json:"comparison"`
+}
+
+// ModelCost is the estimated cost of a run with a model, the output tokens
+// being estimated from the input ones with the expected output ratio.
+type ModelCost struct {
+	Model      Model   `json:"model"`
+	InputCost  float64 `json:"input_cost"`
+	OutputCost float64 `json:"output_cost"`
+	Cost       float64 `json:"cost"`
+	Note       string  `json:"note"`
+}
+
+// modelNotes is a rough note on the quality of each model to help choosing.
+var modelNotes = map[Model]string{
+	ModelGPT5Nano: "fastest and cheapest, fine for simple filtering",
+	ModelGPT5Mini: "balanced, better at nuanced instructions",
+	ModelGPT5:     "strongest reasoning, for complex extraction",
+	ModelGPT51:    "latest flagship, for complex extraction",
+}
+
+// compareModels estimates the cost of processing the tokens with each model,
+// sorted by increasing cost.
+func compareModels(tokens int, outputRatio float64) []ModelCost {
+	comparison := make([]ModelCost, 0, len(modelCosts))
+	outputTokens := float64(tokens) * outputRatio
+	for model, costPerMillion := range modelCosts {
+		inputCost := float64(tokens) * costPerMillion / 1000000
+		outputCost := outputTokens * modelOutputCosts[model] / 1000000
+		comparison = append(comparison, ModelCost{
+			Model:      model,
+			InputCost:  inputCost,
+			OutputCost: outputCost,
+			Cost:       inputCost + outputCost,
+			Note:       modelNotes[model],
+		})
+	}
+
+	sort.Slice(comparison, func(i, j int) bool {
+		if comparison[i].Cost != comparison[j].Cost {
+			return comparison[i].Cost < comparison[j].Cost
+		}
+		return comparison[i].Model < comparison[j].Model
+	})
+	return comparison
+}
+
+// DirectoryEstimation is the aggregate estimation of the files of a directory.
+type DirectoryEstimation struct {
+	Directory string            `json:"directory"`
+	Files     []Estimation      `json:"files"`
+	Bytes     int               `json:"bytes"`
+	Tokens    int               `json:"tokens"`
+	Chunks    int               `json:"chunks"`
+	Costs     map[Model]float64 `json:"costs"`
+	// Comparison lists the estimated cost of the run with each model, cheapest first.
+	Comparison []ModelCost `json:"comparison"`
+}
+
+// EstimateDirectory sums the estimations of the files processed in directory mode.
+func EstimateDirectory(dirPath string, opts Options) (DirectoryEstimation, error) {
+	files, err := listInputFiles(io.Discard, dirPath, opts.Extensions)
+	if err != nil {
+		return DirectoryEstimation{}, err
+	}
+
+	total := DirectoryEstimation{
+		Directory: dirPath,
+		Files:     make([]Estimation, 0, len(files)),
+		Costs:     make(map[Model]float64, len(modelCosts)),
+	}
+	for _, file := range files {
+		estimation, err := Estimate(file, opts)
+		if err != nil {
+			return DirectoryEstimation{}, fmt.Errorf("failed to estimate %s: %w", file, err)
+		}
+
+		total.Files = append(total.Files, estimation)
+		total.Bytes += estimation.Bytes
+		total.Tokens += estimation.Tokens
+		total.Chunks += estimation.Chunks
+		for model, cost := range estimation.Costs {
+			total.Costs[model] += cost
+		}
+	}
+	total.Comparison = compareModels(total.Tokens, opts.ExpectedOutputRatio)
+	return total, nil
+}
+
+// Estimate computes the tokens, chunks and per-model input costs of a file
+// without printing anything nor touching the filesystem beyond reading it.
+func Estimate(filePath string, opts Options) (Estimation, error) {
+	b, err := os.ReadFile(filePath)
+	if err != nil {
+		return Estimation{}, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	text, _ := normalizeMixedLineEndings(string(b))
+	if opts.NormalizeUnicode {
+		text = normalizeUnicode(text)
+	}
+	enc, err := tokenizer.Get(tokenizer.Cl100kBase)
+	if err != nil {
+		return Estimation{}, withCategory(ErrTokenizer, fmt.Errorf("failed to get tokenizer: %w", err))
+	}
+	tokenCount := countTokens(enc, text)
+
+	chunks, err := splitChunks(text, opts)
+	if err != nil {
+		return Estimation{}, fmt.Errorf("failed to split into chunks: %w", err)
+	}
+
+	costs := make(map[Model]float64, len(modelCosts))
+	for model, costPerMillion := range modelCosts {
+		costs[model] = float64(tokenCount) * costPerMillion / 1000000
+	}
+
+	return Estimation{
+		File:   filePath,
+		Bytes:  len(b),
+		Tokens: tokenCount,
+		Chunks: len(chunks),
+		Costs:  costs,
+
+		Comparison: compareModels(tokenCount, opts.ExpectedOutputRatio),
+	}, nil
+}
+
+// writeEstimation prints the estimation of a file, or the aggregate one of a
+// directory, as JSON.
+func writeEstimation(w io.Writer, filePath string, opts Options) error {
+	var estimation any
+	var err error
+	if info, statErr := os.Stat(filePath); statErr == nil && info.IsDir() {
+		estimation, err = EstimateDirectory(filePath, opts)
+	} else {
+		estimation, err = Estimate(filePath, opts)
+	}
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(estimation)
+}
+
 func estimateTokens(text string) (TokenEstimation, error) {
 	// Count tokens using cl100k_base encoding (used by GPT-4, GPT-3.5-turbo)
 	enc, err := tokenizer.Get(tokenizer.Cl100kBase)
 	if err != nil {
-		return TokenEstimation{}, fmt.Errorf("failed to get tokenizer: %w", err)
+		return TokenEstimation{}, withCategory(ErrTokenizer, fmt.Errorf("failed to get tokenizer: %w", err))
 	}
 
 	// Convert bytes to string and encode
 	tokens, _, _ := enc.Encode(text)
 	tokenCount := len(tokens)
-	fmt.Printf("Text size: %d bytes\n", len(text))
-	fmt.Printf("Token count: %d tokens\n", tokenCount)
-
-	// Show costs for all supported models
-	fmt.Println("Estimated costs (input tokens):")
-	for model, costPerMillion := range modelCosts {
-		cost := float64(tokenCount) * costPerMillion / 1000000
-		fmt.Printf("  %s: $%.4f\n", model, cost)
-	}
 
 	return TokenEstimation{
 		TokensCount: tokenCount,
 	}, nil
 }
 
+// printEstimation shows the size of the text and compares its cost with all
+// the supported models, the selected one being marked with a star.
+func printEstimation(w io.Writer, text string, estimation TokenEstimation, opts Options) {
+	fmt.Fprintf(w, "Text size: %d bytes\n", len(text))
+	fmt.Fprintf(w, "Token count: %d tokens\n", estimation.TokensCount)
+
+	fmt.Fprintf(w, "Estimated costs (input tokens + output tokens at %.0f%% of the input), cheapest first:\n", opts.ExpectedOutputRatio*100)
+	for _, row := range compareModels(estimation.TokensCount, opts.ExpectedOutputRatio) {
+		marker := " "
+		if row.Model == opts.Model {
+			marker = "*"
+		}
+		fmt.Fprintf(w, " %s %-12s $%.4f (input $%.4f + output $%.4f)  %s\n", marker, row.Model, row.Cost, row.InputCost, row.OutputCost, row.Note)
+	}
+}
+
+// autoPromptTokens is the estimated size of the request and of the answer of
+// the prompt expansion.
+const autoPromptTokens = 500
+
+// runningContextTokens is the estimated size of the running summary, asked
+// to fit in 200 words.
+const runningContextTokens = 300
+
+// estimatedRunCost returns the estimated cost in USD of sending the tokens,
+// split into the given number of chunks, to the model of the run, once per
+// task if any with its own output ratio and billing the output of every
+// completion of a request. The prompt expansion, the running context updates
+// and the reduce step, whose input is the expected output of the chunks, are
+// added when requested.
+func estimatedRunCost(tokens, chunks int, opts Options) float64 {
+	if len(opts.Tasks) > 0 {
+		cost := 0.0
+		for _, task := range opts.Tasks {
+			taskOpts := opts
+			taskOpts.Tasks = nil
+			taskOpts.ExpectedOutputRatio = task.OutputRatio
+			cost += estimatedRunCost(tokens, chunks, taskOpts)
+		}
+		return cost
+	}
+
+	input := float64(tokens)
+	output := input * opts.ExpectedOutputRatio
+	cost := (input*modelCosts[opts.Model] + output*float64(max(opts.Choices, 1))*modelOutputCosts[opts.Model]) / 1000000
+
+	if opts.AutoPrompt {
+		cost += usageCost(opts.Model, autoPromptTokens, autoPromptTokens)
+	}
+	if opts.RunningContext {
+		summaries := int64(chunks * runningContextTokens)
+		cost += usageCost(opts.Model, int64(tokens)+summaries, summaries)
+	}
+	if opts.ReducePrompt != "" || opts.Citations {
+		cost += usageCost(opts.reduceModel(), int64(output), int64(output*opts.ExpectedOutputRatio))
+	}
+	return cost
+}
+
+// usageCost returns the cost in USD of the given token usage with a model.
+func usageCost(model Model, promptTokens, completionTokens int64) float64 {
+	return (float64(promptTokens)*modelCosts[model] + float64(completionTokens)*modelOutputCosts[model]) / 1000000
+}
+
+// checkPricedModel refuses a model whose cost is unknown, its usage would be
+// accounted as free. What names the model in the error, e.g. "reduce model".
+func checkPricedModel(what string, model Model) error {
+	if _, ok := modelCosts[model]; !ok {
+		return invalidConfig(fmt.Errorf("unknown %s %q: its cost is not known", what, model))
+	}
+	return nil
+}
+
 // Cost per million tokens (input) in USD
 var modelCosts = map[Model]float64{
 	ModelGPT5Nano: 0.05, // $0.05 per 1M tokens
@@ -42,3 +265,11 @@ var modelCosts = map[Model]float64{
 	ModelGPT5:     1.25, // $1.25 per 1M tokens
 	ModelGPT51:    1.25, // $1.25 per 1M tokens
 }
+
+// Cost per million tokens (output) in USD
+var modelOutputCosts = map[Model]float64{
+	ModelGPT5Nano: 0.40,  // $0.40 per 1M tokens
+	ModelGPT5Mini: 2.00,  // $2.00 per 1M tokens
+	ModelGPT5:     10.00, // $10.00 per 1M tokens
+	ModelGPT51:    10.00, // $10.00 per 1M tokens
+}
@@ -1,6 +1,13 @@
 package cli
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -142,3 +149,254 @@ func TestTokenEstimationConsistency(t *testing.T) {
 			result1.TokensCount, result2.TokensCount)
 	}
 }
+
+func TestProcessWithClient_EstimateOnly(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "estimate_test.txt")
+	testContent := strings.Repeat("word ", 3000)
+	if err := os.WriteFile(testFile, []byte(testContent), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	var stdout bytes.Buffer
+	opts := DefaultOptions()
+	opts.EstimateOnly = true
+	opts.Stdout = &stdout
+
+	mock := &mockChatGenerator{}
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	if mock.callCount != 0 {
+		t.Errorf("Expected no API calls, got %d", mock.callCount)
+	}
+
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		t.Fatalf("Failed to read temp directory: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected only the input file to exist, got %d entries", len(entries))
+	}
+
+	var estimation Estimation
+	if err := json.Unmarshal(stdout.Bytes(), &estimation); err != nil {
+		t.Fatalf("Expected JSON on stdout, got %q: %v", stdout.String(), err)
+	}
+
+	if estimation.Bytes != len(testContent) {
+		t.Errorf("Expected %d bytes, got %d", len(testContent), estimation.Bytes)
+	}
+	if estimation.Tokens < 2900 || estimation.Tokens > 3100 {
+		t.Errorf("Unexpected token count %d", estimation.Tokens)
+	}
+	if estimation.Chunks < 2 {
+		t.Errorf("Expected at least 2 chunks, got %d", estimation.Chunks)
+	}
+	for model, costPerMillion := range modelCosts {
+		expected := float64(estimation.Tokens) * costPerMillion / 1000000
+		if estimation.Costs[model] != expected {
+			t.Errorf("Expected cost %f for %s, got %f", expected, model, estimation.Costs[model])
+		}
+	}
+	if len(estimation.Comparison) != len(modelCosts) {
+		t.Errorf("Expected the comparison of the %d models, got %d", len(modelCosts), len(estimation.Comparison))
+	}
+}
+
+func TestProcessWithClient_EstimateOnlyDirectory(t *testing.T) {
+	tmpDir := t.TempDir()
+	fixtures := map[string]string{
+		"small.txt":  "a few words",
+		"medium.txt": strings.Repeat("word ", 1500),
+		"large.md":   strings.Repeat("another line of text\n", 500),
+	}
+	for name, content := range fixtures {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	var stdout bytes.Buffer
+	opts := DefaultOptions()
+	opts.EstimateOnly = true
+	opts.Stdout = &stdout
+
+	mock := &mockChatGenerator{}
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", tmpDir, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+	if mock.callCount != 0 {
+		t.Errorf("Expected no API calls, got %d", mock.callCount)
+	}
+
+	var total DirectoryEstimation
+	if err := json.Unmarshal(stdout.Bytes(), &total); err != nil {
+		t.Fatalf("Expected JSON on stdout, got %q: %v", stdout.String(), err)
+	}
+	if len(total.Files) != len(fixtures) {
+		t.Fatalf("Expected %d files, got %d", len(fixtures), len(total.Files))
+	}
+
+	var bytesSum, tokensSum, chunksSum int
+	costsSum := make(map[Model]float64)
+	for name := range fixtures {
+		estimation, err := Estimate(filepath.Join(tmpDir, name), opts)
+		if err != nil {
+			t.Fatalf("Estimate failed: %v", err)
+		}
+		bytesSum += estimation.Bytes
+		tokensSum += estimation.Tokens
+		chunksSum += estimation.Chunks
+		for model, cost := range estimation.Costs {
+			costsSum[model] += cost
+		}
+	}
+
+	if total.Bytes != bytesSum || total.Tokens != tokensSum || total.Chunks != chunksSum {
+		t.Errorf("Expected %d bytes, %d tokens and %d chunks, got %d, %d and %d",
+			bytesSum, tokensSum, chunksSum, total.Bytes, total.Tokens, total.Chunks)
+	}
+	for model, cost := range costsSum {
+		if diff := total.Costs[model] - cost; diff > 1e-12 || diff < -1e-12 {
+			t.Errorf("Expected cost %f for %s, got %f", cost, model, total.Costs[model])
+		}
+	}
+}
+
+func TestCompareModels(t *testing.T) {
+	comparison := compareModels(1000000, 0.5)
+
+	if len(comparison) != len(modelCosts) {
+		t.Fatalf("Expected %d models, got %d", len(modelCosts), len(comparison))
+	}
+
+	seen := make(map[Model]bool)
+	for i, row := range comparison {
+		seen[row.Model] = true
+
+		inputCost := modelCosts[row.Model]
+		outputCost := modelOutputCosts[row.Model] / 2
+		if math.Abs(row.InputCost-inputCost) > 1e-9 || math.Abs(row.OutputCost-outputCost) > 1e-9 {
+			t.Errorf("%s: expected $%f + $%f, got $%f + $%f", row.Model, inputCost, outputCost, row.InputCost, row.OutputCost)
+		}
+		if math.Abs(row.Cost-(inputCost+outputCost)) > 1e-9 {
+			t.Errorf("%s: expected a total of $%f, got $%f", row.Model, inputCost+outputCost, row.Cost)
+		}
+		if row.Note == "" {
+			t.Errorf("%s: expected a quality note", row.Model)
+		}
+		if i > 0 && row.Cost < comparison[i-1].Cost {
+			t.Errorf("Expected the comparison sorted by cost, %s ($%f) comes after %s ($%f)", row.Model, row.Cost, comparison[i-1].Model, comparison[i-1].Cost)
+		}
+	}
+	for model := range modelCosts {
+		if !seen[model] {
+			t.Errorf("Expected %s in the comparison", model)
+		}
+	}
+	if comparison[0].Model != ModelGPT5Nano {
+		t.Errorf("Expected %s to be the cheapest, got %s", ModelGPT5Nano, comparison[0].Model)
+	}
+}
+
+func TestPrintEstimation_ComparesModels(t *testing.T) {
+	var out bytes.Buffer
+	opts := DefaultOptions()
+	opts.Model = ModelGPT5Mini
+	printEstimation(&out, "some text", TokenEstimation{TokensCount: 1000000}, opts)
+
+	for _, row := range compareModels(1000000, opts.ExpectedOutputRatio) {
+		marker := " "
+		if row.Model == ModelGPT5Mini {
+			marker = "*"
+		}
+		expected := fmt.Sprintf(" %s %-12s $%.4f", marker, row.Model, row.Cost)
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("Expected %q in the estimation, got:\n%s", expected, out.String())
+		}
+	}
+}
+
+func TestProcessWithClient_ConfirmAbove(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "confirm_test.txt")
+	if err := os.WriteFile(testFile, []byte(strings.Repeat("word ", 2000)), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	prompts := 0
+	original := readConfirmation
+	t.Cleanup(func() { readConfirmation = original })
+	readConfirmation = func() string {
+		prompts++
+		return "no"
+	}
+
+	tests := []struct {
+		name         string
+		threshold    float64
+		expectPrompt bool
+	}{
+		{name: "below the threshold", threshold: 1, expectPrompt: false},
+		{name: "above the threshold", threshold: 0.00001, expectPrompt: true},
+		{name: "no threshold", threshold: 0, expectPrompt: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prompts = 0
+			var log bytes.Buffer
+			opts := DefaultOptions()
+			opts.ConfirmAbove = tt.threshold
+			opts.IfExists = IfExistsOverwrite
+			opts.Log = &log
+
+			mock := &mockChatGenerator{}
+			if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+				t.Fatalf("ProcessWithClientOptions failed: %v", err)
+			}
+
+			if prompted := prompts > 0; prompted != tt.expectPrompt {
+				t.Errorf("Expected prompted=%v, got %v:\n%s", tt.expectPrompt, prompted, log.String())
+			}
+			if prompted := strings.Contains(log.String(), "Do you want to proceed"); prompted != tt.expectPrompt {
+				t.Errorf("Expected the question to be printed=%v, got:\n%s", tt.expectPrompt, log.String())
+			}
+			// The prompted runs are declined
+			if processed := mock.callCount > 0; processed == tt.expectPrompt {
+				t.Errorf("Expected processed=%v, got %d API calls", !tt.expectPrompt, mock.callCount)
+			}
+		})
+	}
+}
+
+func TestEstimatedRunCost_AccountsForEveryRequest(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Model = ModelGPT5Mini
+	opts.ExpectedOutputRatio = 0.5
+	base := estimatedRunCost(1000000, 10, opts)
+	if expected := usageCost(ModelGPT5Mini, 1000000, 500000); math.Abs(base-expected) > 1e-9 {
+		t.Errorf("Expected $%.4f for the chunks alone, got $%.4f", expected, base)
+	}
+
+	tests := []struct {
+		name      string
+		configure func(*Options)
+		extra     float64
+	}{
+		{name: "choices", configure: func(o *Options) { o.Choices = 3 }, extra: usageCost(ModelGPT5Mini, 0, 1000000)},
+		{name: "auto prompt", configure: func(o *Options) { o.AutoPrompt = true }, extra: usageCost(ModelGPT5Mini, autoPromptTokens, autoPromptTokens)},
+		{name: "running context", configure: func(o *Options) { o.RunningContext = true }, extra: usageCost(ModelGPT5Mini, 1000000+10*runningContextTokens, 10*runningContextTokens)},
+		{name: "reduce prompt", configure: func(o *Options) { o.ReducePrompt = "merge"; o.ReduceModel = ModelGPT5 }, extra: usageCost(ModelGPT5, 500000, 250000)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configured := opts
+			tt.configure(&configured)
+			if got := estimatedRunCost(1000000, 10, configured); math.Abs(got-base-tt.extra) > 1e-9 {
+				t.Errorf("Expected $%.4f more than $%.4f, got $%.4f", tt.extra, base, got)
+			}
+		})
+	}
+}
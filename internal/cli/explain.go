@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// writeExplanation prints in plain language what a run would do with the
+// file, or each file of a directory, without running it.
+func writeExplanation(w io.Writer, filePath string, opts Options) error {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	if !info.IsDir() {
+		return explainFile(w, filePath, opts)
+	}
+
+	files, err := listInputFiles(io.Discard, filePath, opts.Extensions)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Process the %d files at the top level of %s, one after the other:\n\n", len(files), filePath)
+	for _, file := range files {
+		if err := explainFile(w, file, opts); err != nil {
+			return fmt.Errorf("failed to explain %s: %w", file, err)
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
+
+// explainFile prints the plan of the run of a single file.
+func explainFile(w io.Writer, filePath string, opts Options) error {
+	estimation, err := Estimate(filePath, opts)
+	if err != nil {
+		return err
+	}
+	chunkDir, err := chunkDirPath(filePath, opts.CacheLabel)
+	if err != nil {
+		return err
+	}
+
+	// Explaining never writes to the cache
+	readOnly := opts
+	readOnly.CacheReadOnly = true
+	store, err := openCacheStore(chunkDir, readOnly)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	cached := 0
+	for i := 0; i < estimation.Chunks; i++ {
+		if store.Has("result", i) {
+			cached++
+		}
+	}
+
+	average := 0
+	if estimation.Chunks > 0 {
+		average = estimation.Tokens / estimation.Chunks
+	}
+	parallel := concurrencyFor(opts.Model, opts.Concurrency)
+	if opts.RunningContext || opts.Sequential {
+		parallel = 1
+	}
+
+	fmt.Fprintf(w, "Plan for %s:\n", filePath)
+	fmt.Fprintf(w, "1. Read %s (%d bytes) and count ~%d tokens.\n", filePath, estimation.Bytes, estimation.Tokens)
+	fmt.Fprintf(w, "2. Split it into %d chunks of up to %d tokens (~%d tokens on average).\n", estimation.Chunks, opts.chunkSize(), average)
+	fmt.Fprintf(w, "3. Call %s ~%d times, one request per chunk not cached yet (%d cached), up to %d at a time, for an estimated input cost of $%.4f.\n",
+		opts.Model, estimation.Chunks-cached, cached, parallel, estimation.Costs[opts.Model])
+	fmt.Fprintf(w, "4. Cache the chunk results in %s/ so that an interrupted run resumes where it stopped.\n", chunkDir)
+	if opts.ReducePrompt != "" {
+		fmt.Fprintf(w, "5. Synthesize the chunk results with one more call to %s and write the output to %s.\n", opts.reduceModel(), opts.combinedOutputPath(combinedFilePath(filePath)))
+	} else {
+		fmt.Fprintf(w, "5. Combine the chunk results and write them to %s.\n", opts.combinedOutputPath(combinedFilePath(filePath)))
+	}
+	fmt.Fprintln(w, "Nothing was run: remove --explain to proceed.")
+	return nil
+}
@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProcessWithClient_Explain(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "explain_test.txt")
+	content := strings.Repeat("word ", 3000)
+	if err := os.WriteFile(testFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	var stdout bytes.Buffer
+	opts := DefaultOptions()
+	opts.Explain = true
+	opts.Stdout = &stdout
+
+	mock := &mockChatGenerator{}
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	if mock.callCount != 0 {
+		t.Errorf("Expected no API call, got %d", mock.callCount)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "explain_test")); !os.IsNotExist(err) {
+		t.Error("Expected no chunk directory to be created")
+	}
+
+	estimation, err := Estimate(testFile, opts)
+	if err != nil {
+		t.Fatalf("Estimate failed: %v", err)
+	}
+
+	explanation := stdout.String()
+	for _, expected := range []string{
+		fmt.Sprintf("(%d bytes) and count ~%d tokens", len(content), estimation.Tokens),
+		fmt.Sprintf("Split it into %d chunks of up to %d tokens", estimation.Chunks, defaultChunkSize),
+		fmt.Sprintf("Call %s ~%d times", ModelGPT5Nano, estimation.Chunks),
+		fmt.Sprintf("$%.4f", estimation.Costs[ModelGPT5Nano]),
+		filepath.Join(tmpDir, "explain_test") + "/",
+		filepath.Join(tmpDir, "explain_test.combined_results.txt"),
+	} {
+		if !strings.Contains(explanation, expected) {
+			t.Errorf("Expected the explanation to contain %q, got:\n%s", expected, explanation)
+		}
+	}
+}
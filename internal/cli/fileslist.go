@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	myopenai "github.com/clems4ever/big-context/internal/openai"
+)
+
+// processFileList processes each file listed in Options.FilesFrom with the
+// prompt. The missing files are reported and skipped, or fail the batch
+// before any request when Options.Strict is set.
+func processFileList(ctx context.Context, client myopenai.ChatGenerator, prompt string, opts Options) error {
+	out := &syncWriter{w: opts.log()}
+
+	files, missing, err := readFileList(out, opts.FilesFrom)
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 && opts.Strict {
+		return withCategory(ErrInput, fmt.Errorf("%d files listed in %s are missing: %s", len(missing), opts.FilesFrom, strings.Join(missing, ", ")))
+	}
+	fmt.Fprintf(out, "Found %d files to process in %s\n", len(files), opts.FilesFrom)
+
+	skipped, err := processFiles(ctx, client, out, prompt, files, opts)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "\n=== Processed %d files listed in %s, %d skipped as up to date, %d missing ===\n", len(files)-skipped, opts.FilesFrom, skipped, len(missing))
+	return nil
+}
+
+// readFileList returns the files listed one per line in listPath, relative
+// to its directory unless absolute, and the listed paths that are not
+// regular files. Blank lines and lines starting with # are ignored.
+func readFileList(out io.Writer, listPath string) ([]string, []string, error) {
+	f, err := os.Open(listPath)
+	if err != nil {
+		return nil, nil, withCategory(ErrInput, fmt.Errorf("failed to read file list: %w", err))
+	}
+	defer f.Close()
+
+	var files, missing []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		path := line
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(listPath), path)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			fmt.Fprintf(out, "Warning: skipping %s: %v\n", line, err)
+			missing = append(missing, line)
+			continue
+		}
+		if !info.Mode().IsRegular() {
+			fmt.Fprintf(out, "Warning: skipping %s: not a regular file\n", line)
+			missing = append(missing, line)
+			continue
+		}
+		files = append(files, path)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, withCategory(ErrInput, fmt.Errorf("failed to read file list: %w", err))
+	}
+	return files, missing, nil
+}
@@ -0,0 +1,101 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// writeFileList writes the fixtures of a batch in their own directory and a
+// list referencing them, with a comment and a missing file.
+func writeFileList(t *testing.T) (string, string) {
+	t.Helper()
+	tmpDir := t.TempDir()
+	fixtures := filepath.Join(tmpDir, "fixtures")
+	if err := os.MkdirAll(fixtures, 0755); err != nil {
+		t.Fatalf("Failed to create fixtures directory: %v", err)
+	}
+	for name, content := range map[string]string{
+		"first.txt":  "first file",
+		"second.log": "second file",
+		"third.md":   "third file",
+	} {
+		if err := os.WriteFile(filepath.Join(fixtures, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	list := strings.Join([]string{
+		"# nightly batch",
+		"fixtures/first.txt",
+		"",
+		"fixtures/missing.txt",
+		"  fixtures/second.log  ",
+		filepath.Join(fixtures, "third.md"),
+	}, "\n")
+	listPath := filepath.Join(tmpDir, "list.txt")
+	if err := os.WriteFile(listPath, []byte(list), 0644); err != nil {
+		t.Fatalf("Failed to create file list: %v", err)
+	}
+	return listPath, fixtures
+}
+
+func TestProcessWithClient_FilesFrom(t *testing.T) {
+	listPath, fixtures := writeFileList(t)
+
+	var log bytes.Buffer
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.FilesFrom = listPath
+	opts.Log = &log
+
+	mock := &mockChatGenerator{}
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", "", opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	var processed []string
+	for _, params := range mock.params {
+		processed = append(processed, strings.TrimSpace(userContent(params)))
+	}
+	sort.Strings(processed)
+	if strings.Join(processed, ",") != "first file,second file,third file" {
+		t.Errorf("Expected every listed file to be processed, got %v", processed)
+	}
+
+	for _, name := range []string{"first.combined_results.txt", "second.combined_results.txt", "third.combined_results.txt"} {
+		if _, err := os.Stat(filepath.Join(fixtures, name)); err != nil {
+			t.Errorf("Expected combined output %s: %v", name, err)
+		}
+	}
+	if !strings.Contains(log.String(), "Warning: skipping fixtures/missing.txt") {
+		t.Errorf("Expected the missing file to be reported, got:\n%s", log.String())
+	}
+	if !strings.Contains(log.String(), "Processed 3 files listed in "+listPath+", 0 skipped as up to date, 1 missing") {
+		t.Errorf("Expected the batch summary, got:\n%s", log.String())
+	}
+}
+
+func TestProcessWithClient_FilesFromStrict(t *testing.T) {
+	listPath, _ := writeFileList(t)
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.FilesFrom = listPath
+	opts.Strict = true
+	opts.Log = &bytes.Buffer{}
+
+	mock := &mockChatGenerator{}
+	err := ProcessWithClientOptions(context.Background(), mock, "test prompt", "", opts)
+	if !errors.Is(err, ErrInput) || !strings.Contains(err.Error(), "fixtures/missing.txt") {
+		t.Fatalf("Expected the missing file to fail the batch, got %v", err)
+	}
+	if mock.callCount != 0 {
+		t.Errorf("Expected no request, got %d", mock.callCount)
+	}
+}
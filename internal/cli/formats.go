@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// OutputFormat is a format the combined output is written in.
+type OutputFormat string
+
+// Output formats
+const (
+	// OutputText writes the combined results as is, e.g. to
+	// <file>.combined_results.txt.
+	OutputText OutputFormat = "text"
+	// OutputJSON writes the combined results along with the result of each
+	// chunk, e.g. to <file>.combined_results.json.
+	OutputJSON OutputFormat = "json"
+)
+
+// ParseOutputFormats parses a comma-separated list of output formats, e.g.
+// text,json.
+func ParseOutputFormats(s string) ([]OutputFormat, error) {
+	var formats []OutputFormat
+	for _, name := range strings.Split(s, ",") {
+		switch format := OutputFormat(strings.TrimSpace(name)); format {
+		case OutputText, OutputJSON:
+			if !slices.Contains(formats, format) {
+				formats = append(formats, format)
+			}
+		default:
+			return nil, invalidConfig(fmt.Errorf("unknown output format %q (expected text or json)", name))
+		}
+	}
+	return formats, nil
+}
+
+// writesFormat tells whether the combined output is written in the format,
+// only as text unless configured otherwise.
+func (o Options) writesFormat(format OutputFormat) bool {
+	if len(o.OutputFormats) == 0 {
+		return format == OutputText
+	}
+	return slices.Contains(o.OutputFormats, format)
+}
+
+// formatFilePath returns the path of the combined output in the format, the
+// text one being the combined output path itself.
+func formatFilePath(combinedFileName string, format OutputFormat) string {
+	if format == OutputText {
+		return combinedFileName
+	}
+	return strings.TrimSuffix(combinedFileName, filepath.Ext(combinedFileName)) + "." + string(format)
+}
+
+// outputPaths returns the paths of the combined output in each of its formats.
+func (o Options) outputPaths(combinedFileName string) []string {
+	var paths []string
+	for _, format := range []OutputFormat{OutputText, OutputJSON} {
+		if o.writesFormat(format) {
+			paths = append(paths, formatFilePath(combinedFileName, format))
+		}
+	}
+	return paths
+}
+
+// jsonOutput is the combined output in the JSON format: the same output as
+// the text one, without the header, and the results it was combined from.
+type jsonOutput struct {
+	Model  Model        `json:"model"`
+	Prompt string       `json:"prompt"`
+	Output string       `json:"output"`
+	Chunks []jsonResult `json:"chunks"`
+}
+
+type jsonResult struct {
+	Chunk   int      `json:"chunk"`
+	Content string   `json:"content"`
+	Score   *float64 `json:"score,omitempty"`
+	Cached  bool     `json:"cached"`
+	Refusal string   `json:"refusal,omitempty"`
+}
+
+// formatJSONOutput returns the JSON format of the combined output reduced
+// from the results.
+func formatJSONOutput(output string, results []chunkResult, prompt string, opts Options) ([]byte, error) {
+	doc := jsonOutput{
+		Model:  opts.Model,
+		Prompt: prompt,
+		Output: output,
+		Chunks: make([]jsonResult, len(results)),
+	}
+	for k, result := range results {
+		doc.Chunks[k] = jsonResult{
+			Chunk:   opts.chunkNumber(result.Index),
+			Content: result.Content,
+			Cached:  result.Cached,
+			Refusal: result.Refusal,
+		}
+		if opts.Scored {
+			score := result.Score
+			doc.Chunks[k].Score = &score
+		}
+	}
+
+	b, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal JSON output: %w", err)
+	}
+	return append(b, '\n'), nil
+}
@@ -0,0 +1,94 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/openai/openai-go"
+)
+
+func TestProcessWithClient_OutputFormats(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "formats_test.txt")
+	var lines []string
+	for i := range 3 {
+		lines = append(lines, fmt.Sprintf("line %d with a few words of content", i))
+	}
+	if err := os.WriteFile(testFile, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.ChunkSize = 10
+	opts.OutputFormats = []OutputFormat{OutputText, OutputJSON}
+
+	mock := &mockChatGenerator{
+		requestFunc: func(params openai.ChatCompletionNewParams) string {
+			return "kept " + userContent(params) + "\n"
+		},
+	}
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	text, err := os.ReadFile(filepath.Join(tmpDir, "formats_test.combined_results.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read text output: %v", err)
+	}
+	b, err := os.ReadFile(filepath.Join(tmpDir, "formats_test.combined_results.json"))
+	if err != nil {
+		t.Fatalf("Failed to read JSON output: %v", err)
+	}
+	var doc jsonOutput
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatalf("Failed to parse JSON output: %v", err)
+	}
+
+	if doc.Output != string(text) {
+		t.Errorf("Expected the JSON output to match the text one %q, got %q", text, doc.Output)
+	}
+	if doc.Model != opts.Model || !strings.HasPrefix(doc.Prompt, "test prompt") {
+		t.Errorf("Expected the model and prompt of the run, got %s and %q", doc.Model, doc.Prompt)
+	}
+	if len(doc.Chunks) != 3 {
+		t.Fatalf("Expected 3 chunks, got %d", len(doc.Chunks))
+	}
+	var combined strings.Builder
+	for k, chunk := range doc.Chunks {
+		if chunk.Chunk != k+1 || chunk.Content != "kept "+lines[k]+"\n" {
+			t.Errorf("Unexpected chunk %d: %+v", k, chunk)
+		}
+		combined.WriteString(chunk.Content)
+	}
+	if combined.String() != string(text) {
+		t.Errorf("Expected the chunks to combine into the text output, got %q", combined.String())
+	}
+}
+
+func TestParseOutputFormats(t *testing.T) {
+	formats, err := ParseOutputFormats("text, json,text")
+	if err != nil || fmt.Sprint(formats) != "[text json]" {
+		t.Errorf("ParseOutputFormats = %v, %v", formats, err)
+	}
+	for _, s := range []string{"xml", "", "text,"} {
+		if _, err := ParseOutputFormats(s); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("ParseOutputFormats(%q): expected an invalid config error, got %v", s, err)
+		}
+	}
+}
+
+func TestFormatFilePath(t *testing.T) {
+	if got := formatFilePath("report.combined_results.txt", OutputJSON); got != "report.combined_results.json" {
+		t.Errorf("Expected report.combined_results.json, got %s", got)
+	}
+	if got := formatFilePath("summary", OutputJSON); got != "summary.json" {
+		t.Errorf("Expected summary.json, got %s", got)
+	}
+}
@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// Version is the version of the tool, set at build time with
+// -ldflags "-X github.com/clems4ever/big-context/internal/cli.Version=v1.2.3".
+var Version = ""
+
+// toolVersion returns the version of the tool, falling back to the module
+// version recorded in the binary.
+func toolVersion() string {
+	if Version != "" {
+		return Version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "dev"
+}
+
+// outputHeader returns a comment block, every line starting with "#",
+// recording how the combined output was produced. It ends with a blank line.
+func outputHeader(prompt string, model Model, chunkSize int, now time.Time) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# mapred-llm %s\n", toolVersion())
+	fmt.Fprintf(&sb, "# generated: %s\n", now.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&sb, "# model: %s\n", model)
+	fmt.Fprintf(&sb, "# chunk size: %d\n", chunkSize)
+	for i, line := range strings.Split(prompt, "\n") {
+		if i == 0 {
+			fmt.Fprintf(&sb, "# prompt: %s\n", line)
+		} else {
+			fmt.Fprintf(&sb, "#   %s\n", line)
+		}
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
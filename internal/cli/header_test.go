@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOutputHeader(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 30, 0, 0, time.UTC)
+	header := outputHeader("first line\nsecond line", ModelGPT5, 1500, now)
+
+	expected := "# mapred-llm " + toolVersion() + "\n" +
+		"# generated: 2025-03-01T12:30:00Z\n" +
+		"# model: gpt-5\n" +
+		"# chunk size: 1500\n" +
+		"# prompt: first line\n" +
+		"#   second line\n" +
+		"\n"
+	if header != expected {
+		t.Errorf("Expected header:\n%s\ngot:\n%s", expected, header)
+	}
+}
+
+func TestProcessWithClient_OutputHeader(t *testing.T) {
+	for _, withHeader := range []bool{true, false} {
+		tmpDir := t.TempDir()
+		testFile := filepath.Join(tmpDir, "header_test.txt")
+		if err := os.WriteFile(testFile, []byte("Some content"), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+
+		opts := DefaultOptions()
+		opts.RequireConfirmation = false
+		opts.OutputHeader = withHeader
+
+		mock := &mockChatGenerator{responseFunc: func(int) string { return "kept line" }}
+		if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+			t.Fatalf("ProcessWithClientOptions failed: %v", err)
+		}
+
+		content, err := os.ReadFile(filepath.Join(tmpDir, "header_test.combined_results.txt"))
+		if err != nil {
+			t.Fatalf("Failed to read combined results: %v", err)
+		}
+
+		if !withHeader {
+			if string(content) != "kept line" {
+				t.Errorf("Expected no header, got %q", string(content))
+			}
+			continue
+		}
+
+		for _, field := range []string{"# mapred-llm ", "# generated: ", "# model: gpt-5-nano\n", "# chunk size: 2000\n", "# prompt: test prompt\n"} {
+			if !strings.Contains(string(content), field) {
+				t.Errorf("Expected the header to contain %q, got:\n%s", field, content)
+			}
+		}
+		if !strings.HasSuffix(string(content), "\n\nkept line") {
+			t.Errorf("Expected the results after the header, got:\n%s", content)
+		}
+	}
+}
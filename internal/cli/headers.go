@@ -0,0 +1,20 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseHeaders parses request headers given as key=value pairs.
+func ParseHeaders(pairs []string) (map[string]string, error) {
+	headers := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, invalidConfig(fmt.Errorf("invalid header %q: expected key=value", pair))
+		}
+		headers[key] = strings.TrimSpace(value)
+	}
+	return headers, nil
+}
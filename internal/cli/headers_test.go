@@ -0,0 +1,20 @@
+package cli
+
+import "testing"
+
+func TestParseHeaders(t *testing.T) {
+	headers, err := ParseHeaders([]string{"OpenAI-Beta=assistants=v2", " Api-Version = 2024-10-21"})
+	if err != nil {
+		t.Fatalf("ParseHeaders failed: %v", err)
+	}
+	if headers["OpenAI-Beta"] != "assistants=v2" {
+		t.Errorf("Expected the value to be split on the first '=', got %q", headers["OpenAI-Beta"])
+	}
+	if headers["Api-Version"] != "2024-10-21" {
+		t.Errorf("Expected trimmed header, got %q", headers["Api-Version"])
+	}
+
+	if _, err := ParseHeaders([]string{"missing-value"}); err == nil {
+		t.Error("Expected an error for a header without '='")
+	}
+}
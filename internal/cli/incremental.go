@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// syncedWriter is a file whose writes can be flushed to stable storage.
+type syncedWriter interface {
+	io.WriteCloser
+	Sync() error
+}
+
+// openIncrementalFile creates the file receiving the incremental output,
+// replaced in tests.
+var openIncrementalFile = func(path string, perm os.FileMode) (syncedWriter, error) {
+	return os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+}
+
+// incrementalFilePath returns the path of the incremental output next to the
+// combined output, e.g. report.combined_results.partial.txt.
+func incrementalFilePath(combinedFileName string) string {
+	return strings.TrimSuffix(combinedFileName, ".txt") + ".partial.txt"
+}
+
+// incrementalOutput appends the results to a file in the order of the input
+// as they complete, syncing it every few results so that the progress of a
+// long run survives a crash. The results completed after a chunk still in
+// flight wait for it in memory and are not in the file if the run crashes
+// or that chunk fails, the rerun reading them from the cache.
+type incrementalOutput struct {
+	w syncedWriter
+	// every is the number of results written between syncs, never synced
+	// when zero.
+	every    int
+	unsynced int
+	// next is the index of the next result to write, the later ones wait
+	// in pending.
+	next    int
+	pending map[int]string
+}
+
+func newIncrementalOutput(path string, every int, perm os.FileMode) (*incrementalOutput, error) {
+	w, err := openIncrementalFile(path, perm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create incremental output: %w", err)
+	}
+	return &incrementalOutput{w: w, every: every, pending: make(map[int]string)}, nil
+}
+
+// Add writes the result of chunk i once the results before it are written.
+func (o *incrementalOutput) Add(i int, content string) error {
+	o.pending[i] = content
+	for {
+		content, ok := o.pending[o.next]
+		if !ok {
+			return nil
+		}
+		delete(o.pending, o.next)
+		o.next++
+
+		if _, err := io.WriteString(o.w, content); err != nil {
+			return fmt.Errorf("failed to write incremental output: %w", err)
+		}
+		o.unsynced++
+		if o.every > 0 && o.unsynced >= o.every {
+			if err := o.w.Sync(); err != nil {
+				return fmt.Errorf("failed to sync incremental output: %w", err)
+			}
+			o.unsynced = 0
+		}
+	}
+}
+
+// Close syncs the results written since the last sync and closes the file.
+func (o *incrementalOutput) Close() error {
+	if o.every > 0 && o.unsynced > 0 {
+		if err := o.w.Sync(); err != nil {
+			o.w.Close()
+			return fmt.Errorf("failed to sync incremental output: %w", err)
+		}
+	}
+	return o.w.Close()
+}
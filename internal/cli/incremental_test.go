@@ -0,0 +1,123 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/openai/openai-go"
+)
+
+// recordingFile records what was written to it when each sync happened.
+type recordingFile struct {
+	bytes.Buffer
+	syncs  []string
+	closed bool
+}
+
+func (f *recordingFile) Sync() error {
+	f.syncs = append(f.syncs, f.String())
+	return nil
+}
+
+func (f *recordingFile) Close() error {
+	f.closed = true
+	return nil
+}
+
+func TestProcessWithClient_IncrementalOutputSyncs(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "incremental_test.txt")
+	var lines []string
+	for i := range 6 {
+		lines = append(lines, fmt.Sprintf("line %d with a few words of content", i))
+	}
+	if err := os.WriteFile(testFile, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	file := &recordingFile{}
+	var openedPath string
+	defer func(open func(string, os.FileMode) (syncedWriter, error)) { openIncrementalFile = open }(openIncrementalFile)
+	openIncrementalFile = func(path string, _ os.FileMode) (syncedWriter, error) {
+		openedPath = path
+		return file, nil
+	}
+
+	mock := &mockChatGenerator{
+		requestFunc: func(params openai.ChatCompletionNewParams) string {
+			return userContent(params) + "\n"
+		},
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.ChunkSize = 10
+	opts.IncrementalOutput = true
+	opts.SyncEvery = 2
+	opts.Log = &bytes.Buffer{}
+
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	if openedPath != filepath.Join(tmpDir, "incremental_test.combined_results.partial.txt") {
+		t.Errorf("Unexpected incremental output path %s", openedPath)
+	}
+	// One sync every two of the six chunks, each one with the results before
+	// it in the order of the input
+	if len(file.syncs) != 3 {
+		t.Fatalf("Expected 3 syncs, got %d", len(file.syncs))
+	}
+	for k, synced := range file.syncs {
+		want := strings.Join(lines[:2*(k+1)], "\n") + "\n"
+		if synced != want {
+			t.Errorf("Sync %d: expected\n%s\ngot\n%s", k+1, want, synced)
+		}
+	}
+	if !file.closed {
+		t.Error("Expected the incremental output to be closed")
+	}
+}
+
+func TestIncrementalOutput_WaitsForEarlierResults(t *testing.T) {
+	file := &recordingFile{}
+	o := &incrementalOutput{w: file, every: 1, pending: make(map[int]string)}
+
+	for _, i := range []int{2, 0, 3, 1} {
+		if err := o.Add(i, fmt.Sprintf("result %d\n", i)); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+	if err := o.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if file.String() != "result 0\nresult 1\nresult 2\nresult 3\n" {
+		t.Errorf("Expected the results in input order, got:\n%s", file.String())
+	}
+	if len(file.syncs) != 4 {
+		t.Errorf("Expected a sync per result, got %d", len(file.syncs))
+	}
+}
+
+func TestIncrementalOutput_FilePermission(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "perm_test.combined_results.partial.txt")
+	output, err := newIncrementalOutput(path, 1, 0600)
+	if err != nil {
+		t.Fatalf("newIncrementalOutput failed: %v", err)
+	}
+	defer output.Close()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat the incremental output: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("Expected the cache file permission 0600, got %o", perm)
+	}
+}
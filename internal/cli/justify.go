@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// justifyPromptSuffix asks the model to justify each line it keeps.
+const justifyPromptSuffix = `
+For each line you keep, answer with a JSON object on its own line of the form {"line": "...", "reason": "..."} where "line" is the kept line unchanged and "reason" briefly justifies keeping it.`
+
+// justifiedLine is a kept line with the reason given by the model.
+type justifiedLine struct {
+	Line   string `json:"line"`
+	Reason string `json:"reason"`
+}
+
+// parseJustifiedLines extracts the kept lines and their reasons from an
+// answer made of one JSON object per line.
+func parseJustifiedLines(raw string) ([]justifiedLine, error) {
+	var lines []justifiedLine
+	for n, text := range strings.Split(raw, "\n") {
+		text = strings.TrimSpace(text)
+		// Models like to wrap JSON in a code fence
+		if text == "" || strings.HasPrefix(text, "```") {
+			continue
+		}
+
+		var line justifiedLine
+		if err := json.Unmarshal([]byte(text), &line); err != nil {
+			return nil, fmt.Errorf("line %d is not a {line, reason} object: %w", n+1, err)
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// explanationsFilePath returns the path of the explanations next to the combined output.
+func explanationsFilePath(combinedFileName string) string {
+	return strings.TrimSuffix(combinedFileName, ".combined_results.txt") + ".explanations.txt"
+}
+
+// formatExplanations lists the kept lines of the results, each followed by
+// its reason. The lines dropped by the output filter are left out.
+func formatExplanations(results []chunkResult, filter *regexp.Regexp) (string, int) {
+	var sb strings.Builder
+	count := 0
+	for _, result := range results {
+		for _, line := range result.Justifications {
+			if filter != nil && !filter.MatchString(line.Line) {
+				continue
+			}
+			fmt.Fprintf(&sb, "%s\n    reason: %s\n", line.Line, line.Reason)
+			count++
+		}
+	}
+	return sb.String(), count
+}
+
+func writeExplanations(path string, results []chunkResult, filter *regexp.Regexp) (int, error) {
+	explanations, count := formatExplanations(results, filter)
+	if err := os.WriteFile(path, []byte(explanations), 0644); err != nil {
+		return 0, fmt.Errorf("failed to write explanations: %w", err)
+	}
+	return count, nil
+}
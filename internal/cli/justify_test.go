@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/openai/openai-go"
+)
+
+func TestParseJustifiedLines(t *testing.T) {
+	lines, err := parseJustifiedLines("```json\n{\"line\": \"apple\", \"reason\": \"a fruit\"}\n\n{\"line\": \"pear\", \"reason\": \"also a fruit\"}\n```\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []justifiedLine{{Line: "apple", Reason: "a fruit"}, {Line: "pear", Reason: "also a fruit"}}
+	if len(lines) != len(expected) || lines[0] != expected[0] || lines[1] != expected[1] {
+		t.Errorf("Expected %v, got %v", expected, lines)
+	}
+
+	lines, err = parseJustifiedLines("")
+	if err != nil || len(lines) != 0 {
+		t.Errorf("Expected no lines for an empty answer, got %v, %v", lines, err)
+	}
+
+	if _, err := parseJustifiedLines("{\"line\": \"apple\", \"reason\": \"a fruit\"}\napple"); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected an error on line 2, got %v", err)
+	}
+}
+
+func TestProcessWithClient_Justify(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "justify_test.txt")
+	if err := os.WriteFile(testFile, []byte("apple\ncarrot\nbanana\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.Justify = true
+
+	var systemPrompt string
+	mock := &mockChatGenerator{
+		requestFunc: func(params openai.ChatCompletionNewParams) string {
+			systemPrompt = systemContent(params)
+			return `{"line": "apple", "reason": "apples are fruits"}` + "\n" +
+				`{"line": "banana", "reason": "bananas are fruits"}` + "\n"
+		},
+	}
+	if err := ProcessWithClientOptions(context.Background(), mock, "keep the fruits", testFile, opts); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+
+	if !strings.Contains(systemPrompt, `{"line": "...", "reason": "..."}`) {
+		t.Errorf("Expected the prompt to ask for {line, reason} pairs, got %q", systemPrompt)
+	}
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, "justify_test.combined_results.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read combined results: %v", err)
+	}
+	if string(content) != "apple\nbanana\n" {
+		t.Errorf("Expected the combined output to keep only the lines, got %q", content)
+	}
+
+	explanations, err := os.ReadFile(filepath.Join(tmpDir, "justify_test.explanations.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read explanations: %v", err)
+	}
+	expected := "apple\n    reason: apples are fruits\nbanana\n    reason: bananas are fruits\n"
+	if string(explanations) != expected {
+		t.Errorf("Expected explanations %q, got %q", expected, explanations)
+	}
+}
@@ -0,0 +1,33 @@
+package cli
+
+import "strings"
+
+// lineEndings counts the line endings of a text.
+type lineEndings struct {
+	CRLF int
+	LF   int
+}
+
+// Mixed tells whether the text uses both \r\n and \n line endings.
+func (l lineEndings) Mixed() bool {
+	return l.CRLF > 0 && l.LF > 0
+}
+
+func detectLineEndings(text string) lineEndings {
+	crlf := strings.Count(text, "\r\n")
+	return lineEndings{
+		CRLF: crlf,
+		LF:   strings.Count(text, "\n") - crlf,
+	}
+}
+
+// normalizeMixedLineEndings converts the \r\n line endings to \n when the text
+// mixes both, since splitting on \n would otherwise leave stray \r on part of
+// the lines. Consistent line endings are kept as-is.
+func normalizeMixedLineEndings(text string) (string, lineEndings) {
+	endings := detectLineEndings(text)
+	if !endings.Mixed() {
+		return text, endings
+	}
+	return strings.ReplaceAll(text, "\r\n", "\n"), endings
+}
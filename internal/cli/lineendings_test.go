@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeMixedLineEndings(t *testing.T) {
+	text, endings := normalizeMixedLineEndings("a\r\nb\nc\r\nd")
+	if !endings.Mixed() || endings.CRLF != 2 || endings.LF != 1 {
+		t.Errorf("Expected 2 CRLF and 1 LF, got %+v", endings)
+	}
+	if text != "a\nb\nc\nd" {
+		t.Errorf("Expected normalized text, got %q", text)
+	}
+
+	// Consistent line endings are left untouched
+	text, endings = normalizeMixedLineEndings("a\r\nb\r\n")
+	if endings.Mixed() || text != "a\r\nb\r\n" {
+		t.Errorf("Expected CRLF-only text to be kept, got %q (%+v)", text, endings)
+	}
+}
+
+func TestProcessWithClient_MixedLineEndings(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "mixed_test.txt")
+	if err := os.WriteFile(testFile, []byte("first line\r\nsecond line\nthird line\r\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	var log bytes.Buffer
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.Log = &log
+
+	mock := &mockChatGenerator{}
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	if !strings.Contains(log.String(), "Warning: the file mixes line endings (2 \\r\\n, 1 \\n)") {
+		t.Errorf("Expected a mixed line endings warning, got:\n%s", log.String())
+	}
+
+	content := userContent(mock.params[0])
+	if strings.Contains(content, "\r") {
+		t.Errorf("Expected no stray \\r in the chunk, got %q", content)
+	}
+	if strings.TrimSpace(content) != "first line\nsecond line\nthird line" {
+		t.Errorf("Unexpected chunk content %q", content)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package cli
+
+import "os"
+
+// lockFile is a no-op where advisory locks are not available: a single
+// process is assumed to write to the file.
+func lockFile(f *os.File) error {
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
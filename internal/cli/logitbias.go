@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tiktoken-go/tokenizer"
+)
+
+// ParseLogitBias parses logit biases given as token=bias pairs, the token
+// being a token ID or a string whose tokens in the encoding of the model all
+// get the bias. The bias ranges from -100 (ban) to 100 (exclusive selection).
+func ParseLogitBias(pairs []string, model Model) (map[string]int64, error) {
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+
+	enc, err := tokenizer.Get(encodingFor(model))
+	if err != nil {
+		return nil, withCategory(ErrTokenizer, fmt.Errorf("failed to get tokenizer: %w", err))
+	}
+
+	biases := make(map[string]int64, len(pairs))
+	for _, pair := range pairs {
+		// The token may contain '=', the bias never does
+		i := strings.LastIndex(pair, "=")
+		if i <= 0 {
+			return nil, invalidConfig(fmt.Errorf("invalid logit bias %q: expected token=bias", pair))
+		}
+		token, value := pair[:i], strings.TrimSpace(pair[i+1:])
+
+		bias, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || bias < -100 || bias > 100 {
+			return nil, invalidConfig(fmt.Errorf("invalid logit bias %q: the bias must be an integer between -100 and 100", pair))
+		}
+
+		if _, err := strconv.ParseUint(token, 10, 32); err == nil {
+			biases[token] = bias
+			continue
+		}
+		ids, _, _ := enc.Encode(token)
+		for _, id := range ids {
+			biases[strconv.FormatUint(uint64(id), 10)] = bias
+		}
+	}
+	return biases, nil
+}
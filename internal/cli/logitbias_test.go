@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/tiktoken-go/tokenizer"
+)
+
+func TestParseLogitBias(t *testing.T) {
+	// The gpt-5 models use o200k_base, cl100k_base IDs would be other tokens
+	enc, err := tokenizer.Get(tokenizer.O200kBase)
+	if err != nil {
+		t.Fatalf("failed to get tokenizer: %v", err)
+	}
+	ids, _, _ := enc.Encode(" maybe")
+	if len(ids) != 1 {
+		t.Fatalf("Expected \" maybe\" to be a single token, got %v", ids)
+	}
+
+	biases, err := ParseLogitBias([]string{"50256=-100", " maybe=-50", "a=b=10"}, ModelGPT5Mini)
+	if err != nil {
+		t.Fatalf("ParseLogitBias failed: %v", err)
+	}
+	if biases["50256"] != -100 {
+		t.Errorf("Expected the token ID to be used as is, got %v", biases)
+	}
+	if biases[strconv.FormatUint(uint64(ids[0]), 10)] != -50 {
+		t.Errorf("Expected \" maybe\" to resolve to token %d, got %v", ids[0], biases)
+	}
+	legacy, err := tokenizer.Get(tokenizer.Cl100kBase)
+	if err != nil {
+		t.Fatalf("failed to get tokenizer: %v", err)
+	}
+	if legacyIDs, _, _ := legacy.Encode(" maybe"); legacyIDs[0] != ids[0] {
+		if _, ok := biases[strconv.FormatUint(uint64(legacyIDs[0]), 10)]; ok {
+			t.Errorf("Expected the cl100k_base token %d not to get the bias, got %v", legacyIDs[0], biases)
+		}
+	}
+	abIDs, _, _ := enc.Encode("a=b")
+	for _, id := range abIDs {
+		if biases[strconv.FormatUint(uint64(id), 10)] != 10 {
+			t.Errorf("Expected the tokens of \"a=b\" to get the bias, got %v", biases)
+		}
+	}
+
+	for _, pair := range []string{"no-bias", "=10", "token=101", "token=high"} {
+		if _, err := ParseLogitBias([]string{pair}, ModelGPT5Mini); err == nil {
+			t.Errorf("Expected an error for %q", pair)
+		}
+	}
+}
+
+func TestProcessWithClient_LogitBias(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "bias_test.txt")
+	if err := os.WriteFile(testFile, []byte("some content"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	biases, err := ParseLogitBias([]string{"1234=5", " maybe=-100"}, ModelGPT5Mini)
+	if err != nil {
+		t.Fatalf("ParseLogitBias failed: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.LogitBias = biases
+
+	mock := &mockChatGenerator{}
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	if len(mock.params) != 1 {
+		t.Fatalf("Expected 1 request, got %d", len(mock.params))
+	}
+	got := mock.params[0].LogitBias
+	if len(got) != len(biases) {
+		t.Fatalf("Expected %v to be forwarded, got %v", biases, got)
+	}
+	for id, bias := range biases {
+		if got[id] != bias {
+			t.Errorf("Expected bias %d for token %s, got %d", bias, id, got[id])
+		}
+	}
+}
@@ -2,12 +2,18 @@ package cli
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	myopenai "github.com/clems4ever/big-context/internal/openai"
 	"github.com/openai/openai-go"
@@ -17,104 +23,668 @@ import (
 )
 
 func Process(ctx context.Context, apiKey string, model Model, prompt, filePath string) error {
-	openaiClient, err := myopenai.NewClient(apiKey, nil)
+	opts := DefaultOptions()
+	opts.Model = model
+	return ProcessWithOptions(ctx, apiKey, prompt, filePath, opts)
+}
+
+// ErrMissingAPIKey is returned when no OpenAI API key is provided for a run
+// that calls the API.
+var ErrMissingAPIKey = invalidConfig(errors.New("missing OpenAI API key, set the OPENAI_API_KEY environment variable"))
+
+// ProcessWithOptions processes a file with the OpenAI API using the given options.
+func ProcessWithOptions(ctx context.Context, apiKey string, prompt, filePath string, opts Options) error {
+	// Estimating, explaining and echoing don't call the API
+	if apiKey == "" && !opts.EstimateOnly && !opts.Explain && !opts.Echo {
+		return ErrMissingAPIKey
+	}
+
+	openaiClient, err := myopenai.NewClient(apiKey, nil, opts.Headers)
 	if err != nil {
 		return fmt.Errorf("failed to instantiate openai client: %w", err)
 	}
 
-	return ProcessWithClient(ctx, openaiClient, model, prompt, filePath, true)
+	return ProcessWithClientOptions(ctx, openaiClient, prompt, filePath, opts)
 }
 
 // ProcessWithClient processes a file with a custom ChatGenerator client.
 // This function is designed for testing and allows injection of mock clients.
 func ProcessWithClient(ctx context.Context, client myopenai.ChatGenerator, model Model, prompt, filePath string, requireConfirmation bool) error {
-	fmt.Printf("File path provided: %s\n", filePath)
+	opts := DefaultOptions()
+	opts.Model = model
+	opts.RequireConfirmation = requireConfirmation
+	return ProcessWithClientOptions(ctx, client, prompt, filePath, opts)
+}
+
+// ErrTooManyChunks is returned before any request when the input splits into
+// more chunks than allowed, in the ErrBudgetExceeded category.
+var ErrTooManyChunks = withCategory(ErrBudgetExceeded, errors.New("too many chunks"))
+
+// ErrEmptyOutput is returned when the combined output is empty and the run
+// is configured to fail in that case.
+var ErrEmptyOutput = errors.New("the combined output is empty")
+
+// errDeadlineReached cancels the requests in flight when Options.Deadline
+// elapses.
+var errDeadlineReached = errors.New("deadline reached")
+
+// deadlineReached tells whether Options.Deadline elapsed.
+func deadlineReached(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), errDeadlineReached)
+}
+
+// processor holds the state shared by all the chunks of a run.
+type processor struct {
+	client   myopenai.ChatGenerator
+	opts     Options
+	chunkDir string
+	// store holds the cached chunks and results of the chunk directory.
+	store cacheStore
+	// prompt is the system prompt of the chunks.
+	prompt  string
+	out     io.Writer
+	breaker *circuitBreaker
+
+	retryableStatuses map[int]bool
+	checkpoint        *checkpointer
+	progress          *progressEmitter
 
+	// stragglers cancels the slow requests at the end of the run.
+	stragglers *stragglerMonitor
+
+	// runningContext is the summary of the chunks processed so far, in
+	// running context mode.
+	runningContext string
+
+	// encoder estimates the prompt tokens of the requests when verifying tokens.
+	encoder tokenizer.Codec
+
+	// flexUnavailable is set once the API rejected the Flex tier, after which
+	// all requests use the default tier.
+	flexUnavailable     atomic.Bool
+	flexUnavailableOnce sync.Once
+}
+
+// serviceTier returns the tier requests are sent with: Flex is cheaper but
+// not available on all accounts and models.
+func (p *processor) serviceTier() openai.ChatCompletionNewParamsServiceTier {
+	if p.flexUnavailable.Load() {
+		return openai.ChatCompletionNewParamsServiceTierDefault
+	}
+	return openai.ChatCompletionNewParamsServiceTierFlex
+}
+
+// disableFlex switches the remaining requests to the default tier.
+func (p *processor) disableFlex() {
+	p.flexUnavailable.Store(true)
+	p.flexUnavailableOnce.Do(func() {
+		fmt.Fprintf(p.out, "Warning: the Flex service tier is not available for %s, falling back to the default tier\n", p.opts.Model)
+	})
+}
+
+// ProcessWithClientOptions processes a file, each file of a directory or the
+// files listed in Options.FilesFrom, with a custom ChatGenerator client and
+// the given options.
+func ProcessWithClientOptions(ctx context.Context, client myopenai.ChatGenerator, prompt, filePath string, opts Options) error {
+	if len(opts.Tasks) > 0 {
+		opts.Tasks, opts.ExpectedOutputRatio = resolveTaskOutputRatios(opts)
+	} else {
+		opts.ExpectedOutputRatio = expectedOutputRatio(opts, prompt)
+	}
+
+	if opts.ResultJSON {
+		return processWithResultJSON(ctx, client, prompt, filePath, opts)
+	}
+
+	// The deadline bounds the whole job: every file and task, the prompt
+	// expansion and the reduce step
+	if opts.Deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, opts.Deadline, errDeadlineReached)
+		defer cancel()
+	}
+
+	if opts.ReduceModel != "" {
+		if err := checkPricedModel("reduce model", opts.ReduceModel); err != nil {
+			return err
+		}
+	}
+	if opts.FilesFrom != "" && (opts.EstimateOnly || opts.Explain) {
+		return invalidConfig(fmt.Errorf("a file list cannot be combined with estimating or explaining a run"))
+	}
+	if opts.Output != "" && !opts.outputIsDir() {
+		if info, err := os.Stat(filePath); opts.FilesFrom != "" || len(opts.Tasks) > 0 || (err == nil && info.IsDir()) {
+			return invalidConfig(fmt.Errorf("the combined outputs of several files or tasks require the output %s to be a directory", opts.Output))
+		}
+	}
+
+	if opts.EstimateOnly {
+		return writeEstimation(opts.stdout(), filePath, opts)
+	}
+	if opts.Explain {
+		return writeExplanation(opts.stdout(), filePath, opts)
+	}
+	if len(opts.CompareModels) > 0 {
+		return writeModelComparison(ctx, client, opts.stdout(), prompt, filePath, opts)
+	}
+
+	if opts.FilesFrom != "" {
+		return processFileList(ctx, client, prompt, opts)
+	}
+	if info, err := os.Stat(filePath); err == nil && info.IsDir() {
+		return processDirectory(ctx, client, prompt, filePath, opts)
+	}
+	return processFile(ctx, client, prompt, filePath, opts)
+}
+
+// readInput reads the file to process from Options.SinceOffset with its line
+// endings and, if requested, its unicode normalized. The size of the file and
+// the map of the offsets of the text to the ones of the file are returned
+// along with the text.
+func readInput(out io.Writer, filePath string, opts Options) (string, int64, sourceOffsets, error) {
+	var offsets sourceOffsets
 	b, err := os.ReadFile(filePath)
 	if err != nil {
-		return fmt.Errorf("failed to read file: %w", err)
+		return "", 0, offsets, withCategory(ErrInput, fmt.Errorf("failed to read file: %w", err))
+	}
+	size := int64(len(b))
+	if opts.SinceOffset > 0 && opts.SinceOffset <= size {
+		b = b[opts.SinceOffset:]
+		offsets.base = int(opts.SinceOffset)
+	}
+
+	text, endings := normalizeMixedLineEndings(string(b))
+	if endings.Mixed() {
+		fmt.Fprintf(out, "Warning: the file mixes line endings (%d \\r\\n, %d \\n), normalized to \\n\n", endings.CRLF, endings.LF)
+		offsets.maps = append(offsets.maps, lineEndingOffsets(string(b)))
+	}
+	if opts.NormalizeUnicode {
+		var m offsetMap
+		text, m = normalizeUnicodeOffsets(text)
+		offsets.maps = append(offsets.maps, m)
+	}
+	return text, size, offsets, nil
+}
+
+// processFile processes a single file.
+func processFile(ctx context.Context, client myopenai.ChatGenerator, prompt, filePath string, opts Options) error {
+	if opts.Scored && opts.OutputSchema != nil {
+		return invalidConfig(fmt.Errorf("scored mode cannot be combined with an output schema"))
+	}
+	if opts.RecordDelimiter != "" && (opts.Scored || opts.OutputSchema != nil) {
+		return invalidConfig(fmt.Errorf("a record delimiter cannot be combined with scored mode or an output schema"))
+	}
+	if opts.Justify && (opts.Scored || opts.OutputSchema != nil || opts.RecordDelimiter != "") {
+		return invalidConfig(fmt.Errorf("justified lines cannot be combined with scored mode, an output schema or a record delimiter"))
+	}
+	if opts.ChunkFilter != nil && (opts.Scored || opts.OutputSchema != nil || opts.RecordDelimiter != "") {
+		return invalidConfig(fmt.Errorf("a chunk filter cannot be combined with scored mode, an output schema or a record delimiter"))
+	}
+	if opts.Choices > 1 && opts.ChoicePolicy == ChoiceConcat && (opts.Scored || opts.OutputSchema != nil || opts.RecordDelimiter != "") {
+		return invalidConfig(fmt.Errorf("concatenated choices cannot be combined with scored mode, an output schema or a record delimiter"))
+	}
+	if opts.RunningContext && opts.Schedule == ScheduleLargestFirst {
+		return invalidConfig(fmt.Errorf("the running context requires the chunks to be processed in the order of the input"))
+	}
+	if opts.Sequential && opts.Schedule == ScheduleLargestFirst {
+		return invalidConfig(fmt.Errorf("sequential processing cannot be combined with the largest-first schedule"))
+	}
+	if err := checkStopSequences(opts.StopSequences); err != nil {
+		return err
+	}
+	if opts.SinceOffset < 0 {
+		return invalidConfig(fmt.Errorf("invalid offset %d: it must not be negative", opts.SinceOffset))
+	}
+	if opts.SinceMarker != "" && (opts.CacheReadOnly || len(opts.Tasks) > 0) {
+		return invalidConfig(fmt.Errorf("a marker cannot be combined with a read-only cache or tasks"))
+	}
+	if opts.SinceLast && (opts.SinceMarker != "" || opts.CacheReadOnly || len(opts.Tasks) > 0 || opts.MaxOutputFileSize > 0 || opts.writesFormat(OutputJSON)) {
+		return invalidConfig(fmt.Errorf("resuming from the last run cannot be combined with a marker, a read-only cache, tasks, a rotated output or a JSON output"))
+	}
+	if opts.Echo {
+		if err := checkEcho(opts); err != nil {
+			return err
+		}
+		// The echoed results must not be mistaken for the ones of the model
+		opts.CacheLabel = echoCacheLabel(opts.CacheLabel)
+		opts.StatsFile = ""
+	}
+
+	out := &syncWriter{w: opts.log()}
+	fmt.Fprintf(out, "File path provided: %s\n", filePath)
+
+	baseLabel := opts.CacheLabel
+	if opts.SinceOffset > 0 || opts.SinceMarker != "" || opts.SinceLast {
+		offset, err := resolveSinceOffset(out, filePath, opts)
+		if err != nil {
+			return err
+		}
+		opts.SinceOffset = offset
+		if offset > 0 {
+			fmt.Fprintf(out, "Processing the input appended since byte %d\n", offset)
+		}
+		// The chunks of the appended input have their own cache
+		opts.CacheLabel = sinceCacheLabel(opts.CacheLabel, offset)
+		if opts.SinceMarker != "" || opts.SinceLast {
+			if err := pruneSinceCaches(out, filePath, baseLabel, offset); err != nil {
+				return err
+			}
+		}
+	}
+
+	combinedFileName := opts.combinedOutputPath(combinedFilePath(filePath))
+	if opts.Output != "" && !opts.PrefetchOnly {
+		if err := os.MkdirAll(filepath.Dir(combinedFileName), 0755); err != nil {
+			return fmt.Errorf("failed to create output directory: %w", err)
+		}
+	}
+	// Prefetching doesn't write the combined output so the policy doesn't
+	// apply, tasks apply it to their own output, and the results of the
+	// appended input are appended to it
+	if !opts.PrefetchOnly && len(opts.Tasks) == 0 && !appendsOutput(opts) {
+		// The parts of a previous rotated output are replaced or removed too
+		parts, err := existingOutputParts(combinedFileName)
+		if err != nil {
+			return err
+		}
+		skip, err := checkExistingOutputs(out, append(opts.outputPaths(combinedFileName), parts...), opts.IfExists)
+		if err != nil {
+			return err
+		}
+		if skip {
+			return nil
+		}
+	}
+
+	text, size, offsets, err := readInput(out, filePath, opts)
+	if err != nil {
+		return err
+	}
+	if opts.SinceOffset > 0 && text == "" {
+		fmt.Fprintf(out, "No input appended since byte %d, nothing to process\n", opts.SinceOffset)
+		return nil
+	}
+
+	if opts.RecordDelimiter != "" && strings.Contains(text, opts.RecordDelimiter) {
+		fmt.Fprintf(out, "Warning: the record delimiter %q appears in the input, outputs may not map back to their records\n", opts.RecordDelimiter)
 	}
 
-	text := string(b)
 	totalEstimation, err := estimateTokens(text)
 	if err != nil {
 		return fmt.Errorf("failed to estimate tokens: %w", err)
 	}
+	printEstimation(out, text, totalEstimation, opts)
 
-	fmt.Printf("Total tokens: %d\n", totalEstimation.TokensCount)
+	fmt.Fprintf(out, "Total tokens: %d\n", totalEstimation.TokensCount)
 
-	chunks, err := splitIntoTokenChunks(text, 2000)
+	textChunks, err := splitTextChunks(text, opts)
 	if err != nil {
 		return fmt.Errorf("failed to split into chunks: %w", err)
 	}
+	textChunks, err = preflightRequests(out, text, textChunks, requestPrompts(prompt, opts), opts)
+	if err != nil {
+		return err
+	}
+	chunks := chunkTexts(textChunks)
+	// The manifest records the ranges of the file, not of the normalized text
+	textChunks = offsets.sourceChunks(textChunks)
 
-	fmt.Printf("Split into %d chunks\n", len(chunks))
+	fmt.Fprintf(out, "Split into %d chunks\n", len(chunks))
+	if opts.VerifyChunks {
+		fmt.Fprintln(out, "Verified that the chunks cover the whole input")
+	}
+	if opts.MaxChunks > 0 && len(chunks) > opts.MaxChunks {
+		return fmt.Errorf("%w: %s splits into %d chunks, more than the maximum of %d: raise --chunk-size or --max-chunks", ErrTooManyChunks, filePath, len(chunks), opts.MaxChunks)
+	}
+	if len(opts.Tasks) > 0 {
+		fmt.Fprintf(out, "Running %d tasks over the chunks: %d requests\n", len(opts.Tasks), len(opts.Tasks)*len(chunks))
+	}
+	for _, warning := range outputTokenWarnings(opts) {
+		fmt.Fprintf(out, "Warning: %s\n", warning)
+	}
 
 	// Ask for user confirmation before proceeding
-	if requireConfirmation {
-		fmt.Print("\nDo you want to proceed with processing? (yes/no): ")
-		var response string
-		fmt.Scanln(&response)
-
-		if strings.ToLower(strings.TrimSpace(response)) != "yes" && strings.ToLower(strings.TrimSpace(response)) != "y" {
-			fmt.Println("Processing cancelled by user.")
+	// Echoing costs nothing
+	if opts.RequireConfirmation && !opts.Echo {
+		cost := estimatedRunCost(totalEstimation.TokensCount, len(chunks), opts)
+		if opts.ConfirmAbove > 0 && cost <= opts.ConfirmAbove {
+			fmt.Fprintf(out, "Estimated cost $%.4f within the confirmation threshold of $%.4f, proceeding\n", cost, opts.ConfirmAbove)
+		} else if !confirmProcessing(out) {
 			return nil
 		}
+	}
+
+	if len(opts.Tasks) > 0 {
+		return processTasks(ctx, client, out, filePath, textChunks, opts)
+	}
+	if err := processChunks(ctx, client, out, prompt, filePath, textChunks, combinedFileName, opts); err != nil {
+		return err
+	}
+	if opts.PrefetchOnly {
+		return nil
+	}
+	if opts.SinceLast {
+		return advanceSinceLast(out, filePath, baseLabel, size, opts)
+	}
+	if opts.SinceMarker == "" {
+		return nil
+	}
+	return advanceSinceMarker(out, filePath, size, opts)
+}
+
+// readConfirmation reads the answer of the user, replaced in tests.
+var readConfirmation = func() string {
+	var response string
+	fmt.Scanln(&response)
+	return response
+}
 
-		fmt.Println("Proceeding with processing...")
+// confirmProcessing asks the user whether to proceed and tells whether they accepted.
+func confirmProcessing(out io.Writer) bool {
+	fmt.Fprint(out, "\nDo you want to proceed with processing? (yes/no): ")
+	response := readConfirmation()
+
+	if strings.ToLower(strings.TrimSpace(response)) != "yes" && strings.ToLower(strings.TrimSpace(response)) != "y" {
+		fmt.Fprintln(out, "Processing cancelled by user.")
+		return false
 	}
 
+	fmt.Fprintln(out, "Proceeding with processing...")
+	return true
+}
+
+// processChunks processes the chunks of a file with the prompt and combines
+// their results into combinedFileName.
+func processChunks(ctx context.Context, client myopenai.ChatGenerator, out *syncWriter, prompt, filePath string, textChunks []textChunk, combinedFileName string, opts Options) error {
+	chunks := chunkTexts(textChunks)
+	// The output ratio is recorded for the prompt as given by the user
+	userPrompt := prompt
+
 	// Create directory for chunks and results at the same level as the original file
-	baseFileName := strings.TrimSuffix(filePath, filepath.Ext(filePath))
-	chunkDir := baseFileName // Keep the full path, just remove extension
-	err = os.MkdirAll(chunkDir, 0755)
+	chunkDir, err := chunkDirPath(filePath, opts.CacheLabel)
+	if err != nil {
+		return err
+	}
+	if opts.CacheReadOnly {
+		fmt.Fprintf(out, "Using read-only chunk directory: %s/ (cache writes are skipped, new results are kept in memory)\n", chunkDir)
+	} else {
+		err = os.MkdirAll(chunkDir, opts.cacheDirPerm())
+		if err != nil {
+			return fmt.Errorf("failed to create chunk directory: %w", err)
+		}
+		fmt.Fprintf(out, "Using chunk directory: %s/\n", chunkDir)
+	}
+
+	if err := migrateChunkNumbering(out, chunkDir, opts); err != nil {
+		return err
+	}
+
+	store, err := openCacheStore(chunkDir, opts)
 	if err != nil {
-		return fmt.Errorf("failed to create chunk directory: %w", err)
+		return err
 	}
-	fmt.Printf("Using chunk directory: %s/\n", chunkDir)
+	defer store.Close()
 
 	// Check for existing cached results
 	cachedCount := 0
+	cached := make([]bool, len(chunks))
 	for i := range chunks {
-		resultFileName := filepath.Join(chunkDir, fmt.Sprintf("result%d.txt", i+1))
-		if _, err := os.Stat(resultFileName); err == nil {
+		if store.Has("result", i) {
+			cached[i] = true
 			cachedCount++
 		}
 	}
 
+	if err := checkCacheMeta(out, chunkDir, prompt, textChunks, opts, cachedCount); err != nil {
+		return err
+	}
+
 	if cachedCount > 0 {
-		fmt.Printf("Found %d cached results, will process %d new chunks\n", cachedCount, len(chunks)-cachedCount)
+		fmt.Fprintf(out, "Found %d cached results, will process %d new chunks\n", cachedCount, len(chunks)-cachedCount)
+	}
+
+	p := &processor{
+		client:   client,
+		opts:     opts,
+		chunkDir: chunkDir,
+		store:    store,
+		out:      out,
+		breaker:  newCircuitBreaker(opts.BreakerThreshold, opts.BreakerCooldown),
+
+		retryableStatuses: retryableStatuses(opts.RetryOnStatus, opts.NoRetryOnStatus),
+	}
+
+	var expansionUsage Usage
+	if opts.AutoPrompt {
+		prompt, expansionUsage, err = p.expandPrompt(ctx, prompt)
+		if err != nil {
+			return err
+		}
+	}
+
+	prompt = chunkPrompt(prompt, opts)
+	p.prompt = prompt
+
+	emitter := &progressEmitter{total: len(chunks)}
+	if opts.ProgressFunc != nil {
+		emitter.listeners = append(emitter.listeners, opts.ProgressFunc)
+	}
+	p.progress = emitter
+
+	var combinedCache string
+	if opts.CombinedCache {
+		combinedCache = combinedCachePath(chunkDir, combinedCacheKey(chunks, userPrompt, opts))
+		results, ok, err := loadCombinedCache(combinedCache)
+		if err != nil {
+			return err
+		}
+		if ok {
+			fmt.Fprintf(out, "Using the combined cache of the %d chunks -> %s\n", len(results), combinedCache)
+			p.spend(expansionUsage)
+			if opts.PrefetchOnly {
+				fmt.Fprintf(out, "\n=== Prefetch complete: %d results cached in %s/ ===\n", len(chunks), chunkDir)
+				return nil
+			}
+			return p.finish(ctx, chunks, results, combinedFileName)
+		}
+	}
+
+	fmt.Fprintf(out, "Starting parallel processing of %d chunks...\n", len(chunks))
+
+	checkpoint, resumed, err := newCheckpointer(chunkDir, opts.Model, prompt, len(chunks), opts.cacheFilePerm())
+	if err != nil {
+		return err
+	}
+	checkpoint.readOnly = opts.CacheReadOnly
+	if resumed {
+		usage := checkpoint.Usage()
+		fmt.Fprintf(out, "Resuming from checkpoint: %d tokens used so far ($%.4f)\n", usage.PromptTokens+usage.CompletionTokens, usage.Cost)
+
+		attempted := 0
+		for i := range chunks {
+			if !cached[i] && checkpoint.Attempted(i) {
+				attempted++
+			}
+		}
+		fmt.Fprintf(out, "Previous run: %d chunks completed, %d attempted but not completed, %d never started\n", cachedCount, attempted, len(chunks)-cachedCount-attempted)
+	}
+
+	p.checkpoint = checkpoint
+	p.spend(expansionUsage)
+	p.stragglers = newStragglerMonitor(len(chunks), opts)
+
+	if opts.VerifyTokens {
+		p.encoder, err = tokenizer.Get(tokenizer.Cl100kBase)
+		if err != nil {
+			return withCategory(ErrTokenizer, fmt.Errorf("failed to get tokenizer: %w", err))
+		}
 	}
 
-	fmt.Printf("Starting parallel processing of %d chunks...\n", len(chunks))
+	// The live view owns the terminal while the chunks are processed, the
+	// per-chunk messages would scroll it away
+	useTUI := opts.TUI && isTerminal(opts.log())
+	if opts.TUI && !useTUI {
+		fmt.Fprintln(out, "Log is not a terminal, falling back to plain progress messages")
+	}
+	// On a terminal, a progress bar replaces the progress messages
+	var bar *progressBar
+	switch {
+	case useTUI:
+		view := newTUI(out, len(chunks))
+		view.model.first = opts.chunkNumber(0)
+		emitter.listeners = append(emitter.listeners, view.Handle)
+		p.out = io.Discard
+		view.render()
+	case opts.Quiet:
+		p.out = io.Discard
+	case isTerminal(opts.log()):
+		bar = newProgressBar(out, len(chunks))
+		emitter.listeners = append(emitter.listeners, bar.Handle)
+		p.out = bar
+	}
 
-	prompt = prompt + "\nReturn the lines that you want to keep."
+	order, err := scheduleOrder(chunks, opts.Schedule)
+	if err != nil {
+		return err
+	}
 
+	// Past the deadline the requests in flight are cancelled too, the
+	// completed results are still combined
 	g, gCtx := errgroup.WithContext(ctx)
+	if opts.RunningContext || opts.Sequential {
+		// Each chunk needs the summary of the ones before it, or is printed
+		// after them
+		g.SetLimit(1)
+	} else {
+		g.SetLimit(concurrencyFor(opts.Model, opts.Concurrency))
+	}
 
 	// Process each chunk with OpenAI
-	results := make([]string, len(chunks))
+	results := make([]chunkResult, len(chunks))
+
+	done := make([]bool, len(chunks))
 
 	// Progress tracking
 	var completed int64
 	totalChunks := int64(len(chunks))
 	var mu sync.Mutex
 
-	for i, chunk := range chunks {
-		i, chunk := i, chunk
+	// Past the max runtime no new request is sent, the in-flight ones finish
+	// and the cached results are still used
+	start := time.Now()
+	var notStarted, cancelled int64
+	// Once a chunk emitted the stop sentinel, no new request is sent either
+	var stopped atomic.Bool
+	pastMaxRuntime := func() bool {
+		return opts.MaxRuntime > 0 && time.Since(start) >= opts.MaxRuntime
+	}
+
+	// Creating the control file holds the launch of new chunks until it is removed
+	pause := newPauser(chunkDir, out)
+
+	// The chunks are printed one after the other as they complete
+	var live *transcript
+	if opts.Sequential && opts.Stream {
+		live = &transcript{w: opts.stdout()}
+	}
+
+	// The results are written as they complete so that a crash doesn't lose them
+	var incremental *incrementalOutput
+	incrementalFile := incrementalFilePath(combinedFileName)
+	if opts.IncrementalOutput && !opts.PrefetchOnly {
+		incremental, err = newIncrementalOutput(incrementalFile, opts.SyncEvery, opts.cacheFilePerm())
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Writing the results incrementally to %s\n", incrementalFile)
+	}
+
+	if opts.ChunkFilter != nil {
+		matching := 0
+		for _, chunk := range chunks {
+			if matchesChunkFilter(chunk, opts.ChunkFilter) {
+				matching++
+			}
+		}
+		fmt.Fprintf(out, "Chunk filter %q: %d/%d chunks sent to the model, the others are kept unchanged\n", opts.ChunkFilter, matching, len(chunks))
+	}
+
+	for _, i := range order {
+		i, chunk := i, chunks[i]
 		g.Go(func() error {
-			result, err := processChunk(gCtx, model, i, chunkDir, client, prompt, chunk)
+			// The chunks left out by the filter cost nothing, they are never held
+			passthrough := !matchesChunkFilter(chunk, opts.ChunkFilter)
+			if !cached[i] && !passthrough {
+				if err := pause.Wait(gCtx); err != nil && !deadlineReached(ctx) {
+					return err
+				}
+			}
+			if !cached[i] && !passthrough && (pastMaxRuntime() || stopped.Load() || deadlineReached(ctx)) {
+				atomic.AddInt64(&notStarted, 1)
+				return nil
+			}
+
+			var result chunkResult
+			var err error
+			if passthrough {
+				result = p.passthroughResult(i, chunk)
+			} else {
+				chunkPrompt := prompt
+				if opts.RunningContext {
+					chunkPrompt = p.withRunningContext(prompt)
+				}
+
+				result, err = p.processChunk(gCtx, i, chunkPrompt, chunk)
+				if err == nil && opts.RunningContext {
+					var usage Usage
+					usage, err = p.updateRunningContext(gCtx, i, chunk)
+					result.Usage = result.Usage.Add(usage)
+				}
+			}
+			if err != nil && deadlineReached(ctx) {
+				atomic.AddInt64(&cancelled, 1)
+				return nil
+			}
 			if err != nil {
+				p.progress.emit(ProgressEvent{Chunk: i, Status: ChunkError, Err: err})
 				return err
 			}
 			results[i] = result
+			done[i] = true
+			if live != nil {
+				io.WriteString(live, result.Content)
+				live.EndChunk()
+			}
+			p.stragglers.Complete()
+			opts.Metrics.chunkDone(result)
+			if result.Stop && !stopped.Swap(true) {
+				fmt.Fprintf(p.out, "Chunk %d: Stop sentinel found, no new chunk is dispatched\n", opts.chunkNumber(i))
+			}
+
+			if !result.Cached {
+				p.progress.emit(ProgressEvent{Chunk: i, Status: ChunkDone, Usage: result.Usage})
+			}
+
+			if err := p.checkpoint.Complete(i, result.Usage); err != nil {
+				fmt.Fprintf(p.out, "Warning: failed to update checkpoint: %v\n", err)
+			}
 
 			// Update progress
 			current := atomic.AddInt64(&completed, 1)
 			progress := float64(current) / float64(totalChunks) * 100
 
 			mu.Lock()
-			fmt.Printf("Progress: %d/%d chunks completed (%.1f%%)\n", current, totalChunks, progress)
+			if !useTUI && !opts.Quiet && bar == nil {
+				fmt.Fprintf(out, "Progress: %d/%d chunks completed (%.1f%%)\n", current, totalChunks, progress)
+			}
+			if opts.ResultFunc != nil {
+				opts.ResultFunc(i, result.Content, result.Cached)
+			}
+			if incremental != nil {
+				if err := incremental.Add(i, result.Content); err != nil {
+					fmt.Fprintf(p.out, "Warning: %v\n", err)
+				}
+			}
 			mu.Unlock()
 
 			return nil
@@ -122,156 +692,677 @@ func ProcessWithClient(ctx context.Context, client myopenai.ChatGenerator, model
 	}
 
 	err = g.Wait()
+	if bar != nil {
+		bar.Finish()
+	}
+	p.out = out
+	if incremental != nil {
+		if err := incremental.Close(); err != nil {
+			fmt.Fprintf(out, "Warning: %v\n", err)
+		}
+	}
 	if err != nil {
 		return fmt.Errorf("failed to wait for all subtasks to complete: %w", err)
 	}
 
-	fmt.Printf("\n✓ All %d chunks processed successfully!\n", len(chunks))
+	partialRun := notStarted > 0 || cancelled > 0
+	if partialRun {
+		switch {
+		case deadlineReached(ctx):
+			fmt.Fprintf(out, "\nDeadline of %s reached, partial output: %d/%d chunks completed, %d cancelled in flight, %d not started\n", opts.Deadline, completed, len(chunks), cancelled, notStarted)
+		case stopped.Load():
+			fmt.Fprintf(out, "\nStop sentinel %q found: %d/%d chunks completed, %d not started\n", opts.StopSentinel, completed, len(chunks), notStarted)
+		default:
+			fmt.Fprintf(out, "\nMax runtime of %s reached: %d/%d chunks completed, %d not started\n", opts.MaxRuntime, completed, len(chunks), notStarted)
+		}
 
-	var combinedResults strings.Builder
+		// Only the completed chunks are combined
+		var partial []chunkResult
+		for i, result := range results {
+			if done[i] {
+				partial = append(partial, result)
+			}
+		}
+		results = partial
+	} else {
+		fmt.Fprintf(out, "\n✓ All %d chunks processed successfully!\n", len(chunks))
+	}
 
+	refused := 0
 	for _, result := range results {
-		// Add to combined results (just append without separators)
-		combinedResults.WriteString(result)
+		if result.Refusal != "" {
+			refused++
+		}
+	}
+	if refused > 0 {
+		fmt.Fprintf(out, "%d chunks refused by the model (policy: %s)\n", refused, opts.OnRefusal)
 	}
 
-	// Write combined results to file
-	filePathWithoutExt := strings.TrimSuffix(filePath, filepath.Ext(filePath))
-	combinedFileName := fmt.Sprintf("%s.combined_results.txt", filePathWithoutExt)
-	err = os.WriteFile(combinedFileName, []byte(combinedResults.String()), 0644)
+	// Only a complete run is worth serving again as a whole
+	if combinedCache != "" && !partialRun && refused == 0 && !opts.CacheReadOnly {
+		if err := saveCombinedCache(combinedCache, results, opts.cacheFilePerm()); err != nil {
+			fmt.Fprintf(out, "Warning: failed to write the combined cache: %v\n", err)
+		}
+	}
+
+	// The usage includes the reduce step, printed once it completed
+	defer func() {
+		usage := checkpoint.Usage()
+		fmt.Fprintf(out, "Token usage: %d prompt + %d completion tokens ($%.4f)\n", usage.PromptTokens, usage.CompletionTokens, usage.Cost)
+	}()
+
+	if opts.StatsFile != "" {
+		if err := recordOutputRatio(opts.StatsFile, userPrompt, chunks, results); err != nil {
+			fmt.Fprintf(out, "Warning: failed to record the output ratio: %v\n", err)
+		}
+	}
+
+	if opts.ReportCSV != "" {
+		if err := writeReportCSV(opts.ReportCSV, results, opts); err != nil {
+			return fmt.Errorf("failed to write CSV report: %w", err)
+		}
+		fmt.Fprintf(out, "Chunk report written to: %s\n", opts.ReportCSV)
+	}
+
+	if opts.VerifyTokens {
+		printTokenDiscrepancy(out, computeTokenDiscrepancy(results))
+	}
+
+	if opts.PrefetchOnly {
+		fmt.Fprintf(out, "\n=== Prefetch complete: %d results cached in %s/ ===\n", len(chunks), chunkDir)
+		return nil
+	}
+	// The next run resumes the same input from the cache and appends all its
+	// results at once, appending them now would duplicate them
+	if partialRun && appendsOutput(opts) {
+		fmt.Fprintf(out, "Combined output not appended to %s: some chunks were not processed, the next run resumes them\n", combinedFileName)
+		return nil
+	}
+
+	if err := p.finish(ctx, chunks, results, combinedFileName); err != nil {
+		return err
+	}
+	// The combined output supersedes the incremental one
+	if incremental != nil {
+		if err := os.Remove(incrementalFile); err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(out, "Warning: failed to remove the incremental output: %v\n", err)
+		}
+	}
+	return nil
+}
+
+// finish writes the outputs of the run from the results of its chunks.
+func (p *processor) finish(ctx context.Context, chunks []string, results []chunkResult, combinedFileName string) error {
+	if p.opts.SideBySide {
+		path := sideBySideFilePath(combinedFileName)
+		if err := writeSideBySide(path, chunks, results, p.opts.chunkNumber(0)); err != nil {
+			return err
+		}
+		fmt.Fprintf(p.out, "Side-by-side inputs and results written to: %s\n", path)
+	}
+
+	if p.opts.ChangesOnly {
+		changed := changedResults(chunks, results)
+		fmt.Fprintf(p.out, "Changes only: %d/%d chunks modified by the model\n", len(changed), len(results))
+		results = changed
+	}
+
+	return p.combine(ctx, results, combinedFileName)
+}
+
+// combine reduces the chunk results into the combined output.
+func (p *processor) combine(ctx context.Context, results []chunkResult, combinedFileName string) error {
+	if p.opts.Scored {
+		kept := filterByScore(results, p.opts.MinScore, p.opts.SortByScore)
+		if dropped := len(results) - len(kept); dropped > 0 {
+			fmt.Fprintf(p.out, "Dropped %d chunks scored below %.2f\n", dropped, p.opts.MinScore)
+		}
+		results = kept
+	}
+
+	if empty := countEmptyResults(results); empty > 0 {
+		fmt.Fprintf(p.out, "%d chunks contributed nothing\n", empty)
+		if p.opts.OmitEmpty {
+			results = omitEmptyResults(results)
+		}
+	}
+
+	var combinedResults string
+	var err error
+	if p.opts.Citations {
+		combinedResults, err = p.reduceWithCitations(ctx, results, citationsFilePath(combinedFileName))
+	} else {
+		combinedResults, err = p.reduce(ctx, results)
+	}
+	if err != nil && deadlineReached(ctx) {
+		return fmt.Errorf("deadline of %s reached before the reduce step completed, rerun to reduce the cached results: %w", p.opts.Deadline, err)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to write combined results: %w", err)
+		return fmt.Errorf("failed to reduce results: %w", err)
+	}
+
+	if p.opts.OutputFilter != nil {
+		var dropped int
+		combinedResults, dropped = filterOutputLines(combinedResults, p.opts.OutputFilter, p.opts.lineDelimiter())
+		fmt.Fprintf(p.out, "Output filter %q dropped %d lines\n", p.opts.OutputFilter, dropped)
+	}
+
+	// An empty output usually means the prompt filtered out everything
+	if strings.TrimSpace(combinedResults) == "" {
+		if p.opts.FailOnEmpty {
+			return ErrEmptyOutput
+		}
+		fmt.Fprintln(p.out, "Warning: the combined output is empty, every chunk filtered everything out")
+	}
+
+	if p.opts.writesFormat(OutputJSON) {
+		b, err := formatJSONOutput(combinedResults, results, p.prompt, p.opts)
+		if err != nil {
+			return err
+		}
+		if err := writeCombinedOutput(p.out, formatFilePath(combinedFileName, OutputJSON), string(b), p.opts.IfExists); err != nil {
+			return fmt.Errorf("failed to write JSON output: %w", err)
+		}
 	}
 
-	fmt.Printf("\n=== Combined results written to: %s ===\n", combinedFileName)
+	if p.opts.OutputHeader {
+		combinedResults = outputHeader(p.prompt, p.opts.Model, p.opts.chunkSize(), time.Now()) + combinedResults
+	}
+
+	// Write combined results to file
+	switch {
+	case !p.opts.writesFormat(OutputText):
+		// Only the other formats are written
+	case p.opts.MaxOutputFileSize > 0:
+		paths, err := writeOutputParts(p.out, combinedFileName, combinedResults, p.opts.MaxOutputFileSize, p.opts.IfExists)
+		if err != nil {
+			return fmt.Errorf("failed to write combined results: %w", err)
+		}
+		if len(paths) > 1 {
+			fmt.Fprintf(p.out, "Combined results rotated into %d parts of at most %d bytes: %s\n", len(paths), p.opts.MaxOutputFileSize, strings.Join(paths, ", "))
+		}
+		if !p.opts.CacheReadOnly {
+			if err := recordOutputParts(p.chunkDir, paths, p.opts.cacheFilePerm()); err != nil {
+				fmt.Fprintf(p.out, "Warning: failed to record the output parts: %v\n", err)
+			}
+		}
+	case appendsOutput(p.opts):
+		if err := appendCombinedOutput(combinedFileName, combinedResults); err != nil {
+			return fmt.Errorf("failed to append combined results: %w", err)
+		}
+	default:
+		err = writeCombinedOutput(p.out, combinedFileName, combinedResults, p.opts.IfExists)
+		if err != nil {
+			return fmt.Errorf("failed to write combined results: %w", err)
+		}
+		// The parts of a previous rotated output would be mistaken for this one
+		if err := removeStaleOutputParts(p.out, combinedFileName, 1, p.opts.IfExists); err != nil {
+			fmt.Fprintf(p.out, "Warning: %v\n", err)
+		}
+	}
+
+	if p.opts.Justify {
+		path := explanationsFilePath(combinedFileName)
+		count, err := writeExplanations(path, results, p.opts.OutputFilter)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(p.out, "Reasons of the %d kept lines written to: %s\n", count, path)
+	}
+
+	fmt.Fprintf(p.out, "\n=== Combined results written to: %s ===\n", strings.Join(p.opts.outputPaths(combinedFileName), ", "))
 
 	return nil
 }
 
-func processChunk(ctx context.Context, model Model, i int, chunkDir string, client myopenai.ChatGenerator, prompt, chunk string) (string, error) {
-	chunkFileName := filepath.Join(chunkDir, fmt.Sprintf("chunk%d.txt", i+1))
-	resultFileName := filepath.Join(chunkDir, fmt.Sprintf("result%d.txt", i+1))
+// reduce combines the results with the configured reducer.
+func (p *processor) reduce(ctx context.Context, results []chunkResult) (string, error) {
+	reducer := p.opts.Reducer
+	if reducer == nil {
+		reducer = reducers[ReducerConcat]
+	}
+	if p.opts.ReducePrompt != "" {
+		reducer = p.llmReducer(ctx, p.opts.ReducePrompt)
+	}
+
+	contents := make([]string, len(results))
+	for i, result := range results {
+		contents[i] = result.Content
+	}
 
+	if builtin, ok := reducer.(builtinReducer); ok {
+		reducer = builtin.Reducer
+	}
+	if reducer, ok := reducer.(lineReducer); ok {
+		return reducer(contents, p.opts.lineDelimiter())
+	}
+	return reducer.Reduce(contents)
+}
+
+// chunkResult is the outcome of processing a single chunk.
+type chunkResult struct {
+	// Index is the zero-based index of the chunk in the input.
+	Index int
+	// Content is the text kept for the chunk in the combined output.
+	Content string
+	// Score is the relevance reported by the model in scored mode.
+	Score float64
+	// Usage is what the API billed for the chunk, zero for cached results.
+	Usage Usage
+	// Latency is the time spent waiting for the API, retries included.
+	Latency time.Duration
+	// Cached tells whether the result was read from the cache.
+	Cached bool
+	// Refusal is the reason given by the model when it refused the chunk.
+	Refusal string
+	// Stop tells whether the output contained the stop sentinel.
+	Stop bool
+	// Records are the outputs of the records of the chunk when they are delimited.
+	Records []string
+	// Justifications are the kept lines with the reasons given by the model
+	// when they are requested.
+	Justifications []justifiedLine
+	// EstimatedPromptTokens is our estimate of the prompt tokens of the
+	// request, only computed when verifying tokens.
+	EstimatedPromptTokens int64
+}
+
+func (p *processor) processChunk(ctx context.Context, i int, prompt, chunk string) (chunkResult, error) {
 	// Check if result already exists
-	if existingResult, err := os.ReadFile(resultFileName); err == nil {
-		fmt.Printf("Chunk %d: Using cached result -> %s\n", i+1, resultFileName)
-		return string(existingResult), nil
+	if existingResult, err := p.store.Read("result", i); err == nil {
+		fmt.Fprintf(p.out, "Chunk %d: Using cached result -> %s\n", p.opts.chunkNumber(i), p.store.Path("result", i))
+		result, err := p.newChunkResult(i, string(existingResult))
+		if err != nil {
+			return chunkResult{}, err
+		}
+		result.Cached = true
+		p.progress.emit(ProgressEvent{Chunk: i, Status: ChunkCached})
+		return result, nil
+	}
+
+	// Don't start new chunks once the run failed
+	if err := ctx.Err(); err != nil {
+		return chunkResult{}, err
+	}
+
+	p.progress.emit(ProgressEvent{Chunk: i, Status: ChunkRunning})
+	if err := p.checkpoint.Attempt(i); err != nil {
+		fmt.Fprintf(p.out, "Warning: failed to update checkpoint: %v\n", err)
+	}
+
+	// Write chunk to disk, only useful for debugging since the cache relies on results
+	if p.opts.NoChunkFiles || p.opts.CacheReadOnly {
+		fmt.Fprintf(p.out, "Chunk %d: processing...\n", p.opts.chunkNumber(i))
+	} else {
+		err := p.store.Write("chunk", i, []byte(chunk))
+		if err != nil {
+			return chunkResult{}, fmt.Errorf("failed to write chunk %d: %w", p.opts.chunkNumber(i), err)
+		}
+
+		fmt.Fprintf(p.out, "Chunk %d: %s (processing...)\n", p.opts.chunkNumber(i), p.store.Path("chunk", i))
 	}
 
-	// Write chunk to disk
-	err := os.WriteFile(chunkFileName, []byte(chunk), 0644)
+	params := p.chunkParams(prompt, chunk)
+
+	start := time.Now()
+	var res *openai.ChatCompletion
+	var discarded Usage
+	var err error
+	if p.opts.Echo {
+		res = p.echoCompletion(chunk)
+	} else {
+		res, discarded, err = p.requestChunk(ctx, i, &params)
+	}
+	latency := time.Since(start)
 	if err != nil {
-		return "", fmt.Errorf("failed to write chunk %d: %w", i+1, err)
+		return chunkResult{}, fmt.Errorf("failed to generate chat completion for chunk %d: %w", p.opts.chunkNumber(i), err)
+	}
+
+	if len(res.Choices) == 0 {
+		return chunkResult{}, withCategory(ErrAPI, fmt.Errorf("no content in response for chunk %d", p.opts.chunkNumber(i)))
+	}
+	choice := selectChoice(res.Choices, p.opts.ChoicePolicy)
+
+	if choice.Message.Refusal != "" {
+		result, err := p.refusedChunkResult(i, chunk, choice.Message.Refusal)
+		if err != nil {
+			return chunkResult{}, err
+		}
+		result.Usage = discarded.Add(Usage{
+			PromptTokens:     res.Usage.PromptTokens,
+			CompletionTokens: res.Usage.CompletionTokens,
+			Cost:             usageCost(Model(params.Model), res.Usage.PromptTokens, res.Usage.CompletionTokens),
+		})
+		result.Latency = latency
+		return result, nil
 	}
 
-	fmt.Printf("Chunk %d: %s (processing...)\n", i+1, chunkFileName)
+	// Extract the content from the response. An empty content is a valid
+	// answer when the model stopped on its own: it kept nothing.
+	if usableChoice(choice) {
+		content := choice.Message.Content
+
+		// Only cache outputs that can be interpreted
+		result, err := p.newChunkResult(i, content)
+		if err != nil {
+			return chunkResult{}, err
+		}
+		result.Usage = discarded.Add(Usage{
+			PromptTokens:     res.Usage.PromptTokens,
+			CompletionTokens: res.Usage.CompletionTokens,
+			Cost:             usageCost(Model(params.Model), res.Usage.PromptTokens, res.Usage.CompletionTokens),
+		})
+		result.Latency = latency
+		if p.opts.RecordDelimiter != "" {
+			if got, expected := len(result.Records), countRecords(chunk, p.opts.RecordDelimiter); got != expected {
+				fmt.Fprintf(p.out, "Warning: chunk %d returned %d records for %d in the input\n", p.opts.chunkNumber(i), got, expected)
+			}
+		}
+		if p.encoder != nil {
+			result.EstimatedPromptTokens = int64(countTokens(p.encoder, prompt) + countTokens(p.encoder, chunk))
+		}
+
+		// Cache the result to disk
+		if p.opts.CacheReadOnly {
+			return result, nil
+		}
+		err = p.store.Write("result", i, []byte(content))
+		if err != nil {
+			fmt.Fprintf(p.out, "Warning: failed to cache result for chunk %d: %v\n", p.opts.chunkNumber(i), err)
+		} else {
+			fmt.Fprintf(p.out, "Chunk %d: Result cached -> %s\n", p.opts.chunkNumber(i), p.store.Path("result", i))
+		}
+
+		return result, nil
+	}
+
+	return chunkResult{}, withCategory(ErrAPI, fmt.Errorf("no content in response for chunk %d", p.opts.chunkNumber(i)))
+}
+
+// requestChunk sends the request of a chunk, falling back from the Flex
+// service tier when it is unavailable, and requests it again up to
+// MaxRetriesEmpty times while the response has no content. The usage of the
+// discarded responses is returned along with the last response.
+func (p *processor) requestChunk(ctx context.Context, i int, params *openai.ChatCompletionNewParams) (*openai.ChatCompletion, Usage, error) {
+	var discarded Usage
+	for attempt := 0; ; attempt++ {
+		res, err := p.generateChunk(ctx, i, attempt, params)
+		if err != nil && params.ServiceTier == openai.ChatCompletionNewParamsServiceTierFlex && isFlexUnavailable(err) {
+			p.disableFlex()
+			params.ServiceTier = openai.ChatCompletionNewParamsServiceTierDefault
+			res, err = p.generate(myopenai.WithIdempotencyKey(ctx, idempotencyKey(i, attempt, *params)), *params)
+		}
+		if err != nil {
+			return nil, discarded, err
+		}
+		if len(res.Choices) > 0 {
+			choice := selectChoice(res.Choices, p.opts.ChoicePolicy)
+			if choice.Message.Refusal != "" || usableChoice(choice) {
+				return res, discarded, nil
+			}
+		}
+		if attempt >= p.opts.MaxRetriesEmpty {
+			return res, discarded, nil
+		}
 
-	res, err := client.GenerateChatCompletion(ctx, openai.ChatCompletionNewParams{
+		discarded = discarded.Add(Usage{
+			PromptTokens:     res.Usage.PromptTokens,
+			CompletionTokens: res.Usage.CompletionTokens,
+			Cost:             usageCost(Model(params.Model), res.Usage.PromptTokens, res.Usage.CompletionTokens),
+		})
+		p.opts.Metrics.retry()
+		fmt.Fprintf(p.out, "Chunk %d: empty response, retrying\n", p.opts.chunkNumber(i))
+	}
+}
+
+// chunkParams returns the request sending a chunk with the given system prompt.
+func (p *processor) chunkParams(prompt, chunk string) openai.ChatCompletionNewParams {
+	params := openai.ChatCompletionNewParams{
 		Messages: []openai.ChatCompletionMessageParamUnion{
 			openai.SystemMessage(prompt),
 			openai.UserMessage(chunk),
 		},
-		Model:       shared.ChatModel(model),
-		ServiceTier: openai.ChatCompletionNewParamsServiceTierFlex,
-	})
-	if err != nil {
-		return "", fmt.Errorf("failed to generate chat completion for chunk %d: %w", i+1, err)
+		Model:       shared.ChatModel(p.opts.Model),
+		ServiceTier: p.serviceTier(),
+	}
+	if p.opts.Choices > 1 {
+		params.N = openai.Int(int64(p.opts.Choices))
+	}
+	if len(p.opts.LogitBias) > 0 {
+		params.LogitBias = p.opts.LogitBias
+	}
+	if len(p.opts.StopSequences) > 0 {
+		params.Stop = openai.ChatCompletionNewParamsStopUnion{OfStringArray: p.opts.StopSequences}
+	}
+	if p.opts.MaxOutputTokens > 0 {
+		params.MaxCompletionTokens = openai.Int(p.opts.MaxOutputTokens)
+	}
+	if p.opts.DeveloperPrompt != "" {
+		// Developer instructions outrank the user content of the chunk
+		params.Messages = []openai.ChatCompletionMessageParamUnion{
+			openai.SystemMessage(prompt),
+			openai.DeveloperMessage(p.opts.DeveloperPrompt),
+			openai.UserMessage(chunk),
+		}
+	}
+	if p.opts.Scored {
+		params.ResponseFormat = openai.ChatCompletionNewParamsResponseFormatUnion{
+			OfJSONObject: &shared.ResponseFormatJSONObjectParam{},
+		}
+	}
+	if p.opts.OutputSchema != nil {
+		params.ResponseFormat = openai.ChatCompletionNewParamsResponseFormatUnion{
+			OfJSONSchema: &shared.ResponseFormatJSONSchemaParam{
+				JSONSchema: shared.ResponseFormatJSONSchemaJSONSchemaParam{
+					Name:   "chunk_output",
+					Schema: p.opts.OutputSchema,
+					Strict: openai.Bool(p.opts.OutputSchema["type"] == "object"),
+				},
+			},
+		}
 	}
+	return params
+}
 
-	// Extract the content from the response
-	if len(res.Choices) > 0 && res.Choices[0].Message.Content != "" {
-		content := res.Choices[0].Message.Content
+// idempotencyKey derives a key from the chunk and the request so that the
+// retries of a request are deduplicated server-side while any change to the
+// request, e.g. its messages or service tier, makes it a new one. Requesting a
+// chunk again after an empty response is a new attempt, not a retry.
+func idempotencyKey(i, attempt int, params openai.ChatCompletionNewParams) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\x00%s\x00%s\x00", i, params.Model, params.ServiceTier)
+	if attempt > 0 {
+		fmt.Fprintf(h, "attempt=%d\x00", attempt)
+	}
+	// The messages are plain data, they always marshal
+	messages, _ := json.Marshal(params.Messages)
+	h.Write(messages)
+	return "chunk-" + hex.EncodeToString(h.Sum(nil))
+}
 
-		// Cache the result to disk
-		err = os.WriteFile(resultFileName, []byte(content), 0644)
-		if err != nil {
-			fmt.Printf("Warning: failed to cache result for chunk %d: %v\n", i+1, err)
-		} else {
-			fmt.Printf("Chunk %d: Result cached -> %s\n", i+1, resultFileName)
+// countEmptyResults counts the results with no content besides whitespace.
+func countEmptyResults(results []chunkResult) int {
+	count := 0
+	for _, result := range results {
+		if strings.TrimSpace(result.Content) == "" {
+			count++
 		}
+	}
+	return count
+}
 
-		return content, nil
+// omitEmptyResults drops the results with no content besides whitespace.
+func omitEmptyResults(results []chunkResult) []chunkResult {
+	var kept []chunkResult
+	for _, result := range results {
+		if strings.TrimSpace(result.Content) != "" {
+			kept = append(kept, result)
+		}
 	}
+	return kept
+}
 
-	return "", fmt.Errorf("no content in response for chunk %d", i+1)
+// newChunkResult interprets the raw model output of a chunk.
+func (p *processor) newChunkResult(i int, content string) (chunkResult, error) {
+	stop := false
+	if p.opts.StopSentinel != "" {
+		content, stop = stripStopSentinel(content, p.opts.StopSentinel)
+	}
+
+	result, err := p.parseChunkResult(i, content)
+	result.Stop = stop
+	return result, err
 }
 
-func splitIntoTokenChunks(text string, maxTokensPerChunk int) ([]string, error) {
-	// Get the tokenizer
-	enc, err := tokenizer.Get(tokenizer.Cl100kBase)
+// parseChunkResult interprets the output of a chunk according to the output
+// format of the run.
+func (p *processor) parseChunkResult(i int, content string) (chunkResult, error) {
+	if p.opts.OutputSchema != nil {
+		if err := validateJSON(content, p.opts.OutputSchema); err != nil {
+			return chunkResult{}, fmt.Errorf("output of chunk %d does not match the schema: %w", p.opts.chunkNumber(i), err)
+		}
+	}
+
+	if p.opts.RecordDelimiter != "" {
+		records := splitRecords(content, p.opts.RecordDelimiter)
+		return chunkResult{Index: i, Content: strings.Join(records, "\n") + "\n", Records: records}, nil
+	}
+
+	if p.opts.Justify {
+		lines, err := parseJustifiedLines(content)
+		if err != nil {
+			return chunkResult{}, fmt.Errorf("invalid output for chunk %d: %w", p.opts.chunkNumber(i), err)
+		}
+		var sb strings.Builder
+		for _, line := range lines {
+			sb.WriteString(line.Line)
+			sb.WriteString(p.opts.lineDelimiter())
+		}
+		return chunkResult{Index: i, Content: sb.String(), Justifications: lines}, nil
+	}
+
+	if !p.opts.Scored {
+		return chunkResult{Index: i, Content: content}, nil
+	}
+
+	score, scoredContent, err := parseScoredOutput(content)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get tokenizer: %w", err)
+		return chunkResult{}, fmt.Errorf("invalid output for chunk %d: %w", p.opts.chunkNumber(i), err)
 	}
+	return chunkResult{Index: i, Content: scoredContent, Score: score}, nil
+}
 
-	var chunks []string
-	lines := strings.Split(text, "\n")
+// generate sends the request, retrying retryable failures after the delay the
+// API asks for or with an exponential backoff. Every attempt waits on the
+// shared circuit breaker while it is open so that an outage holds all the
+// chunks back instead of multiplying the load.
+func (p *processor) generate(ctx context.Context, params openai.ChatCompletionNewParams) (*openai.ChatCompletion, error) {
+	retries := make(map[retryKind]int)
+	for attempt := 0; ; attempt++ {
+		if err := p.breaker.Wait(ctx); err != nil {
+			return nil, err
+		}
 
-	currentChunk := ""
-	currentTokens := 0
+		res, err := p.complete(ctx, params)
+		if err == nil {
+			p.breaker.Success()
+			return res, nil
+		}
 
-	for _, line := range lines {
-		lineWithNewline := line + "\n"
-		tokens, _, _ := enc.Encode(lineWithNewline)
-		lineTokenCount := len(tokens)
+		// A request cancelled by the run, e.g. a failed sibling or the
+		// deadline, is not a failure of the API
+		if ctx.Err() == nil {
+			p.opts.Metrics.apiError()
+		}
 
-		// If adding this line would exceed the limit, start a new chunk
-		if currentTokens+lineTokenCount > maxTokensPerChunk && currentChunk != "" {
-			chunks = append(chunks, strings.TrimSuffix(currentChunk, "\n"))
-			currentChunk = lineWithNewline
-			currentTokens = lineTokenCount
-		} else {
-			currentChunk += lineWithNewline
-			currentTokens += lineTokenCount
-		}
-
-		// Handle case where a single line exceeds the token limit
-		if lineTokenCount > maxTokensPerChunk {
-			// Split the line into smaller parts
-			words := strings.Fields(line)
-			wordChunk := ""
-			wordTokens := 0
-
-			for _, word := range words {
-				wordWithSpace := word + " "
-				tokens, _, _ := enc.Encode(wordWithSpace)
-				wordTokenCount := len(tokens)
-
-				if wordTokens+wordTokenCount > maxTokensPerChunk && wordChunk != "" {
-					chunks = append(chunks, strings.TrimSpace(wordChunk))
-					wordChunk = wordWithSpace
-					wordTokens = wordTokenCount
-				} else {
-					wordChunk += wordWithSpace
-					wordTokens += wordTokenCount
-				}
-			}
+		if !isRetryable(err, p.retryableStatuses) {
+			p.breaker.Release()
+			return nil, apiError(err)
+		}
+		p.breaker.Failure()
 
-			if wordChunk != "" {
-				currentChunk = strings.TrimSpace(wordChunk) + "\n"
-				tokens, _, _ := enc.Encode(currentChunk)
-				currentTokens = len(tokens)
-			}
+		kind := retryKindOf(err)
+		if retries[kind] >= p.opts.retryLimit(kind) {
+			return nil, apiError(err)
+		}
+		retries[kind]++
+		p.opts.Metrics.retry()
+
+		if err := sleepContext(ctx, p.opts.retryDelay(err, attempt+1)); err != nil {
+			return nil, err
 		}
 	}
+}
 
-	// Add the last chunk if it's not empty
-	if currentChunk != "" {
-		chunks = append(chunks, strings.TrimSuffix(currentChunk, "\n"))
+// generateWithFallback sends a request that is not a chunk's, falling back
+// from the Flex service tier when it is unavailable.
+func (p *processor) generateWithFallback(ctx context.Context, params openai.ChatCompletionNewParams) (*openai.ChatCompletion, error) {
+	res, err := p.generate(ctx, params)
+	if err != nil && params.ServiceTier == openai.ChatCompletionNewParamsServiceTierFlex && isFlexUnavailable(err) {
+		p.disableFlex()
+		params.ServiceTier = openai.ChatCompletionNewParamsServiceTierDefault
+		return p.generate(ctx, params)
 	}
+	return res, err
+}
 
-	return chunks, nil
+// spend reports the usage of a request that is not a chunk's and adds it to
+// the checkpoint, once the chunks are being processed.
+func (p *processor) spend(usage Usage) {
+	if usage == (Usage{}) {
+		return
+	}
+	p.progress.emit(ProgressEvent{Chunk: -1, Status: StepDone, Usage: usage})
+	if p.checkpoint == nil {
+		return
+	}
+	if err := p.checkpoint.Spend(usage); err != nil {
+		fmt.Fprintf(p.out, "Warning: failed to update checkpoint: %v\n", err)
+	}
 }
 
-// CleanCache removes the entire chunk directory for a given file path
-func CleanCache(filePath string) error {
+// responseUsage returns the usage billed for a response of the model.
+func responseUsage(model Model, res *openai.ChatCompletion) Usage {
+	return Usage{
+		PromptTokens:     res.Usage.PromptTokens,
+		CompletionTokens: res.Usage.CompletionTokens,
+		Cost:             usageCost(model, res.Usage.PromptTokens, res.Usage.CompletionTokens),
+	}
+}
+
+// chunkDirPath returns the directory of the chunks and results of a file: the
+// path of the file without its extension, with the label as a subdirectory
+// so that labeled caches don't clobber each other.
+func chunkDirPath(filePath, label string) (string, error) {
 	chunkDir := strings.TrimSuffix(filePath, filepath.Ext(filePath))
+	if label == "" {
+		return chunkDir, nil
+	}
+	if label == "." || label == ".." || strings.ContainsAny(label, `/\`) {
+		return "", invalidConfig(fmt.Errorf("invalid cache label %q: it must be a plain directory name", label))
+	}
+	return filepath.Join(chunkDir, label), nil
+}
+
+// CleanCache removes the entire chunk directory for a given file path,
+// including the labeled caches.
+func CleanCache(filePath string) error {
+	return CleanCacheLabel(filePath, "")
+}
+
+// CleanCacheLabel removes the cache of a file with the given label only.
+func CleanCacheLabel(filePath, label string) error {
+	chunkDir, err := chunkDirPath(filePath, label)
+	if err != nil {
+		return err
+	}
 
 	if _, err := os.Stat(chunkDir); os.IsNotExist(err) {
 		fmt.Printf("No cache directory found: %s\n", chunkDir)
 		return nil
 	}
 
-	err := os.RemoveAll(chunkDir)
+	err = os.RemoveAll(chunkDir)
 	if err != nil {
 		return fmt.Errorf("failed to remove cache directory: %w", err)
 	}
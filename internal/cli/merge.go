@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// MergeOutputs merges combined outputs, e.g. of several files, into one
+// deduplicated output written to outputPath, or to w when it is empty. The
+// lines are kept in the order they first appear unless sortLines is set. The
+// header blocks written with --output-header are left out.
+func MergeOutputs(w, log io.Writer, paths []string, outputPath string, sortLines bool) error {
+	contents := make([]string, len(paths))
+	for i, path := range paths {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return withCategory(ErrInput, fmt.Errorf("failed to read combined output: %w", err))
+		}
+		contents[i] = string(b)
+	}
+
+	merged, total := mergeOutputs(contents, sortLines)
+	lines := strings.Count(merged, "\n")
+
+	if outputPath == "" {
+		_, err := io.WriteString(w, merged)
+		return err
+	}
+	if err := os.WriteFile(outputPath, []byte(merged), 0644); err != nil {
+		return fmt.Errorf("failed to write merged output: %w", err)
+	}
+	fmt.Fprintf(log, "Merged %d files into %s: %d lines, %d duplicates dropped\n", len(paths), outputPath, lines, total-lines)
+	return nil
+}
+
+// mergeOutputs returns the distinct non-blank lines of the outputs and the
+// number of non-blank lines read.
+func mergeOutputs(contents []string, sortLines bool) (string, int) {
+	seen := make(map[string]bool)
+	var lines []string
+	total := 0
+	for _, content := range contents {
+		for _, line := range strings.Split(stripOutputHeader(content), "\n") {
+			line = strings.TrimSuffix(line, "\r")
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			total++
+			if seen[line] {
+				continue
+			}
+			seen[line] = true
+			lines = append(lines, line)
+		}
+	}
+
+	if sortLines {
+		sort.Strings(lines)
+	}
+	if len(lines) == 0 {
+		return "", total
+	}
+	return strings.Join(lines, "\n") + "\n", total
+}
+
+// stripOutputHeader removes the header block that starts a combined output
+// written with an output header.
+func stripOutputHeader(content string) string {
+	if !strings.HasPrefix(content, "# mapred-llm ") {
+		return content
+	}
+	if i := strings.Index(content, "\n\n"); i >= 0 {
+		return content[i+2:]
+	}
+	return ""
+}
@@ -0,0 +1,52 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMergeOutputs(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "a.combined_results.txt")
+	second := filepath.Join(dir, "b.combined_results.txt")
+	header := outputHeader("keep the fruits", ModelGPT5Nano, 2000, time.Now())
+	if err := os.WriteFile(first, []byte(header+"pear\napple\n\nbanana\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(second, []byte("banana\r\ncherry\npear\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The lines are kept in the order they first appear
+	output := filepath.Join(dir, "merged.txt")
+	var log bytes.Buffer
+	if err := MergeOutputs(nil, &log, []string{first, second}, output, false); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "pear\napple\nbanana\ncherry\n"; string(content) != expected {
+		t.Errorf("Expected %q, got %q", expected, content)
+	}
+	if expected := "Merged 2 files into " + output + ": 4 lines, 2 duplicates dropped\n"; log.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, log.String())
+	}
+
+	// Sorted, to stdout
+	var stdout bytes.Buffer
+	if err := MergeOutputs(&stdout, &log, []string{second, first}, "", true); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "apple\nbanana\ncherry\npear\n"; stdout.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, stdout.String())
+	}
+
+	if err := MergeOutputs(&stdout, &log, []string{filepath.Join(dir, "missing.txt")}, "", false); err == nil {
+		t.Error("Expected an error for a missing input")
+	}
+}
@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// tokenBuckets are the upper bounds of the token histograms.
+var tokenBuckets = []int64{256, 512, 1024, 2048, 4096, 8192, 16384}
+
+// Metrics counts what happens during runs and exposes it in the Prometheus
+// text format. Its methods are safe to call on a nil Metrics.
+type Metrics struct {
+	chunksProcessed atomic.Int64
+	cacheHits       atomic.Int64
+	apiErrors       atomic.Int64
+	retries         atomic.Int64
+
+	mu               sync.Mutex
+	promptTokens     histogram
+	completionTokens histogram
+}
+
+// histogram is a Prometheus histogram over tokenBuckets.
+type histogram struct {
+	counts []int64
+	sum    int64
+	count  int64
+}
+
+func (h *histogram) observe(v int64) {
+	if h.counts == nil {
+		h.counts = make([]int64, len(tokenBuckets))
+	}
+	for i, bound := range tokenBuckets {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// NewMetrics returns metrics with all the counters at zero.
+func NewMetrics() *Metrics {
+	return &Metrics{}
+}
+
+// chunkDone counts a processed chunk and observes the tokens of its request.
+func (m *Metrics) chunkDone(result chunkResult) {
+	if m == nil {
+		return
+	}
+	m.chunksProcessed.Add(1)
+	if result.Cached {
+		m.cacheHits.Add(1)
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.promptTokens.observe(result.Usage.PromptTokens)
+	m.completionTokens.observe(result.Usage.CompletionTokens)
+}
+
+// apiError counts a failed request.
+func (m *Metrics) apiError() {
+	if m != nil {
+		m.apiErrors.Add(1)
+	}
+}
+
+// retry counts a retried request.
+func (m *Metrics) retry() {
+	if m != nil {
+		m.retries.Add(1)
+	}
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.write(w)
+}
+
+func (m *Metrics) write(w io.Writer) {
+	writeCounter(w, "mapred_llm_chunks_processed_total", "Chunks processed, cached ones included.", m.chunksProcessed.Load())
+	writeCounter(w, "mapred_llm_cache_hits_total", "Chunks whose result was read from the cache.", m.cacheHits.Load())
+	writeCounter(w, "mapred_llm_api_errors_total", "Failed API requests, retried ones included and the ones cancelled by the run excluded.", m.apiErrors.Load())
+	writeCounter(w, "mapred_llm_retries_total", "Retried API requests.", m.retries.Load())
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	writeHistogram(w, "mapred_llm_prompt_tokens", "Prompt tokens billed per chunk request.", m.promptTokens)
+	writeHistogram(w, "mapred_llm_completion_tokens", "Completion tokens billed per chunk request.", m.completionTokens)
+}
+
+func writeCounter(w io.Writer, name, help string, value int64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, value)
+}
+
+func writeHistogram(w io.Writer, name, help string, h histogram) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	for i, bound := range tokenBuckets {
+		var count int64
+		if h.counts != nil {
+			count = h.counts[i]
+		}
+		fmt.Fprintf(w, "%s_bucket{le=\"%d\"} %d\n", name, bound, count)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n%s_sum %d\n%s_count %d\n", name, h.count, name, h.sum, name, h.count)
+}
@@ -0,0 +1,127 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openai/openai-go"
+)
+
+func TestMetrics_Endpoint(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "metrics_test.txt")
+	text := strings.Repeat("word ", 3000)
+	if err := os.WriteFile(testFile, []byte(text), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	metrics := NewMetrics()
+	server := httptest.NewServer(metrics)
+	defer server.Close()
+
+	scrape := func() string {
+		res, err := http.Get(server.URL + "/metrics")
+		if err != nil {
+			t.Fatalf("Failed to scrape the metrics: %v", err)
+		}
+		defer res.Body.Close()
+		b, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatalf("Failed to read the metrics: %v", err)
+		}
+		return string(b)
+	}
+
+	before := scrape()
+	for _, name := range []string{"mapred_llm_chunks_processed_total", "mapred_llm_cache_hits_total", "mapred_llm_api_errors_total", "mapred_llm_retries_total"} {
+		if !strings.Contains(before, name+" 0\n") {
+			t.Errorf("Expected %s at zero before the run, got:\n%s", name, before)
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.RetryBackoff = time.Millisecond
+	opts.Concurrency = 1
+	opts.Metrics = metrics
+
+	chunks, err := splitChunks(text, opts)
+	if err != nil {
+		t.Fatalf("splitChunks failed: %v", err)
+	}
+
+	mock := &mockChatGenerator{
+		usage: openai.CompletionUsage{PromptTokens: 2100, CompletionTokens: 300},
+		errorFunc: func(callCount int) error {
+			if callCount == 1 {
+				return newAPIError(http.StatusServiceUnavailable)
+			}
+			return nil
+		},
+	}
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	after := scrape()
+	for _, expected := range []string{
+		fmt.Sprintf("mapred_llm_chunks_processed_total %d\n", len(chunks)),
+		"mapred_llm_cache_hits_total 0\n",
+		"mapred_llm_api_errors_total 1\n",
+		"mapred_llm_retries_total 1\n",
+		"# TYPE mapred_llm_prompt_tokens histogram\n",
+		fmt.Sprintf("mapred_llm_prompt_tokens_bucket{le=\"2048\"} 0\nmapred_llm_prompt_tokens_bucket{le=\"4096\"} %d\n", len(chunks)),
+		fmt.Sprintf("mapred_llm_prompt_tokens_sum %d\n", 2100*len(chunks)),
+		fmt.Sprintf("mapred_llm_completion_tokens_count %d\n", len(chunks)),
+	} {
+		if !strings.Contains(after, expected) {
+			t.Errorf("Expected %q in the metrics, got:\n%s", expected, after)
+		}
+	}
+
+	// A rerun is served from the cache
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed on rerun: %v", err)
+	}
+	if expected := fmt.Sprintf("mapred_llm_cache_hits_total %d\n", len(chunks)); !strings.Contains(scrape(), expected) {
+		t.Errorf("Expected %q in the metrics after the rerun", expected)
+	}
+}
+
+func TestMetrics_CancelledRequestsAreNotAPIErrors(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "metrics_cancel_test.txt")
+	if err := os.WriteFile(testFile, []byte("slow line with a few words"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	metrics := NewMetrics()
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.Metrics = metrics
+	opts.Log = io.Discard
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	generator := &blockingGenerator{prefix: "slow"}
+	if err := ProcessWithClientOptions(ctx, generator, "test prompt", testFile, opts); err == nil {
+		t.Fatal("Expected the cancelled run to fail")
+	}
+	if generator.cancelled.Load() == 0 {
+		t.Fatal("Expected the request to be cancelled")
+	}
+
+	var sb strings.Builder
+	metrics.write(&sb)
+	if !strings.Contains(sb.String(), "mapred_llm_api_errors_total 0\n") {
+		t.Errorf("Expected the cancelled request not to count as an API error, got:\n%s", sb.String())
+	}
+}
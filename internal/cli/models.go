@@ -1,5 +1,11 @@
 package cli
 
+import (
+	"fmt"
+
+	"github.com/tiktoken-go/tokenizer"
+)
+
 // Model represents an AI model name
 type Model string
 
@@ -10,3 +16,75 @@ const (
 	ModelGPT5     Model = "gpt-5"
 	ModelGPT51    Model = "gpt-5.1"
 )
+
+// defaultConcurrency is the number of chunks processed in parallel for each
+// model when not configured, reflecting the typical rate limits of its tier.
+var defaultConcurrency = map[Model]int{
+	ModelGPT5Nano: 32,
+	ModelGPT5Mini: 16,
+	ModelGPT5:     8,
+	ModelGPT51:    8,
+}
+
+// fallbackConcurrency is used for models without a default concurrency.
+const fallbackConcurrency = 8
+
+// concurrencyFor returns the number of chunks to process in parallel, the
+// configured value taking precedence over the model default.
+func concurrencyFor(model Model, configured int) int {
+	if configured > 0 {
+		return configured
+	}
+	if concurrency, ok := defaultConcurrency[model]; ok {
+		return concurrency
+	}
+	return fallbackConcurrency
+}
+
+// modelEncodings is the tokenizer encoding of each model, the one its token
+// IDs refer to.
+var modelEncodings = map[Model]tokenizer.Encoding{
+	ModelGPT5Nano: tokenizer.O200kBase,
+	ModelGPT5Mini: tokenizer.O200kBase,
+	ModelGPT5:     tokenizer.O200kBase,
+	ModelGPT51:    tokenizer.O200kBase,
+}
+
+// fallbackEncoding is used for models without a known encoding.
+const fallbackEncoding = tokenizer.O200kBase
+
+// encodingFor returns the tokenizer encoding of the model.
+func encodingFor(model Model) tokenizer.Encoding {
+	if encoding, ok := modelEncodings[model]; ok {
+		return encoding
+	}
+	return fallbackEncoding
+}
+
+// maxOutputTokens is the maximum number of output tokens of each model.
+var maxOutputTokens = map[Model]int64{
+	ModelGPT5Nano: 128000,
+	ModelGPT5Mini: 128000,
+	ModelGPT5:     128000,
+	ModelGPT51:    128000,
+}
+
+// outputTokenWarnings tells, before the run, when the outputs may exceed the
+// output tokens of the model or the configured maximum. An output is at most
+// as long as its chunk when the model filters it.
+func outputTokenWarnings(opts Options) []string {
+	var warnings []string
+	limit, known := maxOutputTokens[opts.Model]
+	chunkSize := int64(opts.chunkSize())
+
+	switch {
+	case known && opts.MaxOutputTokens > limit:
+		warnings = append(warnings, fmt.Sprintf("the max output tokens (%d) exceeds the %d output tokens of %s, outputs are capped by the model", opts.MaxOutputTokens, limit, opts.Model))
+	case known && opts.MaxOutputTokens == 0 && chunkSize > limit:
+		warnings = append(warnings, fmt.Sprintf("chunks of up to %d tokens may produce outputs exceeding the %d output tokens of %s", chunkSize, limit, opts.Model))
+	}
+	if opts.MaxOutputTokens > 0 && opts.MaxOutputTokens < chunkSize {
+		warnings = append(warnings, fmt.Sprintf("the max output tokens (%d) is lower than the chunk size (%d), outputs keeping most of their chunk may be truncated", opts.MaxOutputTokens, chunkSize))
+	}
+	return warnings
+}
@@ -0,0 +1,148 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/packages/ssestream"
+)
+
+func TestConcurrencyFor(t *testing.T) {
+	if concurrencyFor(ModelGPT5Nano, 0) == concurrencyFor(ModelGPT5, 0) {
+		t.Error("Expected the default concurrency to differ between gpt-5-nano and gpt-5")
+	}
+
+	for model := range modelCosts {
+		if _, ok := defaultConcurrency[model]; !ok {
+			t.Errorf("Model %s has no default concurrency", model)
+		}
+	}
+
+	if got := concurrencyFor(ModelGPT5Nano, 3); got != 3 {
+		t.Errorf("Expected the configured concurrency to take precedence, got %d", got)
+	}
+
+	if got := concurrencyFor(Model("unknown"), 0); got != fallbackConcurrency {
+		t.Errorf("Expected the fallback concurrency for an unknown model, got %d", got)
+	}
+}
+
+// inFlightChatGenerator records the maximum number of concurrent requests.
+type inFlightChatGenerator struct {
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+}
+
+func (g *inFlightChatGenerator) GenerateChatCompletion(ctx context.Context, params openai.ChatCompletionNewParams) (*openai.ChatCompletion, error) {
+	g.mu.Lock()
+	g.inFlight++
+	if g.inFlight > g.maxInFlight {
+		g.maxInFlight = g.inFlight
+	}
+	g.mu.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	g.mu.Lock()
+	g.inFlight--
+	g.mu.Unlock()
+
+	return &openai.ChatCompletion{
+		Choices: []openai.ChatCompletionChoice{
+			{FinishReason: "stop", Message: openai.ChatCompletionMessage{Content: "ok"}},
+		},
+	}, nil
+}
+
+func (g *inFlightChatGenerator) GenerateChatCompletionStream(ctx context.Context, params openai.ChatCompletionNewParams) *ssestream.Stream[openai.ChatCompletionChunk] {
+	return nil
+}
+
+func TestProcessWithClient_ConcurrencyLimit(t *testing.T) {
+	var sb strings.Builder
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&sb, "line %d with a few words to fill the chunk\n", i)
+	}
+
+	for _, concurrency := range []int{1, 2} {
+		t.Run(fmt.Sprintf("concurrency %d", concurrency), func(t *testing.T) {
+			tmpDir := t.TempDir()
+			testFile := filepath.Join(tmpDir, "concurrency_test.txt")
+			if err := os.WriteFile(testFile, []byte(sb.String()), 0644); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+
+			opts := DefaultOptions()
+			opts.RequireConfirmation = false
+			opts.Concurrency = concurrency
+
+			generator := &inFlightChatGenerator{}
+			if err := ProcessWithClientOptions(context.Background(), generator, "test prompt", testFile, opts); err != nil {
+				t.Fatalf("ProcessWithClientOptions failed: %v", err)
+			}
+
+			if generator.maxInFlight > concurrency {
+				t.Errorf("Expected at most %d concurrent requests, got %d", concurrency, generator.maxInFlight)
+			}
+		})
+	}
+}
+
+func TestOutputTokenWarnings(t *testing.T) {
+	for model := range modelCosts {
+		if _, ok := maxOutputTokens[model]; !ok {
+			t.Errorf("Model %s has no max output tokens", model)
+		}
+	}
+
+	opts := DefaultOptions()
+	if warnings := outputTokenWarnings(opts); len(warnings) != 0 {
+		t.Errorf("Expected no warning by default, got %v", warnings)
+	}
+
+	opts.MaxOutputTokens = 1000
+	if warnings := outputTokenWarnings(opts); len(warnings) != 1 || !strings.Contains(warnings[0], "lower than the chunk size") {
+		t.Errorf("Expected a truncation warning, got %v", warnings)
+	}
+
+	opts.MaxOutputTokens = 0
+	opts.ChunkSize = 200000
+	if warnings := outputTokenWarnings(opts); len(warnings) != 1 || !strings.Contains(warnings[0], "may produce outputs exceeding") {
+		t.Errorf("Expected a warning for chunks larger than the model limit, got %v", warnings)
+	}
+}
+
+func TestProcessWithClient_MaxOutputTokensWarning(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "output_tokens_test.txt")
+	if err := os.WriteFile(testFile, []byte("apple\npear\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	var log strings.Builder
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.MaxOutputTokens = 200000
+	opts.Log = &log
+
+	mock := &mockChatGenerator{}
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	expected := fmt.Sprintf("Warning: the max output tokens (200000) exceeds the %d output tokens of %s", maxOutputTokens[ModelGPT5Nano], ModelGPT5Nano)
+	if !strings.Contains(log.String(), expected) {
+		t.Errorf("Expected the warning %q, got:\n%s", expected, log.String())
+	}
+	if got := mock.params[0].MaxCompletionTokens.Value; got != 200000 {
+		t.Errorf("Expected the max output tokens to be sent, got %d", got)
+	}
+}
@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// numberedFileKinds are the files of the chunk directory numbered after the
+// chunks.
+var numberedFileKinds = []string{"chunk", "result", "context"}
+
+// chunkNumber is the number of the chunk at index i in the file names and
+// messages: one-based unless ZeroIndex is set.
+func (o Options) chunkNumber(i int) int {
+	if o.ZeroIndex {
+		return i
+	}
+	return i + 1
+}
+
+// chunkFileName is the name of the file of the given kind, e.g. "result", of
+// the chunk at index i.
+func (o Options) chunkFileName(kind string, i int) string {
+	return fmt.Sprintf("%s%d.txt", kind, o.chunkNumber(i))
+}
+
+// migrateChunkNumbering renames the files of a cache numbered otherwise than
+// the run, e.g. a one-based cache processed with --zero-index, so that no
+// result is read as the one of its neighbor. The caches without manifest are
+// one-based.
+func migrateChunkNumbering(out io.Writer, chunkDir string, opts Options) error {
+	meta, err := loadCacheMeta(chunkDir)
+	if err != nil {
+		return err
+	}
+	cachedZeroIndex := meta != nil && meta.ZeroIndex
+	if cachedZeroIndex == opts.ZeroIndex {
+		return nil
+	}
+
+	from, to := opts, opts
+	from.ZeroIndex = cachedZeroIndex
+	count := numberedFileCount(chunkDir, from)
+	if count == 0 {
+		return nil
+	}
+	if opts.CacheReadOnly {
+		return invalidConfig(fmt.Errorf("the cache in %s/ is numbered from %d but this run numbers the chunks from %d and the cache is read-only: flip --zero-index", chunkDir, from.chunkNumber(0), to.chunkNumber(0)))
+	}
+
+	fmt.Fprintf(out, "WARNING: the cache in %s/ is numbered from %d, renumbering its %d chunks from %d\n", chunkDir, from.chunkNumber(0), count, to.chunkNumber(0))
+
+	// Renaming towards the free end never overwrites a file not renamed yet
+	rename := func(i int) error {
+		for _, kind := range numberedFileKinds {
+			oldPath := filepath.Join(chunkDir, from.chunkFileName(kind, i))
+			if _, err := os.Stat(oldPath); os.IsNotExist(err) {
+				continue
+			}
+			if err := os.Rename(oldPath, filepath.Join(chunkDir, to.chunkFileName(kind, i))); err != nil {
+				return fmt.Errorf("failed to renumber the cache: %w", err)
+			}
+		}
+		return nil
+	}
+	if opts.ZeroIndex {
+		for i := 0; i < count; i++ {
+			if err := rename(i); err != nil {
+				return err
+			}
+		}
+	} else {
+		for i := count - 1; i >= 0; i-- {
+			if err := rename(i); err != nil {
+				return err
+			}
+		}
+	}
+
+	if meta == nil {
+		meta = &legacyCacheMeta
+	}
+	migrated := *meta
+	migrated.ZeroIndex = opts.ZeroIndex
+	return saveCacheMeta(chunkDir, migrated, opts.cacheFilePerm())
+}
+
+// numberedFileCount returns the number of chunks having files in the chunk
+// directory, the last chunk with a file of any kind delimiting them.
+func numberedFileCount(chunkDir string, opts Options) int {
+	entries, err := os.ReadDir(chunkDir)
+	if err != nil {
+		return 0
+	}
+
+	count := 0
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".txt")
+		if !ok {
+			continue
+		}
+		for _, kind := range numberedFileKinds {
+			digits, ok := strings.CutPrefix(name, kind)
+			if n, err := strconv.Atoi(digits); ok && err == nil && n >= opts.chunkNumber(0) {
+				count = max(count, n-opts.chunkNumber(0)+1)
+			}
+		}
+	}
+	return count
+}
@@ -0,0 +1,122 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/openai/openai-go"
+)
+
+func TestProcessWithClient_ZeroIndex(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "zero_index_test.txt")
+	var content strings.Builder
+	for i := 0; i < 30; i++ {
+		fmt.Fprintf(&content, "line %d of the input\n", i)
+	}
+	if err := os.WriteFile(testFile, []byte(content.String()), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	var log bytes.Buffer
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.ChunkSize = 10
+	opts.ZeroIndex = true
+	opts.IfExists = IfExistsOverwrite
+	opts.Log = &log
+
+	chunks, err := splitChunks(content.String(), opts)
+	if err != nil {
+		t.Fatalf("splitChunks failed: %v", err)
+	}
+	// Past 10 chunks the lexical order of the files differs from theirs
+	if len(chunks) <= 10 {
+		t.Fatalf("Expected more than 10 chunks, got %d", len(chunks))
+	}
+	var expected strings.Builder
+	for _, chunk := range chunks {
+		fmt.Fprintf(&expected, "kept %s\n", strings.SplitN(chunk, "\n", 2)[0])
+	}
+
+	mock := &mockChatGenerator{
+		requestFunc: func(params openai.ChatCompletionNewParams) string {
+			return fmt.Sprintf("kept %s\n", strings.SplitN(userContent(params), "\n", 2)[0])
+		},
+	}
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	chunkDir := filepath.Join(tmpDir, "zero_index_test")
+	checkFiles := func(first int) {
+		t.Helper()
+		for i, chunk := range chunks {
+			result, err := os.ReadFile(filepath.Join(chunkDir, fmt.Sprintf("result%d.txt", first+i)))
+			if err != nil {
+				t.Fatalf("Failed to read the result of chunk %d: %v", first+i, err)
+			}
+			if want := fmt.Sprintf("kept %s\n", strings.SplitN(chunk, "\n", 2)[0]); string(result) != want {
+				t.Errorf("result%d.txt: expected %q, got %q", first+i, want, result)
+			}
+		}
+		unused := len(chunks)
+		if first == 1 {
+			unused = 0
+		}
+		for _, kind := range []string{"chunk", "result"} {
+			if _, err := os.Stat(filepath.Join(chunkDir, fmt.Sprintf("%s%d.txt", kind, unused))); !os.IsNotExist(err) {
+				t.Errorf("Expected no %s%d.txt when numbering from %d", kind, unused, first)
+			}
+		}
+
+		combined, err := os.ReadFile(filepath.Join(tmpDir, "zero_index_test.combined_results.txt"))
+		if err != nil {
+			t.Fatalf("Failed to read combined output: %v", err)
+		}
+		if string(combined) != expected.String() {
+			t.Errorf("Expected the results combined in the order of the chunks:\n%s\ngot:\n%s", expected.String(), combined)
+		}
+	}
+	checkFiles(0)
+	if _, err := os.Stat(filepath.Join(chunkDir, "chunk0.txt")); err != nil {
+		t.Errorf("Expected chunk0.txt: %v", err)
+	}
+	if !strings.Contains(log.String(), "Chunk 0: Result cached -> "+filepath.Join(chunkDir, "result0.txt")) {
+		t.Errorf("Expected the messages to number the chunks from 0, got:\n%s", log.String())
+	}
+
+	// Flipping the option renumbers the cache instead of misreading it
+	for _, zeroIndex := range []bool{false, true} {
+		log.Reset()
+		opts.ZeroIndex = zeroIndex
+		calls := mock.callCount
+		if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+			t.Fatalf("ProcessWithClientOptions failed: %v", err)
+		}
+		if mock.callCount != calls {
+			t.Errorf("Expected the renumbered cache to be used, got %d requests", mock.callCount-calls)
+		}
+		if !strings.Contains(log.String(), "renumbering its") {
+			t.Errorf("Expected a warning about the renumbering, got:\n%s", log.String())
+		}
+		checkFiles(opts.chunkNumber(0))
+	}
+
+	// Patching follows the numbering of the cache
+	if err := PatchChunk(context.Background(), testFile, 0, "patched\n", opts); err != nil {
+		t.Fatalf("PatchChunk failed: %v", err)
+	}
+	combined, err := os.ReadFile(filepath.Join(tmpDir, "zero_index_test.combined_results.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read combined output: %v", err)
+	}
+	if !strings.HasPrefix(string(combined), "patched\nkept line 1 ") {
+		t.Errorf("Expected the first chunk patched, got:\n%s", combined)
+	}
+}
@@ -0,0 +1,94 @@
+package cli
+
+import (
+	"sort"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// offsetStep tells that the byte at offset Text of a normalized text comes
+// from the byte at offset Source of the text it was normalized from.
+type offsetStep struct {
+	Text   int
+	Source int
+}
+
+// offsetMap maps the byte offsets of a normalized text back to the text it
+// was normalized from. It holds a step wherever their lengths diverge, the
+// offsets between two steps advancing together.
+type offsetMap []offsetStep
+
+func (m offsetMap) source(offset int) int {
+	i := sort.Search(len(m), func(i int) bool { return m[i].Text > offset })
+	if i == 0 {
+		return offset
+	}
+	source := m[i-1].Source + offset - m[i-1].Text
+	if i < len(m) {
+		source = min(source, m[i].Source)
+	}
+	return source
+}
+
+// lineEndingOffsets returns the offset map of the \r\n line endings of the
+// text converted to \n.
+func lineEndingOffsets(text string) offsetMap {
+	var m offsetMap
+	removed := 0
+	for offset := 0; ; {
+		i := strings.Index(text[offset:], "\r\n")
+		if i < 0 {
+			return m
+		}
+		offset += i + 2
+		removed++
+		m = append(m, offsetStep{Text: offset - removed, Source: offset})
+	}
+}
+
+// normalizeUnicodeOffsets is normalizeUnicode also returning the offset map
+// of the normalized text.
+func normalizeUnicodeOffsets(text string) (string, offsetMap) {
+	if norm.NFC.IsNormalString(text) {
+		return text, nil
+	}
+
+	var normalized strings.Builder
+	var m offsetMap
+	var it norm.Iter
+	it.InitString(norm.NFC, text)
+	for !it.Done() {
+		start := it.Pos()
+		segment := it.Next()
+		normalized.Write(segment)
+		if len(segment) != it.Pos()-start {
+			m = append(m, offsetStep{Text: normalized.Len(), Source: it.Pos()})
+		}
+	}
+	return normalized.String(), m
+}
+
+// sourceOffsets maps the byte offsets of the text returned by readInput back
+// to the ones of the file, undoing its normalizations in reverse order.
+type sourceOffsets struct {
+	base int
+	maps []offsetMap
+}
+
+func (o sourceOffsets) source(offset int) int {
+	for i := len(o.maps) - 1; i >= 0; i-- {
+		offset = o.maps[i].source(offset)
+	}
+	return o.base + offset
+}
+
+// sourceChunks returns the chunks with the ranges of the file they cover.
+func (o sourceOffsets) sourceChunks(chunks []textChunk) []textChunk {
+	mapped := make([]textChunk, len(chunks))
+	for i, chunk := range chunks {
+		chunk.Start, chunk.End = o.source(chunk.Start), o.source(chunk.End)
+		mapped[i] = chunk
+	}
+	return mapped
+}
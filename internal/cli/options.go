@@ -0,0 +1,443 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// defaultChunkSize is the maximum number of tokens of a chunk unless configured otherwise.
+const defaultChunkSize = 2000
+
+// defaultCompareSample is the number of chunks sent to each compared model
+// unless configured otherwise.
+const defaultCompareSample = 3
+
+// Default permissions of the chunk directory and of the files in it
+const (
+	defaultCacheDirPerm  os.FileMode = 0755
+	defaultCacheFilePerm os.FileMode = 0644
+)
+
+// Options configures a processing run.
+type Options struct {
+	// Model is the model used to process each chunk.
+	Model Model
+	// Extensions restricts the files processed in directory mode to these
+	// extensions, e.g. ".txt". All the files are processed when empty.
+	Extensions []string
+	// Force reuses the cached results computed with another prompt, model or
+	// request settings and, in directory mode, processes the files whose
+	// combined output is up to date instead of skipping them.
+	Force bool
+	// PromptOverridesDir, in directory mode, holds per-file prompts replacing
+	// the prompt of the run: <dir>/<file name>.txt, e.g. notes.md.txt.
+	PromptOverridesDir string
+	// FilesFrom is a file listing the files to process, one path per line,
+	// relative to its directory unless absolute. It replaces the file path.
+	FilesFrom string
+	// Strict fails a batch listed in FilesFrom before any request when a
+	// listed file is missing, instead of skipping it.
+	Strict bool
+	// Headers are added to every API request, e.g. for API versions or beta features.
+	Headers map[string]string
+	// DeveloperPrompt, when set, is sent as a developer message before each
+	// chunk, for instructions that must outrank the user content.
+	DeveloperPrompt string
+	// Tasks, when set, are run over the chunks instead of the prompt, each
+	// one with its own cache and combined output.
+	Tasks []Task
+	// Choices is the number of completions requested for each chunk, turned
+	// into its result with ChoicePolicy.
+	Choices int
+	// ChoicePolicy selects or combines the completions of a chunk.
+	ChoicePolicy ChoicePolicy
+	// LogitBias maps token IDs to a bias between -100 and 100 steering the
+	// token selection of the model for each chunk.
+	LogitBias map[string]int64
+	// StopSequences are up to 4 sequences at which the model stops
+	// generating the output of a chunk, e.g. the end of a record.
+	StopSequences []string
+	// AutoPrompt treats the prompt as a plain-English task description that
+	// the model first expands into the precise instruction used for every chunk.
+	AutoPrompt bool
+	// Concurrency is the number of chunks processed in parallel. The model
+	// default is used when zero.
+	Concurrency int
+	// Schedule is the order in which the chunks are sent.
+	Schedule Schedule
+	// RunningContext processes the chunks in order, each one with a running
+	// summary of the previous ones updated after each chunk.
+	RunningContext bool
+	// Sequential processes the chunks one at a time in the order of the
+	// input. With Stream, the output of each chunk is written to Stdout as it
+	// completes, making a live transcript of the document.
+	Sequential bool
+	// StopSentinel, when emitted by the model in the output of a chunk, stops
+	// the dispatch of the remaining chunks: the chunks in flight finish and
+	// the completed ones are combined.
+	StopSentinel string
+	// MaxRuntime, when set, stops sending new chunk requests once elapsed: the
+	// in-flight chunks finish and the completed ones are combined.
+	MaxRuntime time.Duration
+	// Deadline, when set, bounds the whole job, every file and task included:
+	// once elapsed the requests in flight are cancelled too, the completed
+	// chunks are combined into a partial output and the files and tasks not
+	// started are left out.
+	Deadline time.Duration
+	// ExpectedOutputRatio is the expected number of output tokens per input
+	// token used to estimate the cost of the run. When zero, the average of
+	// the past runs of the prompt, or of the prompt of each task, recorded in
+	// StatsFile is used, or 1 when the prompt was never run.
+	ExpectedOutputRatio float64
+	// StatsFile records the output ratio of the runs of each prompt. Nothing
+	// is recorded when empty.
+	StatsFile string
+	// RequireConfirmation asks the user before any API call is made.
+	RequireConfirmation bool
+	// ConfirmAbove, when set, only asks for the confirmation when the
+	// estimated cost of the run in USD exceeds it.
+	ConfirmAbove float64
+	// EstimateOnly prints the JSON estimation of the run and exits without
+	// prompting, calling the API or writing any file.
+	EstimateOnly bool
+	// Explain prints in plain language what the run would do and exits
+	// without prompting, calling the API or writing any file.
+	Explain bool
+	// CompareModels, when set, sends a sample of the chunks to each of these
+	// models and prints their outputs and costs side by side instead of
+	// processing the file, to choose the model of the full run.
+	CompareModels []Model
+	// CompareSample is the number of chunks sent to each compared model,
+	// spread over the input. Defaults to 3.
+	CompareSample int
+	// ZeroIndex numbers the chunks from 0 instead of 1 in the file names,
+	// e.g. result0.txt, and in the messages and outputs referring to them.
+	ZeroIndex bool
+	// Echo makes each chunk its own result instead of sending it to the
+	// model, to benchmark the chunking, the cache and the outputs without the
+	// API. The results are cached under their own label.
+	Echo bool
+	// NoChunkFiles skips writing the raw chunks next to their results.
+	NoChunkFiles bool
+	// PrefetchOnly processes and caches all the chunks without producing the
+	// combined output, so that a later run combines instantly.
+	PrefetchOnly bool
+	// IncrementalOutput appends the results, in the order of the input, to
+	// <file>.combined_results.partial.txt as they complete, so that a crash
+	// doesn't lose them. A result waits for the chunks before it to be
+	// written. The file has CacheFilePerm and is removed once the combined
+	// output is written.
+	IncrementalOutput bool
+	// SyncEvery is the number of results appended to the incremental output
+	// between two fsyncs, the file is never synced when zero.
+	SyncEvery int
+	// CombinedCache caches the results of all the chunks in a single file
+	// keyed by the chunks, prompt and model, so that an identical run skips
+	// the per-chunk cache.
+	CombinedCache bool
+	// SinceOffset processes only the input after this byte offset, e.g. the
+	// lines appended to a log since a previous run.
+	SinceOffset int64
+	// SinceMarker is a file recording the size of the input processed by the
+	// last complete run, from which the next run starts instead of
+	// SinceOffset.
+	SinceMarker string
+	// SinceLast processes only the input appended since the last complete
+	// run, whose size is recorded in the manifest of the chunk directory, and
+	// appends its results to the combined output.
+	SinceLast bool
+	// CacheLabel nests the cache in a subdirectory of the chunk directory so
+	// that runs with different labels, e.g. prompt variants, don't share it.
+	CacheLabel string
+	// PackedCache stores the chunks and results in a single compressed
+	// archive of the chunk directory, cache.pack, instead of one file each,
+	// for caches shared over a network filesystem. An existing archive is
+	// used whether or not it is set.
+	PackedCache bool
+	// CacheReadOnly uses the cached results without writing to the chunk
+	// directory, e.g. a shared cache mounted read-only: the results of the
+	// cache misses are kept in memory.
+	CacheReadOnly bool
+	// CacheDirPerm is the permission of the chunk directory when it is created.
+	CacheDirPerm os.FileMode
+	// CacheFilePerm is the permission of the files written in the chunk directory.
+	CacheFilePerm os.FileMode
+	// ReportCSV is the path of a CSV file receiving one row per chunk with its
+	// tokens, cost, latency and cache status. No report is written when empty.
+	ReportCSV string
+	// VerifyTokens compares the estimated prompt tokens of each chunk with the
+	// ones billed by the API and reports the discrepancies at the end.
+	VerifyTokens bool
+	// ResultFunc, when set, receives the result of each chunk as soon as it is
+	// ready, along with its zero-based index and whether it came from the cache.
+	// Calls are serialized, never concurrent.
+	ResultFunc func(index int, content string, cached bool)
+	// ProgressFunc, when set, receives the status changes of the chunks while
+	// they are processed. Calls are serialized, never concurrent.
+	ProgressFunc func(ProgressEvent)
+	// Metrics, when set, counts the chunks, cache hits, errors, retries and
+	// tokens of the run.
+	Metrics *Metrics
+	// Quiet hides the per-chunk and progress messages.
+	Quiet bool
+	// TUI replaces the progress messages with a live view of the chunks when
+	// the log is a terminal.
+	TUI bool
+	// Stdout receives the machine-readable output. Defaults to os.Stdout.
+	Stdout io.Writer
+	// Log receives the human-readable progress messages. Defaults to os.Stdout.
+	Log io.Writer
+	// ResultJSON prints the summary of the run as a single JSON object to
+	// Stdout once done: the combined output path, the chunk count, the cache
+	// hits, the token usage and cost, the duration and the chunk failures.
+	// Log then defaults to os.Stderr.
+	ResultJSON bool
+
+	// PreserveInputStructure makes the chunks an exact partition of the input so
+	// that blank lines and spacing are kept byte for byte.
+	PreserveInputStructure bool
+	// ChunkSize is the maximum number of tokens of a chunk.
+	ChunkSize int
+	// Packing is how the lines are packed into chunks.
+	Packing Packing
+	// SplitStrategy is the unit the chunks are cut between: lines or sentences.
+	SplitStrategy SplitStrategy
+	// MaxChunkSize is the hard ceiling of the number of tokens of a chunk:
+	// above ChunkSize, a chunk grows up to it to be cut at the end of a
+	// paragraph rather than in its middle. ChunkSize is strict when lower.
+	MaxChunkSize int
+	// MaxOutputTokens caps the output tokens of each chunk request, the model
+	// limit applies when zero.
+	MaxOutputTokens int64
+	// VerifyChunks checks that the chunks cover the whole input, without gap
+	// nor overlap, before any request.
+	VerifyChunks bool
+	// MaxChunks, when set, fails the run before any request if the input
+	// splits into more chunks, e.g. an unexpectedly large file.
+	MaxChunks int
+	// MaxRequestTokens, when set, is the ceiling of the tokens of the request
+	// of a chunk with its prompts, checked before any request.
+	MaxRequestTokens int
+	// OnRequestOverflow tells what to do with the chunks whose request
+	// exceeds MaxRequestTokens.
+	OnRequestOverflow OverflowPolicy
+	// MinChunkSize is the number of tokens below which the last chunk is merged
+	// into the previous one instead of being sent on its own.
+	MinChunkSize int
+	// NormalizeUnicode applies the NFC normalization to the input before chunking.
+	NormalizeUnicode bool
+	// LineDelimiter separates the lines of the input, which are never split
+	// across chunks, and of the combined output. Defaults to "\n".
+	LineDelimiter string
+	// RecordDelimiter, when set, separates the records (lines) of each chunk and
+	// is expected between their outputs, so that each output maps back to its
+	// record. The combined output has one line per record.
+	RecordDelimiter string
+	// Scored asks the model for a relevance score alongside the kept lines of each chunk.
+	Scored bool
+	// OutputSchema is the JSON schema every chunk output must follow. It is sent
+	// as the response format and each output is validated against it.
+	OutputSchema map[string]any
+	// MinScore drops the chunks scored below this threshold from the combined output.
+	MinScore float64
+	// SortByScore orders the combined output by decreasing score instead of input order.
+	SortByScore bool
+	// OmitEmpty leaves the chunks whose result is blank out of the combined output.
+	OmitEmpty bool
+	// FailOnEmpty makes the run fail instead of warning when the combined output is empty.
+	FailOnEmpty bool
+	// Reducer combines the chunk results into the final output. Results are
+	// concatenated when nil.
+	Reducer Reducer
+	// ReducePrompt, when set, makes the reduce model synthesize the chunk
+	// results with this prompt. It takes precedence over Reducer.
+	ReducePrompt string
+	// ReduceModel is the model used by the reduce step. Defaults to Model.
+	ReduceModel Model
+	// Citations makes the reduce model answer with the chunks supporting each
+	// segment of the answer, written as markdown and as JSONL next to it.
+	Citations bool
+	// Justify asks the model for the reason of each kept line, written next
+	// to the combined output which keeps only the lines.
+	Justify bool
+	// ChunkFilter, when set, only sends the chunks matching it to the model,
+	// the other chunks being kept unchanged in the combined output.
+	ChunkFilter *regexp.Regexp
+	// OutputFilter, when set, drops the lines of the combined output that
+	// don't match it.
+	OutputFilter *regexp.Regexp
+	// ChangesOnly leaves the chunks whose result equals their input out of
+	// the combined output, to highlight what the model modified.
+	ChangesOnly bool
+	// SideBySide also writes the input of each chunk next to its result to
+	// <file>.side_by_side.txt, to review the decisions of the model.
+	SideBySide bool
+	// MaxOutputFileSize, when positive, rotates the combined output into
+	// <file>.combined_results.partN.txt files of at most this many bytes,
+	// cut between lines.
+	MaxOutputFileSize int64
+	// Output is where the combined output is written instead of next to the
+	// input, the cache staying there. When it is a directory, or ends with a
+	// path separator, the output keeps its default name in it.
+	Output string
+	// OutputFormats are the formats the combined output is written in, each
+	// to its own file, e.g. <file>.combined_results.txt and
+	// <file>.combined_results.json. Defaults to text only.
+	OutputFormats []OutputFormat
+	// OutputHeader starts the combined output with a comment block recording
+	// the prompt, model, chunk size, timestamp and tool version.
+	OutputHeader bool
+	// PromptSuffix tells whether the keep-lines instruction is appended to
+	// the prompt, by default unless an output schema is used.
+	PromptSuffix PromptSuffixMode
+	// OnRefusal tells what to do with the chunks the model refused to process.
+	OnRefusal RefusalPolicy
+	// IfExists tells what to do when the combined output already exists.
+	IfExists IfExistsPolicy
+
+	// Stream receives the completions as server-sent events instead of a
+	// single response, the usage being requested in the final event.
+	Stream bool
+	// MaxRetries is the number of times a failed chunk request is retried.
+	MaxRetries int
+	// MaxRetriesNetwork and MaxRetriesRateLimit replace MaxRetries for the
+	// network errors and the rate limits (429) unless negative.
+	MaxRetriesNetwork   int
+	MaxRetriesRateLimit int
+	// MaxRetriesEmpty is the number of times a chunk is requested again when
+	// the response has no content.
+	MaxRetriesEmpty int
+	// RetryBackoff is the initial delay between retries, doubled on each attempt.
+	RetryBackoff time.Duration
+	// MaxRetryBackoff caps the delay between retries.
+	MaxRetryBackoff time.Duration
+	// MaxRetryAfter caps the delay the API asks to wait in the Retry-After
+	// header of a failed request, which replaces the backoff.
+	MaxRetryAfter time.Duration
+	// RetryOnStatus lists HTTP statuses retried in addition to the default ones.
+	RetryOnStatus []int
+	// NoRetryOnStatus lists HTTP statuses removed from the retried ones.
+	NoRetryOnStatus []int
+
+	// StragglerAfter is the fraction of completed chunks, e.g. 0.9, after
+	// which the requests in flight for longer than StragglerTimeout are
+	// cancelled and sent again. Zero disables the straggler policy.
+	StragglerAfter float64
+	// StragglerTimeout is how long a request may run once StragglerAfter of
+	// the chunks are complete.
+	StragglerTimeout time.Duration
+	// StragglerModel is the model straggler requests are sent again with,
+	// the map model when empty.
+	StragglerModel Model
+
+	// BreakerThreshold is the number of consecutive failures, across all chunks,
+	// after which the circuit opens and requests fail fast.
+	BreakerThreshold int
+	// BreakerCooldown is how long the circuit stays open before a probe request is allowed.
+	BreakerCooldown time.Duration
+}
+
+// DefaultOptions returns the options used by the CLI when no flag is provided.
+func DefaultOptions() Options {
+	return Options{
+		Model:               ModelGPT5Nano,
+		ChunkSize:           defaultChunkSize,
+		CacheDirPerm:        defaultCacheDirPerm,
+		CacheFilePerm:       defaultCacheFilePerm,
+		RequireConfirmation: true,
+		IfExists:            IfExistsOverwrite,
+		OnRefusal:           RefusalFail,
+		OnRequestOverflow:   OverflowSplit,
+		Choices:             1,
+		ChoicePolicy:        ChoiceFirst,
+		PromptSuffix:        PromptSuffixAuto,
+		Schedule:            ScheduleInput,
+		Packing:             PackingGreedy,
+		SplitStrategy:       SplitLines,
+		MaxRetries:          3,
+		MaxRetriesNetwork:   -1,
+		MaxRetriesRateLimit: -1,
+		SyncEvery:           1,
+		RetryBackoff:        time.Second,
+		MaxRetryBackoff:     30 * time.Second,
+		MaxRetryAfter:       time.Minute,
+		BreakerThreshold:    5,
+		BreakerCooldown:     30 * time.Second,
+	}
+}
+
+func (o Options) stdout() io.Writer {
+	if o.Stdout == nil {
+		return os.Stdout
+	}
+	return o.Stdout
+}
+
+func (o Options) log() io.Writer {
+	if o.Log == nil {
+		return os.Stdout
+	}
+	return o.Log
+}
+
+func (o Options) chunkSize() int {
+	if o.ChunkSize <= 0 {
+		return defaultChunkSize
+	}
+	return o.ChunkSize
+}
+
+func (o Options) compareSample() int {
+	if o.CompareSample <= 0 {
+		return defaultCompareSample
+	}
+	return o.CompareSample
+}
+
+func (o Options) lineDelimiter() string {
+	if o.LineDelimiter == "" {
+		return "\n"
+	}
+	return o.LineDelimiter
+}
+
+func (o Options) maxChunkSize() int {
+	if o.MaxChunkSize < o.chunkSize() {
+		return o.chunkSize()
+	}
+	return o.MaxChunkSize
+}
+
+func (o Options) cacheDirPerm() os.FileMode {
+	if o.CacheDirPerm == 0 {
+		return defaultCacheDirPerm
+	}
+	return o.CacheDirPerm
+}
+
+func (o Options) cacheFilePerm() os.FileMode {
+	if o.CacheFilePerm == 0 {
+		return defaultCacheFilePerm
+	}
+	return o.CacheFilePerm
+}
+
+// ParsePerm parses an octal permission such as 0700.
+func ParsePerm(s string) (os.FileMode, error) {
+	perm, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || perm > 0777 {
+		return 0, invalidConfig(fmt.Errorf("invalid permission %q (expected an octal mode such as 0700)", s))
+	}
+	return os.FileMode(perm), nil
+}
+
+func (o Options) reduceModel() Model {
+	if o.ReduceModel == "" {
+		return o.Model
+	}
+	return o.ReduceModel
+}
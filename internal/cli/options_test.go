@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProcessWithClient_CachePerms(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "perms_test.txt")
+	if err := os.WriteFile(testFile, []byte(strings.Repeat("word ", 3000)), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.CacheDirPerm = 0700
+	opts.CacheFilePerm = 0600
+
+	if err := ProcessWithClientOptions(context.Background(), &mockChatGenerator{}, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	chunkDir := filepath.Join(tmpDir, "perms_test")
+	info, err := os.Stat(chunkDir)
+	if err != nil {
+		t.Fatalf("Failed to stat chunk directory: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0700 {
+		t.Errorf("Expected the chunk directory to have permission 0700, got %#o", perm)
+	}
+
+	entries, err := os.ReadDir(chunkDir)
+	if err != nil {
+		t.Fatalf("Failed to read chunk directory: %v", err)
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			t.Fatalf("Failed to stat %s: %v", entry.Name(), err)
+		}
+		if perm := info.Mode().Perm(); perm != 0600 {
+			t.Errorf("Expected %s to have permission 0600, got %#o", entry.Name(), perm)
+		}
+	}
+}
+
+func TestParsePerm(t *testing.T) {
+	perm, err := ParsePerm("0700")
+	if err != nil || perm != 0700 {
+		t.Errorf("Expected 0700, got %#o (%v)", perm, err)
+	}
+	for _, invalid := range []string{"rwx", "0800", "1777", ""} {
+		if _, err := ParsePerm(invalid); err == nil {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+}
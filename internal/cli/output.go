@@ -0,0 +1,147 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// IfExistsPolicy tells what to do when the combined output file already exists.
+type IfExistsPolicy string
+
+// Policies applied when the combined output file already exists
+const (
+	// IfExistsOverwrite replaces the existing file.
+	IfExistsOverwrite IfExistsPolicy = "overwrite"
+	// IfExistsSkip leaves the existing file untouched and does nothing.
+	IfExistsSkip IfExistsPolicy = "skip"
+	// IfExistsError fails the run.
+	IfExistsError IfExistsPolicy = "error"
+	// IfExistsBackup renames the existing file with a .bak suffix before writing.
+	IfExistsBackup IfExistsPolicy = "backup"
+)
+
+// ErrOutputExists is returned when the combined output exists and the policy is IfExistsError.
+var ErrOutputExists = errors.New("combined output already exists")
+
+// ParseIfExistsPolicy validates a policy name.
+func ParseIfExistsPolicy(s string) (IfExistsPolicy, error) {
+	switch policy := IfExistsPolicy(s); policy {
+	case IfExistsOverwrite, IfExistsSkip, IfExistsError, IfExistsBackup:
+		return policy, nil
+	}
+	return "", invalidConfig(fmt.Errorf("unknown if-exists policy %q (expected overwrite, skip, error or backup)", s))
+}
+
+// combinedFilePath returns the path of the combined output for the given input file.
+func combinedFilePath(filePath string) string {
+	filePathWithoutExt := strings.TrimSuffix(filePath, filepath.Ext(filePath))
+	return fmt.Sprintf("%s.combined_results.txt", filePathWithoutExt)
+}
+
+// combinedOutputPath redirects the default path of a combined output to
+// Options.Output.
+func (o Options) combinedOutputPath(defaultPath string) string {
+	if o.Output == "" {
+		return defaultPath
+	}
+	if o.outputIsDir() {
+		return filepath.Join(o.Output, filepath.Base(defaultPath))
+	}
+	return o.Output
+}
+
+// outputIsDir tells whether Options.Output is a directory the combined
+// outputs are written in, rather than the path of the combined output.
+func (o Options) outputIsDir() bool {
+	if strings.HasSuffix(o.Output, "/") || strings.HasSuffix(o.Output, string(filepath.Separator)) {
+		return true
+	}
+	info, err := os.Stat(o.Output)
+	return err == nil && info.IsDir()
+}
+
+// checkExistingOutput applies the policy before any processing happens. It
+// returns true when the run must stop because the existing output is kept.
+func checkExistingOutput(out io.Writer, path string, policy IfExistsPolicy) (bool, error) {
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to stat combined output: %w", err)
+	}
+
+	switch policy {
+	case IfExistsSkip:
+		fmt.Fprintf(out, "Combined output %s already exists, skipping\n", path)
+		return true, nil
+	case IfExistsError:
+		return false, fmt.Errorf("%w: %s", ErrOutputExists, path)
+	}
+	return false, nil
+}
+
+// checkExistingOutputs applies the policy to the combined output in each of
+// its formats. Skipping the run requires all of them to exist.
+func checkExistingOutputs(out io.Writer, paths []string, policy IfExistsPolicy) (bool, error) {
+	if policy == IfExistsSkip {
+		for _, path := range paths {
+			if _, err := os.Stat(path); err != nil {
+				return false, nil
+			}
+		}
+		return checkExistingOutput(out, paths[0], policy)
+	}
+	for _, path := range paths {
+		if _, err := checkExistingOutput(out, path, policy); err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// writeCombinedOutput writes the combined results, backing up the existing
+// file first when required by the policy.
+func writeCombinedOutput(out io.Writer, path, content string, policy IfExistsPolicy) error {
+	if policy == IfExistsBackup {
+		if _, err := os.Stat(path); err == nil {
+			backupPath := path + ".bak"
+			if err := os.Rename(path, backupPath); err != nil {
+				return fmt.Errorf("failed to back up combined output: %w", err)
+			}
+			fmt.Fprintf(out, "Backed up existing combined output to %s\n", backupPath)
+		}
+	}
+
+	return os.WriteFile(path, []byte(content), 0644)
+}
+
+// appendCombinedOutput appends the combined results of the input appended to
+// the file to the ones of the previous runs.
+func appendCombinedOutput(path, content string) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncWriter serializes the writes of the concurrent chunk workers.
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
@@ -0,0 +1,151 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProcessWithClient_IfExistsPolicies(t *testing.T) {
+	tests := []struct {
+		policy          IfExistsPolicy
+		expectError     error
+		expectedContent string
+		expectedBackup  string
+		expectedCalls   int
+	}{
+		{policy: IfExistsOverwrite, expectedContent: "new output", expectedCalls: 1},
+		{policy: IfExistsSkip, expectedContent: "previous output", expectedCalls: 0},
+		{policy: IfExistsError, expectError: ErrOutputExists, expectedContent: "previous output", expectedCalls: 0},
+		{policy: IfExistsBackup, expectedContent: "new output", expectedBackup: "previous output", expectedCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			tmpDir := t.TempDir()
+			testFile := filepath.Join(tmpDir, "policy_test.txt")
+			if err := os.WriteFile(testFile, []byte("Some content"), 0644); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+
+			combinedFile := filepath.Join(tmpDir, "policy_test.combined_results.txt")
+			if err := os.WriteFile(combinedFile, []byte("previous output"), 0644); err != nil {
+				t.Fatalf("Failed to create combined file: %v", err)
+			}
+
+			mock := &mockChatGenerator{
+				responseFunc: func(callCount int) string {
+					return "new output"
+				},
+			}
+
+			opts := DefaultOptions()
+			opts.RequireConfirmation = false
+			opts.IfExists = tt.policy
+
+			err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts)
+			if tt.expectError != nil {
+				if !errors.Is(err, tt.expectError) {
+					t.Fatalf("Expected error %v, got: %v", tt.expectError, err)
+				}
+			} else if err != nil {
+				t.Fatalf("ProcessWithClientOptions failed: %v", err)
+			}
+
+			content, err := os.ReadFile(combinedFile)
+			if err != nil {
+				t.Fatalf("Failed to read combined results: %v", err)
+			}
+			if string(content) != tt.expectedContent {
+				t.Errorf("Expected combined content %q, got %q", tt.expectedContent, string(content))
+			}
+
+			backup, err := os.ReadFile(combinedFile + ".bak")
+			if tt.expectedBackup == "" {
+				if !os.IsNotExist(err) {
+					t.Errorf("Expected no backup file, got err=%v", err)
+				}
+			} else if string(backup) != tt.expectedBackup {
+				t.Errorf("Expected backup content %q, got %q (err=%v)", tt.expectedBackup, string(backup), err)
+			}
+
+			if mock.callCount != tt.expectedCalls {
+				t.Errorf("Expected %d API calls, got %d", tt.expectedCalls, mock.callCount)
+			}
+		})
+	}
+}
+
+func TestParseIfExistsPolicy(t *testing.T) {
+	if _, err := ParseIfExistsPolicy("backup"); err != nil {
+		t.Errorf("Expected backup to be valid, got: %v", err)
+	}
+	if _, err := ParseIfExistsPolicy("append"); err == nil {
+		t.Error("Expected an error for an unknown policy")
+	}
+}
+
+func TestProcessWithClient_Output(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   func(outDir string) string
+		expected func(outDir string) string
+	}{
+		{
+			name:     "file",
+			output:   func(outDir string) string { return filepath.Join(outDir, "summary.txt") },
+			expected: func(outDir string) string { return filepath.Join(outDir, "summary.txt") },
+		},
+		{
+			name:     "directory",
+			output:   func(outDir string) string { return outDir + string(filepath.Separator) },
+			expected: func(outDir string) string { return filepath.Join(outDir, "output_test.combined_results.txt") },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			testFile := filepath.Join(tmpDir, "output_test.txt")
+			if err := os.WriteFile(testFile, []byte("some content"), 0644); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+			outDir := filepath.Join(t.TempDir(), "reports")
+
+			opts := DefaultOptions()
+			opts.RequireConfirmation = false
+			opts.Output = tt.output(outDir)
+
+			mock := &mockChatGenerator{responseFunc: func(int) string { return "redirected" }}
+			if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+				t.Fatalf("ProcessWithClientOptions failed: %v", err)
+			}
+
+			content, err := os.ReadFile(tt.expected(outDir))
+			if err != nil || string(content) != "redirected" {
+				t.Errorf("Expected the combined output at %s, got %q (%v)", tt.expected(outDir), content, err)
+			}
+			if _, err := os.Stat(combinedFilePath(testFile)); !os.IsNotExist(err) {
+				t.Errorf("Expected no combined output next to the input, got %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(tmpDir, "output_test", "result1.txt")); err != nil {
+				t.Errorf("Expected the cache to stay by the input: %v", err)
+			}
+		})
+	}
+}
+
+func TestProcessWithClient_OutputFileForDirectory(t *testing.T) {
+	tmpDir := t.TempDir()
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.Output = filepath.Join(t.TempDir(), "summary.txt")
+
+	mock := &mockChatGenerator{}
+	err := ProcessWithClientOptions(context.Background(), mock, "test prompt", tmpDir, opts)
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("Expected an invalid config error, got %v", err)
+	}
+}
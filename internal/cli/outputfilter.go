@@ -0,0 +1,30 @@
+package cli
+
+import (
+	"regexp"
+	"strings"
+)
+
+// filterOutputLines keeps the lines of the combined output, separated by the
+// delimiter, matching the filter and returns the number of lines dropped.
+func filterOutputLines(output string, filter *regexp.Regexp, delimiter string) (string, int) {
+	trailingDelimiter := strings.HasSuffix(output, delimiter)
+	lines := strings.Split(strings.TrimSuffix(output, delimiter), delimiter)
+
+	kept := lines[:0]
+	for _, line := range lines {
+		if filter.MatchString(line) {
+			kept = append(kept, line)
+		}
+	}
+	dropped := len(lines) - len(kept)
+
+	if len(kept) == 0 {
+		return "", dropped
+	}
+	filtered := strings.Join(kept, delimiter)
+	if trailingDelimiter {
+		filtered += delimiter
+	}
+	return filtered, dropped
+}
@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestProcessWithClient_OutputFilter(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "filter_test.txt")
+	if err := os.WriteFile(testFile, []byte("some content"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.OutputFilter = regexp.MustCompile(`^ERROR\b`)
+
+	mock := &mockChatGenerator{
+		responseFunc: func(int) string {
+			return "ERROR disk full\nthe model kept this explanation\nWARN slow disk\nERROR out of memory\n"
+		},
+	}
+	if err := ProcessWithClientOptions(context.Background(), mock, "Keep the errors", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, "filter_test.combined_results.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read combined results: %v", err)
+	}
+	if expected := "ERROR disk full\nERROR out of memory\n"; string(content) != expected {
+		t.Errorf("Expected %q, got %q", expected, string(content))
+	}
+
+	// The cached result is unfiltered
+	cached, err := os.ReadFile(filepath.Join(tmpDir, "filter_test", "result1.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read cached result: %v", err)
+	}
+	if string(cached) != mock.responseFunc(1) {
+		t.Errorf("Expected the cached result to be the output of the model, got %q", string(cached))
+	}
+}
+
+func TestFilterOutputLines(t *testing.T) {
+	filter := regexp.MustCompile(`keep`)
+	tests := []struct {
+		input, expected string
+		dropped         int
+	}{
+		{"keep 1\ndrop\nkeep 2", "keep 1\nkeep 2", 1},
+		{"drop\ndrop\n", "", 2},
+		{"keep\n", "keep\n", 0},
+	}
+	for _, tt := range tests {
+		got, dropped := filterOutputLines(tt.input, filter, "\n")
+		if got != tt.expected || dropped != tt.dropped {
+			t.Errorf("filterOutputLines(%q) = %q, %d; expected %q, %d", tt.input, got, dropped, tt.expected, tt.dropped)
+		}
+	}
+}
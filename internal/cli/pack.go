@@ -0,0 +1,196 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// packFileName is the archive of the chunk directory holding all the chunks
+// and results of a packed cache.
+const packFileName = "cache.pack"
+
+// packEntry locates the compressed content of an entry in the archive.
+type packEntry struct {
+	offset int64
+	length int64
+}
+
+// packStore keeps the entries in a single append-only archive, so that a
+// cache shared over a network filesystem is one file instead of thousands.
+// Each record is a "<name> <length>\n" header followed by the gzipped
+// content, a later record of the same name replacing the earlier one. A
+// record truncated by a crash is ignored and overwritten by the next write.
+// The writers of several processes sharing the archive take turns with an
+// exclusive lock on it, each indexing the records appended by the others
+// before appending its own.
+type packStore struct {
+	mu    sync.Mutex
+	path  string
+	opts  Options
+	f     *os.File
+	size  int64
+	index map[string]packEntry
+}
+
+// openPackStore opens the archive, creating it unless the cache is read-only.
+func openPackStore(path string, opts Options) (*packStore, error) {
+	s := &packStore{path: path, opts: opts, index: make(map[string]packEntry)}
+
+	flag := os.O_RDWR | os.O_CREATE
+	if opts.CacheReadOnly {
+		flag = os.O_RDONLY
+	}
+	f, err := os.OpenFile(path, flag, opts.cacheFilePerm())
+	if err != nil {
+		if opts.CacheReadOnly && os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("failed to open cache archive: %w", err)
+	}
+	s.f = f
+
+	if opts.CacheReadOnly {
+		if err := s.load(); err != nil {
+			f.Close()
+			return nil, err
+		}
+		return s, nil
+	}
+
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to lock cache archive: %w", err)
+	}
+	defer unlockFile(f)
+	if err := s.load(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	// Drop a record truncated by a crash so that the next ones follow the
+	// complete records. The other writers hold the lock while appending,
+	// the record is not one being written.
+	if err := f.Truncate(s.size); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to repair cache archive: %w", err)
+	}
+	return s, nil
+}
+
+// load indexes the records of the archive from the end of the ones already
+// indexed.
+func (s *packStore) load() error {
+	r := bufio.NewReader(io.NewSectionReader(s.f, s.size, math.MaxInt64-s.size))
+	offset := s.size
+	for {
+		header, err := r.ReadString('\n')
+		if err != nil {
+			// The end of the archive, or a header truncated by a crash
+			break
+		}
+		name, length, ok := strings.Cut(strings.TrimSuffix(header, "\n"), " ")
+		n, err := strconv.ParseInt(length, 10, 64)
+		if !ok || err != nil || n < 0 {
+			return fmt.Errorf("corrupted cache archive %s at byte %d", s.path, offset)
+		}
+		if discarded, _ := r.Discard(int(n)); int64(discarded) < n {
+			// A record truncated by a crash
+			break
+		}
+
+		s.index[name] = packEntry{offset: offset + int64(len(header)), length: n}
+		offset += int64(len(header)) + n
+	}
+	s.size = offset
+	return nil
+}
+
+func packEntryName(kind string, i int) string {
+	return kind + strconv.Itoa(i)
+}
+
+func (s *packStore) Path(kind string, i int) string {
+	return fmt.Sprintf("%s[%s]", s.path, s.opts.chunkFileName(kind, i))
+}
+
+func (s *packStore) Read(kind string, i int) ([]byte, error) {
+	s.mu.Lock()
+	entry, ok := s.index[packEntryName(kind, i)]
+	s.mu.Unlock()
+	if !ok {
+		return nil, &os.PathError{Op: "read", Path: s.Path(kind, i), Err: os.ErrNotExist}
+	}
+
+	zr, err := gzip.NewReader(io.NewSectionReader(s.f, entry.offset, entry.length))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", s.Path(kind, i), err)
+	}
+	defer zr.Close()
+	b, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", s.Path(kind, i), err)
+	}
+	return b, nil
+}
+
+func (s *packStore) Write(kind string, i int, data []byte) error {
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	if _, err := zw.Write(data); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	name := packEntryName(kind, i)
+	header := fmt.Sprintf("%s %d\n", name, compressed.Len())
+	record := append([]byte(header), compressed.Bytes()...)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil || s.opts.CacheReadOnly {
+		return fmt.Errorf("cache archive %s is read-only", s.path)
+	}
+
+	// Append after the records written by the other processes since
+	if err := lockFile(s.f); err != nil {
+		return fmt.Errorf("failed to lock cache archive: %w", err)
+	}
+	defer unlockFile(s.f)
+	if err := s.load(); err != nil {
+		return err
+	}
+	// Drop a record left truncated by a writer that crashed, it would trail
+	// this one
+	if err := s.f.Truncate(s.size); err != nil {
+		return fmt.Errorf("failed to repair cache archive: %w", err)
+	}
+	if _, err := s.f.WriteAt(record, s.size); err != nil {
+		return fmt.Errorf("failed to write to cache archive: %w", err)
+	}
+	s.index[name] = packEntry{offset: s.size + int64(len(header)), length: int64(compressed.Len())}
+	s.size += int64(len(record))
+	return nil
+}
+
+func (s *packStore) Has(kind string, i int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.index[packEntryName(kind, i)]
+	return ok
+}
+
+func (s *packStore) Close() error {
+	if s.f == nil {
+		return nil
+	}
+	return s.f.Close()
+}
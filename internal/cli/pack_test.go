@@ -0,0 +1,183 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/openai/openai-go"
+)
+
+func TestProcessWithClient_PackedCache(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "packed_test.txt")
+	var lines []string
+	for i := range 5 {
+		lines = append(lines, fmt.Sprintf("line %d with a few words of content", i))
+	}
+	if err := os.WriteFile(testFile, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	mock := &mockChatGenerator{
+		requestFunc: func(params openai.ChatCompletionNewParams) string {
+			return strings.ToUpper(userContent(params)) + "\n"
+		},
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.ChunkSize = 10
+	opts.PackedCache = true
+	opts.Log = &bytes.Buffer{}
+
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+	if mock.callCount != 5 {
+		t.Fatalf("Expected 5 API calls, got %d", mock.callCount)
+	}
+
+	// The chunks and results are in the archive, not in their own files
+	chunkDir := filepath.Join(tmpDir, "packed_test")
+	if _, err := os.Stat(filepath.Join(chunkDir, packFileName)); err != nil {
+		t.Fatalf("Expected the cache archive: %v", err)
+	}
+	for _, name := range []string{"chunk1.txt", "result1.txt"} {
+		if _, err := os.Stat(filepath.Join(chunkDir, name)); !os.IsNotExist(err) {
+			t.Errorf("Expected no %s next to the archive, got %v", name, err)
+		}
+	}
+
+	store, err := openPackStore(filepath.Join(chunkDir, packFileName), opts)
+	if err != nil {
+		t.Fatalf("Failed to open the archive: %v", err)
+	}
+	for i, line := range lines {
+		result, err := store.Read("result", i)
+		if err != nil {
+			t.Fatalf("Failed to read result %d: %v", i, err)
+		}
+		if string(result) != strings.ToUpper(line)+"\n" {
+			t.Errorf("Result %d: expected %q, got %q", i, strings.ToUpper(line)+"\n", result)
+		}
+	}
+	store.Close()
+
+	// A rerun is served from the archive, even without the option
+	log := &bytes.Buffer{}
+	opts.PackedCache = false
+	opts.Log = log
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("Second ProcessWithClientOptions failed: %v", err)
+	}
+	if mock.callCount != 5 {
+		t.Errorf("Expected the rerun to be served from the archive, got %d API calls", mock.callCount)
+	}
+	if !strings.Contains(log.String(), "Using cached result -> "+filepath.Join(chunkDir, packFileName)+"[result1.txt]") {
+		t.Errorf("Expected the results to be read from the archive, got:\n%s", log.String())
+	}
+
+	if err := CleanCache(testFile); err != nil {
+		t.Fatalf("CleanCache failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(chunkDir, packFileName)); !os.IsNotExist(err) {
+		t.Errorf("Expected the archive to be removed, got %v", err)
+	}
+}
+
+func TestPackStore_IgnoresTruncatedRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), packFileName)
+	opts := DefaultOptions()
+
+	store, err := openPackStore(path, opts)
+	if err != nil {
+		t.Fatalf("openPackStore failed: %v", err)
+	}
+	for i, content := range []string{"first", "second"} {
+		if err := store.Write("result", i, []byte(content)); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	// A later record replaces the earlier one
+	if err := store.Write("result", 0, []byte("replaced")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	store.Close()
+
+	// A crash in the middle of a record
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open archive: %v", err)
+	}
+	f.WriteString("result2 1000\npartial")
+	f.Close()
+
+	store, err = openPackStore(path, opts)
+	if err != nil {
+		t.Fatalf("openPackStore failed: %v", err)
+	}
+	defer store.Close()
+	if store.Has("result", 2) {
+		t.Error("Expected the truncated record to be ignored")
+	}
+	if err := store.Write("result", 2, []byte("third")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	for i, want := range []string{"replaced", "second", "third"} {
+		got, err := store.Read("result", i)
+		if err != nil || string(got) != want {
+			t.Errorf("Read(result, %d) = %q, %v, want %q", i, got, err, want)
+		}
+	}
+	if _, err := store.Read("result", 3); !os.IsNotExist(err) {
+		t.Errorf("Expected a missing entry to be reported as not existing, got %v", err)
+	}
+}
+
+func TestPackStore_SharedBetweenWriters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), packFileName)
+	opts := DefaultOptions()
+
+	// Two processes sharing the cache
+	first, err := openPackStore(path, opts)
+	if err != nil {
+		t.Fatalf("openPackStore failed: %v", err)
+	}
+	defer first.Close()
+	second, err := openPackStore(path, opts)
+	if err != nil {
+		t.Fatalf("openPackStore failed: %v", err)
+	}
+	defer second.Close()
+
+	writes := []struct {
+		store   *packStore
+		content string
+	}{{first, "zero"}, {second, "one"}, {first, "two"}}
+	for i, w := range writes {
+		if err := w.store.Write("result", i, []byte(w.content)); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	if !second.Has("result", 0) {
+		t.Error("Expected a writer to index the records of the other before appending")
+	}
+
+	// No record overwrote another
+	store, err := openPackStore(path, opts)
+	if err != nil {
+		t.Fatalf("openPackStore failed: %v", err)
+	}
+	defer store.Close()
+	for i, w := range writes {
+		got, err := store.Read("result", i)
+		if err != nil || string(got) != w.content {
+			t.Errorf("Read(result, %d) = %q, %v, want %q", i, got, err, w.content)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/tiktoken-go/tokenizer"
+)
+
+// Packing is how the lines are packed into chunks.
+type Packing string
+
+// Packings
+const (
+	// PackingGreedy fills each chunk up to the chunk size, the last one
+	// getting what remains.
+	PackingGreedy Packing = "greedy"
+	// PackingBalanced keeps the number of chunks of the greedy packing but
+	// evens out their sizes, so that no chunk lags behind the others.
+	PackingBalanced Packing = "balanced"
+)
+
+// ParsePacking validates a packing name.
+func ParsePacking(s string) (Packing, error) {
+	switch packing := Packing(s); packing {
+	case PackingGreedy, PackingBalanced:
+		return packing, nil
+	}
+	return "", invalidConfig(fmt.Errorf("unknown packing %q (expected greedy or balanced)", s))
+}
+
+// balanceChunks splits the text in as many chunks as the greedy packing with
+// the smallest chunk size that still fits, found by binary search between the
+// average chunk size and the configured one.
+func balanceChunks(text string, chunks []textChunk, maxTokensPerChunk int, split func(limit int) ([]textChunk, error)) ([]textChunk, error) {
+	if len(chunks) < 2 {
+		return chunks, nil
+	}
+
+	enc, err := tokenizer.Get(tokenizer.Cl100kBase)
+	if err != nil {
+		return nil, withCategory(ErrTokenizer, fmt.Errorf("failed to get tokenizer: %w", err))
+	}
+
+	low, high := countTokens(enc, text)/len(chunks), maxTokensPerChunk
+	best := chunks
+	for low < high {
+		mid := (low + high) / 2
+		candidate, err := split(mid)
+		if err != nil {
+			return nil, err
+		}
+		if len(candidate) <= len(chunks) {
+			best = candidate
+			high = mid
+		} else {
+			low = mid + 1
+		}
+	}
+	return best, nil
+}
@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/tiktoken-go/tokenizer"
+)
+
+func TestSplitChunks_BalancedPacking(t *testing.T) {
+	var lines []string
+	for i := 0; i < 260; i++ {
+		lines = append(lines, fmt.Sprintf("record %d %s", i, strings.Repeat("data ", i%7)))
+	}
+	text := strings.Join(lines, "\n")
+
+	enc, err := tokenizer.Get(tokenizer.Cl100kBase)
+	if err != nil {
+		t.Fatalf("failed to get tokenizer: %v", err)
+	}
+	variance := func(chunks []string) float64 {
+		var sum float64
+		for _, chunk := range chunks {
+			sum += float64(countTokens(enc, chunk))
+		}
+		mean := sum / float64(len(chunks))
+		var v float64
+		for _, chunk := range chunks {
+			d := float64(countTokens(enc, chunk)) - mean
+			v += d * d
+		}
+		return v / float64(len(chunks))
+	}
+
+	opts := DefaultOptions()
+	opts.ChunkSize = 1000
+	greedy, err := splitChunks(text, opts)
+	if err != nil {
+		t.Fatalf("splitChunks failed: %v", err)
+	}
+
+	opts.Packing = PackingBalanced
+	opts.VerifyChunks = true
+	balanced, err := splitChunks(text, opts)
+	if err != nil {
+		t.Fatalf("splitChunks failed: %v", err)
+	}
+
+	if len(balanced) != len(greedy) {
+		t.Errorf("Expected the same number of chunks, got %d balanced for %d greedy", len(balanced), len(greedy))
+	}
+	if vb, vg := variance(balanced), variance(greedy); vb >= vg {
+		t.Errorf("Expected a lower variance with balanced packing, got %.1f (greedy: %.1f)", vb, vg)
+	}
+	for i, chunk := range balanced {
+		if tokens := countTokens(enc, chunk); tokens > opts.ChunkSize {
+			t.Errorf("Chunk %d has %d tokens, above the chunk size", i+1, tokens)
+		}
+	}
+
+	opts.MaxChunkSize = 1500
+	if _, err := splitChunks(text, opts); err == nil {
+		t.Error("Expected an error when combining balanced packing and a max chunk size")
+	}
+}
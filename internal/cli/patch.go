@@ -0,0 +1,172 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// PatchChunk replaces the cached result of a chunk, numbered as in the cache
+// from 1 or from 0 with --zero-index, with the given content and rebuilds the
+// combined output from the cached results. The output is rebuilt with the
+// settings recorded in the cache manifest, e.g. the reducer and the output
+// formats, but for a reducer set in the options. The chunks left out by the
+// chunk filter of the run are kept unchanged again and, with ChangesOnly, the
+// results equal to their chunk are left out again, the chunks being cut from
+// the input.
+func PatchChunk(ctx context.Context, filePath string, chunk int, content string, opts Options) error {
+	chunkDir, err := chunkDirPath(filePath, opts.CacheLabel)
+	if err != nil {
+		return err
+	}
+	state, err := loadCheckpoint(chunkDir)
+	if err != nil {
+		return err
+	}
+	meta, err := loadCacheMeta(chunkDir)
+	if err != nil {
+		return err
+	}
+	opts.ZeroIndex = meta != nil && meta.ZeroIndex
+	if meta != nil {
+		opts.LineDelimiter = meta.LineDelimiter
+		opts.OutputSchema = meta.OutputSchema
+		if err := meta.Combine.apply(&opts); err != nil {
+			return err
+		}
+	}
+	if opts.ReducePrompt != "" || opts.Citations {
+		return fmt.Errorf("patching does not support a reduce prompt or citations")
+	}
+	chunkCount, err := cachedChunkCount(chunkDir, opts)
+	if err != nil {
+		return err
+	}
+	if chunkCount == 0 {
+		return fmt.Errorf("no cached results found in %s/, process the file first", chunkDir)
+	}
+	index := chunk - opts.chunkNumber(0)
+	if index < 0 || index >= chunkCount {
+		return fmt.Errorf("chunk %d out of range: the file has %d chunks numbered from %d", chunk, chunkCount, opts.chunkNumber(0))
+	}
+
+	// The chunks left out by the filter have no result, they are their input,
+	// and the changes and the side-by-side file compare the results to them
+	var chunks []string
+	if opts.ChunkFilter != nil || opts.ChangesOnly || opts.SideBySide {
+		chunks, err = cachedChunkTexts(filePath, meta)
+		if err != nil {
+			return err
+		}
+		if len(chunks) != chunkCount {
+			return fmt.Errorf("the cache manifest records %d chunks, the last run processed %d: process the file again first", len(chunks), chunkCount)
+		}
+	}
+	passthrough := func(i int) bool {
+		return opts.ChunkFilter != nil && !matchesChunkFilter(chunks[i], opts.ChunkFilter)
+	}
+	if passthrough(index) {
+		return fmt.Errorf("chunk %d doesn't match the chunk filter %q, it is kept unchanged and has no result to patch", chunk, opts.ChunkFilter)
+	}
+
+	store, err := openCacheStore(chunkDir, opts)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	out := &syncWriter{w: opts.log()}
+	p := &processor{opts: opts, chunkDir: chunkDir, store: store, out: out}
+	if state != nil {
+		p.prompt = state.Prompt
+	}
+
+	// Every result is read before the patched one is written, so that a
+	// cache missing a result or refusing the correction is left untouched
+	results := make([]chunkResult, chunkCount)
+	for i := range results {
+		if passthrough(i) {
+			results[i] = chunkResult{Index: i, Content: p.wholeLines(chunks[i]), Cached: true}
+			continue
+		}
+		result := content
+		if i != index {
+			b, err := store.Read("result", i)
+			if err != nil {
+				return fmt.Errorf("failed to read cached result of chunk %d: %w", opts.chunkNumber(i), err)
+			}
+			result = string(b)
+		}
+		results[i], err = p.newChunkResult(i, result)
+		if err != nil {
+			return err
+		}
+		results[i].Cached = true
+	}
+
+	if err := store.Write("result", index, []byte(content)); err != nil {
+		return fmt.Errorf("failed to write result of chunk %d: %w", chunk, err)
+	}
+	fmt.Fprintf(out, "Chunk %d: Result patched -> %s\n", chunk, store.Path("result", index))
+
+	return p.finish(ctx, chunks, results, opts.combinedOutputPath(combinedFilePath(filePath)))
+}
+
+// cachedChunkTexts returns the texts of the chunks of the last run, cut from
+// the input at the byte ranges recorded in the cache manifest and normalized
+// as the run did.
+func cachedChunkTexts(filePath string, meta *cacheMeta) ([]string, error) {
+	if meta == nil || len(meta.Chunks) == 0 {
+		return nil, fmt.Errorf("the cache manifest doesn't record the chunks of the last run: process the file again first")
+	}
+	b, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, withCategory(ErrInput, fmt.Errorf("failed to read file: %w", err))
+	}
+
+	text := string(b)
+	// The run only normalized the line endings of an input mixing them
+	var mixed bool
+	if start := meta.Chunks[0].Start; start >= 0 && start <= len(text) {
+		mixed = detectLineEndings(text[start:]).Mixed()
+	}
+	texts := make([]string, len(meta.Chunks))
+	for i, chunk := range meta.Chunks {
+		if chunk.Start < 0 || chunk.Start > chunk.End || chunk.End > len(text) {
+			return nil, fmt.Errorf("%s changed since it was processed: process the file again first", filePath)
+		}
+		texts[i] = text[chunk.Start:chunk.End]
+		if mixed {
+			texts[i] = strings.ReplaceAll(texts[i], "\r\n", "\n")
+		}
+		if meta.NormalizeUnicode {
+			texts[i] = norm.NFC.String(texts[i])
+		}
+	}
+	return texts, nil
+}
+
+// cachedChunkCount returns the number of chunks of the last run, taken from
+// its checkpoint or, for older caches, from the consecutive result files
+// numbered as in the cache.
+func cachedChunkCount(chunkDir string, opts Options) (int, error) {
+	state, err := loadCheckpoint(chunkDir)
+	if err != nil {
+		return 0, err
+	}
+	if state != nil {
+		return state.ChunkCount, nil
+	}
+
+	count := 0
+	for {
+		if _, err := os.Stat(filepath.Join(chunkDir, opts.chunkFileName("result", count))); err != nil {
+			return count, nil
+		}
+		count++
+	}
+}
@@ -0,0 +1,271 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/openai/openai-go"
+)
+
+func TestPatchChunk(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "patch_test.txt")
+	if err := os.WriteFile(testFile, []byte(strings.Repeat("word ", 3000)), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.Log = &bytes.Buffer{}
+
+	mock := &mockChatGenerator{
+		requestFunc: func(params openai.ChatCompletionNewParams) string {
+			return fmt.Sprintf("result of %d words", len(strings.Fields(userContent(params))))
+		},
+	}
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	if err := PatchChunk(context.Background(), testFile, 2, "corrected result", opts); err != nil {
+		t.Fatalf("PatchChunk failed: %v", err)
+	}
+
+	chunkDir := filepath.Join(tmpDir, "patch_test")
+	patched, err := os.ReadFile(filepath.Join(chunkDir, "result2.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read patched result: %v", err)
+	}
+	if string(patched) != "corrected result" {
+		t.Errorf("Expected the result file to be replaced, got %q", patched)
+	}
+
+	combined, err := os.ReadFile(filepath.Join(tmpDir, "patch_test.combined_results.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read combined results: %v", err)
+	}
+	if expected := "result of 1000 wordscorrected resultresult of 1000 words"; string(combined) != expected {
+		t.Errorf("Expected the combined output to reflect the correction, got %q", combined)
+	}
+
+	if err := PatchChunk(context.Background(), testFile, 4, "out of range", opts); err == nil {
+		t.Error("Expected an error when patching a chunk out of range")
+	}
+}
+
+func TestPatchChunk_ZeroIndexWithoutCheckpoint(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "patch_zero_test.txt")
+	if err := os.WriteFile(testFile, []byte(strings.Repeat("word ", 3000)), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.ZeroIndex = true
+	opts.Log = &bytes.Buffer{}
+
+	mock := &mockChatGenerator{responseFunc: func(int) string { return "result\n" }}
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+	// The chunks of an older cache are counted from its result files
+	chunkDir := filepath.Join(tmpDir, "patch_zero_test")
+	if err := os.Remove(filepath.Join(chunkDir, checkpointFileName)); err != nil {
+		t.Fatalf("Failed to remove the checkpoint: %v", err)
+	}
+
+	if err := PatchChunk(context.Background(), testFile, 0, "corrected result", opts); err != nil {
+		t.Fatalf("PatchChunk failed: %v", err)
+	}
+	combined, err := os.ReadFile(filepath.Join(tmpDir, "patch_zero_test.combined_results.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read combined results: %v", err)
+	}
+	if expected := "corrected resultresult\nresult\n"; string(combined) != expected {
+		t.Errorf("Expected the combined output to reflect the correction, got %q", combined)
+	}
+}
+
+func TestPatchChunk_RebuildsWithTheRecordedSettings(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "patch_settings_test.txt")
+	if err := os.WriteFile(testFile, []byte(strings.Repeat("word ", 3000)), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.Reducer, _ = GetReducer(ReducerDedupUnion)
+	opts.OutputFilter = regexp.MustCompile(`^keep`)
+	opts.Log = &bytes.Buffer{}
+
+	mock := &mockChatGenerator{responseFunc: func(int) string { return "keep a\ndrop b\nkeep a\n" }}
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	// The patch is run with the defaults, as the patch command does
+	patchOpts := DefaultOptions()
+	patchOpts.Log = &bytes.Buffer{}
+	if err := PatchChunk(context.Background(), testFile, 2, "keep c\ndrop d\n", patchOpts); err != nil {
+		t.Fatalf("PatchChunk failed: %v", err)
+	}
+	combined, err := os.ReadFile(filepath.Join(tmpDir, "patch_settings_test.combined_results.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read combined results: %v", err)
+	}
+	if expected := "keep a\nkeep c\n"; string(combined) != expected {
+		t.Errorf("Expected the output rebuilt with the recorded reducer and filter %q, got %q", expected, combined)
+	}
+
+	// A reducer given explicitly takes precedence
+	patchOpts.Reducer, _ = GetReducer(ReducerConcat)
+	if err := PatchChunk(context.Background(), testFile, 2, "keep c\n", patchOpts); err != nil {
+		t.Fatalf("PatchChunk failed: %v", err)
+	}
+	combined, err = os.ReadFile(filepath.Join(tmpDir, "patch_settings_test.combined_results.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read combined results: %v", err)
+	}
+	if expected := "keep a\nkeep a\nkeep c\nkeep a\nkeep a\n"; string(combined) != expected {
+		t.Errorf("Expected the concatenated output %q, got %q", expected, combined)
+	}
+}
+
+func TestPatchChunk_ChunkFilter(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "patch_filter_test.txt")
+	var lines []string
+	for i := 0; i < 600; i++ {
+		word := "skip"
+		if i < 20 {
+			word = "keep"
+		}
+		lines = append(lines, fmt.Sprintf("line %d to %s", i, word))
+	}
+	if err := os.WriteFile(testFile, []byte(strings.Join(lines, "\r\n")+"\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.ChunkSize = 500
+	opts.ChunkFilter = regexp.MustCompile("keep")
+	opts.Log = &bytes.Buffer{}
+
+	mock := &mockChatGenerator{responseFunc: func(int) string { return "processed\n" }}
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+	if mock.callCount != 1 {
+		t.Fatalf("Expected only the first chunk to be sent, got %d calls", mock.callCount)
+	}
+	combinedFile := filepath.Join(tmpDir, "patch_filter_test.combined_results.txt")
+	processed, err := os.ReadFile(combinedFile)
+	if err != nil {
+		t.Fatalf("Failed to read combined results: %v", err)
+	}
+
+	// The chunks left out by the filter are cut from the input again
+	patchOpts := DefaultOptions()
+	patchOpts.Log = &bytes.Buffer{}
+	if err := PatchChunk(context.Background(), testFile, 1, "patched\n", patchOpts); err != nil {
+		t.Fatalf("PatchChunk failed: %v", err)
+	}
+	combined, err := os.ReadFile(combinedFile)
+	if err != nil {
+		t.Fatalf("Failed to read combined results: %v", err)
+	}
+	if expected := "patched\n" + strings.TrimPrefix(string(processed), "processed\n"); string(combined) != expected {
+		t.Errorf("Expected only the patched result to change\nexpected: %q\ngot:      %q", expected, combined)
+	}
+
+	if err := PatchChunk(context.Background(), testFile, 2, "not sent\n", patchOpts); err == nil || !strings.Contains(err.Error(), "chunk filter") {
+		t.Errorf("Expected patching a chunk left out by the filter to be refused, got %v", err)
+	}
+}
+
+func TestPatchChunk_MissingResultLeavesTheCacheUntouched(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "patch_missing_test.txt")
+	if err := os.WriteFile(testFile, []byte(strings.Repeat("word ", 3000)), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.Log = &bytes.Buffer{}
+	if err := ProcessWithClientOptions(context.Background(), &mockChatGenerator{}, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	chunkDir := filepath.Join(tmpDir, "patch_missing_test")
+	original, err := os.ReadFile(filepath.Join(chunkDir, "result2.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read result: %v", err)
+	}
+	if err := os.Remove(filepath.Join(chunkDir, "result3.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := PatchChunk(context.Background(), testFile, 2, "corrected result", opts); err == nil {
+		t.Fatal("Expected an error with a missing result")
+	}
+	if b, err := os.ReadFile(filepath.Join(chunkDir, "result2.txt")); err != nil || !bytes.Equal(b, original) {
+		t.Errorf("Expected the result to be left untouched, got %q (%v)", b, err)
+	}
+}
+
+func TestPatchChunk_ChangesOnly(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "patch_changes_test.txt")
+	var lines []string
+	for i := 0; i < 600; i++ {
+		lines = append(lines, fmt.Sprintf("line %d of the input", i))
+	}
+	if err := os.WriteFile(testFile, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.ChunkSize = 500
+	opts.ChangesOnly = true
+	opts.Log = &bytes.Buffer{}
+
+	// The model only modifies the first chunk
+	mock := &mockChatGenerator{
+		requestFunc: func(params openai.ChatCompletionNewParams) string {
+			if strings.HasPrefix(userContent(params), "line 0 ") {
+				return "changed\n"
+			}
+			return userContent(params)
+		},
+	}
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+	if mock.callCount < 3 {
+		t.Fatalf("Expected at least 3 chunks, got %d calls", mock.callCount)
+	}
+
+	patchOpts := DefaultOptions()
+	patchOpts.Log = &bytes.Buffer{}
+	if err := PatchChunk(context.Background(), testFile, 2, "fixed\n", patchOpts); err != nil {
+		t.Fatalf("PatchChunk failed: %v", err)
+	}
+	combined, err := os.ReadFile(filepath.Join(tmpDir, "patch_changes_test.combined_results.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read combined results: %v", err)
+	}
+	if expected := "changed\nfixed\n"; string(combined) != expected {
+		t.Errorf("Expected only the changed chunks in the patched output %q, got %q", expected, combined)
+	}
+}
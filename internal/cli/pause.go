@@ -0,0 +1,64 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// pauseFileName is the control file pausing a run while it exists in the
+// chunk directory.
+const pauseFileName = ".pause"
+
+// pausePollInterval is how often a paused run checks whether it can resume,
+// a variable so that the tests don't wait.
+var pausePollInterval = time.Second
+
+// pauser holds the launch of new chunks while the control file exists. The
+// requests in flight are not affected, so pausing loses no progress.
+type pauser struct {
+	path string
+	out  io.Writer
+
+	mu     sync.Mutex
+	paused bool
+}
+
+func newPauser(chunkDir string, out io.Writer) *pauser {
+	return &pauser{path: filepath.Join(chunkDir, pauseFileName), out: out}
+}
+
+// Wait returns once the control file is absent, or when the context is done.
+func (p *pauser) Wait(ctx context.Context) error {
+	for p.check() {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pausePollInterval):
+		}
+	}
+	return nil
+}
+
+// check tells whether the run is paused, reporting the transitions once
+// rather than once per waiting chunk.
+func (p *pauser) check() bool {
+	_, err := os.Stat(p.path)
+	paused := err == nil
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if paused != p.paused {
+		if paused {
+			fmt.Fprintf(p.out, "Paused: no new chunk is launched until %s is removed\n", p.path)
+		} else {
+			fmt.Fprintln(p.out, "Resumed: launching new chunks again")
+		}
+		p.paused = paused
+	}
+	return paused
+}
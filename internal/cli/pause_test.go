@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProcessWithClient_PauseFile(t *testing.T) {
+	interval := pausePollInterval
+	pausePollInterval = 5 * time.Millisecond
+	defer func() { pausePollInterval = interval }()
+
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "pause_test.txt")
+	if err := os.WriteFile(testFile, []byte(strings.Repeat("word ", 3000)), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	// The run starts paused
+	pauseFile := filepath.Join(tmpDir, "pause_test", pauseFileName)
+	if err := os.MkdirAll(filepath.Dir(pauseFile), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(pauseFile, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var log bytes.Buffer
+	logw := &syncWriter{w: &log}
+	logged := func() string {
+		logw.mu.Lock()
+		defer logw.mu.Unlock()
+		return log.String()
+	}
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.Log = logw
+
+	mock := &mockChatGenerator{
+		responseFunc: func(callCount int) string {
+			return "processed"
+		},
+	}
+	calls := func() int {
+		mock.mu.Lock()
+		defer mock.mu.Unlock()
+		return mock.callCount
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts)
+	}()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for !strings.Contains(logged(), "Paused:") {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the run to pause, got log:\n%s", logged())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := calls(); n != 0 {
+		t.Fatalf("Expected no chunk launched while paused, got %d calls", n)
+	}
+
+	if err := os.Remove(pauseFile); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run did not resume after the pause file was removed")
+	}
+
+	if n := calls(); n < 2 {
+		t.Errorf("Expected all the chunks to be launched after resuming, got %d calls", n)
+	}
+	if !strings.Contains(logged(), "Resumed:") {
+		t.Errorf("Expected the resume to be reported, got log:\n%s", logged())
+	}
+}
+
+func TestPauser_CancelledWhilePaused(t *testing.T) {
+	interval := pausePollInterval
+	pausePollInterval = 5 * time.Millisecond
+	defer func() { pausePollInterval = interval }()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, pauseFileName), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := newPauser(dir, &bytes.Buffer{}).Wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected the wait to end with the context, got %v", err)
+	}
+}
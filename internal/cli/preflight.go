@@ -0,0 +1,128 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/tiktoken-go/tokenizer"
+)
+
+// ErrRequestTooLarge is returned before any request when the request of a
+// chunk exceeds MaxRequestTokens and cannot be split to fit, in the
+// ErrBudgetExceeded category.
+var ErrRequestTooLarge = withCategory(ErrBudgetExceeded, errors.New("request above the token ceiling"))
+
+// messageTokenOverhead approximates the tokens the API adds around each
+// message of a request, e.g. its role, and to prime the reply.
+const messageTokenOverhead = 4
+
+// OverflowPolicy tells what to do with a chunk whose request exceeds
+// MaxRequestTokens.
+type OverflowPolicy string
+
+// Overflow policies
+const (
+	// OverflowSplit splits the chunk into smaller ones whose requests fit.
+	OverflowSplit OverflowPolicy = "split"
+	// OverflowFail fails the run before any request.
+	OverflowFail OverflowPolicy = "fail"
+)
+
+// ParseOverflowPolicy parses an overflow policy name.
+func ParseOverflowPolicy(s string) (OverflowPolicy, error) {
+	switch policy := OverflowPolicy(s); policy {
+	case OverflowSplit, OverflowFail:
+		return policy, nil
+	}
+	return "", invalidConfig(fmt.Errorf("unknown overflow policy %q (expected split or fail)", s))
+}
+
+// requestPrompts returns the prompts the chunks are sent with: the one of the
+// run or the ones of its tasks.
+func requestPrompts(prompt string, opts Options) []string {
+	if len(opts.Tasks) == 0 {
+		return []string{chunkPrompt(prompt, opts)}
+	}
+	prompts := make([]string, len(opts.Tasks))
+	for i, task := range opts.Tasks {
+		prompts[i] = chunkPrompt(task.Prompt, opts)
+	}
+	return prompts
+}
+
+// preflightRequests counts the tokens of the assembled request of each chunk,
+// with the largest of the prompts, and applies OnRequestOverflow to the
+// chunks whose request exceeds MaxRequestTokens. The running context and
+// the expansion of an automatic prompt are not known yet and not counted.
+func preflightRequests(out io.Writer, text string, chunks []textChunk, prompts []string, opts Options) ([]textChunk, error) {
+	if opts.MaxRequestTokens <= 0 {
+		return chunks, nil
+	}
+
+	enc, err := tokenizer.Get(tokenizer.Cl100kBase)
+	if err != nil {
+		return nil, withCategory(ErrTokenizer, fmt.Errorf("failed to get tokenizer: %w", err))
+	}
+
+	// The system and user messages, and the reply
+	overhead := 3 * messageTokenOverhead
+	if opts.DeveloperPrompt != "" {
+		overhead += messageTokenOverhead + countTokens(enc, opts.DeveloperPrompt)
+	}
+	largest := 0
+	for _, prompt := range prompts {
+		largest = max(largest, countTokens(enc, prompt))
+	}
+	overhead += largest
+
+	budget := opts.MaxRequestTokens - overhead
+	if budget <= 0 {
+		return nil, fmt.Errorf("%w: the prompt alone takes %d tokens, the ceiling is %d", ErrRequestTooLarge, overhead, opts.MaxRequestTokens)
+	}
+
+	var checked []textChunk
+	for i, chunk := range chunks {
+		tokens := overhead + countTokens(enc, chunk.Text)
+		if tokens <= opts.MaxRequestTokens {
+			checked = append(checked, chunk)
+			continue
+		}
+		if opts.OnRequestOverflow == OverflowFail {
+			return nil, fmt.Errorf("%w: the request of chunk %d takes %d tokens, more than %d: lower --chunk-size or raise --max-request-tokens", ErrRequestTooLarge, opts.chunkNumber(i), tokens, opts.MaxRequestTokens)
+		}
+
+		pieces, err := splitOverflowingChunk(text, chunk, budget, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split chunk %d: %w", opts.chunkNumber(i), err)
+		}
+		for _, piece := range pieces {
+			if n := overhead + countTokens(enc, piece.Text); n > opts.MaxRequestTokens {
+				return nil, fmt.Errorf("%w: the request of a part of chunk %d still takes %d tokens, more than %d", ErrRequestTooLarge, opts.chunkNumber(i), n, opts.MaxRequestTokens)
+			}
+		}
+		fmt.Fprintf(out, "Warning: the request of chunk %d takes %d tokens, more than %d: split into %d chunks\n", opts.chunkNumber(i), tokens, opts.MaxRequestTokens, len(pieces))
+		checked = append(checked, pieces...)
+	}
+	return checked, nil
+}
+
+// splitOverflowingChunk splits the input of a chunk into chunks of at most
+// budget tokens, with the splitting options of the run.
+func splitOverflowingChunk(text string, chunk textChunk, budget int, opts Options) ([]textChunk, error) {
+	opts.ChunkSize = budget
+	opts.MaxChunkSize = 0
+	opts.MinChunkSize = 0
+	opts.Packing = PackingGreedy
+	opts.VerifyChunks = false
+
+	pieces, err := splitTextChunks(text[chunk.Start:chunk.End], opts)
+	if err != nil {
+		return nil, err
+	}
+	for i := range pieces {
+		pieces[i].Start += chunk.Start
+		pieces[i].End += chunk.Start
+	}
+	return pieces, nil
+}
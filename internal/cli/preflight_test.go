@@ -0,0 +1,127 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/openai/openai-go"
+	"github.com/tiktoken-go/tokenizer"
+)
+
+// fewShotPrompt is a prompt whose examples take several hundred tokens.
+var fewShotPrompt = "Keep the lines mentioning an error.\n" + strings.Repeat("Example: 'disk error on sda1' -> keep it, 'user logged in' -> drop it.\n", 20)
+
+func writePreflightInput(t *testing.T) (string, string) {
+	t.Helper()
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "preflight_test.txt")
+	var input strings.Builder
+	for i := range 40 {
+		fmt.Fprintf(&input, "line %d with a few words of content\n", i)
+	}
+	if err := os.WriteFile(testFile, []byte(input.String()), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	return testFile, input.String()
+}
+
+func TestProcessWithClient_PreflightSplitsOverflowingRequests(t *testing.T) {
+	testFile, input := writePreflightInput(t)
+
+	mock := &mockChatGenerator{
+		requestFunc: func(params openai.ChatCompletionNewParams) string {
+			return userContent(params) + "\n"
+		},
+	}
+
+	var log bytes.Buffer
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.MaxRequestTokens = 600
+	opts.Log = &log
+
+	if err := ProcessWithClientOptions(context.Background(), mock, fewShotPrompt, testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	// The whole input fits in a chunk, but not with the examples
+	if mock.callCount < 2 {
+		t.Fatalf("Expected the chunk to be split, got %d requests", mock.callCount)
+	}
+	if !strings.Contains(log.String(), "split into") {
+		t.Errorf("Expected the split to be reported, got:\n%s", log.String())
+	}
+
+	enc, err := tokenizer.Get(tokenizer.Cl100kBase)
+	if err != nil {
+		t.Fatalf("Failed to get tokenizer: %v", err)
+	}
+	for _, params := range mock.params {
+		tokens := 3*messageTokenOverhead + countTokens(enc, systemContent(params)) + countTokens(enc, userContent(params))
+		if tokens > opts.MaxRequestTokens {
+			t.Errorf("Expected every request within %d tokens, got %d", opts.MaxRequestTokens, tokens)
+		}
+	}
+
+	combined, err := os.ReadFile(combinedFilePath(testFile))
+	if err != nil {
+		t.Fatalf("Failed to read combined output: %v", err)
+	}
+	if strings.TrimSpace(string(combined)) != strings.TrimSpace(input) {
+		t.Errorf("Expected the whole input in the combined output, got:\n%s", combined)
+	}
+}
+
+func TestProcessWithClient_PreflightFailsOverflowingRequests(t *testing.T) {
+	testFile, _ := writePreflightInput(t)
+
+	mock := &mockChatGenerator{}
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.MaxRequestTokens = 600
+	opts.OnRequestOverflow = OverflowFail
+	opts.Log = &bytes.Buffer{}
+
+	err := ProcessWithClientOptions(context.Background(), mock, fewShotPrompt, testFile, opts)
+	if !errors.Is(err, ErrRequestTooLarge) || !errors.Is(err, ErrBudgetExceeded) {
+		t.Fatalf("Expected ErrRequestTooLarge, got %v", err)
+	}
+	if mock.callCount != 0 {
+		t.Errorf("Expected no request, got %d", mock.callCount)
+	}
+}
+
+func TestProcessWithClient_PreflightPromptAboveCeiling(t *testing.T) {
+	testFile, _ := writePreflightInput(t)
+
+	mock := &mockChatGenerator{}
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.MaxRequestTokens = 100
+	opts.Log = &bytes.Buffer{}
+
+	err := ProcessWithClientOptions(context.Background(), mock, fewShotPrompt, testFile, opts)
+	if !errors.Is(err, ErrRequestTooLarge) || !strings.Contains(err.Error(), "the prompt alone") {
+		t.Fatalf("Expected the prompt to be reported above the ceiling, got %v", err)
+	}
+	if mock.callCount != 0 {
+		t.Errorf("Expected no request, got %d", mock.callCount)
+	}
+}
+
+func TestParseOverflowPolicy(t *testing.T) {
+	for _, s := range []string{"split", "fail"} {
+		if policy, err := ParseOverflowPolicy(s); err != nil || string(policy) != s {
+			t.Errorf("ParseOverflowPolicy(%q) = %q, %v", s, policy, err)
+		}
+	}
+	if _, err := ParseOverflowPolicy("truncate"); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected an invalid config error, got %v", err)
+	}
+}
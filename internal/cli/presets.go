@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Preset is a named prompt reused across runs, with the reduce strategy that
+// suits it. The flags given explicitly take precedence over the preset.
+type Preset struct {
+	Name   string
+	Prompt string
+	// ReduceStrategy is the reduce strategy of the preset, empty to keep the
+	// default concatenation.
+	ReduceStrategy string
+}
+
+// builtinPresets are the presets available without any configuration.
+var builtinPresets = map[string]Preset{
+	"extract-action-items": {
+		Prompt: "Extract the action items: the tasks someone committed to or was asked to do, one per line, with the owner and the due date when they are mentioned.",
+	},
+	"extract-entities": {
+		Prompt: "List the people, organizations and places mentioned in the text, one name per line.",
+	},
+	"find-errors": {
+		Prompt: "Keep only the lines reporting an error, a failure or a warning.",
+	},
+	"find-personal-data": {
+		Prompt: "Keep only the lines containing personal data such as names, email addresses, phone numbers or postal addresses.",
+	},
+	"summarize": {
+		Prompt:         "Summarize the key points of the text as short lines.",
+		ReduceStrategy: ReduceStrategySummarize,
+	},
+}
+
+// DefaultPresetsDir returns the directory of the user presets in the config
+// directory of the user, empty if it cannot be determined.
+func DefaultPresetsDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "mapred-llm", "presets")
+}
+
+// LoadPreset returns the preset with the given name. A user preset is the
+// prompt stored in <dir>/<name>.txt and takes precedence over the built-in
+// preset of the same name.
+func LoadPreset(name, dir string) (Preset, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return Preset{}, invalidConfig(fmt.Errorf("invalid preset name %q", name))
+	}
+
+	if dir != "" {
+		path := filepath.Join(dir, name+".txt")
+		b, err := os.ReadFile(path)
+		if err == nil {
+			prompt := strings.TrimSpace(string(b))
+			if prompt == "" {
+				return Preset{}, fmt.Errorf("preset %s is empty", path)
+			}
+			return Preset{Name: name, Prompt: prompt}, nil
+		}
+		if !os.IsNotExist(err) {
+			return Preset{}, fmt.Errorf("failed to read preset: %w", err)
+		}
+	}
+
+	preset, ok := builtinPresets[name]
+	if !ok {
+		return Preset{}, invalidConfig(fmt.Errorf("unknown preset %q (available: %s)", name, strings.Join(PresetNames(dir), ", ")))
+	}
+	preset.Name = name
+	return preset, nil
+}
+
+// PresetNames returns the names of the built-in presets and of the user
+// presets found in dir.
+func PresetNames(dir string) []string {
+	seen := make(map[string]bool)
+	for name := range builtinPresets {
+		seen[name] = true
+	}
+	if dir != "" {
+		paths, _ := filepath.Glob(filepath.Join(dir, "*.txt"))
+		for _, path := range paths {
+			seen[strings.TrimSuffix(filepath.Base(path), ".txt")] = true
+		}
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/openai/openai-go"
+)
+
+func TestLoadPreset(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "summarize.txt"), []byte("Summarize in French.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "find-todos.txt"), []byte("Keep the TODO comments."), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	preset, err := LoadPreset("extract-action-items", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preset.Prompt != builtinPresets["extract-action-items"].Prompt {
+		t.Errorf("Expected the built-in prompt, got %q", preset.Prompt)
+	}
+
+	// A user preset takes precedence over the built-in one
+	preset, err = LoadPreset("summarize", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preset.Prompt != "Summarize in French." || preset.ReduceStrategy != "" {
+		t.Errorf("Expected the user preset, got %+v", preset)
+	}
+
+	preset, err = LoadPreset("summarize", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preset.ReduceStrategy != ReduceStrategySummarize {
+		t.Errorf("Expected the built-in summarize preset to reduce with the summarize strategy, got %q", preset.ReduceStrategy)
+	}
+
+	_, err = LoadPreset("unknown", dir)
+	if err == nil || !strings.Contains(err.Error(), "find-todos") || !strings.Contains(err.Error(), "extract-action-items") {
+		t.Errorf("Expected an error listing the available presets, got %v", err)
+	}
+
+	if _, err := LoadPreset("../secrets", dir); err == nil {
+		t.Error("Expected an error for a path as preset name")
+	}
+}
+
+func TestProcessWithClient_Preset(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "preset_test.txt")
+	if err := os.WriteFile(testFile, []byte("Alice will send the report on Friday.\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	preset, err := LoadPreset("extract-action-items", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+
+	var systemPrompt string
+	mock := &mockChatGenerator{
+		requestFunc: func(params openai.ChatCompletionNewParams) string {
+			systemPrompt = systemContent(params)
+			return "Alice: send the report (Friday)\n"
+		},
+	}
+	if err := ProcessWithClientOptions(context.Background(), mock, preset.Prompt, testFile, opts); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+
+	expected := "Extract the action items: the tasks someone committed to or was asked to do, one per line, with the owner and the due date when they are mentioned."
+	if !strings.HasPrefix(systemPrompt, expected) {
+		t.Errorf("Expected the prompt of the preset to reach the model, got %q", systemPrompt)
+	}
+}
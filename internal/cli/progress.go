@@ -0,0 +1,53 @@
+package cli
+
+import "sync"
+
+// ChunkStatus is the processing state of a chunk.
+type ChunkStatus string
+
+// Chunk statuses reported by progress events
+const (
+	ChunkPending ChunkStatus = "pending"
+	ChunkRunning ChunkStatus = "running"
+	ChunkCached  ChunkStatus = "cached"
+	ChunkDone    ChunkStatus = "done"
+	ChunkError   ChunkStatus = "error"
+	// StepDone reports the usage of a request that is not a chunk's, e.g.
+	// the reduce step.
+	StepDone ChunkStatus = "step-done"
+)
+
+// ProgressEvent reports a change of status of a chunk.
+type ProgressEvent struct {
+	// Chunk is the zero-based index of the chunk, -1 for StepDone.
+	Chunk int
+	// Total is the number of chunks of the run.
+	Total  int
+	Status ChunkStatus
+	// Usage is what the API billed for the chunk once done.
+	Usage Usage
+	// Err is the failure of the chunk when Status is ChunkError.
+	Err error
+}
+
+// progressEmitter forwards the progress events of the workers to the
+// listeners, one event at a time.
+type progressEmitter struct {
+	mu        sync.Mutex
+	total     int
+	listeners []func(ProgressEvent)
+}
+
+func (e *progressEmitter) emit(event ProgressEvent) {
+	if e == nil || len(e.listeners) == 0 {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	event.Total = e.total
+	for _, listener := range e.listeners {
+		listener(event)
+	}
+}
@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// progressBarWidth is the number of cells of the progress bar.
+const progressBarWidth = 30
+
+// progressBar draws a single line progress bar on a terminal, redrawn in
+// place after each event. It is also the writer of the messages printed
+// while the chunks are processed, so that they are printed above the bar.
+type progressBar struct {
+	mu    sync.Mutex
+	w     io.Writer
+	model *tuiModel
+	drawn bool
+}
+
+func newProgressBar(w io.Writer, total int) *progressBar {
+	return &progressBar{w: w, model: newTUIModel(total)}
+}
+
+// Handle updates the progress with the event and redraws the bar.
+func (b *progressBar) Handle(event ProgressEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.model.Update(event)
+	b.render()
+}
+
+// Write prints a message above the bar.
+func (b *progressBar) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.clear()
+	n, err := b.w.Write(p)
+	b.render()
+	return n, err
+}
+
+// Finish leaves the final state of the bar on its own line.
+func (b *progressBar) Finish() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.drawn {
+		fmt.Fprintln(b.w)
+		b.drawn = false
+	}
+}
+
+// View renders the bar, without line ending.
+func (b *progressBar) View() string {
+	total := len(b.model.statuses)
+	finished := b.model.Finished()
+	progress := 1.0
+	if total > 0 {
+		progress = float64(finished) / float64(total)
+	}
+	filled := int(progress * progressBarWidth)
+
+	eta := "unknown"
+	if d, ok := b.model.ETA(); ok {
+		eta = d.Round(time.Second).String()
+	}
+
+	return fmt.Sprintf("[%s%s] %d/%d chunks (%.1f%%) ETA: %s",
+		strings.Repeat("#", filled), strings.Repeat("-", progressBarWidth-filled),
+		finished, total, progress*100, eta)
+}
+
+func (b *progressBar) render() {
+	b.clear()
+	fmt.Fprint(b.w, b.View())
+	b.drawn = true
+}
+
+// clear erases the bar so that the cursor is at the beginning of its line.
+func (b *progressBar) clear() {
+	if b.drawn {
+		fmt.Fprint(b.w, "\r\033[K")
+		b.drawn = false
+	}
+}
@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestProgressBar_View(t *testing.T) {
+	var out bytes.Buffer
+	bar := newProgressBar(&out, 4)
+	bar.Handle(ProgressEvent{Chunk: 0, Status: ChunkCached})
+	bar.Handle(ProgressEvent{Chunk: 1, Status: ChunkDone})
+
+	expected := "[###############---------------] 2/4 chunks (50.0%) ETA: "
+	if !strings.HasPrefix(bar.View(), expected) {
+		t.Errorf("Expected the bar to start with %q, got %q", expected, bar.View())
+	}
+
+	// Messages are printed above the bar, which is redrawn after them
+	out.Reset()
+	bar.Write([]byte("Chunk 3: processing...\n"))
+	if !strings.HasPrefix(out.String(), "\r\033[KChunk 3: processing...\n[") {
+		t.Errorf("Expected the bar to be cleared before the message, got %q", out.String())
+	}
+}
+
+func TestProcessWithClient_ProgressRenderer(t *testing.T) {
+	run := func(t *testing.T, terminal bool) string {
+		tmpDir := t.TempDir()
+		testFile := filepath.Join(tmpDir, "progress_test.txt")
+		if err := os.WriteFile(testFile, []byte(strings.Repeat("word ", 3000)), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+
+		if terminal {
+			original := isTerminal
+			isTerminal = func(w io.Writer) bool { return true }
+			defer func() { isTerminal = original }()
+		}
+
+		var log bytes.Buffer
+		opts := DefaultOptions()
+		opts.RequireConfirmation = false
+		opts.Log = &log
+		if err := ProcessWithClientOptions(context.Background(), &mockChatGenerator{}, "test prompt", testFile, opts); err != nil {
+			t.Fatalf("ProcessWithClientOptions failed: %v", err)
+		}
+		return log.String()
+	}
+
+	t.Run("terminal", func(t *testing.T) {
+		log := run(t, true)
+		if strings.Contains(log, "Progress: ") {
+			t.Errorf("Expected no progress lines on a terminal, got:\n%s", log)
+		}
+		if !strings.Contains(log, "\r\033[K[##############################] 3/3 chunks (100.0%)") {
+			t.Errorf("Expected a completed progress bar, got:\n%q", log)
+		}
+	})
+
+	t.Run("not a terminal", func(t *testing.T) {
+		log := run(t, false)
+		if strings.Contains(log, "\r") {
+			t.Errorf("Expected no carriage return, got:\n%q", log)
+		}
+		progressLine := regexp.MustCompile(`(?m)^Progress: (\d+)/3 chunks completed \(\d+\.\d%\)$`)
+		if matches := progressLine.FindAllStringSubmatch(log, -1); len(matches) != 3 {
+			t.Errorf("Expected 3 progress lines, got %d in:\n%s", len(matches), log)
+		}
+	})
+}
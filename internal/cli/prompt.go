@@ -0,0 +1,70 @@
+package cli
+
+import "fmt"
+
+// keepLinesSuffix is appended to the prompt of the user to tell the model
+// what to answer.
+const keepLinesSuffix = "\nReturn the lines that you want to keep."
+
+// lineDelimiterSuffix tells the model how the lines are separated when they
+// are not separated by newlines.
+const lineDelimiterSuffix = "\nThe lines are separated by the delimiter %q, separate the lines you return the same way."
+
+// PromptSuffixMode tells whether the keep-lines instruction is appended to
+// the prompt of the user.
+type PromptSuffixMode string
+
+// Prompt suffix modes
+const (
+	// PromptSuffixAuto appends the instruction unless an output schema is
+	// used, since it conflicts with structured outputs.
+	PromptSuffixAuto PromptSuffixMode = "auto"
+	// PromptSuffixAlways always appends the instruction.
+	PromptSuffixAlways PromptSuffixMode = "always"
+	// PromptSuffixNever never appends the instruction.
+	PromptSuffixNever PromptSuffixMode = "never"
+)
+
+// ParsePromptSuffixMode validates a prompt suffix mode name.
+func ParsePromptSuffixMode(s string) (PromptSuffixMode, error) {
+	switch mode := PromptSuffixMode(s); mode {
+	case PromptSuffixAuto, PromptSuffixAlways, PromptSuffixNever:
+		return mode, nil
+	}
+	return "", invalidConfig(fmt.Errorf("unknown prompt suffix mode %q (expected auto, always or never)", s))
+}
+
+// keepLines tells whether the keep-lines instruction is appended.
+func (m PromptSuffixMode) keepLines(opts Options) bool {
+	switch m {
+	case PromptSuffixAlways:
+		return true
+	case PromptSuffixNever:
+		return false
+	}
+	return opts.OutputSchema == nil
+}
+
+// chunkPrompt returns the system prompt sent with every chunk: the prompt of
+// the user followed by the instructions of the output format.
+func chunkPrompt(prompt string, opts Options) string {
+	if opts.PromptSuffix.keepLines(opts) {
+		prompt += keepLinesSuffix
+	}
+	if delimiter := opts.lineDelimiter(); delimiter != "\n" {
+		prompt += fmt.Sprintf(lineDelimiterSuffix, delimiter)
+	}
+	if opts.Justify {
+		prompt += justifyPromptSuffix
+	}
+	if opts.Scored {
+		prompt += scoredPromptSuffix
+	}
+	if opts.RecordDelimiter != "" {
+		prompt += fmt.Sprintf(recordPromptSuffix, opts.RecordDelimiter)
+	}
+	if opts.StopSentinel != "" {
+		prompt += fmt.Sprintf(stopPromptSuffix, opts.StopSentinel)
+	}
+	return prompt
+}
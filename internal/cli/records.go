@@ -0,0 +1,40 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// recordPromptSuffix tells the model how the records of a chunk are delimited
+// and how its output must be delimited.
+const recordPromptSuffix = "\nThe input contains records separated by the delimiter %q. Return exactly one output per record, in the same order, separated by the same delimiter."
+
+// UnescapeDelimiter interprets the Go escape sequences of a delimiter given on
+// the command line, e.g. `\n---\n` or `\x00`.
+func UnescapeDelimiter(s string) (string, error) {
+	// Go has no \0 escape, the NUL delimiter is common enough to accept it
+	if s == `\0` {
+		return "\x00", nil
+	}
+	unescaped, err := strconv.Unquote(`"` + strings.ReplaceAll(s, `"`, `\"`) + `"`)
+	if err != nil {
+		return "", invalidConfig(fmt.Errorf("invalid delimiter %q: %w", s, err))
+	}
+	return unescaped, nil
+}
+
+// splitRecords demultiplexes the output of a chunk into one output per record.
+func splitRecords(content, delimiter string) []string {
+	content = strings.TrimSuffix(content, delimiter)
+	records := strings.Split(content, delimiter)
+	for i, record := range records {
+		records[i] = strings.TrimSpace(record)
+	}
+	return records
+}
+
+// countRecords returns the number of records of a chunk.
+func countRecords(chunk, delimiter string) int {
+	return strings.Count(chunk, delimiter) + 1
+}
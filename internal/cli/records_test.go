@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/openai/openai-go"
+)
+
+func TestUnescapeDelimiter(t *testing.T) {
+	for input, expected := range map[string]string{
+		`\n---\n`: "\n---\n",
+		`\x00`:    "\x00",
+		`\0`:      "\x00",
+		`;`:       ";",
+		`"`:       `"`,
+	} {
+		got, err := UnescapeDelimiter(input)
+		if err != nil {
+			t.Fatalf("UnescapeDelimiter(%q) failed: %v", input, err)
+		}
+		if got != expected {
+			t.Errorf("UnescapeDelimiter(%q) = %q, expected %q", input, got, expected)
+		}
+	}
+}
+
+func TestProcessWithClient_RecordDelimiter(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "records_test.txt")
+	if err := os.WriteFile(testFile, []byte("apple\nbanana\ncherry"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	const delimiter = "\n---\n"
+
+	var log bytes.Buffer
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.RecordDelimiter = delimiter
+	opts.Log = &log
+
+	// The model uppercases each record
+	mock := &mockChatGenerator{
+		requestFunc: func(params openai.ChatCompletionNewParams) string {
+			return strings.ToUpper(userContent(params))
+		},
+	}
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	if got := userContent(mock.params[0]); got != "apple\n---\nbanana\n---\ncherry" {
+		t.Errorf("Expected the records to be delimited, got %q", got)
+	}
+	if !strings.Contains(systemContent(mock.params[0]), `separated by the delimiter "\n---\n"`) {
+		t.Errorf("Expected the prompt to describe the delimiter, got %q", systemContent(mock.params[0]))
+	}
+
+	combined, err := os.ReadFile(filepath.Join(tmpDir, "records_test.combined_results.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read combined results: %v", err)
+	}
+	if string(combined) != "APPLE\nBANANA\nCHERRY\n" {
+		t.Errorf("Expected one output per record, got %q", string(combined))
+	}
+	if strings.Contains(log.String(), "Warning") {
+		t.Errorf("Expected no warning, got:\n%s", log.String())
+	}
+}
+
+func TestProcessWithClient_RecordDelimiterWarnings(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "records_test.txt")
+	if err := os.WriteFile(testFile, []byte("a;b\nc\nd"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	var log bytes.Buffer
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.RecordDelimiter = ";"
+	opts.Log = &log
+
+	// The model merges two records
+	mock := &mockChatGenerator{
+		responseFunc: func(callCount int) string { return "x;y" },
+	}
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	if !strings.Contains(log.String(), `Warning: the record delimiter ";" appears in the input`) {
+		t.Errorf("Expected a warning about the delimiter in the input, got:\n%s", log.String())
+	}
+	if !strings.Contains(log.String(), "Warning: chunk 1 returned 2 records for 4 in the input") {
+		t.Errorf("Expected a warning about the record count, got:\n%s", log.String())
+	}
+}
@@ -0,0 +1,286 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/shared"
+)
+
+// Reducer combines the results of all the chunks, in input order, into the final output.
+type Reducer interface {
+	Reduce(results []string) (string, error)
+}
+
+// ReducerFunc adapts a function to the Reducer interface.
+type ReducerFunc func(results []string) (string, error)
+
+// Reduce calls f(results).
+func (f ReducerFunc) Reduce(results []string) (string, error) {
+	return f(results)
+}
+
+// lineReducer is a built-in reducer working on lines, which are separated by
+// the delimiter given to it.
+type lineReducer func(results []string, delimiter string) (string, error)
+
+// Reduce calls f(results, "\n").
+func (f lineReducer) Reduce(results []string) (string, error) {
+	return f(results, "\n")
+}
+
+// Built-in reducer names
+const (
+	ReducerConcat     = "concat"
+	ReducerDedupUnion = "dedup-union"
+	ReducerJSONMerge  = "json-merge"
+	ReducerNumericSum = "numeric-sum"
+	ReducerVote       = "vote"
+)
+
+var reducers = map[string]Reducer{
+	ReducerConcat:     builtinReducer{ReducerConcat, lineReducer(concatReduce)},
+	ReducerDedupUnion: builtinReducer{ReducerDedupUnion, lineReducer(dedupUnionReduce)},
+	ReducerJSONMerge:  builtinReducer{ReducerJSONMerge, ReducerFunc(jsonMergeReduce)},
+	ReducerNumericSum: builtinReducer{ReducerNumericSum, ReducerFunc(numericSumReduce)},
+	ReducerVote:       builtinReducer{ReducerVote, ReducerFunc(voteReduce)},
+}
+
+// builtinReducer is a built-in reducer with its name, recorded in the cache
+// manifest.
+type builtinReducer struct {
+	name string
+	Reducer
+}
+
+// reducerName returns the name of a built-in reducer, empty for the others.
+func reducerName(reducer Reducer) string {
+	if builtin, ok := reducer.(builtinReducer); ok {
+		return builtin.name
+	}
+	return ""
+}
+
+// Reduce strategies
+const (
+	ReduceStrategyConcat    = "concat"
+	ReduceStrategySummarize = "summarize"
+	ReduceStrategyVote      = "vote"
+)
+
+// defaultSummarizePrompt is the reduce prompt of the summarize strategy when
+// none is provided.
+const defaultSummarizePrompt = "You are given the results extracted from consecutive parts of a document. Synthesize them into a single coherent result, merging duplicates and keeping every relevant piece of information."
+
+// ApplyReduceStrategy configures the reduce step of the options for the strategy:
+// concat appends the results, summarize synthesizes them with the reduce model
+// and vote picks the label returned by most chunks.
+func ApplyReduceStrategy(opts *Options, strategy string) error {
+	switch strategy {
+	case ReduceStrategyConcat:
+		opts.Reducer = reducers[ReducerConcat]
+		opts.ReducePrompt = ""
+	case ReduceStrategySummarize:
+		if opts.ReducePrompt == "" {
+			opts.ReducePrompt = defaultSummarizePrompt
+		}
+	case ReduceStrategyVote:
+		opts.Reducer = reducers[ReducerVote]
+		opts.ReducePrompt = ""
+	default:
+		return invalidConfig(fmt.Errorf("unknown reduce strategy %q (available: %s, %s, %s)", strategy, ReduceStrategyConcat, ReduceStrategySummarize, ReduceStrategyVote))
+	}
+	return nil
+}
+
+// GetReducer returns the built-in reducer with the given name.
+func GetReducer(name string) (Reducer, error) {
+	reducer, ok := reducers[name]
+	if !ok {
+		return nil, invalidConfig(fmt.Errorf("unknown reducer %q (available: %s)", name, strings.Join(ReducerNames(), ", ")))
+	}
+	return reducer, nil
+}
+
+// ReducerNames returns the names of the built-in reducers.
+func ReducerNames() []string {
+	names := make([]string, 0, len(reducers))
+	for name := range reducers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// concatReduce appends the results without separators. With a custom line
+// delimiter, the results not ending with it are terminated by it so that the
+// last line of a chunk doesn't run into the first line of the next one.
+func concatReduce(results []string, delimiter string) (string, error) {
+	var combined strings.Builder
+	for _, result := range results {
+		combined.WriteString(result)
+		if delimiter != "\n" && result != "" && !strings.HasSuffix(result, delimiter) {
+			combined.WriteString(delimiter)
+		}
+	}
+	return combined.String(), nil
+}
+
+// voteReduce returns the label returned by most chunks, for classification
+// tasks. Labels are compared ignoring case and surrounding whitespace, blank
+// results don't vote and ties go to the label seen first.
+func voteReduce(results []string) (string, error) {
+	counts := make(map[string]int)
+	labels := make(map[string]string)
+	var order []string
+
+	for _, result := range results {
+		label := strings.TrimSpace(result)
+		if label == "" {
+			continue
+		}
+		key := strings.ToLower(label)
+		if _, ok := counts[key]; !ok {
+			labels[key] = label
+			order = append(order, key)
+		}
+		counts[key]++
+	}
+
+	winner := ""
+	for _, key := range order {
+		if winner == "" || counts[key] > counts[winner] {
+			winner = key
+		}
+	}
+	return labels[winner], nil
+}
+
+// dedupUnionReduce keeps each non-empty line once, in order of first appearance.
+func dedupUnionReduce(results []string, delimiter string) (string, error) {
+	seen := make(map[string]struct{})
+	var combined strings.Builder
+
+	for _, result := range results {
+		for _, line := range strings.Split(result, delimiter) {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			if _, ok := seen[line]; ok {
+				continue
+			}
+			seen[line] = struct{}{}
+			combined.WriteString(line)
+			combined.WriteString(delimiter)
+		}
+	}
+
+	return combined.String(), nil
+}
+
+// jsonMergeReduce merges JSON results: arrays are concatenated, objects are
+// merged recursively and other values are replaced by later ones.
+func jsonMergeReduce(results []string) (string, error) {
+	var merged any
+
+	for i, result := range results {
+		if strings.TrimSpace(result) == "" {
+			continue
+		}
+
+		var value any
+		if err := json.Unmarshal([]byte(result), &value); err != nil {
+			return "", fmt.Errorf("result %d is not valid JSON: %w", i+1, err)
+		}
+		merged = mergeJSON(merged, value)
+	}
+
+	if merged == nil {
+		return "", nil
+	}
+
+	b, err := json.MarshalIndent(merged, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal merged JSON: %w", err)
+	}
+	return string(b) + "\n", nil
+}
+
+func mergeJSON(dst, src any) any {
+	switch s := src.(type) {
+	case []any:
+		if d, ok := dst.([]any); ok {
+			return append(d, s...)
+		}
+	case map[string]any:
+		if d, ok := dst.(map[string]any); ok {
+			for key, value := range s {
+				d[key] = mergeJSON(d[key], value)
+			}
+			return d
+		}
+	}
+	return src
+}
+
+// numericSumReduce sums the results, each being expected to be a number.
+func numericSumReduce(results []string) (string, error) {
+	var sum float64
+
+	for i, result := range results {
+		result = strings.TrimSpace(result)
+		if result == "" {
+			continue
+		}
+
+		value, err := strconv.ParseFloat(result, 64)
+		if err != nil {
+			return "", fmt.Errorf("result %d is not a number: %w", i+1, err)
+		}
+		sum += value
+	}
+
+	return strconv.FormatFloat(sum, 'f', -1, 64) + "\n", nil
+}
+
+// llmReducer returns a reducer asking the reduce model to synthesize the
+// chunk results according to the reduce prompt.
+func (p *processor) llmReducer(ctx context.Context, prompt string) Reducer {
+	return ReducerFunc(func(results []string) (string, error) {
+		model := p.opts.reduceModel()
+		fmt.Fprintf(p.out, "Reducing %d results with %s...\n", len(results), model)
+
+		return p.generateReduce(ctx, openai.ChatCompletionNewParams{
+			Messages: []openai.ChatCompletionMessageParamUnion{
+				openai.SystemMessage(prompt),
+				openai.UserMessage(strings.Join(results, "\n")),
+			},
+			Model:       shared.ChatModel(model),
+			ServiceTier: p.serviceTier(),
+		})
+	})
+}
+
+// generateReduce sends the request of the reduce step, reports its usage and
+// adds it to the checkpoint.
+func (p *processor) generateReduce(ctx context.Context, params openai.ChatCompletionNewParams) (string, error) {
+	res, err := p.generateWithFallback(ctx, params)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate chat completion for the reduce step: %w", err)
+	}
+
+	usage := responseUsage(Model(params.Model), res)
+	fmt.Fprintf(p.out, "Reduce usage: %d prompt + %d completion tokens ($%.4f)\n", usage.PromptTokens, usage.CompletionTokens, usage.Cost)
+	p.spend(usage)
+
+	if len(res.Choices) == 0 {
+		return "", withCategory(ErrAPI, fmt.Errorf("no content in response for the reduce step"))
+	}
+
+	return res.Choices[0].Message.Content, nil
+}
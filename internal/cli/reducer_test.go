@@ -0,0 +1,434 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/openai/openai-go"
+)
+
+func TestBuiltinReducers(t *testing.T) {
+	tests := []struct {
+		name        string
+		reducer     string
+		results     []string
+		expected    string
+		expectError bool
+	}{
+		{
+			name:     "concat",
+			reducer:  ReducerConcat,
+			results:  []string{"a\n", "b\n", "c"},
+			expected: "a\nb\nc",
+		},
+		{
+			name:     "dedup union",
+			reducer:  ReducerDedupUnion,
+			results:  []string{"apple\nbanana\n", "banana\n\ncherry", "apple"},
+			expected: "apple\nbanana\ncherry\n",
+		},
+		{
+			name:     "numeric sum",
+			reducer:  ReducerNumericSum,
+			results:  []string{"3\n", " 4.5 ", "", "-1"},
+			expected: "6.5\n",
+		},
+		{
+			name:     "vote",
+			reducer:  ReducerVote,
+			results:  []string{"positive\n", " Negative", "", "POSITIVE", "neutral"},
+			expected: "positive",
+		},
+		{
+			name:     "vote tie goes to the first label",
+			reducer:  ReducerVote,
+			results:  []string{"negative", "positive", "positive", "negative"},
+			expected: "negative",
+		},
+		{
+			name:        "numeric sum invalid",
+			reducer:     ReducerNumericSum,
+			results:     []string{"3", "three"},
+			expectError: true,
+		},
+		{
+			name:        "json merge invalid",
+			reducer:     ReducerJSONMerge,
+			results:     []string{"{"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reducer, err := GetReducer(tt.reducer)
+			if err != nil {
+				t.Fatalf("GetReducer failed: %v", err)
+			}
+
+			got, err := reducer.Reduce(tt.results)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Reduce failed: %v", err)
+			}
+
+			if got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestJSONMergeReducer(t *testing.T) {
+	reducer, err := GetReducer(ReducerJSONMerge)
+	if err != nil {
+		t.Fatalf("GetReducer failed: %v", err)
+	}
+
+	t.Run("arrays", func(t *testing.T) {
+		got, err := reducer.Reduce([]string{`[1, 2]`, ``, `[3]`})
+		if err != nil {
+			t.Fatalf("Reduce failed: %v", err)
+		}
+
+		var merged []int
+		if err := json.Unmarshal([]byte(got), &merged); err != nil {
+			t.Fatalf("Output is not a JSON array: %v", err)
+		}
+		if !reflect.DeepEqual(merged, []int{1, 2, 3}) {
+			t.Errorf("Expected [1 2 3], got %v", merged)
+		}
+	})
+
+	t.Run("objects", func(t *testing.T) {
+		got, err := reducer.Reduce([]string{
+			`{"fruits": ["apple"], "count": 1, "meta": {"a": 1}}`,
+			`{"fruits": ["pear"], "count": 2, "meta": {"b": 2}}`,
+		})
+		if err != nil {
+			t.Fatalf("Reduce failed: %v", err)
+		}
+
+		var merged map[string]any
+		if err := json.Unmarshal([]byte(got), &merged); err != nil {
+			t.Fatalf("Output is not a JSON object: %v", err)
+		}
+		expected := map[string]any{
+			"fruits": []any{"apple", "pear"},
+			"count":  float64(2),
+			"meta":   map[string]any{"a": float64(1), "b": float64(2)},
+		}
+		if !reflect.DeepEqual(merged, expected) {
+			t.Errorf("Expected %v, got %v", expected, merged)
+		}
+	})
+}
+
+func TestGetReducer_Unknown(t *testing.T) {
+	if _, err := GetReducer("median"); err == nil {
+		t.Error("Expected an error for an unknown reducer")
+	}
+}
+
+func TestProcessWithClient_CustomReducer(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "reducer_test.txt")
+	if err := os.WriteFile(testFile, []byte(strings.Repeat("word ", 3000)), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	var received []string
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.Reducer = ReducerFunc(func(results []string) (string, error) {
+		received = results
+		return "reduced", nil
+	})
+
+	mock := &mockChatGenerator{}
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	if len(received) != mock.callCount {
+		t.Errorf("Expected the reducer to receive %d results, got %d", mock.callCount, len(received))
+	}
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, "reducer_test.combined_results.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read combined results: %v", err)
+	}
+	if string(content) != "reduced" {
+		t.Errorf("Expected the reducer output, got: %q", string(content))
+	}
+}
+
+func TestProcessWithClient_ReducersWithLineDelimiter(t *testing.T) {
+	tmpDir := t.TempDir()
+	var files []string
+	for i := range 300 {
+		files = append(files, fmt.Sprintf("src/file%d.go", i))
+	}
+
+	run := func(reducer string, response string, configure func(*Options)) string {
+		t.Helper()
+		testFile := filepath.Join(tmpDir, reducer+".txt")
+		if err := os.WriteFile(testFile, []byte(strings.Join(files, "\x00")), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+		opts := DefaultOptions()
+		opts.RequireConfirmation = false
+		opts.ChunkSize = 1000
+		opts.LineDelimiter = "\x00"
+		opts.Reducer, _ = GetReducer(reducer)
+		if configure != nil {
+			configure(&opts)
+		}
+		mock := &mockChatGenerator{responseFunc: func(int) string { return response }}
+		if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+			t.Fatalf("ProcessWithClientOptions failed with %s: %v", reducer, err)
+		}
+		if mock.callCount != 2 {
+			t.Fatalf("Expected 2 chunks, got %d", mock.callCount)
+		}
+		content, err := os.ReadFile(filepath.Join(tmpDir, reducer+".combined_results.txt"))
+		if err != nil {
+			t.Fatalf("Failed to read combined results: %v", err)
+		}
+		return string(content)
+	}
+
+	// The lines are split and rejoined on the delimiter, then filtered
+	got := run(ReducerDedupUnion, "a.go\x00b.txt\x00a.go", func(opts *Options) {
+		opts.OutputFilter = regexp.MustCompile(`\.go$`)
+	})
+	if got != "a.go\x00" {
+		t.Errorf("Expected the deduplicated and filtered lines, got %q", got)
+	}
+
+	// The results of the other reducers are not terminated by the delimiter
+	if got := run(ReducerNumericSum, "2", nil); got != "4\n" {
+		t.Errorf("Expected the sum of the results, got %q", got)
+	}
+	if got := run(ReducerJSONMerge, "[1]", nil); got != "[\n  1,\n  1\n]\n" {
+		t.Errorf("Expected the merged JSON array, got %q", got)
+	}
+}
+
+func TestProcessWithClient_ReduceModel(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "reduce_model_test.txt")
+	if err := os.WriteFile(testFile, []byte(strings.Repeat("word ", 3000)), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	const reducePrompt = "Summarize the results"
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.ReducePrompt = reducePrompt
+	opts.ReduceModel = ModelGPT5
+
+	mock := &mockChatGenerator{
+		requestFunc: func(params openai.ChatCompletionNewParams) string {
+			if systemContent(params) == reducePrompt {
+				return "final summary"
+			}
+			return "chunk result"
+		},
+	}
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	reduceCalls := 0
+	for _, params := range mock.params {
+		if systemContent(params) == reducePrompt {
+			reduceCalls++
+			if params.Model != string(ModelGPT5) {
+				t.Errorf("Expected the reduce step to use %s, got %s", ModelGPT5, params.Model)
+			}
+			if !strings.Contains(userContent(params), "chunk result") {
+				t.Errorf("Expected the reduce step to receive the chunk results, got %q", userContent(params))
+			}
+		} else if params.Model != string(ModelGPT5Nano) {
+			t.Errorf("Expected map chunks to use %s, got %s", ModelGPT5Nano, params.Model)
+		}
+	}
+
+	if reduceCalls != 1 {
+		t.Errorf("Expected a single reduce call, got %d", reduceCalls)
+	}
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, "reduce_model_test.combined_results.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read combined results: %v", err)
+	}
+	if string(content) != "final summary" {
+		t.Errorf("Expected the reduce output, got %q", string(content))
+	}
+}
+
+func TestProcessWithClient_ReduceUsageAndFlexFallback(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "reduce_usage_test.txt")
+	if err := os.WriteFile(testFile, []byte(strings.Repeat("word ", 3000)), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	const reducePrompt = "Summarize the results"
+
+	var log bytes.Buffer
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.ReducePrompt = reducePrompt
+	opts.Log = &log
+
+	// Only the reduce model rejects the Flex tier
+	var mock *mockChatGenerator
+	mock = &mockChatGenerator{
+		usage: openai.CompletionUsage{PromptTokens: 100, CompletionTokens: 10},
+		errorFunc: func(callCount int) error {
+			params := mock.params[callCount-1]
+			if systemContent(params) == reducePrompt && params.ServiceTier == openai.ChatCompletionNewParamsServiceTierFlex {
+				err := newAPIError(http.StatusBadRequest)
+				err.Param = "service_tier"
+				err.Message = "Flex processing is not available for this model"
+				return err
+			}
+			return nil
+		},
+		requestFunc: func(params openai.ChatCompletionNewParams) string {
+			return "result"
+		},
+	}
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	last := mock.params[len(mock.params)-1]
+	if systemContent(last) != reducePrompt || last.ServiceTier != openai.ChatCompletionNewParamsServiceTierDefault {
+		t.Errorf("Expected the reduce step to fall back to the default tier, got %q", last.ServiceTier)
+	}
+
+	// The chunks and the reduce step are billed, not the rejected request
+	billed := int64(mock.callCount - 1)
+	state, err := loadCheckpoint(filepath.Join(tmpDir, "reduce_usage_test"))
+	if err != nil || state == nil {
+		t.Fatalf("Expected a checkpoint, got %v (%v)", state, err)
+	}
+	if state.Usage.PromptTokens != 100*billed || state.Usage.CompletionTokens != 10*billed {
+		t.Errorf("Expected the usage of %d requests in the checkpoint, got %+v", billed, state.Usage)
+	}
+	if line := fmt.Sprintf("Token usage: %d prompt + %d completion tokens", 100*billed, 10*billed); !strings.Contains(log.String(), line) {
+		t.Errorf("Expected %q in the log, got:\n%s", line, log.String())
+	}
+}
+
+func TestProcessWithClient_RejectsUnknownReduceModel(t *testing.T) {
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.ReduceModel = "gpt-unknown"
+
+	mock := &mockChatGenerator{}
+	err := ProcessWithClientOptions(context.Background(), mock, "test prompt", filepath.Join(t.TempDir(), "missing.txt"), opts)
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected an unknown reduce model to be rejected, got %v", err)
+	}
+	if mock.callCount != 0 {
+		t.Errorf("Expected no API call, got %d", mock.callCount)
+	}
+}
+
+func TestReduceModelDefaultsToMapModel(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Model = ModelGPT5Mini
+	if got := opts.reduceModel(); got != ModelGPT5Mini {
+		t.Errorf("Expected the reduce model to default to the map model, got %s", got)
+	}
+}
+
+func TestApplyReduceStrategy(t *testing.T) {
+	tests := []struct {
+		strategy  string
+		responses func(callCount int) string
+		expected  string
+	}{
+		{
+			strategy:  ReduceStrategyConcat,
+			responses: func(callCount int) string { return "part\n" },
+			expected:  "part\npart\npart\n",
+		},
+		{
+			strategy: ReduceStrategyVote,
+			responses: func(callCount int) string {
+				if callCount == 2 {
+					return "negative"
+				}
+				return "positive"
+			},
+			expected: "positive",
+		},
+		{
+			strategy:  ReduceStrategySummarize,
+			responses: func(callCount int) string { return "chunk result" },
+			expected:  "final summary",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			testFile := filepath.Join(tmpDir, "strategy_test.txt")
+			if err := os.WriteFile(testFile, []byte(strings.Repeat("word ", 3000)), 0644); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+
+			opts := DefaultOptions()
+			opts.RequireConfirmation = false
+			opts.Concurrency = 1
+			if err := ApplyReduceStrategy(&opts, tt.strategy); err != nil {
+				t.Fatalf("ApplyReduceStrategy failed: %v", err)
+			}
+
+			mock := &mockChatGenerator{}
+			mock.responseFunc = func(callCount int) string {
+				if systemContent(mock.params[callCount-1]) == defaultSummarizePrompt {
+					return "final summary"
+				}
+				return tt.responses(callCount)
+			}
+			if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+				t.Fatalf("ProcessWithClientOptions failed: %v", err)
+			}
+
+			content, err := os.ReadFile(filepath.Join(tmpDir, "strategy_test.combined_results.txt"))
+			if err != nil {
+				t.Fatalf("Failed to read combined results: %v", err)
+			}
+			if string(content) != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, string(content))
+			}
+		})
+	}
+
+	opts := DefaultOptions()
+	if err := ApplyReduceStrategy(&opts, "unknown"); err == nil {
+		t.Error("Expected an error for an unknown strategy")
+	}
+}
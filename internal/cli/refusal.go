@@ -0,0 +1,46 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrRefusal is returned when the model refused to process a chunk and the
+// refusal policy is to fail.
+var ErrRefusal = errors.New("the model refused to process the chunk")
+
+// RefusalPolicy tells what to do with a chunk the model refused to process.
+type RefusalPolicy string
+
+// Refusal policies
+const (
+	// RefusalFail fails the run.
+	RefusalFail RefusalPolicy = "fail"
+	// RefusalSkip leaves the chunk out of the combined output.
+	RefusalSkip RefusalPolicy = "skip"
+	// RefusalKeepInput puts the chunk unprocessed in the combined output.
+	RefusalKeepInput RefusalPolicy = "keep-input"
+)
+
+// ParseRefusalPolicy parses a refusal policy name.
+func ParseRefusalPolicy(s string) (RefusalPolicy, error) {
+	switch policy := RefusalPolicy(s); policy {
+	case RefusalFail, RefusalSkip, RefusalKeepInput:
+		return policy, nil
+	}
+	return "", invalidConfig(fmt.Errorf("unknown refusal policy %q (expected skip, fail or keep-input)", s))
+}
+
+// refusedChunkResult applies the refusal policy to a refused chunk. Refusals
+// are never cached so that a rerun tries again.
+func (p *processor) refusedChunkResult(i int, chunk, refusal string) (chunkResult, error) {
+	fmt.Fprintf(p.out, "Chunk %d: refused by the model: %s\n", p.opts.chunkNumber(i), refusal)
+
+	switch p.opts.OnRefusal {
+	case RefusalSkip:
+		return chunkResult{Index: i, Refusal: refusal}, nil
+	case RefusalKeepInput:
+		return chunkResult{Index: i, Content: chunk, Refusal: refusal}, nil
+	}
+	return chunkResult{}, fmt.Errorf("%w %d: %s", ErrRefusal, p.opts.chunkNumber(i), refusal)
+}
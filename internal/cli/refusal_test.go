@@ -0,0 +1,118 @@
+package cli
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProcessWithClient_Refusal(t *testing.T) {
+	const refusal = "I can't help with that."
+
+	tests := []struct {
+		policy      RefusalPolicy
+		expectError bool
+		expected    func(chunk string) string
+	}{
+		{
+			policy:      RefusalFail,
+			expectError: true,
+		},
+		{
+			policy:   RefusalSkip,
+			expected: func(chunk string) string { return "kept\n" },
+		},
+		{
+			policy:   RefusalKeepInput,
+			expected: func(chunk string) string { return "kept\n" + chunk },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			tmpDir := t.TempDir()
+			testFile := filepath.Join(tmpDir, "refusal_test.txt")
+			if err := os.WriteFile(testFile, []byte(strings.Repeat("word ", 3000)), 0644); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+
+			opts := DefaultOptions()
+			opts.RequireConfirmation = false
+			opts.Concurrency = 1
+			opts.OnRefusal = tt.policy
+			opts.ReportCSV = filepath.Join(tmpDir, "report.csv")
+
+			mock := &mockChatGenerator{
+				responseFunc: func(callCount int) string {
+					if callCount == 2 {
+						return ""
+					}
+					return "kept\n"
+				},
+				refusalFunc: func(callCount int) string {
+					if callCount == 2 {
+						return refusal
+					}
+					return ""
+				},
+			}
+			err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts)
+			if tt.expectError {
+				if !errors.Is(err, ErrRefusal) {
+					t.Fatalf("Expected ErrRefusal, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ProcessWithClientOptions failed: %v", err)
+			}
+
+			chunkDir := filepath.Join(tmpDir, "refusal_test")
+			if _, err := os.Stat(filepath.Join(chunkDir, "result2.txt")); !os.IsNotExist(err) {
+				t.Error("Expected the refused chunk not to be cached")
+			}
+
+			chunk, err := os.ReadFile(filepath.Join(chunkDir, "chunk2.txt"))
+			if err != nil {
+				t.Fatalf("Failed to read chunk 2: %v", err)
+			}
+			content, err := os.ReadFile(filepath.Join(tmpDir, "refusal_test.combined_results.txt"))
+			if err != nil {
+				t.Fatalf("Failed to read combined results: %v", err)
+			}
+			if !strings.HasPrefix(string(content), tt.expected(string(chunk))) {
+				t.Errorf("Expected the combined output to start with %q, got %q", tt.expected(string(chunk)), string(content))
+			}
+
+			f, err := os.Open(opts.ReportCSV)
+			if err != nil {
+				t.Fatalf("Failed to open report: %v", err)
+			}
+			defer f.Close()
+			records, err := csv.NewReader(f).ReadAll()
+			if err != nil {
+				t.Fatalf("Failed to parse report: %v", err)
+			}
+			if records[2][6] != refusal {
+				t.Errorf("Expected chunk 2 to be reported as refused, got %v", records[2])
+			}
+			if records[1][6] != "" {
+				t.Errorf("Expected chunk 1 not to be reported as refused, got %v", records[1])
+			}
+		})
+	}
+}
+
+func TestParseRefusalPolicy(t *testing.T) {
+	if _, err := ParseRefusalPolicy("ignore"); err == nil {
+		t.Error("Expected an error for an unknown policy")
+	}
+	policy, err := ParseRefusalPolicy("keep-input")
+	if err != nil || policy != RefusalKeepInput {
+		t.Errorf("Expected keep-input, got %q (%v)", policy, err)
+	}
+}
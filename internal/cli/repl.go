@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	myopenai "github.com/clems4ever/big-context/internal/openai"
+)
+
+const replHelp = `Type a prompt to run it against the current chunk. Commands:
+  :chunk N  switch to chunk N
+  :show     print the current chunk
+  :help     print this help
+  :quit     exit
+`
+
+// RunREPL loads a chunk of the file, numbered from 1 or from 0 with
+// Options.ZeroIndex, and runs each prompt read from in against it, writing the outputs of the model to w. Nothing is
+// cached, the point is to iterate on a prompt before processing the file.
+func RunREPL(ctx context.Context, client myopenai.ChatGenerator, filePath string, chunk int, in io.Reader, w io.Writer, opts Options) error {
+	out := &syncWriter{w: opts.log()}
+
+	text, _, _, err := readInput(out, filePath, opts)
+	if err != nil {
+		return err
+	}
+	chunks, err := splitChunks(text, opts)
+	if err != nil {
+		return fmt.Errorf("failed to split into chunks: %w", err)
+	}
+	if len(chunks) == 0 {
+		return fmt.Errorf("the file %s is empty", filePath)
+	}
+	index := chunk - opts.chunkNumber(0)
+	if index < 0 || index >= len(chunks) {
+		return fmt.Errorf("chunk %d out of range: the file has %d chunks numbered from %d", chunk, len(chunks), opts.chunkNumber(0))
+	}
+
+	p := &processor{
+		client:  client,
+		opts:    opts,
+		out:     out,
+		breaker: newCircuitBreaker(opts.BreakerThreshold, opts.BreakerCooldown),
+
+		retryableStatuses: retryableStatuses(opts.RetryOnStatus, opts.NoRetryOnStatus),
+	}
+
+	fmt.Fprintf(w, "Loaded chunk %d (%d chunks numbered from %d) of %s\n%s", chunk, len(chunks), opts.chunkNumber(0), filePath, replHelp)
+
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprintf(w, "chunk %d> ", opts.chunkNumber(index))
+		if !scanner.Scan() {
+			fmt.Fprintln(w)
+			return scanner.Err()
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		command, arg, _ := strings.Cut(line, " ")
+		switch {
+		case line == "":
+		case command == ":quit" || command == ":q":
+			return nil
+		case command == ":help":
+			fmt.Fprint(w, replHelp)
+		case command == ":show":
+			fmt.Fprintln(w, chunks[index])
+		case command == ":chunk":
+			n, err := strconv.Atoi(strings.TrimSpace(arg))
+			if err != nil || n-opts.chunkNumber(0) < 0 || n-opts.chunkNumber(0) >= len(chunks) {
+				fmt.Fprintf(w, "Invalid chunk %q: the file has %d chunks numbered from %d\n", arg, len(chunks), opts.chunkNumber(0))
+				continue
+			}
+			index = n - opts.chunkNumber(0)
+		case strings.HasPrefix(command, ":"):
+			fmt.Fprintf(w, "Unknown command %s, type :help for the list of commands\n", command)
+		default:
+			output, err := p.runPrompt(ctx, line, chunks[index])
+			if err != nil {
+				// A failed prompt doesn't end the session
+				fmt.Fprintf(w, "Error: %v\n", err)
+				continue
+			}
+			fmt.Fprintln(w, output)
+		}
+	}
+}
+
+// runPrompt sends a chunk with a prompt the way the processing of the file
+// would and returns the output of the model.
+func (p *processor) runPrompt(ctx context.Context, prompt, chunk string) (string, error) {
+	res, err := p.generate(ctx, p.chunkParams(chunkPrompt(prompt, p.opts), chunk))
+	if err != nil {
+		return "", err
+	}
+	if len(res.Choices) == 0 {
+		return "", fmt.Errorf("no content in response")
+	}
+
+	usage := Usage{
+		PromptTokens:     res.Usage.PromptTokens,
+		CompletionTokens: res.Usage.CompletionTokens,
+		Cost:             usageCost(p.opts.Model, res.Usage.PromptTokens, res.Usage.CompletionTokens),
+	}
+	fmt.Fprintf(p.out, "Usage: %d prompt + %d completion tokens ($%.4f)\n", usage.PromptTokens, usage.CompletionTokens, usage.Cost)
+
+	if refusal := res.Choices[0].Message.Refusal; refusal != "" {
+		return "", fmt.Errorf("%w: %s", ErrRefusal, refusal)
+	}
+	return res.Choices[0].Message.Content, nil
+}
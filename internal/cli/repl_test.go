@@ -0,0 +1,134 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/openai/openai-go"
+)
+
+func TestRunREPL(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "repl_test.txt")
+	var lines []string
+	for i := 0; i < 600; i++ {
+		lines = append(lines, "line "+strings.Repeat("x", i%7))
+	}
+	if err := os.WriteFile(testFile, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.ChunkSize = 500
+	opts.Log = &bytes.Buffer{}
+
+	chunks, err := splitChunks(strings.Join(lines, "\n"), opts)
+	if err != nil {
+		t.Fatalf("splitChunks failed: %v", err)
+	}
+	if len(chunks) < 2 {
+		t.Fatalf("Expected at least 2 chunks, got %d", len(chunks))
+	}
+
+	mock := &mockChatGenerator{
+		requestFunc: func(params openai.ChatCompletionNewParams) string {
+			prompt, _, _ := strings.Cut(systemContent(params), "\n")
+			chunk := "other"
+			if userContent(params) == chunks[1] {
+				chunk = "chunk2"
+			}
+			return strings.ToUpper(prompt) + " on " + chunk
+		},
+	}
+
+	in := strings.NewReader("keep fruits\n\n:chunk 2\nkeep vegetables\n:chunk 99\n:bogus\n:quit\nnever sent\n")
+	var w bytes.Buffer
+	if err := RunREPL(context.Background(), mock, testFile, 1, in, &w, opts); err != nil {
+		t.Fatalf("RunREPL failed: %v", err)
+	}
+
+	if mock.callCount != 2 {
+		t.Errorf("Expected 2 requests, got %d", mock.callCount)
+	}
+
+	output := w.String()
+	for _, expected := range []string{
+		"chunk 1> KEEP FRUITS on other\n",
+		"chunk 2> KEEP VEGETABLES on chunk2\n",
+		"Invalid chunk \"99\"",
+		"Unknown command :bogus",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected the output to contain %q, got:\n%s", expected, output)
+		}
+	}
+	if strings.Contains(output, "NEVER SENT") {
+		t.Error("Expected the prompts after :quit to be ignored")
+	}
+
+	if err := RunREPL(context.Background(), mock, testFile, 99, strings.NewReader(""), &w, opts); err == nil {
+		t.Error("Expected an error for an out of range chunk")
+	}
+}
+
+func TestRunREPL_ZeroIndex(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "repl_zero_test.txt")
+	var lines []string
+	for i := 0; i < 600; i++ {
+		lines = append(lines, "line "+strings.Repeat("x", i%7))
+	}
+	if err := os.WriteFile(testFile, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.ChunkSize = 500
+	opts.ZeroIndex = true
+	opts.Log = &bytes.Buffer{}
+
+	chunks, err := splitChunks(strings.Join(lines, "\n"), opts)
+	if err != nil {
+		t.Fatalf("splitChunks failed: %v", err)
+	}
+	if len(chunks) < 2 {
+		t.Fatalf("Expected at least 2 chunks, got %d", len(chunks))
+	}
+
+	mock := &mockChatGenerator{
+		requestFunc: func(params openai.ChatCompletionNewParams) string {
+			for i, chunk := range chunks {
+				if userContent(params) == chunk {
+					return fmt.Sprintf("index %d", i)
+				}
+			}
+			return "unknown"
+		},
+	}
+
+	// Chunk 0 is the first one and chunk 1 the second one
+	in := strings.NewReader(fmt.Sprintf("prompt\n:chunk 1\nprompt\n:chunk %d\n:quit\n", len(chunks)))
+	var w bytes.Buffer
+	if err := RunREPL(context.Background(), mock, testFile, 0, in, &w, opts); err != nil {
+		t.Fatalf("RunREPL failed: %v", err)
+	}
+	output := w.String()
+	for _, expected := range []string{
+		"chunk 0> index 0\n",
+		"chunk 1> index 1\n",
+		fmt.Sprintf("Invalid chunk \"%d\"", len(chunks)),
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected the output to contain %q, got:\n%s", expected, output)
+		}
+	}
+
+	if err := RunREPL(context.Background(), mock, testFile, len(chunks), strings.NewReader(""), &w, opts); err == nil {
+		t.Error("Expected an error for the chunk past the last one")
+	}
+}
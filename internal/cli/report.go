@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// writeReportCSV writes one row per chunk, numbered as in the messages, with
+// its token usage, cost, latency whether it was served from the cache and the
+// refusal of the model, if any.
+func writeReportCSV(path string, results []chunkResult, opts Options) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	if err := w.Write([]string{"chunk", "input_tokens", "output_tokens", "cost_usd", "latency_ms", "cache_hit", "refusal"}); err != nil {
+		return err
+	}
+
+	for _, result := range results {
+		err := w.Write([]string{
+			strconv.Itoa(opts.chunkNumber(result.Index)),
+			strconv.FormatInt(result.Usage.PromptTokens, 10),
+			strconv.FormatInt(result.Usage.CompletionTokens, 10),
+			fmt.Sprintf("%.6f", result.Usage.Cost),
+			strconv.FormatInt(result.Latency.Milliseconds(), 10),
+			strconv.FormatBool(result.Cached),
+			result.Refusal,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
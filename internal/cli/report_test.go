@@ -0,0 +1,110 @@
+package cli
+
+import (
+	"context"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/openai/openai-go"
+)
+
+func TestProcessWithClient_ReportCSV(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "report_test.txt")
+	if err := os.WriteFile(testFile, []byte(strings.Repeat("word ", 3000)), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	reportFile := filepath.Join(tmpDir, "report.csv")
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.ReportCSV = reportFile
+
+	mock := &mockChatGenerator{usage: openai.CompletionUsage{PromptTokens: 2000, CompletionTokens: 50}}
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	f, err := os.Open(reportFile)
+	if err != nil {
+		t.Fatalf("Failed to open report: %v", err)
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse report: %v", err)
+	}
+
+	expectedHeader := []string{"chunk", "input_tokens", "output_tokens", "cost_usd", "latency_ms", "cache_hit", "refusal"}
+	if !reflect.DeepEqual(records[0], expectedHeader) {
+		t.Errorf("Expected header %v, got %v", expectedHeader, records[0])
+	}
+
+	if rows := len(records) - 1; rows != mock.callCount {
+		t.Errorf("Expected %d rows, got %d", mock.callCount, rows)
+	}
+
+	for _, row := range records[1:] {
+		if row[1] != "2000" || row[2] != "50" || row[5] != "false" {
+			t.Errorf("Unexpected row %v", row)
+		}
+	}
+
+	// A rerun reports cache hits.
+	if err := ProcessWithClientOptions(context.Background(), &mockChatGenerator{}, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("Cached run failed: %v", err)
+	}
+
+	b, err := os.ReadFile(reportFile)
+	if err != nil {
+		t.Fatalf("Failed to read report: %v", err)
+	}
+	records, err = csv.NewReader(strings.NewReader(string(b))).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse report: %v", err)
+	}
+	for _, row := range records[1:] {
+		if row[5] != "true" {
+			t.Errorf("Expected a cache hit, got row %v", row)
+		}
+	}
+}
+
+func TestProcessWithClient_ReportCSVZeroIndex(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "report_zero_test.txt")
+	if err := os.WriteFile(testFile, []byte(strings.Repeat("word ", 3000)), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	reportFile := filepath.Join(tmpDir, "report.csv")
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.ZeroIndex = true
+	opts.ReportCSV = reportFile
+
+	mock := &mockChatGenerator{}
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	b, err := os.ReadFile(reportFile)
+	if err != nil {
+		t.Fatalf("Failed to read report: %v", err)
+	}
+	records, err := csv.NewReader(strings.NewReader(string(b))).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse report: %v", err)
+	}
+	for i, row := range records[1:] {
+		if row[0] != strconv.Itoa(i) {
+			t.Errorf("Expected row %d to be numbered %d as the chunk files, got %v", i, i, row)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	myopenai "github.com/clems4ever/big-context/internal/openai"
+)
+
+// runResult is the summary of a run printed with Options.ResultJSON.
+type runResult struct {
+	File string `json:"file"`
+	// Output is the path of the combined output, empty when the run didn't
+	// write it.
+	Output           string         `json:"output"`
+	Chunks           int            `json:"chunks"`
+	CacheHits        int            `json:"cache_hits"`
+	PromptTokens     int64          `json:"prompt_tokens"`
+	CompletionTokens int64          `json:"completion_tokens"`
+	Cost             float64        `json:"cost_usd"`
+	DurationMs       int64          `json:"duration_ms"`
+	Errors           []chunkFailure `json:"errors"`
+	// Error is the failure of the run, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// chunkFailure is the failure of a chunk.
+type chunkFailure struct {
+	Chunk int    `json:"chunk"`
+	Error string `json:"error"`
+}
+
+// observe accounts for a progress event of the run.
+func (r *runResult) observe(event ProgressEvent, opts Options) {
+	r.Chunks = max(r.Chunks, event.Total)
+	switch event.Status {
+	case ChunkCached:
+		r.CacheHits++
+	case ChunkDone, StepDone:
+		r.PromptTokens += event.Usage.PromptTokens
+		r.CompletionTokens += event.Usage.CompletionTokens
+		r.Cost += event.Usage.Cost
+	case ChunkError:
+		r.Errors = append(r.Errors, chunkFailure{Chunk: opts.chunkNumber(event.Chunk), Error: event.Err.Error()})
+	}
+}
+
+// processWithResultJSON processes a file and prints the summary of the run
+// as a single JSON object to Stdout once done, failed or not. The progress
+// messages go to stderr unless Log is set.
+func processWithResultJSON(ctx context.Context, client myopenai.ChatGenerator, prompt, filePath string, opts Options) error {
+	if info, err := os.Stat(filePath); opts.FilesFrom != "" || (err == nil && info.IsDir()) {
+		return invalidConfig(fmt.Errorf("the JSON result requires a single file"))
+	}
+	if opts.EstimateOnly || opts.Explain || len(opts.CompareModels) > 0 {
+		return invalidConfig(fmt.Errorf("the JSON result cannot be combined with estimating, explaining or comparing models"))
+	}
+	if opts.Sequential && opts.Stream {
+		return invalidConfig(fmt.Errorf("the JSON result cannot be combined with the sequential transcript, which is printed to stdout"))
+	}
+	if opts.Log == nil {
+		opts.Log = os.Stderr
+	}
+
+	result := runResult{File: filePath, Errors: []chunkFailure{}}
+	listener := opts.ProgressFunc
+	opts.ProgressFunc = func(event ProgressEvent) {
+		result.observe(event, opts)
+		if listener != nil {
+			listener(event)
+		}
+	}
+	opts.ResultJSON = false
+
+	start := time.Now()
+	err := ProcessWithClientOptions(ctx, client, prompt, filePath, opts)
+	result.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	// An output left by a previous run was not written by this one, the
+	// modification times may be truncated to the second
+	output := opts.outputPaths(opts.combinedOutputPath(combinedFilePath(filePath)))[0]
+	if info, statErr := os.Stat(output); err == nil && statErr == nil && !info.ModTime().Before(start.Truncate(time.Second)) {
+		result.Output = output
+	}
+
+	b, jsonErr := json.Marshal(result)
+	if jsonErr != nil {
+		return fmt.Errorf("failed to marshal the JSON result: %w", jsonErr)
+	}
+	if _, writeErr := fmt.Fprintf(opts.stdout(), "%s\n", b); writeErr != nil && err == nil {
+		return writeErr
+	}
+	return err
+}
@@ -0,0 +1,139 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/openai/openai-go"
+)
+
+func TestProcessWithClient_ResultJSON(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "result_test.txt")
+	var lines []string
+	for i := range 3 {
+		lines = append(lines, fmt.Sprintf("line %d with a few words of content", i))
+	}
+	if err := os.WriteFile(testFile, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	mock := &mockChatGenerator{usage: openai.CompletionUsage{PromptTokens: 100, CompletionTokens: 10}}
+	run := func() (runResult, string, error) {
+		t.Helper()
+		var stdout, log bytes.Buffer
+		opts := DefaultOptions()
+		opts.RequireConfirmation = false
+		opts.ChunkSize = 10
+		opts.ResultJSON = true
+		opts.Stdout = &stdout
+		opts.Log = &log
+
+		err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts)
+		var result runResult
+		if jsonErr := json.Unmarshal(stdout.Bytes(), &result); jsonErr != nil {
+			t.Fatalf("Failed to parse the JSON result %q: %v", stdout.String(), jsonErr)
+		}
+		if strings.Contains(stdout.String(), "Split into") || !strings.Contains(log.String(), "Split into") {
+			t.Errorf("Expected the progress messages in the log only, got stdout %q", stdout.String())
+		}
+		return result, log.String(), err
+	}
+
+	// The second chunk fails
+	mock.errorFunc = func(callCount int) error {
+		if callCount == 2 {
+			return newAPIError(http.StatusBadRequest)
+		}
+		return nil
+	}
+	result, _, err := run()
+	if err == nil || result.Error == "" {
+		t.Fatalf("Expected the run to fail, got %v and %+v", err, result)
+	}
+	if result.Output != "" {
+		t.Errorf("Expected no output, got %s", result.Output)
+	}
+	// The chunks in flight are cancelled by the failure
+	failed := 0
+	for _, failure := range result.Errors {
+		if failure.Chunk < 1 || failure.Chunk > 3 {
+			t.Errorf("Unexpected chunk number %d", failure.Chunk)
+		}
+		if strings.Contains(failure.Error, "400 Bad Request") {
+			failed++
+		}
+	}
+	if failed != 1 {
+		t.Errorf("Expected the failed chunk to be reported, got %+v", result.Errors)
+	}
+
+	// The chunks completed before are served from the cache
+	mock.errorFunc = nil
+	result, _, err = run()
+	if err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+	if result.File != testFile || result.Output != combinedFilePath(testFile) {
+		t.Errorf("Expected the file and its combined output, got %+v", result)
+	}
+	if result.Chunks != 3 || result.CacheHits < 1 || result.Error != "" || len(result.Errors) != 0 {
+		t.Errorf("Expected 3 chunks with cache hits and no error, got %+v", result)
+	}
+	processed := int64(result.Chunks - result.CacheHits)
+	if result.PromptTokens != 100*processed || result.CompletionTokens != 10*processed {
+		t.Errorf("Expected the usage of the %d processed chunks, got %d + %d tokens", processed, result.PromptTokens, result.CompletionTokens)
+	}
+	if result.Cost != usageCost(ModelGPT5Nano, result.PromptTokens, result.CompletionTokens) {
+		t.Errorf("Expected the cost of the usage, got %f", result.Cost)
+	}
+	if result.DurationMs < 0 {
+		t.Errorf("Expected a duration, got %d", result.DurationMs)
+	}
+}
+
+func TestProcessWithClient_ResultJSONCountsTheReduce(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "result_reduce_test.txt")
+	if err := os.WriteFile(testFile, []byte("line 0 with a few words\nline 1 with a few words"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	mock := &mockChatGenerator{usage: openai.CompletionUsage{PromptTokens: 100, CompletionTokens: 10}}
+	var stdout bytes.Buffer
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.ChunkSize = 10
+	opts.ReducePrompt = "merge the results"
+	opts.ResultJSON = true
+	opts.Stdout = &stdout
+	opts.Log = &bytes.Buffer{}
+
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var result runResult
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to parse the JSON result %q: %v", stdout.String(), err)
+	}
+	// Every chunk plus the reduce step
+	calls := int64(mock.callCount)
+	if result.Chunks+1 != int(calls) || result.PromptTokens != 100*calls || result.CompletionTokens != 10*calls {
+		t.Errorf("Expected the usage of %d calls, got %+v", calls, result)
+	}
+
+	opts.Sequential = true
+	opts.Stream = true
+	err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts)
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected the sequential transcript to be rejected, got %v", err)
+	}
+}
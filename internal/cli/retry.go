@@ -0,0 +1,313 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/openai/openai-go"
+)
+
+// ErrCircuitOpen is returned by the shared circuit breaker when it refuses a
+// request because too many consecutive failures were observed across chunks.
+var ErrCircuitOpen = withCategory(ErrAPI, errors.New("circuit breaker is open"))
+
+// defaultRetryableStatuses are the HTTP statuses retried unless configured otherwise.
+var defaultRetryableStatuses = []int{
+	http.StatusRequestTimeout,
+	http.StatusConflict,
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// retryableStatuses merges the default retryable statuses with the added
+// ones and removes the excluded ones.
+func retryableStatuses(added, removed []int) map[int]bool {
+	statuses := make(map[int]bool)
+	for _, status := range defaultRetryableStatuses {
+		statuses[status] = true
+	}
+	for _, status := range added {
+		statuses[status] = true
+	}
+	for _, status := range removed {
+		delete(statuses, status)
+	}
+	return statuses
+}
+
+// isRetryable tells whether a failed request is worth retrying.
+func isRetryable(err error, statuses map[int]bool) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var apiErr *openai.Error
+	if errors.As(err, &apiErr) {
+		return statuses[apiErr.StatusCode]
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// retryKind is a kind of failure with its own number of retries.
+type retryKind int
+
+const (
+	// retryStatus is a retryable HTTP status other than 429.
+	retryStatus retryKind = iota
+	retryRateLimit
+	retryNetwork
+)
+
+func retryKindOf(err error) retryKind {
+	var apiErr *openai.Error
+	if !errors.As(err, &apiErr) {
+		return retryNetwork
+	}
+	if apiErr.StatusCode == http.StatusTooManyRequests {
+		return retryRateLimit
+	}
+	return retryStatus
+}
+
+// retryLimit returns the number of retries of a kind of failure, MaxRetries
+// unless overridden for the kind.
+func (o Options) retryLimit(kind retryKind) int {
+	limit := -1
+	switch kind {
+	case retryNetwork:
+		limit = o.MaxRetriesNetwork
+	case retryRateLimit:
+		limit = o.MaxRetriesRateLimit
+	}
+	if limit < 0 {
+		return o.MaxRetries
+	}
+	return limit
+}
+
+// isFlexUnavailable tells whether the API rejected the request because the
+// Flex service tier is not available for the account or the model.
+func isFlexUnavailable(err error) bool {
+	var apiErr *openai.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	switch apiErr.StatusCode {
+	case http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound:
+	default:
+		return false
+	}
+
+	if apiErr.Param == "service_tier" {
+		return true
+	}
+	message := strings.ToLower(apiErr.Code + " " + apiErr.Message)
+	return strings.Contains(message, "flex") || strings.Contains(message, "service_tier") || strings.Contains(message, "service tier")
+}
+
+// backoffDelay returns the delay to wait before the given retry attempt (starting at 1).
+func backoffDelay(initial, maxDelay time.Duration, attempt int) time.Duration {
+	delay := initial
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if maxDelay > 0 && delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
+// retryAfter returns the delay the API asks to wait before retrying a failed
+// request, from the retry-after-ms or Retry-After header of its response.
+func retryAfter(err error, now time.Time) (time.Duration, bool) {
+	var apiErr *openai.Error
+	if !errors.As(err, &apiErr) || apiErr.Response == nil {
+		return 0, false
+	}
+	header := apiErr.Response.Header
+
+	if ms, err := strconv.ParseFloat(header.Get("retry-after-ms"), 64); err == nil && ms >= 0 {
+		return time.Duration(ms * float64(time.Millisecond)), true
+	}
+	value := header.Get("Retry-After")
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds >= 0 {
+		return time.Duration(seconds * float64(time.Second)), true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// retryDelay returns the delay to wait before the given retry attempt
+// (starting at 1): the one the API asked for, capped by MaxRetryAfter, or
+// the backoff otherwise.
+func (o Options) retryDelay(err error, attempt int) time.Duration {
+	if delay, ok := retryAfter(err, time.Now()); ok {
+		if o.MaxRetryAfter > 0 && delay > o.MaxRetryAfter {
+			return o.MaxRetryAfter
+		}
+		return delay
+	}
+	return backoffDelay(o.RetryBackoff, o.MaxRetryBackoff, attempt)
+}
+
+// sleepContext waits for the given duration or until the context is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// circuitBreaker is shared by all chunks of a run. Once threshold consecutive
+// failures are observed it opens and rejects requests until cooldown elapses,
+// then lets a single probe through to decide whether to close again.
+type circuitBreaker struct {
+	mu sync.Mutex
+
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	state    breakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// Allow returns ErrCircuitOpen when a request must not be sent.
+func (b *circuitBreaker) Allow() error {
+	if b == nil || b.threshold <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return ErrCircuitOpen
+		}
+		b.state = breakerHalfOpen
+		b.probing = true
+		return nil
+	case breakerHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+		return nil
+	}
+	return nil
+}
+
+// probePoll is how often a request waiting for the probe in flight checks
+// whether it ended.
+const probePoll = 100 * time.Millisecond
+
+// Wait blocks until a request may be sent: while the circuit is open until
+// the cooldown elapses, while a probe is in flight until it ends.
+func (b *circuitBreaker) Wait(ctx context.Context) error {
+	for {
+		err := b.Allow()
+		if !errors.Is(err, ErrCircuitOpen) {
+			return err
+		}
+		if err := sleepContext(ctx, b.retryIn()); err != nil {
+			return err
+		}
+	}
+}
+
+// retryIn returns how long a refused request waits before asking again.
+func (b *circuitBreaker) retryIn() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerOpen {
+		if remaining := b.openedAt.Add(b.cooldown).Sub(b.now()); remaining > 0 {
+			return remaining
+		}
+	}
+	return min(b.cooldown, probePoll)
+}
+
+// Release ends a request that tells nothing about the health of the API,
+// e.g. a cancelled or rejected one, so that another request can probe the
+// circuit.
+func (b *circuitBreaker) Release() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+// Success records a successful request and closes the circuit.
+func (b *circuitBreaker) Success() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = breakerClosed
+	b.failures = 0
+	b.probing = false
+}
+
+// Failure records a failed request and opens the circuit when the threshold is reached.
+func (b *circuitBreaker) Failure() {
+	if b == nil || b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		b.state = breakerOpen
+		b.openedAt = b.now()
+		b.probing = false
+	}
+}
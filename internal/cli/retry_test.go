@@ -0,0 +1,601 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	myopenai "github.com/clems4ever/big-context/internal/openai"
+	"github.com/openai/openai-go"
+)
+
+// newAPIError builds an OpenAI API error with the given HTTP status code.
+func newAPIError(statusCode int) *openai.Error {
+	req, _ := http.NewRequest(http.MethodPost, "https://api.openai.com/v1/chat/completions", nil)
+	return &openai.Error{
+		StatusCode: statusCode,
+		Request:    req,
+		Response:   &http.Response{StatusCode: statusCode, Header: http.Header{}},
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"rate limited", newAPIError(http.StatusTooManyRequests), true},
+		{"server error", newAPIError(http.StatusServiceUnavailable), true},
+		{"bad request", newAPIError(http.StatusBadRequest), false},
+		{"wrapped server error", fmt.Errorf("wrapped: %w", newAPIError(http.StatusBadGateway)), true},
+		{"cancelled", context.Canceled, false},
+		{"unknown error", errors.New("boom"), false},
+	}
+
+	statuses := retryableStatuses(nil, nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryable(tt.err, statuses); got != tt.expected {
+				t.Errorf("expected isRetryable=%v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestCircuitBreaker_OpensAndProbes(t *testing.T) {
+	now := time.Now()
+	breaker := newCircuitBreaker(3, time.Minute)
+	breaker.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if err := breaker.Allow(); err != nil {
+			t.Fatalf("expected request %d to be allowed, got %v", i, err)
+		}
+		breaker.Failure()
+	}
+
+	if err := breaker.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected circuit to be open, got %v", err)
+	}
+
+	// After the cooldown a single probe is allowed.
+	now = now.Add(time.Minute)
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("expected probe to be allowed, got %v", err)
+	}
+	if err := breaker.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected concurrent request to be rejected during probe, got %v", err)
+	}
+
+	// A failed probe opens the circuit again.
+	breaker.Failure()
+	if err := breaker.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected circuit to reopen after failed probe, got %v", err)
+	}
+
+	// A successful probe closes it.
+	now = now.Add(time.Minute)
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("expected probe to be allowed, got %v", err)
+	}
+	breaker.Success()
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("expected circuit to be closed after successful probe, got %v", err)
+	}
+}
+
+func TestCircuitBreaker_ReleaseLetsAnotherProbeThrough(t *testing.T) {
+	now := time.Now()
+	breaker := newCircuitBreaker(1, time.Minute)
+	breaker.now = func() time.Time { return now }
+
+	breaker.Failure()
+	now = now.Add(time.Minute)
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("expected probe to be allowed, got %v", err)
+	}
+
+	// A probe rejected for a reason unrelated to the outage tells nothing,
+	// the next request probes instead of waiting forever.
+	breaker.Release()
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("expected another probe to be allowed after the release, got %v", err)
+	}
+}
+
+func TestCircuitBreaker_WaitsForCooldown(t *testing.T) {
+	breaker := newCircuitBreaker(1, 50*time.Millisecond)
+	breaker.Failure()
+
+	start := time.Now()
+	if err := breaker.Wait(context.Background()); err != nil {
+		t.Fatalf("expected the wait to end with the cooldown, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("expected the wait to last the cooldown, took %s", elapsed)
+	}
+
+	// A request waiting for the probe in flight gives up with its context.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := breaker.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the wait to end with the context, got %v", err)
+	}
+}
+
+func TestProcessWithClient_RetriesTransientErrors(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "retry_test.txt")
+	if err := os.WriteFile(testFile, []byte("Some content"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	mock := &mockChatGenerator{
+		errorFunc: func(callCount int) error {
+			if callCount < 3 {
+				return newAPIError(http.StatusServiceUnavailable)
+			}
+			return nil
+		},
+		responseFunc: func(callCount int) string {
+			return "recovered"
+		},
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.RetryBackoff = time.Millisecond
+
+	err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts)
+	if err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	if mock.callCount != 3 {
+		t.Errorf("Expected 3 API calls, got %d", mock.callCount)
+	}
+}
+
+func TestProcessWithClient_RetryLimitsPerKind(t *testing.T) {
+	networkErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+	tests := []struct {
+		name      string
+		configure func(opts *Options)
+		mock      func() *mockChatGenerator
+		calls     int
+	}{
+		{
+			name:      "network",
+			configure: func(opts *Options) { opts.MaxRetriesNetwork = 2 },
+			mock: func() *mockChatGenerator {
+				return &mockChatGenerator{errorFunc: func(int) error { return networkErr }}
+			},
+			calls: 3,
+		},
+		{
+			name:      "rate limit",
+			configure: func(opts *Options) { opts.MaxRetriesRateLimit = 1 },
+			mock: func() *mockChatGenerator {
+				return &mockChatGenerator{errorFunc: func(int) error { return newAPIError(http.StatusTooManyRequests) }}
+			},
+			calls: 2,
+		},
+		{
+			name:      "server error",
+			configure: func(opts *Options) { opts.MaxRetriesNetwork, opts.MaxRetriesRateLimit = 0, 0 },
+			mock: func() *mockChatGenerator {
+				return &mockChatGenerator{errorFunc: func(int) error { return newAPIError(http.StatusServiceUnavailable) }}
+			},
+			calls: 5,
+		},
+		{
+			name:      "empty",
+			configure: func(opts *Options) { opts.MaxRetriesEmpty = 2 },
+			mock: func() *mockChatGenerator {
+				return &mockChatGenerator{choicesFunc: func(int) []string { return nil }}
+			},
+			calls: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			testFile := filepath.Join(tmpDir, "input.txt")
+			if err := os.WriteFile(testFile, []byte("Some content"), 0644); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+
+			mock := tt.mock()
+			opts := DefaultOptions()
+			opts.RequireConfirmation = false
+			opts.MaxRetries = 4
+			opts.RetryBackoff = time.Millisecond
+			opts.BreakerThreshold = 0
+			tt.configure(&opts)
+
+			err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts)
+			if err == nil {
+				t.Fatal("Expected the run to fail once the retries are exhausted")
+			}
+			if mock.callCount != tt.calls {
+				t.Errorf("Expected %d API calls, got %d", tt.calls, mock.callCount)
+			}
+		})
+	}
+}
+
+func TestProcessWithClient_RetriesEmptyResponse(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "empty_test.txt")
+	if err := os.WriteFile(testFile, []byte("Some content"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	mock := &mockChatGenerator{
+		choicesFunc: func(callCount int) []string {
+			if callCount < 3 {
+				return nil
+			}
+			return []string{"recovered"}
+		},
+		usage: openai.CompletionUsage{PromptTokens: 10, CompletionTokens: 1},
+	}
+
+	var out bytes.Buffer
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.MaxRetriesEmpty = 2
+	opts.Stdout = &out
+	opts.Log = &out
+
+	err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts)
+	if err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	if mock.callCount != 3 {
+		t.Errorf("Expected 3 API calls, got %d", mock.callCount)
+	}
+	if strings.Count(out.String(), "Chunk 1: empty response, retrying") != 2 {
+		t.Errorf("Expected two empty response retries, got:\n%s", out.String())
+	}
+	// The discarded responses were billed too
+	if !strings.Contains(out.String(), "Token usage: 30 prompt + 3 completion tokens") {
+		t.Errorf("Expected the usage of the three requests, got:\n%s", out.String())
+	}
+	// A new attempt must not be deduplicated into the empty response
+	if idempotencyKey(0, 0, mock.params[0]) == idempotencyKey(0, 1, mock.params[1]) {
+		t.Error("Expected a new idempotency key for the new attempt")
+	}
+}
+
+func TestProcessWithClient_CircuitBreakerStopsRequests(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "outage_test.txt")
+	if err := os.WriteFile(testFile, []byte(strings.Repeat("word ", 3000)), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	// The provider is down for every request.
+	mock := &mockChatGenerator{
+		errorFunc: func(callCount int) error {
+			return newAPIError(http.StatusServiceUnavailable)
+		},
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.MaxRetries = 4
+	opts.RetryBackoff = time.Millisecond
+	opts.BreakerThreshold = 3
+	opts.BreakerCooldown = 20 * time.Millisecond
+
+	start := time.Now()
+	err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts)
+	if err == nil {
+		t.Fatal("Expected ProcessWithClientOptions to fail during the outage")
+	}
+
+	// The chunks wait for the probes instead of failing with the breaker.
+	if errors.Is(err, ErrCircuitOpen) || !errors.Is(err, ErrAPI) {
+		t.Errorf("Expected the error of the API, got: %v", err)
+	}
+
+	elapsed := time.Since(start)
+	if elapsed < opts.BreakerCooldown {
+		t.Errorf("Expected the run to wait for the cooldown, took %s", elapsed)
+	}
+
+	// Once the breaker opened, the requests in flight aside, a single probe
+	// is sent per cooldown.
+	chunks, err := splitIntoTokenChunks(strings.Repeat("word ", 3000), 2000)
+	if err != nil {
+		t.Fatalf("splitIntoTokenChunks failed: %v", err)
+	}
+	probes := int(elapsed/opts.BreakerCooldown) + 1
+	if maxCalls := opts.BreakerThreshold + len(chunks) + probes; mock.callCount > maxCalls {
+		t.Errorf("Expected at most %d API calls once the breaker opened, got %d", maxCalls, mock.callCount)
+	}
+}
+
+func TestRetryableStatuses(t *testing.T) {
+	statuses := retryableStatuses([]int{520}, []int{http.StatusConflict})
+
+	if !statuses[520] {
+		t.Error("Expected the added status to be retryable")
+	}
+	if statuses[http.StatusConflict] {
+		t.Error("Expected the removed status not to be retryable")
+	}
+	if !statuses[http.StatusTooManyRequests] {
+		t.Error("Expected the default statuses to be kept")
+	}
+}
+
+func TestProcessWithClient_RetryOnStatus(t *testing.T) {
+	tests := []struct {
+		name          string
+		retryOn       []int
+		noRetryOn     []int
+		status        int
+		expectSuccess bool
+		expectedCalls int
+	}{
+		{name: "custom status not retried by default", status: 520, expectedCalls: 1},
+		{name: "custom status retried when configured", retryOn: []int{520}, status: 520, expectSuccess: true, expectedCalls: 2},
+		{name: "default status retried", status: http.StatusServiceUnavailable, expectSuccess: true, expectedCalls: 2},
+		{name: "default status removed", noRetryOn: []int{http.StatusServiceUnavailable}, status: http.StatusServiceUnavailable, expectedCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			testFile := filepath.Join(tmpDir, "status_test.txt")
+			if err := os.WriteFile(testFile, []byte("Some content"), 0644); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+
+			mock := &mockChatGenerator{
+				errorFunc: func(callCount int) error {
+					if callCount == 1 {
+						return newAPIError(tt.status)
+					}
+					return nil
+				},
+			}
+
+			opts := DefaultOptions()
+			opts.RequireConfirmation = false
+			opts.RetryBackoff = time.Millisecond
+			opts.RetryOnStatus = tt.retryOn
+			opts.NoRetryOnStatus = tt.noRetryOn
+
+			err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts)
+			if tt.expectSuccess && err != nil {
+				t.Fatalf("Expected success, got: %v", err)
+			}
+			if !tt.expectSuccess && err == nil {
+				t.Fatal("Expected the run to fail")
+			}
+
+			if mock.callCount != tt.expectedCalls {
+				t.Errorf("Expected %d API calls, got %d", tt.expectedCalls, mock.callCount)
+			}
+		})
+	}
+}
+
+func TestProcessWithClient_FlexFallback(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "flex_test.txt")
+	if err := os.WriteFile(testFile, []byte(strings.Repeat("word ", 3000)), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	var log bytes.Buffer
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.Concurrency = 1
+	opts.Log = &log
+
+	var mock *mockChatGenerator
+	mock = &mockChatGenerator{
+		errorFunc: func(callCount int) error {
+			if mock.params[callCount-1].ServiceTier == openai.ChatCompletionNewParamsServiceTierFlex {
+				err := newAPIError(http.StatusBadRequest)
+				err.Param = "service_tier"
+				err.Message = "Flex processing is not available for this model"
+				return err
+			}
+			return nil
+		},
+	}
+
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	// Only the first request is sent with Flex, the others go to the default tier.
+	flexRequests := 0
+	for _, params := range mock.params {
+		if params.ServiceTier == openai.ChatCompletionNewParamsServiceTierFlex {
+			flexRequests++
+		}
+	}
+	if flexRequests != 1 {
+		t.Errorf("Expected a single Flex request, got %d", flexRequests)
+	}
+
+	last := mock.params[len(mock.params)-1]
+	if last.ServiceTier != openai.ChatCompletionNewParamsServiceTierDefault {
+		t.Errorf("Expected the default tier after the downgrade, got %q", last.ServiceTier)
+	}
+
+	if count := strings.Count(log.String(), "Flex service tier is not available"); count != 1 {
+		t.Errorf("Expected a single downgrade warning, got %d", count)
+	}
+}
+
+func TestIsFlexUnavailable(t *testing.T) {
+	tierErr := newAPIError(http.StatusBadRequest)
+	tierErr.Message = "Invalid service_tier: flex"
+	if !isFlexUnavailable(tierErr) {
+		t.Error("Expected a service tier error to be detected")
+	}
+
+	if isFlexUnavailable(newAPIError(http.StatusBadRequest)) {
+		t.Error("Expected a generic bad request not to be detected")
+	}
+
+	if isFlexUnavailable(newAPIError(http.StatusServiceUnavailable)) {
+		t.Error("Expected a server error not to be detected")
+	}
+}
+
+// idempotencyRecorder records the idempotency key of each request by chunk content.
+type idempotencyRecorder struct {
+	*mockChatGenerator
+	mu   sync.Mutex
+	keys map[string][]string
+}
+
+func (r *idempotencyRecorder) GenerateChatCompletion(ctx context.Context, params openai.ChatCompletionNewParams) (*openai.ChatCompletion, error) {
+	r.mu.Lock()
+	r.keys[userContent(params)] = append(r.keys[userContent(params)], myopenai.IdempotencyKey(ctx))
+	r.mu.Unlock()
+	return r.mockChatGenerator.GenerateChatCompletion(ctx, params)
+}
+
+func TestProcessWithClient_IdempotencyKeyStableAcrossRetries(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "idempotency_test.txt")
+	var content strings.Builder
+	for i := 0; i < 600; i++ {
+		fmt.Fprintf(&content, "line %d with a few words to fill the chunk\n", i)
+	}
+	if err := os.WriteFile(testFile, []byte(content.String()), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	// Every chunk fails once before succeeding
+	var failed sync.Map
+	recorder := &idempotencyRecorder{keys: make(map[string][]string)}
+	recorder.mockChatGenerator = &mockChatGenerator{}
+	recorder.mockChatGenerator.errorFunc = func(callCount int) error {
+		params := recorder.mockChatGenerator.params[callCount-1]
+		if _, loaded := failed.LoadOrStore(userContent(params), true); !loaded {
+			return newAPIError(http.StatusServiceUnavailable)
+		}
+		return nil
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.RetryBackoff = time.Millisecond
+	opts.Log = &bytes.Buffer{}
+
+	if err := ProcessWithClientOptions(context.Background(), recorder, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	if len(recorder.keys) < 2 {
+		t.Fatalf("Expected requests for several chunks, got %d", len(recorder.keys))
+	}
+
+	seen := make(map[string]bool)
+	for _, keys := range recorder.keys {
+		if len(keys) != 2 {
+			t.Fatalf("Expected 2 attempts per chunk, got %d", len(keys))
+		}
+		if keys[0] == "" {
+			t.Error("Expected an idempotency key on the request")
+		}
+		if keys[0] != keys[1] {
+			t.Errorf("Expected the key to be stable across retries, got %q and %q", keys[0], keys[1])
+		}
+		if seen[keys[0]] {
+			t.Errorf("Expected distinct keys for distinct chunks, got %q twice", keys[0])
+		}
+		seen[keys[0]] = true
+	}
+}
+
+// newRateLimitError returns a 429 whose response carries the given header.
+func newRateLimitError(header, value string) *openai.Error {
+	err := newAPIError(http.StatusTooManyRequests)
+	err.Response.Header.Set(header, value)
+	return err
+}
+
+func TestRetryDelay(t *testing.T) {
+	opts := DefaultOptions()
+	opts.RetryBackoff = time.Second
+	opts.MaxRetryAfter = 10 * time.Second
+
+	tests := []struct {
+		name     string
+		err      error
+		expected time.Duration
+	}{
+		{"seconds", newRateLimitError("Retry-After", "7"), 7 * time.Second},
+		{"fractional seconds", newRateLimitError("Retry-After", "0.5"), 500 * time.Millisecond},
+		{"milliseconds", newRateLimitError("retry-after-ms", "250"), 250 * time.Millisecond},
+		{"capped", newRateLimitError("Retry-After", "3600"), 10 * time.Second},
+		{"past date", newRateLimitError("Retry-After", "Mon, 02 Jan 2006 15:04:05 GMT"), 0},
+		{"invalid header", newRateLimitError("Retry-After", "soon"), 4 * time.Second},
+		{"no header", newAPIError(http.StatusTooManyRequests), 4 * time.Second},
+		{"network error", &net.OpError{Op: "dial", Err: errors.New("refused")}, 4 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := opts.retryDelay(tt.err, 3); got != tt.expected {
+				t.Errorf("Expected a delay of %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestProcessWithClient_HonorsRetryAfter(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "retry_after_test.txt")
+	if err := os.WriteFile(testFile, []byte("Some content"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	mock := &mockChatGenerator{
+		errorFunc: func(callCount int) error {
+			if callCount == 1 {
+				return newRateLimitError("Retry-After", "0.2")
+			}
+			return nil
+		},
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	// The backoff would time the test out
+	opts.RetryBackoff = time.Hour
+
+	start := time.Now()
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond || elapsed > 5*time.Second {
+		t.Errorf("Expected to wait the 200ms asked by the API, waited %s", elapsed)
+	}
+	if mock.callCount != 2 {
+		t.Errorf("Expected 2 API calls, got %d", mock.callCount)
+	}
+}
@@ -0,0 +1,165 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ParseSize parses a size in bytes, optionally with a KB, MB or GB suffix
+// (1 KB = 1024 bytes).
+func ParseSize(s string) (int64, error) {
+	units := []struct {
+		suffix     string
+		multiplier int64
+	}{
+		{"GB", 1 << 30},
+		{"MB", 1 << 20},
+		{"KB", 1 << 10},
+		{"B", 1},
+	}
+
+	value, multiplier := strings.ToUpper(strings.TrimSpace(s)), int64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(value, unit.suffix) {
+			value, multiplier = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix)), unit.multiplier
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, invalidConfig(fmt.Errorf("invalid size %q (expected a number of bytes, optionally with a KB, MB or GB suffix)", s))
+	}
+	return n * multiplier, nil
+}
+
+// outputPartPath returns the path of a part of the combined output, the first
+// part being the combined output itself.
+func outputPartPath(combinedFileName string, part int) string {
+	if part == 1 {
+		return combinedFileName
+	}
+	return fmt.Sprintf("%s.combined_results.part%d.txt", strings.TrimSuffix(combinedFileName, ".combined_results.txt"), part)
+}
+
+// splitOutputParts cuts the output between lines in parts of at most maxSize
+// bytes. A line longer than maxSize makes a part on its own.
+func splitOutputParts(content string, maxSize int64) []string {
+	var parts []string
+	var current strings.Builder
+	for _, line := range strings.SplitAfter(content, "\n") {
+		if current.Len() > 0 && int64(current.Len()+len(line)) > maxSize {
+			parts = append(parts, current.String())
+			current.Reset()
+		}
+		current.WriteString(line)
+	}
+	if current.Len() > 0 || len(parts) == 0 {
+		parts = append(parts, current.String())
+	}
+	return parts
+}
+
+// writeOutputParts writes the combined output rotated in parts of at most
+// maxSize bytes and removes the extra parts left by a previous run, the
+// policy applying to every part. It returns the paths of the parts.
+func writeOutputParts(out io.Writer, combinedFileName, content string, maxSize int64, policy IfExistsPolicy) ([]string, error) {
+	var paths []string
+	for i, part := range splitOutputParts(content, maxSize) {
+		path := outputPartPath(combinedFileName, i+1)
+		if err := writeCombinedOutput(out, path, part, policy); err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+
+	if err := removeStaleOutputParts(out, combinedFileName, len(paths), policy); err != nil {
+		return nil, err
+	}
+	return paths, nil
+}
+
+// partPattern matches the suffix of a part of the combined output.
+var partPattern = regexp.MustCompile(`\.combined_results\.part(\d+)\.txt$`)
+
+// outputPartNumber returns the number of the part of the combined output at
+// path, or 0 when it is not one of its parts.
+func outputPartNumber(combinedFileName, path string) int {
+	m := partPattern.FindStringSubmatch(path)
+	if m == nil || strings.TrimSuffix(path, m[0]) != strings.TrimSuffix(combinedFileName, ".combined_results.txt") {
+		return 0
+	}
+	n, _ := strconv.Atoi(m[1])
+	return n
+}
+
+// existingOutputParts returns the parts of the combined output beyond the
+// first one left by a previous run.
+func existingOutputParts(combinedFileName string) ([]string, error) {
+	base := strings.TrimSuffix(combinedFileName, ".combined_results.txt")
+	matches, err := filepath.Glob(escapeGlob(base) + ".combined_results.part*.txt")
+	if err != nil {
+		return nil, err
+	}
+
+	var parts []string
+	for _, path := range matches {
+		if outputPartNumber(combinedFileName, path) > 1 {
+			parts = append(parts, path)
+		}
+	}
+	return parts, nil
+}
+
+// removeStaleOutputParts removes the parts of the combined output beyond the
+// given count, written by a previous run with more output, or backs them up
+// when required by the policy.
+func removeStaleOutputParts(out io.Writer, combinedFileName string, count int, policy IfExistsPolicy) error {
+	parts, err := existingOutputParts(combinedFileName)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range parts {
+		if outputPartNumber(combinedFileName, path) <= count {
+			continue
+		}
+		if policy == IfExistsBackup {
+			backupPath := path + ".bak"
+			if err := os.Rename(path, backupPath); err != nil {
+				return fmt.Errorf("failed to back up stale output part: %w", err)
+			}
+			fmt.Fprintf(out, "Backed up stale output part to %s\n", backupPath)
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove stale output part: %w", err)
+		}
+	}
+	return nil
+}
+
+// escapeGlob escapes the metacharacters of a path used in a glob pattern.
+func escapeGlob(path string) string {
+	return strings.NewReplacer(`*`, `\*`, `?`, `\?`, `[`, `\[`).Replace(path)
+}
+
+// recordOutputParts records the parts of the combined output in the manifest
+// of the cache directory.
+func recordOutputParts(chunkDir string, paths []string, perm os.FileMode) error {
+	meta, err := loadCacheMeta(chunkDir)
+	if err != nil || meta == nil {
+		return err
+	}
+
+	meta.OutputParts = nil
+	for _, path := range paths {
+		meta.OutputParts = append(meta.OutputParts, filepath.Base(path))
+	}
+	return saveCacheMeta(chunkDir, *meta, perm)
+}
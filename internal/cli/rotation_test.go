@@ -0,0 +1,196 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"100", 100},
+		{"100B", 100},
+		{"2KB", 2048},
+		{"50mb", 50 << 20},
+		{"1 GB", 1 << 30},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.input)
+		if err != nil || got != tt.expected {
+			t.Errorf("ParseSize(%q) = %d, %v, expected %d", tt.input, got, err, tt.expected)
+		}
+	}
+
+	for _, input := range []string{"", "MB", "-1", "1.5MB", "10TB"} {
+		if _, err := ParseSize(input); err == nil {
+			t.Errorf("Expected an error for %q", input)
+		}
+	}
+}
+
+func TestSplitOutputParts(t *testing.T) {
+	content := strings.Repeat("123456789\n", 10)
+
+	// 2 lines of 10 bytes fit in 25 bytes, not 3
+	parts := splitOutputParts(content, 25)
+	if len(parts) != 5 {
+		t.Fatalf("Expected 5 parts, got %d: %q", len(parts), parts)
+	}
+	for i, part := range parts {
+		if len(part) != 20 {
+			t.Errorf("Part %d has %d bytes, expected 20", i+1, len(part))
+		}
+	}
+
+	// A part may reach the threshold exactly
+	if parts := splitOutputParts(content, 30); len(parts) != 4 || len(parts[0]) != 30 || len(parts[3]) != 10 {
+		t.Errorf("Expected parts of 30 bytes, got %q", parts)
+	}
+
+	// A line longer than the limit is a part on its own
+	parts = splitOutputParts("short\n"+strings.Repeat("x", 50)+"\nshort\n", 20)
+	if expected := []string{"short\n", strings.Repeat("x", 50) + "\n", "short\n"}; !reflect.DeepEqual(parts, expected) {
+		t.Errorf("Expected %q, got %q", expected, parts)
+	}
+
+	if parts := splitOutputParts("", 20); len(parts) != 1 || parts[0] != "" {
+		t.Errorf("Expected a single empty part, got %q", parts)
+	}
+}
+
+func TestProcessWithClient_MaxOutputFileSize(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "rotate_test.txt")
+	if err := os.WriteFile(testFile, []byte(strings.Repeat("word ", 3000)), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.Log = &bytes.Buffer{}
+	opts.MaxOutputFileSize = 25
+
+	// Each chunk outputs two lines of 10 bytes
+	mock := &mockChatGenerator{
+		responseFunc: func(callCount int) string {
+			return fmt.Sprintf("result %02d\nresult %02d\n", callCount, callCount)
+		},
+	}
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+
+	var names []string
+	var combined strings.Builder
+	for i := 1; i <= mock.callCount; i++ {
+		path := outputPartPath(filepath.Join(tmpDir, "rotate_test.combined_results.txt"), i)
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Expected part %d: %v", i, err)
+		}
+		if len(content) != 20 {
+			t.Errorf("Part %d has %d bytes, expected the 2 lines of a chunk below the limit", i, len(content))
+		}
+		combined.Write(content)
+		names = append(names, filepath.Base(path))
+	}
+	if names[1] != "rotate_test.combined_results.part2.txt" {
+		t.Errorf("Expected the second part to be named after the combined output, got %s", names[1])
+	}
+	if strings.Count(combined.String(), "\n") != 2*mock.callCount {
+		t.Errorf("Expected the parts to hold the whole output, got %q", combined.String())
+	}
+
+	meta, err := loadCacheMeta(filepath.Join(tmpDir, "rotate_test"))
+	if err != nil || meta == nil {
+		t.Fatalf("Expected a cache manifest, got %v, %v", meta, err)
+	}
+	if !reflect.DeepEqual(meta.OutputParts, names) {
+		t.Errorf("Expected the parts %v in the manifest, got %v", names, meta.OutputParts)
+	}
+
+	// Without rotation, the parts of the previous run are removed
+	opts.MaxOutputFileSize = 0
+	if err := ProcessWithClientOptions(context.Background(), &mockChatGenerator{}, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, names[1])); !os.IsNotExist(err) {
+		t.Errorf("Expected the stale part to be removed, got %v", err)
+	}
+}
+
+func TestProcessWithClient_MaxOutputFileSizeIfExists(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "rotate_backup_test.txt")
+	if err := os.WriteFile(testFile, []byte(strings.Repeat("word ", 3000)), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	combinedFile := filepath.Join(tmpDir, "rotate_backup_test.combined_results.txt")
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.Log = &bytes.Buffer{}
+	opts.MaxOutputFileSize = 25
+
+	mock := &mockChatGenerator{
+		responseFunc: func(callCount int) string {
+			return fmt.Sprintf("result %02d\nresult %02d\n", callCount, callCount)
+		},
+	}
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	if mock.callCount != 3 {
+		t.Fatalf("Expected 3 chunks, got %d", mock.callCount)
+	}
+	previous := make([][]byte, mock.callCount)
+	for i := range previous {
+		b, err := os.ReadFile(outputPartPath(combinedFile, i+1))
+		if err != nil {
+			t.Fatalf("Expected part %d: %v", i+1, err)
+		}
+		previous[i] = b
+	}
+
+	// Every part of the previous run is backed up, the stale ones included
+	opts.IfExists = IfExistsBackup
+	opts.MaxOutputFileSize = 40
+	opts.CacheLabel = "rerun"
+	if err := ProcessWithClientOptions(context.Background(), &mockChatGenerator{}, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+	for i, content := range previous {
+		backup, err := os.ReadFile(outputPartPath(combinedFile, i+1) + ".bak")
+		if err != nil {
+			t.Fatalf("Expected a backup of part %d: %v", i+1, err)
+		}
+		if !bytes.Equal(backup, content) {
+			t.Errorf("Expected the backup of part %d to hold %q, got %q", i+1, content, backup)
+		}
+	}
+	if _, err := os.Stat(outputPartPath(combinedFile, 3)); !os.IsNotExist(err) {
+		t.Errorf("Expected the stale part 3 to be moved away, got %v", err)
+	}
+
+	// A part left by a previous run is an existing output too
+	if err := os.Remove(combinedFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(outputPartPath(combinedFile, 2), previous[1], 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts.IfExists = IfExistsError
+	err := ProcessWithClientOptions(context.Background(), &mockChatGenerator{}, "test prompt", testFile, opts)
+	if !errors.Is(err, ErrOutputExists) {
+		t.Errorf("Expected the existing part to fail the run, got %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/shared"
+)
+
+// runningContextPrompt asks the model to fold a chunk into the summary of the
+// chunks before it.
+const runningContextPrompt = `You maintain a compact running summary of a document processed one chunk at a time.
+Update the current summary with the new chunk, keeping the names, definitions, conventions and facts that the processing of the next chunks may need.
+Respond with the updated summary only, in at most 200 words.`
+
+// runningContextSuffix introduces the running summary in the prompt of a chunk.
+const runningContextSuffix = "\n\nContext from the previous chunks of the document:\n%s"
+
+// withRunningContext returns the prompt of the next chunk, with the summary
+// of the chunks processed so far.
+func (p *processor) withRunningContext(prompt string) string {
+	if p.runningContext == "" {
+		return prompt
+	}
+	return prompt + fmt.Sprintf(runningContextSuffix, p.runningContext)
+}
+
+// updateRunningContext folds a chunk into the running summary and returns the
+// usage of the update. The summary after each chunk is cached as its context
+// entry, e.g. context{N}.txt, so that a resumed run continues with the same
+// context.
+func (p *processor) updateRunningContext(ctx context.Context, i int, chunk string) (Usage, error) {
+	if b, err := p.store.Read("context", i); err == nil {
+		p.runningContext = string(b)
+		return Usage{}, nil
+	}
+
+	res, err := p.generateWithFallback(ctx, openai.ChatCompletionNewParams{
+		Messages: []openai.ChatCompletionMessageParamUnion{
+			openai.SystemMessage(runningContextPrompt),
+			openai.UserMessage(fmt.Sprintf("Current summary:\n%s\n\nNew chunk:\n%s", p.runningContext, chunk)),
+		},
+		Model:       shared.ChatModel(p.opts.Model),
+		ServiceTier: p.serviceTier(),
+	})
+	if err != nil {
+		return Usage{}, fmt.Errorf("failed to update the running context after chunk %d: %w", p.opts.chunkNumber(i), err)
+	}
+	usage := responseUsage(p.opts.Model, res)
+	if len(res.Choices) == 0 {
+		return usage, withCategory(ErrAPI, fmt.Errorf("no content in response for the running context after chunk %d", p.opts.chunkNumber(i)))
+	}
+
+	p.runningContext = strings.TrimSpace(res.Choices[0].Message.Content)
+	if !p.opts.CacheReadOnly {
+		if err := p.store.Write("context", i, []byte(p.runningContext)); err != nil {
+			return usage, fmt.Errorf("failed to write the running context after chunk %d: %w", p.opts.chunkNumber(i), err)
+		}
+		fmt.Fprintf(p.out, "Chunk %d: Running context updated -> %s\n", p.opts.chunkNumber(i), p.store.Path("context", i))
+	}
+
+	return usage, nil
+}
@@ -0,0 +1,157 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/openai/openai-go"
+)
+
+func TestProcessWithClient_RunningContext(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "context_test.txt")
+	var lines []string
+	for i := 0; i < 600; i++ {
+		lines = append(lines, fmt.Sprintf("term%d means something", i))
+	}
+	text := strings.Join(lines, "\n")
+	if err := os.WriteFile(testFile, []byte(text), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.ChunkSize = 500
+	opts.RunningContext = true
+
+	chunks, err := splitChunks(text, opts)
+	if err != nil {
+		t.Fatalf("splitChunks failed: %v", err)
+	}
+	if len(chunks) < 3 {
+		t.Fatalf("Expected at least 3 chunks, got %d", len(chunks))
+	}
+	firstTerm := func(chunk string) string {
+		term, _, _ := strings.Cut(strings.TrimSpace(chunk), " ")
+		return "[" + term + "]"
+	}
+
+	// The summary accumulates the first term of every chunk it was updated with
+	mock := &mockChatGenerator{
+		requestFunc: func(params openai.ChatCompletionNewParams) string {
+			if systemContent(params) != runningContextPrompt {
+				return "kept\n"
+			}
+			summary, chunk, _ := strings.Cut(strings.TrimPrefix(userContent(params), "Current summary:\n"), "\n\nNew chunk:\n")
+			return summary + firstTerm(chunk)
+		},
+	}
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	for k, chunk := range chunks {
+		var prompt string
+		found := false
+		for _, params := range mock.params {
+			if userContent(params) == chunk {
+				prompt, found = systemContent(params), true
+			}
+		}
+		if !found {
+			t.Fatalf("Chunk %d was not sent", k+1)
+		}
+
+		for j, other := range chunks {
+			if got := strings.Contains(prompt, firstTerm(other)); got != (j < k) {
+				t.Errorf("Chunk %d: expected the context of chunk %d to be present: %v, got prompt %q", k+1, j+1, j < k, prompt)
+			}
+		}
+	}
+
+	// A rerun continues with the cached context without any request
+	mock.params = nil
+	mock.callCount = 0
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+	if mock.callCount != 0 {
+		t.Errorf("Expected no request on rerun, got %d", mock.callCount)
+	}
+}
+
+func TestProcessWithClient_RunningContextInPackedCache(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "packed_context_test.txt")
+	var lines []string
+	for i := 0; i < 600; i++ {
+		lines = append(lines, fmt.Sprintf("term%d means something", i))
+	}
+	if err := os.WriteFile(testFile, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.ChunkSize = 500
+	opts.RunningContext = true
+	opts.PackedCache = true
+
+	if err := ProcessWithClientOptions(context.Background(), &mockChatGenerator{}, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	chunkDir := filepath.Join(tmpDir, "packed_context_test")
+	if _, err := os.Stat(filepath.Join(chunkDir, "context1.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected the running context in the archive only, got a file: %v", err)
+	}
+	store, err := openCacheStore(chunkDir, opts)
+	if err != nil {
+		t.Fatalf("openCacheStore failed: %v", err)
+	}
+	defer store.Close()
+	if !store.Has("context", 0) {
+		t.Error("Expected the running context after the first chunk in the archive")
+	}
+}
+
+func TestProcessWithClient_RunningContextChangesTheCache(t *testing.T) {
+	tmpDir := t.TempDir()
+	var lines []string
+	for i := 0; i < 600; i++ {
+		lines = append(lines, fmt.Sprintf("term%d means something", i))
+	}
+
+	// The results computed with or without the running context are not the
+	// same, in either direction
+	for _, first := range []bool{false, true} {
+		testFile := filepath.Join(tmpDir, fmt.Sprintf("toggle_context_%v.txt", first))
+		if err := os.WriteFile(testFile, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+
+		opts := DefaultOptions()
+		opts.RequireConfirmation = false
+		opts.ChunkSize = 500
+		opts.RunningContext = first
+		opts.Log = &bytes.Buffer{}
+		if err := ProcessWithClientOptions(context.Background(), &mockChatGenerator{}, "test prompt", testFile, opts); err != nil {
+			t.Fatalf("ProcessWithClientOptions failed: %v", err)
+		}
+
+		opts.RunningContext = !first
+		mock := &mockChatGenerator{}
+		err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts)
+		if err == nil || !strings.Contains(err.Error(), "--force") {
+			t.Errorf("Running context %v after %v: expected the cache to be refused, got %v", !first, first, err)
+		}
+		if mock.callCount != 0 {
+			t.Errorf("Running context %v after %v: expected no API call, got %d", !first, first, mock.callCount)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/tiktoken-go/tokenizer"
+)
+
+// Schedule is the order in which the chunks are sent. The combined output
+// always follows the order of the input.
+type Schedule string
+
+// Schedules
+const (
+	// ScheduleInput sends the chunks in the order of the input.
+	ScheduleInput Schedule = "input"
+	// ScheduleLargestFirst sends the chunks with the most tokens first so
+	// that the run doesn't end waiting for a single large chunk.
+	ScheduleLargestFirst Schedule = "largest-first"
+)
+
+// ParseSchedule validates a schedule name.
+func ParseSchedule(s string) (Schedule, error) {
+	switch schedule := Schedule(s); schedule {
+	case ScheduleInput, ScheduleLargestFirst:
+		return schedule, nil
+	}
+	return "", invalidConfig(fmt.Errorf("unknown schedule %q (expected input or largest-first)", s))
+}
+
+// scheduleOrder returns the indexes of the chunks in the order they are sent.
+func scheduleOrder(chunks []string, schedule Schedule) ([]int, error) {
+	order := make([]int, len(chunks))
+	for i := range order {
+		order[i] = i
+	}
+	if schedule != ScheduleLargestFirst {
+		return order, nil
+	}
+
+	enc, err := tokenizer.Get(tokenizer.Cl100kBase)
+	if err != nil {
+		return nil, withCategory(ErrTokenizer, fmt.Errorf("failed to get tokenizer: %w", err))
+	}
+	tokens := make([]int, len(chunks))
+	for i, chunk := range chunks {
+		tokens[i] = countTokens(enc, chunk)
+	}
+
+	// Chunks of the same size keep the order of the input
+	sort.SliceStable(order, func(a, b int) bool {
+		return tokens[order[a]] > tokens[order[b]]
+	})
+	return order, nil
+}
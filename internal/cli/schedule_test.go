@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/openai/openai-go"
+)
+
+func TestScheduleOrder(t *testing.T) {
+	chunks := []string{"small", strings.Repeat("large ", 50), "tiny", strings.Repeat("medium ", 10), "also"}
+
+	order, err := scheduleOrder(chunks, ScheduleInput)
+	if err != nil {
+		t.Fatalf("scheduleOrder failed: %v", err)
+	}
+	if !reflect.DeepEqual(order, []int{0, 1, 2, 3, 4}) {
+		t.Errorf("Expected the order of the input, got %v", order)
+	}
+
+	order, err = scheduleOrder(chunks, ScheduleLargestFirst)
+	if err != nil {
+		t.Fatalf("scheduleOrder failed: %v", err)
+	}
+	// The single-token chunks keep the order of the input
+	if !reflect.DeepEqual(order, []int{1, 3, 0, 2, 4}) {
+		t.Errorf("Expected the largest chunks first, got %v", order)
+	}
+
+	if _, err := ParseSchedule("smallest-first"); err == nil {
+		t.Error("Expected an error for an unknown schedule")
+	}
+}
+
+func TestProcessWithClient_ScheduleLargestFirst(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "schedule_test.txt")
+	var lines []string
+	for i := 0; i < 700; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	if err := os.WriteFile(testFile, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.ChunkSize = 1000
+	// The small tail is merged into the last chunk, making it the largest
+	opts.MinChunkSize = 900
+	opts.Concurrency = 1
+	opts.Schedule = ScheduleLargestFirst
+
+	var processed []int
+	opts.ProgressFunc = func(event ProgressEvent) {
+		if event.Status == ChunkRunning {
+			processed = append(processed, event.Chunk)
+		}
+	}
+
+	chunks, err := splitChunks(strings.Join(lines, "\n"), opts)
+	if err != nil {
+		t.Fatalf("splitChunks failed: %v", err)
+	}
+	if len(chunks) < 2 {
+		t.Fatalf("Expected at least 2 chunks, got %d", len(chunks))
+	}
+
+	mock := &mockChatGenerator{
+		requestFunc: func(params openai.ChatCompletionNewParams) string {
+			first, _, _ := strings.Cut(userContent(params), "\n")
+			return first + "\n"
+		},
+	}
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	if processed[0] != len(chunks)-1 {
+		t.Errorf("Expected the last chunk, the largest one, to be processed first, got order %v", processed)
+	}
+	expected, _ := scheduleOrder(chunks, ScheduleLargestFirst)
+	if !reflect.DeepEqual(processed, expected) {
+		t.Errorf("Expected the processing order %v, got %v", expected, processed)
+	}
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, "schedule_test.combined_results.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read combined results: %v", err)
+	}
+	var expectedOutput string
+	for _, chunk := range chunks {
+		first, _, _ := strings.Cut(chunk, "\n")
+		expectedOutput += first + "\n"
+	}
+	if string(content) != expectedOutput {
+		t.Errorf("Expected the output in the order of the input %q, got %q", expectedOutput, string(content))
+	}
+}
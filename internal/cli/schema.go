@@ -0,0 +1,156 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+)
+
+// LoadSchemaFromExample derives a JSON schema from the structure of an example JSON file.
+func LoadSchemaFromExample(path string) (map[string]any, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read output example: %w", err)
+	}
+
+	var example any
+	if err := json.Unmarshal(b, &example); err != nil {
+		return nil, fmt.Errorf("failed to parse output example: %w", err)
+	}
+
+	return inferSchema(example), nil
+}
+
+// inferSchema returns the JSON schema describing the shape of value. Every
+// property of an object is required and no other property is allowed, which is
+// what strict structured outputs expect.
+func inferSchema(value any) map[string]any {
+	switch v := value.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		properties := make(map[string]any, len(v))
+		for _, key := range keys {
+			properties[key] = inferSchema(v[key])
+		}
+
+		return map[string]any{
+			"type":                 "object",
+			"properties":           properties,
+			"required":             keys,
+			"additionalProperties": false,
+		}
+	case []any:
+		items := map[string]any{}
+		if len(v) > 0 {
+			items = inferSchema(v[0])
+		}
+		return map[string]any{"type": "array", "items": items}
+	case string:
+		return map[string]any{"type": "string"}
+	case float64:
+		if v == math.Trunc(v) {
+			return map[string]any{"type": "integer"}
+		}
+		return map[string]any{"type": "number"}
+	case bool:
+		return map[string]any{"type": "boolean"}
+	}
+	return map[string]any{"type": "null"}
+}
+
+// validateJSON checks that raw is a JSON document matching the schema.
+func validateJSON(raw string, schema map[string]any) error {
+	var value any
+	if err := json.Unmarshal([]byte(strings.TrimSpace(raw)), &value); err != nil {
+		return fmt.Errorf("output is not valid JSON: %w", err)
+	}
+	return validateValue(value, schema, "$")
+}
+
+// validateValue validates value against the subset of JSON schema produced by inferSchema.
+func validateValue(value any, schema map[string]any, path string) error {
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: expected an object", path)
+		}
+
+		properties, _ := schema["properties"].(map[string]any)
+		for _, key := range requiredKeys(schema) {
+			if _, ok := object[key]; !ok {
+				return fmt.Errorf("%s: missing property %q", path, key)
+			}
+		}
+
+		for key, propertyValue := range object {
+			propertySchema, ok := properties[key].(map[string]any)
+			if !ok {
+				if schema["additionalProperties"] == false {
+					return fmt.Errorf("%s: unexpected property %q", path, key)
+				}
+				continue
+			}
+			if err := validateValue(propertyValue, propertySchema, path+"."+key); err != nil {
+				return err
+			}
+		}
+	case "array":
+		array, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("%s: expected an array", path)
+		}
+
+		items, _ := schema["items"].(map[string]any)
+		for i, item := range array {
+			if err := validateValue(item, items, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("%s: expected a string", path)
+		}
+	case "integer":
+		if n, ok := value.(float64); !ok || n != math.Trunc(n) {
+			return fmt.Errorf("%s: expected an integer", path)
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("%s: expected a number", path)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: expected a boolean", path)
+		}
+	case "null":
+		if value != nil {
+			return fmt.Errorf("%s: expected null", path)
+		}
+	}
+	return nil
+}
+
+func requiredKeys(schema map[string]any) []string {
+	switch required := schema["required"].(type) {
+	case []string:
+		return required
+	case []any:
+		keys := make([]string, 0, len(required))
+		for _, key := range required {
+			if s, ok := key.(string); ok {
+				keys = append(keys, s)
+			}
+		}
+		return keys
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInferSchema(t *testing.T) {
+	schema := inferSchema(map[string]any{
+		"name":  "apple",
+		"price": 1.5,
+		"count": float64(3),
+		"tags":  []any{"fruit"},
+		"fresh": true,
+	})
+
+	if schema["type"] != "object" {
+		t.Fatalf("Expected an object schema, got %v", schema["type"])
+	}
+
+	expectedRequired := []string{"count", "fresh", "name", "price", "tags"}
+	if !reflect.DeepEqual(schema["required"], expectedRequired) {
+		t.Errorf("Expected required %v, got %v", expectedRequired, schema["required"])
+	}
+
+	properties := schema["properties"].(map[string]any)
+	expectedTypes := map[string]string{
+		"name":  "string",
+		"price": "number",
+		"count": "integer",
+		"tags":  "array",
+		"fresh": "boolean",
+	}
+	for key, expectedType := range expectedTypes {
+		if got := properties[key].(map[string]any)["type"]; got != expectedType {
+			t.Errorf("Expected %s to be %s, got %v", key, expectedType, got)
+		}
+	}
+}
+
+func TestValidateJSON(t *testing.T) {
+	schema := inferSchema(map[string]any{
+		"items": []any{map[string]any{"name": "apple"}},
+	})
+
+	if err := validateJSON(`{"items": [{"name": "pear"}, {"name": "plum"}]}`, schema); err != nil {
+		t.Errorf("Expected valid output, got: %v", err)
+	}
+
+	invalid := []string{
+		`not json`,
+		`{"items": [{"name": 3}]}`,
+		`{"items": [{"name": "pear", "color": "green"}]}`,
+		`{}`,
+		`[]`,
+	}
+	for _, raw := range invalid {
+		if err := validateJSON(raw, schema); err == nil {
+			t.Errorf("Expected %q to be rejected", raw)
+		}
+	}
+}
+
+func TestProcessWithClient_OutputExample(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "schema_test.txt")
+	if err := os.WriteFile(testFile, []byte("apple\npear\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	exampleFile := filepath.Join(tmpDir, "example.json")
+	if err := os.WriteFile(exampleFile, []byte(`{"fruits": ["banana"]}`), 0644); err != nil {
+		t.Fatalf("Failed to create example file: %v", err)
+	}
+
+	schema, err := LoadSchemaFromExample(exampleFile)
+	if err != nil {
+		t.Fatalf("LoadSchemaFromExample failed: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.OutputSchema = schema
+
+	mock := &mockChatGenerator{
+		responseFunc: func(callCount int) string {
+			return `{"fruits": ["apple", "pear"]}`
+		},
+	}
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	responseFormat := mock.params[0].ResponseFormat.OfJSONSchema
+	if responseFormat == nil {
+		t.Fatal("Expected a JSON schema response format in the request")
+	}
+	if !reflect.DeepEqual(responseFormat.JSONSchema.Schema, schema) {
+		t.Errorf("Expected the derived schema to be sent, got %v", responseFormat.JSONSchema.Schema)
+	}
+
+	// An output that doesn't follow the schema fails the run and is not cached.
+	invalidFile := filepath.Join(tmpDir, "invalid_test.txt")
+	if err := os.WriteFile(invalidFile, []byte("apple\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	invalidMock := &mockChatGenerator{
+		responseFunc: func(callCount int) string {
+			return `{"vegetables": ["carrot"]}`
+		},
+	}
+
+	err = ProcessWithClientOptions(context.Background(), invalidMock, "test prompt", invalidFile, opts)
+	if err == nil || !strings.Contains(err.Error(), "does not match the schema") {
+		t.Fatalf("Expected a schema validation error, got: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "invalid_test", "result1.txt")); !os.IsNotExist(err) {
+		t.Error("Expected the invalid output not to be cached")
+	}
+}
+
+func TestProcessWithClient_PromptSuffix(t *testing.T) {
+	schema := map[string]any{"type": "object"}
+
+	tests := []struct {
+		name     string
+		schema   map[string]any
+		mode     PromptSuffixMode
+		expected bool
+	}{
+		{name: "text", mode: PromptSuffixAuto, expected: true},
+		{name: "json schema", schema: schema, mode: PromptSuffixAuto, expected: false},
+		{name: "json schema forced", schema: schema, mode: PromptSuffixAlways, expected: true},
+		{name: "text disabled", mode: PromptSuffixNever, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			testFile := filepath.Join(tmpDir, "suffix_test.txt")
+			if err := os.WriteFile(testFile, []byte("apple\npear\n"), 0644); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+
+			opts := DefaultOptions()
+			opts.RequireConfirmation = false
+			opts.OutputSchema = tt.schema
+			opts.PromptSuffix = tt.mode
+
+			mock := &mockChatGenerator{
+				responseFunc: func(callCount int) string { return `{}` },
+			}
+			if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+				t.Fatalf("ProcessWithClientOptions failed: %v", err)
+			}
+
+			prompt := systemContent(mock.params[0])
+			if got := strings.Contains(prompt, keepLinesSuffix); got != tt.expected {
+				t.Errorf("Expected the suffix to be present: %v, got prompt %q", tt.expected, prompt)
+			}
+		})
+	}
+
+	if _, err := ParsePromptSuffixMode("sometimes"); err == nil {
+		t.Error("Expected an error for an unknown mode")
+	}
+}
@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// scoredPromptSuffix asks the model to rate the relevance of the chunk in addition to the kept lines.
+const scoredPromptSuffix = "\nAnswer with a JSON object of the form {\"score\": <relevance of the chunk between 0 and 1>, \"content\": \"<the lines that you want to keep>\"}."
+
+// scoredOutput is the structured answer expected from the model in scored mode.
+type scoredOutput struct {
+	Score   *float64 `json:"score"`
+	Content string   `json:"content"`
+}
+
+// parseScoredOutput extracts the score and the content from a scored answer.
+func parseScoredOutput(raw string) (float64, string, error) {
+	var out scoredOutput
+	if err := json.Unmarshal([]byte(strings.TrimSpace(raw)), &out); err != nil {
+		return 0, "", fmt.Errorf("failed to parse scored output: %w", err)
+	}
+	if out.Score == nil {
+		return 0, "", fmt.Errorf("failed to parse scored output: missing score")
+	}
+	return *out.Score, out.Content, nil
+}
+
+// filterByScore drops the results scored below minScore and, if requested,
+// orders the remaining ones by decreasing score.
+func filterByScore(results []chunkResult, minScore float64, sortByScore bool) []chunkResult {
+	var kept []chunkResult
+	for _, result := range results {
+		if result.Score >= minScore {
+			kept = append(kept, result)
+		}
+	}
+
+	if sortByScore {
+		sort.SliceStable(kept, func(i, j int) bool {
+			return kept[i].Score > kept[j].Score
+		})
+	}
+
+	return kept
+}
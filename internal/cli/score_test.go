@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseScoredOutput(t *testing.T) {
+	score, content, err := parseScoredOutput(`{"score": 0.75, "content": "kept line"}`)
+	if err != nil {
+		t.Fatalf("parseScoredOutput failed: %v", err)
+	}
+	if score != 0.75 || content != "kept line" {
+		t.Errorf("Unexpected parsed output: score=%f content=%q", score, content)
+	}
+
+	if _, _, err := parseScoredOutput(`{"content": "no score"}`); err == nil {
+		t.Error("Expected an error when the score is missing")
+	}
+
+	if _, _, err := parseScoredOutput("not json"); err == nil {
+		t.Error("Expected an error for non JSON output")
+	}
+}
+
+func TestFilterByScore(t *testing.T) {
+	results := []chunkResult{
+		{Content: "a", Score: 0.2},
+		{Content: "b", Score: 0.9},
+		{Content: "c", Score: 0.5},
+	}
+
+	kept := filterByScore(results, 0.5, false)
+	if len(kept) != 2 || kept[0].Content != "b" || kept[1].Content != "c" {
+		t.Errorf("Expected [b c] in input order, got %+v", kept)
+	}
+
+	kept = filterByScore(results, 0, true)
+	if len(kept) != 3 || kept[0].Content != "b" || kept[1].Content != "c" || kept[2].Content != "a" {
+		t.Errorf("Expected [b c a] sorted by score, got %+v", kept)
+	}
+}
+
+func TestProcessWithClient_ScoredThreshold(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "scored_test.txt")
+	testContent := strings.Repeat("word ", 3000)
+	if err := os.WriteFile(testFile, []byte(testContent), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	chunks, err := splitIntoTokenChunks(testContent, 2000)
+	if err != nil {
+		t.Fatalf("splitIntoTokenChunks failed: %v", err)
+	}
+	if len(chunks) < 2 {
+		t.Fatalf("Expected at least 2 chunks, got %d", len(chunks))
+	}
+
+	// Seed the cache with scored outputs so that each chunk gets a known score.
+	chunkDir := filepath.Join(tmpDir, "scored_test")
+	if err := os.MkdirAll(chunkDir, 0755); err != nil {
+		t.Fatalf("Failed to create chunk directory: %v", err)
+	}
+	var expected strings.Builder
+	for i := range chunks {
+		output := fmt.Sprintf(`{"score": 0.9, "content": "relevant %d\n"}`, i+1)
+		if i == 0 {
+			output = `{"score": 0.2, "content": "irrelevant\n"}`
+		} else {
+			fmt.Fprintf(&expected, "relevant %d\n", i+1)
+		}
+
+		resultFile := filepath.Join(chunkDir, fmt.Sprintf("result%d.txt", i+1))
+		if err := os.WriteFile(resultFile, []byte(output), 0644); err != nil {
+			t.Fatalf("Failed to seed result: %v", err)
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.Scored = true
+	opts.MinScore = 0.5
+
+	mock := &mockChatGenerator{}
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, "scored_test.combined_results.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read combined results: %v", err)
+	}
+
+	if string(content) != expected.String() {
+		t.Errorf("Expected only the relevant chunks %q, got: %q", expected.String(), string(content))
+	}
+}
@@ -0,0 +1,177 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/tiktoken-go/tokenizer"
+)
+
+// SplitStrategy is the unit the input is split on.
+type SplitStrategy string
+
+// Split strategies
+const (
+	// SplitLines cuts the chunks between lines.
+	SplitLines SplitStrategy = "lines"
+	// SplitSentences cuts the chunks between sentences, for prose whose line
+	// breaks don't follow the sentences, e.g. single-paragraph documents.
+	SplitSentences SplitStrategy = "sentences"
+)
+
+// ParseSplitStrategy validates a split strategy name.
+func ParseSplitStrategy(s string) (SplitStrategy, error) {
+	switch strategy := SplitStrategy(s); strategy {
+	case SplitLines, SplitSentences:
+		return strategy, nil
+	}
+	return "", invalidConfig(fmt.Errorf("unknown split strategy %q (expected lines or sentences)", s))
+}
+
+// abbreviations are the words followed by a period that don't end a sentence
+// even before a capitalized word, compared in lower case.
+var abbreviations = map[string]bool{
+	"mr": true, "mrs": true, "ms": true, "dr": true, "prof": true, "sr": true, "jr": true, "st": true,
+	"mt": true, "gen": true, "col": true, "capt": true, "lt": true, "sgt": true, "rev": true, "hon": true,
+	"inc": true, "ltd": true, "co": true, "corp": true, "dept": true, "univ": true,
+	"vs": true, "e.g": true, "i.e": true, "cf": true, "al": true, "approx": true, "no": true,
+	"fig": true, "vol": true, "p": true, "pp": true, "ch": true, "sec": true,
+	"jan": true, "feb": true, "mar": true, "apr": true, "jun": true, "jul": true, "aug": true,
+	"sep": true, "sept": true, "oct": true, "nov": true, "dec": true,
+	"u.s": true, "u.k": true,
+}
+
+// splitSentences splits the text into sentences whose concatenation is the
+// text, each sentence keeping the whitespace that follows it. A sentence ends
+// at a blank line or at a terminal punctuation, possibly followed by closing
+// quotes or brackets, then whitespace and a word that can start a sentence.
+// The periods of abbreviations and initials don't end sentences.
+func splitSentences(text string) []string {
+	var sentences []string
+	start := 0
+
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		end := i + size
+
+		switch {
+		case r == '\n' && strings.HasPrefix(text[end:], "\n"):
+			// A blank line ends the sentence, whatever its punctuation
+		case r == '.' || r == '!' || r == '?' || r == '…':
+			for end < len(text) {
+				c, n := utf8.DecodeRuneInString(text[end:])
+				if !strings.ContainsRune(`.!?…"'”’)]»`, c) {
+					break
+				}
+				end += n
+			}
+			if !endsSentence(text, start, i, r, end) {
+				i = end
+				continue
+			}
+		default:
+			i = end
+			continue
+		}
+
+		// The whitespace after the sentence belongs to it
+		for end < len(text) {
+			c, n := utf8.DecodeRuneInString(text[end:])
+			if !unicode.IsSpace(c) {
+				break
+			}
+			end += n
+		}
+		sentences = append(sentences, text[start:end])
+		start, i = end, end
+	}
+
+	if start < len(text) {
+		sentences = append(sentences, text[start:])
+	}
+	return sentences
+}
+
+// endsSentence tells whether the punctuation r at i, whose trailing closing
+// marks end at end, ends the sentence started at start.
+func endsSentence(text string, start, i int, r rune, end int) bool {
+	next := strings.TrimLeftFunc(text[end:], unicode.IsSpace)
+	if next == "" {
+		return true
+	}
+	// A sentence is followed by whitespace
+	if len(next) == len(text[end:]) {
+		return false
+	}
+	// and by a word that can start a sentence
+	c, _ := utf8.DecodeRuneInString(next)
+	if !unicode.IsUpper(c) && !unicode.IsDigit(c) && !strings.ContainsRune(`"'“‘([«¿¡`, c) {
+		return false
+	}
+
+	if r != '.' || end != i+1 {
+		return true
+	}
+	fields := strings.Fields(text[start:i])
+	if len(fields) == 0 {
+		return true
+	}
+	word := strings.TrimLeft(fields[len(fields)-1], `"'“‘([«`)
+	// Initials such as J. Smith
+	if utf8.RuneCountInString(word) == 1 && unicode.IsUpper([]rune(word)[0]) {
+		return false
+	}
+	return !abbreviations[strings.ToLower(word)]
+}
+
+// splitIntoSentenceChunks splits the text in chunks of at most
+// maxTokensPerChunk tokens cut between sentences. A sentence longer than a
+// chunk is cut between words. The concatenation of the chunks is the text.
+func splitIntoSentenceChunks(text string, maxTokensPerChunk int) ([]string, error) {
+	enc, err := tokenizer.Get(tokenizer.Cl100kBase)
+	if err != nil {
+		return nil, withCategory(ErrTokenizer, fmt.Errorf("failed to get tokenizer: %w", err))
+	}
+
+	var chunks []string
+	var currentChunk strings.Builder
+	currentTokens := 0
+
+	appendSegment := func(segment string, segmentTokens int) {
+		if currentTokens+segmentTokens > maxTokensPerChunk && currentChunk.Len() > 0 {
+			chunks = append(chunks, currentChunk.String())
+			currentChunk.Reset()
+			currentTokens = 0
+		}
+		currentChunk.WriteString(segment)
+		currentTokens += segmentTokens
+	}
+
+	for _, sentence := range splitSentences(text) {
+		sentenceTokenCount := countTokens(enc, sentence)
+		if sentenceTokenCount <= maxTokensPerChunk {
+			appendSegment(sentence, sentenceTokenCount)
+			continue
+		}
+
+		for _, word := range splitAfterSpaces(sentence) {
+			wordTokenCount := countTokens(enc, word)
+			if wordTokenCount <= maxTokensPerChunk {
+				appendSegment(word, wordTokenCount)
+				continue
+			}
+
+			for _, piece := range splitWordByTokens(enc, word, maxTokensPerChunk) {
+				appendSegment(piece, countTokens(enc, piece))
+			}
+		}
+	}
+
+	if currentChunk.Len() > 0 {
+		chunks = append(chunks, currentChunk.String())
+	}
+
+	return chunks, nil
+}
@@ -0,0 +1,147 @@
+package cli
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tiktoken-go/tokenizer"
+)
+
+func TestSplitSentences(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected []string
+	}{
+		{
+			name:     "terminal punctuation",
+			text:     "It rained. Did it stop? Yes! Then",
+			expected: []string{"It rained. ", "Did it stop? ", "Yes! ", "Then"},
+		},
+		{
+			name:     "abbreviations and initials",
+			text:     "Dr. Smith met J. R. Doe at 5 p.m. on Jan. 3, e.g. near St. Paul. They talked.",
+			expected: []string{"Dr. Smith met J. R. Doe at 5 p.m. on Jan. 3, e.g. near St. Paul. ", "They talked."},
+		},
+		{
+			name:     "closing quotes",
+			text:     `He said "stop." She left. (It was late.) Done`,
+			expected: []string{`He said "stop." `, "She left. ", "(It was late.) ", "Done"},
+		},
+		{
+			name:     "no space after the period",
+			text:     "Version 3.5 is out.Really. Yes",
+			expected: []string{"Version 3.5 is out.Really. ", "Yes"},
+		},
+		{
+			name:     "blank line",
+			text:     "A title\n\nThe body. ",
+			expected: []string{"A title\n\n", "The body. "},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitSentences(tt.text)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+			if strings.Join(got, "") != tt.text {
+				t.Errorf("Expected the sentences to cover the text, got %q", got)
+			}
+		})
+	}
+}
+
+func TestSplitChunks_Sentences(t *testing.T) {
+	// A single line made of many sentences, some with abbreviations
+	var sentences []string
+	for i := 0; i < 40; i++ {
+		switch i % 3 {
+		case 0:
+			sentences = append(sentences, "Dr. Jones reviewed the quarterly figures with the team.")
+		case 1:
+			sentences = append(sentences, "Several items, e.g. the travel costs, were over budget!")
+		default:
+			sentences = append(sentences, "Was the forecast for Q3 still realistic?")
+		}
+	}
+	text := strings.Join(sentences, " ")
+
+	opts := DefaultOptions()
+	opts.ChunkSize = 60
+	opts.SplitStrategy = SplitSentences
+	opts.VerifyChunks = true
+
+	chunks, err := splitChunks(text, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) < 2 {
+		t.Fatalf("Expected several chunks, got %d", len(chunks))
+	}
+
+	enc, err := tokenizer.Get(tokenizer.Cl100kBase)
+	if err != nil {
+		t.Fatalf("Failed to get tokenizer: %v", err)
+	}
+
+	// Each chunk is a run of whole sentences
+	next := 0
+	for i, chunk := range chunks {
+		var run []string
+		for next < len(sentences) && len(strings.Join(append(run, sentences[next]), " ")) <= len(chunk) {
+			run = append(run, sentences[next])
+			next++
+		}
+		if strings.Join(run, " ") != chunk {
+			t.Fatalf("Chunk %d doesn't end between sentences: %q", i+1, chunk)
+		}
+		if tokens := countTokens(enc, chunk); tokens > opts.ChunkSize {
+			t.Errorf("Chunk %d has %d tokens, more than %d", i+1, tokens, opts.ChunkSize)
+		}
+	}
+	if next != len(sentences) {
+		t.Errorf("Expected the chunks to cover the %d sentences, got %d", len(sentences), next)
+	}
+
+	// Preserving the structure, the chunks are an exact partition
+	opts.PreserveInputStructure = true
+	chunks, err = splitChunks(text, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(chunks, "") != text {
+		t.Error("Expected the chunks to be an exact partition of the input")
+	}
+}
+
+func TestSplitChunks_SentencesLongerThanAChunk(t *testing.T) {
+	text := strings.Repeat("word ", 200) + "end. Short sentence."
+
+	opts := DefaultOptions()
+	opts.ChunkSize = 50
+	opts.SplitStrategy = SplitSentences
+	opts.VerifyChunks = true
+
+	chunks, err := splitChunks(text, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) < 5 {
+		t.Errorf("Expected the long sentence to be cut between words, got %d chunks", len(chunks))
+	}
+	if last := chunks[len(chunks)-1]; !strings.HasSuffix(last, "end. Short sentence.") {
+		t.Errorf("Expected the short sentence to be kept whole, got %q", last)
+	}
+}
+
+func TestSplitChunks_SentencesRejectsDelimiters(t *testing.T) {
+	opts := DefaultOptions()
+	opts.SplitStrategy = SplitSentences
+	opts.RecordDelimiter = "\x1e"
+	if _, err := splitChunks("A sentence.", opts); err == nil {
+		t.Error("Expected an error with a record delimiter")
+	}
+}
@@ -0,0 +1,40 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// sideBySideFilePath returns the path of the side-by-side output next to the
+// combined output.
+func sideBySideFilePath(combinedFileName string) string {
+	return strings.TrimSuffix(combinedFileName, ".combined_results.txt") + ".side_by_side.txt"
+}
+
+// formatSideBySide puts the input of each chunk next to its result so that
+// the decisions of the model can be reviewed, the chunks being numbered from
+// first.
+func formatSideBySide(chunks []string, results []chunkResult, first int) string {
+	var sb strings.Builder
+	for _, result := range results {
+		fmt.Fprintf(&sb, "=== Chunk %d input ===\n%s", first+result.Index, chunks[result.Index])
+		if !strings.HasSuffix(chunks[result.Index], "\n") {
+			sb.WriteString("\n")
+		}
+		fmt.Fprintf(&sb, "=== Chunk %d result ===\n%s", first+result.Index, result.Content)
+		if !strings.HasSuffix(result.Content, "\n") {
+			sb.WriteString("\n")
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// writeSideBySide writes the side-by-side output of the chunks.
+func writeSideBySide(path string, chunks []string, results []chunkResult, first int) error {
+	if err := os.WriteFile(path, []byte(formatSideBySide(chunks, results, first)), 0644); err != nil {
+		return fmt.Errorf("failed to write side-by-side output: %w", err)
+	}
+	return nil
+}
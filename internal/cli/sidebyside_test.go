@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/openai/openai-go"
+)
+
+func TestProcessWithClient_SideBySide(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "side_test.txt")
+	var lines []string
+	for i := 0; i < 600; i++ {
+		lines = append(lines, fmt.Sprintf("review %d", i))
+	}
+	text := strings.Join(lines, "\n")
+	if err := os.WriteFile(testFile, []byte(text), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.ChunkSize = 1000
+	opts.SideBySide = true
+
+	chunks, err := splitChunks(text, opts)
+	if err != nil {
+		t.Fatalf("splitChunks failed: %v", err)
+	}
+	if len(chunks) < 2 {
+		t.Fatalf("Expected at least 2 chunks, got %d", len(chunks))
+	}
+
+	mock := &mockChatGenerator{
+		requestFunc: func(params openai.ChatCompletionNewParams) string {
+			first, _, _ := strings.Cut(userContent(params), "\n")
+			return "kept " + first + "\n"
+		},
+	}
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, "side_test.side_by_side.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read side-by-side output: %v", err)
+	}
+	for i, chunk := range chunks {
+		first, _, _ := strings.Cut(chunk, "\n")
+		expected := fmt.Sprintf("=== Chunk %d input ===\n%s", i+1, chunk)
+		if !strings.Contains(string(content), expected) {
+			t.Errorf("Expected the input of chunk %d in the side-by-side output", i+1)
+		}
+		expected = fmt.Sprintf("=== Chunk %d result ===\nkept %s\n", i+1, first)
+		if !strings.Contains(string(content), expected) {
+			t.Errorf("Expected %q in the side-by-side output", expected)
+		}
+	}
+
+	// The combined output is unchanged
+	combined, err := os.ReadFile(filepath.Join(tmpDir, "side_test.combined_results.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read combined results: %v", err)
+	}
+	if strings.Contains(string(combined), "===") {
+		t.Errorf("Expected the combined output to only contain the results, got %q", string(combined))
+	}
+}
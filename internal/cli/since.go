@@ -0,0 +1,208 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// sinceCacheLabel nests the cache of the input appended after an offset, whose
+// chunks are not the ones of the whole file.
+func sinceCacheLabel(label string, offset int64) string {
+	if label == "" {
+		return fmt.Sprintf("since-%d", offset)
+	}
+	return fmt.Sprintf("%s-since-%d", label, offset)
+}
+
+// pruneSinceCaches removes the caches of the input appended after other
+// offsets than the processed one, left by the previous runs: the marker moved
+// past them so that no run reads them again.
+func pruneSinceCaches(out io.Writer, filePath, label string, offset int64) error {
+	chunkDir, err := chunkDirPath(filePath, "")
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(chunkDir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to list the caches: %w", err)
+	}
+
+	prefix := strings.TrimSuffix(sinceCacheLabel(label, 0), "0")
+	for _, entry := range entries {
+		rest, ok := strings.CutPrefix(entry.Name(), prefix)
+		if !ok || !entry.IsDir() {
+			continue
+		}
+		previous, err := strconv.ParseInt(rest, 10, 64)
+		if err != nil || previous == offset {
+			continue
+		}
+		stale := filepath.Join(chunkDir, entry.Name())
+		if err := os.RemoveAll(stale); err != nil {
+			return fmt.Errorf("failed to remove the stale cache: %w", err)
+		}
+		fmt.Fprintf(out, "Removed the cache of the input appended since byte %d: %s/\n", previous, stale)
+	}
+	return nil
+}
+
+// resolveSinceOffset returns the byte offset from which the file is
+// processed: the one recorded in the marker or the manifest if any, the
+// configured one otherwise. A file shorter than the offset was truncated or
+// rotated and is processed from the start, the cache of the previous start
+// being stale.
+func resolveSinceOffset(out io.Writer, filePath string, opts Options) (int64, error) {
+	offset := opts.SinceOffset
+	if opts.SinceLast {
+		meta, err := loadSinceLastMeta(filePath, opts.CacheLabel)
+		if err != nil {
+			return 0, err
+		}
+		offset = meta.ProcessedOffset
+	}
+	if opts.SinceMarker != "" {
+		recorded, ok, err := readSinceMarker(opts.SinceMarker)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			offset = recorded
+		}
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return 0, withCategory(ErrInput, fmt.Errorf("failed to read file: %w", err))
+	}
+	if offset > info.Size() {
+		fmt.Fprintf(out, "Warning: %s is shorter than the offset %d, it was truncated or rotated: processing it from the start\n", filePath, offset)
+		chunkDir, err := chunkDirPath(filePath, sinceCacheLabel(opts.CacheLabel, 0))
+		if err != nil {
+			return 0, err
+		}
+		if err := os.RemoveAll(chunkDir); err != nil {
+			return 0, fmt.Errorf("failed to remove the stale cache: %w", err)
+		}
+		return 0, nil
+	}
+	return offset, nil
+}
+
+// readSinceMarker returns the offset recorded in the marker, if it exists.
+func readSinceMarker(path string) (int64, bool, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, false, nil
+		}
+		return 0, false, fmt.Errorf("failed to read the marker: %w", err)
+	}
+
+	offset, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil || offset < 0 {
+		return 0, false, withCategory(ErrInput, fmt.Errorf("invalid marker %s: %q is not a byte offset", path, strings.TrimSpace(string(b))))
+	}
+	return offset, true, nil
+}
+
+func writeSinceMarker(path string, offset int64, perm os.FileMode) error {
+	if err := writeFileAtomic(path, []byte(strconv.FormatInt(offset, 10)+"\n"), perm); err != nil {
+		return fmt.Errorf("failed to write the marker: %w", err)
+	}
+	return nil
+}
+
+// runComplete tells whether all the chunks of the last run of the cache
+// completed, a run stopped by the max runtime or a stop sentinel leaving
+// chunks to process.
+func runComplete(chunkDir string) (bool, error) {
+	state, err := loadCheckpoint(chunkDir)
+	if err != nil || state == nil {
+		return false, err
+	}
+	return len(state.Completed) == state.ChunkCount, nil
+}
+
+// advanceSinceMarker records the size of the processed input in the marker
+// once all its chunks completed, so that the next run starts after it.
+func advanceSinceMarker(out io.Writer, filePath string, size int64, opts Options) error {
+	chunkDir, err := chunkDirPath(filePath, opts.CacheLabel)
+	if err != nil {
+		return err
+	}
+	complete, err := runComplete(chunkDir)
+	if err != nil {
+		return err
+	}
+	if !complete {
+		fmt.Fprintf(out, "Marker %s not updated: some chunks were not processed\n", opts.SinceMarker)
+		return nil
+	}
+
+	if err := writeSinceMarker(opts.SinceMarker, size, opts.cacheFilePerm()); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Marker %s updated: the next run starts at byte %d\n", opts.SinceMarker, size)
+	return nil
+}
+
+// appendsOutput tells whether the results of the run are appended to the
+// combined output of the previous ones, i.e. it resumes from the last run
+// after the start of the file.
+func appendsOutput(opts Options) bool {
+	return opts.SinceLast && opts.SinceOffset > 0
+}
+
+// loadSinceLastMeta returns the manifest of the chunk directory of the whole
+// file, where the offset processed by the last complete run is recorded.
+func loadSinceLastMeta(filePath, label string) (cacheMeta, error) {
+	chunkDir, err := chunkDirPath(filePath, label)
+	if err != nil {
+		return cacheMeta{}, err
+	}
+	meta, err := loadCacheMeta(chunkDir)
+	if err != nil || meta == nil {
+		return cacheMeta{}, err
+	}
+	return *meta, nil
+}
+
+// advanceSinceLast records the size of the processed input in the manifest of
+// the chunk directory of the whole file once all its chunks completed, so
+// that the next run starts after it.
+func advanceSinceLast(out io.Writer, filePath, label string, size int64, opts Options) error {
+	runDir, err := chunkDirPath(filePath, opts.CacheLabel)
+	if err != nil {
+		return err
+	}
+	complete, err := runComplete(runDir)
+	if err != nil {
+		return err
+	}
+	if !complete {
+		fmt.Fprintln(out, "Processed offset not recorded: some chunks were not processed")
+		return nil
+	}
+
+	chunkDir, err := chunkDirPath(filePath, label)
+	if err != nil {
+		return err
+	}
+	meta, err := loadSinceLastMeta(filePath, label)
+	if err != nil {
+		return err
+	}
+	meta.ProcessedOffset = size
+	if err := saveCacheMeta(chunkDir, meta, opts.cacheFilePerm()); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Processed offset recorded in %s/: the next run starts at byte %d\n", chunkDir, size)
+	return nil
+}
@@ -0,0 +1,252 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openai/openai-go"
+)
+
+func TestProcessWithClient_SinceMarker(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "since_test.log")
+	marker := filepath.Join(tmpDir, "since_test.marker")
+	appendLines := func(from, to int) {
+		f, err := os.OpenFile(testFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatalf("Failed to open test file: %v", err)
+		}
+		defer f.Close()
+		for i := from; i < to; i++ {
+			fmt.Fprintf(f, "event %d\n", i)
+		}
+	}
+
+	var log bytes.Buffer
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.SinceMarker = marker
+	opts.IfExists = IfExistsOverwrite
+	opts.Log = &log
+
+	mock := &mockChatGenerator{
+		requestFunc: func(params openai.ChatCompletionNewParams) string {
+			return strings.ReplaceAll(userContent(params), "event", "seen")
+		},
+	}
+	run := func() string {
+		t.Helper()
+		mock.params = nil
+		if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+			t.Fatalf("ProcessWithClientOptions failed: %v", err)
+		}
+		var sent strings.Builder
+		for _, params := range mock.params {
+			sent.WriteString(userContent(params))
+		}
+		return sent.String()
+	}
+	combined := func() string {
+		t.Helper()
+		b, err := os.ReadFile(filepath.Join(tmpDir, "since_test.combined_results.txt"))
+		if err != nil {
+			t.Fatalf("Failed to read combined output: %v", err)
+		}
+		return string(b)
+	}
+
+	// Without a marker yet, the whole file is processed
+	appendLines(0, 5)
+	if sent := run(); !strings.Contains(sent, "event 0") || !strings.Contains(sent, "event 4") {
+		t.Errorf("Expected the whole file to be processed, got %q", sent)
+	}
+	info, err := os.Stat(testFile)
+	if err != nil {
+		t.Fatalf("Failed to stat test file: %v", err)
+	}
+	if recorded, ok, err := readSinceMarker(marker); err != nil || !ok || recorded != info.Size() {
+		t.Fatalf("Expected the marker at byte %d, got %d (%v, %v)", info.Size(), recorded, ok, err)
+	}
+
+	// Only the appended lines are processed and combined
+	appendLines(5, 8)
+	sent := run()
+	if sent != "event 5\nevent 6\nevent 7\n" {
+		t.Errorf("Expected only the appended lines to be processed, got %q", sent)
+	}
+	if got := combined(); got != "seen 5\nseen 6\nseen 7\n" {
+		t.Errorf("Expected only the new results in the combined output, got %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "since_test", fmt.Sprintf("since-%d", info.Size()), "result1.txt")); err != nil {
+		t.Errorf("Expected the appended chunks cached apart: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "since_test", "since-0")); !os.IsNotExist(err) {
+		t.Errorf("Expected the cache of the previous run to be pruned once the marker moved past it: %v", err)
+	}
+
+	// Nothing appended, nothing processed
+	log.Reset()
+	if sent := run(); sent != "" {
+		t.Errorf("Expected no request without appended input, got %q", sent)
+	}
+	if !strings.Contains(log.String(), "No input appended since byte") {
+		t.Errorf("Expected a message about the absence of new input, got:\n%s", log.String())
+	}
+
+	// A rotated file is processed from the start
+	if err := os.Remove(testFile); err != nil {
+		t.Fatalf("Failed to remove test file: %v", err)
+	}
+	appendLines(100, 101)
+	if sent := run(); sent != "event 100\n" {
+		t.Errorf("Expected the rotated file to be processed from the start, got %q", sent)
+	}
+}
+
+func TestProcessWithClient_SinceOffset(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "offset_test.log")
+	if err := os.WriteFile(testFile, []byte("old line\nnew line\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.SinceOffset = int64(len("old line\n"))
+	opts.Log = &bytes.Buffer{}
+
+	mock := &mockChatGenerator{}
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+	if mock.callCount != 1 || userContent(mock.params[0]) != "new line\n" {
+		t.Errorf("Expected only the input after the offset to be processed, got %d requests", mock.callCount)
+	}
+}
+
+func TestProcessWithClient_SinceLast(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "last_test.log")
+	appendLines := func(from, to int) {
+		f, err := os.OpenFile(testFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatalf("Failed to open test file: %v", err)
+		}
+		defer f.Close()
+		for i := from; i < to; i++ {
+			fmt.Fprintf(f, "event %d\n", i)
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.SinceLast = true
+	opts.Log = &bytes.Buffer{}
+
+	mock := &mockChatGenerator{
+		requestFunc: func(params openai.ChatCompletionNewParams) string {
+			return strings.ReplaceAll(userContent(params), "event", "seen")
+		},
+	}
+	run := func() string {
+		t.Helper()
+		mock.params = nil
+		if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+			t.Fatalf("ProcessWithClientOptions failed: %v", err)
+		}
+		var sent strings.Builder
+		for _, params := range mock.params {
+			sent.WriteString(userContent(params))
+		}
+		return sent.String()
+	}
+
+	appendLines(0, 3)
+	if sent := run(); sent != "event 0\nevent 1\nevent 2\n" {
+		t.Errorf("Expected the whole file to be processed, got %q", sent)
+	}
+	meta, err := loadCacheMeta(filepath.Join(tmpDir, "last_test"))
+	if err != nil || meta == nil || meta.ProcessedOffset != int64(len("event 0\nevent 1\nevent 2\n")) {
+		t.Fatalf("Expected the processed offset in the manifest, got %+v (%v)", meta, err)
+	}
+
+	// Only the appended lines are processed, their results appended
+	appendLines(3, 5)
+	if sent := run(); sent != "event 3\nevent 4\n" {
+		t.Errorf("Expected only the appended lines to be processed, got %q", sent)
+	}
+	combined, err := os.ReadFile(combinedFilePath(testFile))
+	if err != nil {
+		t.Fatalf("Failed to read combined output: %v", err)
+	}
+	if string(combined) != "seen 0\nseen 1\nseen 2\nseen 3\nseen 4\n" {
+		t.Errorf("Expected the results of both runs in the combined output, got %q", combined)
+	}
+}
+
+func TestProcessWithClient_SinceLastPartialRunNotAppended(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "partial_test.log")
+	if err := os.WriteFile(testFile, []byte("fast line 0 with a few words\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	var log bytes.Buffer
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.SinceLast = true
+	opts.ChunkSize = 10
+	opts.Concurrency = 2
+	opts.Deadline = 200 * time.Millisecond
+	opts.Log = &log
+
+	client := &blockingGenerator{prefix: "slow"}
+	client.requestFunc = func(params openai.ChatCompletionNewParams) string {
+		return userContent(params) + "\n"
+	}
+	run := func() string {
+		t.Helper()
+		if err := ProcessWithClientOptions(context.Background(), client, "test prompt", testFile, opts); err != nil {
+			t.Fatalf("ProcessWithClientOptions failed: %v", err)
+		}
+		combined, err := os.ReadFile(combinedFilePath(testFile))
+		if err != nil {
+			t.Fatalf("Failed to read combined output: %v", err)
+		}
+		return string(combined)
+	}
+	first := run()
+
+	// The deadline cancels the slow chunk of the appended input
+	f, err := os.OpenFile(testFile, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open test file: %v", err)
+	}
+	fmt.Fprint(f, "slow line 1 with a few words\nfast line 2 with a few words\n")
+	f.Close()
+	if combined := run(); combined != first {
+		t.Errorf("Expected the partial run not to append to the combined output, got %q", combined)
+	}
+	if !strings.Contains(log.String(), "Combined output not appended") {
+		t.Errorf("Expected the skipped append to be reported, got:\n%s", log.String())
+	}
+
+	// The next run resumes the appended input and appends all its results once
+	client.prefix = "none"
+	combined := run()
+	appended := strings.TrimPrefix(combined, first)
+	if appended == combined {
+		t.Fatalf("Expected the results to be appended to %q, got %q", first, combined)
+	}
+	for _, line := range []string{"slow line 1", "fast line 2"} {
+		if n := strings.Count(appended, line); n != 1 {
+			t.Errorf("Expected %q to be appended once, got %d times in %q", line, n, appended)
+		}
+	}
+}
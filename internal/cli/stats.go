@@ -0,0 +1,120 @@
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/tiktoken-go/tokenizer"
+)
+
+// defaultOutputRatio is the expected output ratio without history: the model
+// may keep every line of its chunk.
+const defaultOutputRatio = 1
+
+// outputStats records the output tokens per input token observed in the past
+// runs of each prompt, so that the cost estimation of the next runs calibrates
+// itself.
+type outputStats struct {
+	// Prompts is keyed by the hash of the prompt.
+	Prompts map[string]outputRatio `json:"prompts"`
+}
+
+// outputRatio is the running average of the output ratio of a prompt.
+type outputRatio struct {
+	Runs  int     `json:"runs"`
+	Ratio float64 `json:"ratio"`
+}
+
+// DefaultStatsFile returns the path of the output statistics in the user
+// cache directory, or an empty string when there is none.
+func DefaultStatsFile() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "mapred-llm", "output_ratios.json")
+}
+
+func promptKey(prompt string) string {
+	sum := sha256.Sum256([]byte(prompt))
+	return hex.EncodeToString(sum[:])
+}
+
+// loadOutputStats reads the statistics file, if any.
+func loadOutputStats(path string) (outputStats, error) {
+	stats := outputStats{Prompts: make(map[string]outputRatio)}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return stats, nil
+		}
+		return stats, fmt.Errorf("failed to read output statistics: %w", err)
+	}
+	if err := json.Unmarshal(b, &stats); err != nil {
+		return stats, fmt.Errorf("failed to parse output statistics: %w", err)
+	}
+	if stats.Prompts == nil {
+		stats.Prompts = make(map[string]outputRatio)
+	}
+	return stats, nil
+}
+
+// expectedOutputRatio returns the configured output ratio, or the average of
+// the past runs of the prompt when not configured.
+func expectedOutputRatio(opts Options, prompt string) float64 {
+	if opts.ExpectedOutputRatio > 0 {
+		return opts.ExpectedOutputRatio
+	}
+	if opts.StatsFile != "" {
+		// Broken statistics only cost the calibration
+		stats, err := loadOutputStats(opts.StatsFile)
+		if ratio, ok := stats.Prompts[promptKey(prompt)]; err == nil && ok {
+			return ratio.Ratio
+		}
+	}
+	return defaultOutputRatio
+}
+
+// recordOutputRatio adds the output ratio of the chunks processed by the API
+// to the running average of the prompt.
+func recordOutputRatio(path, prompt string, chunks []string, results []chunkResult) error {
+	enc, err := tokenizer.Get(tokenizer.Cl100kBase)
+	if err != nil {
+		return withCategory(ErrTokenizer, fmt.Errorf("failed to get tokenizer: %w", err))
+	}
+
+	var inputTokens, outputTokens int64
+	for _, result := range results {
+		if result.Cached || result.Usage.CompletionTokens == 0 {
+			continue
+		}
+		inputTokens += int64(countTokens(enc, chunks[result.Index]))
+		outputTokens += result.Usage.CompletionTokens
+	}
+	if inputTokens == 0 {
+		return nil
+	}
+
+	stats, err := loadOutputStats(path)
+	if err != nil {
+		return err
+	}
+	key := promptKey(prompt)
+	ratio := stats.Prompts[key]
+	ratio.Runs++
+	ratio.Ratio += (float64(outputTokens)/float64(inputTokens) - ratio.Ratio) / float64(ratio.Runs)
+	stats.Prompts[key] = ratio
+
+	b, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal output statistics: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), defaultCacheDirPerm); err != nil {
+		return fmt.Errorf("failed to create output statistics directory: %w", err)
+	}
+	return writeFileAtomic(path, b, defaultCacheFilePerm)
+}
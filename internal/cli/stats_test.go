@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/openai/openai-go"
+	"github.com/tiktoken-go/tokenizer"
+)
+
+func TestProcessWithClient_HistoricalOutputRatio(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "stats_test.txt")
+	text := strings.Repeat("word ", 3000)
+	if err := os.WriteFile(testFile, []byte(text), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	statsFile := filepath.Join(tmpDir, "stats", "output_ratios.json")
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.StatsFile = statsFile
+	opts.Log = &bytes.Buffer{}
+
+	chunks, err := splitChunks(text, opts)
+	if err != nil {
+		t.Fatalf("splitChunks failed: %v", err)
+	}
+	enc, err := tokenizer.Get(tokenizer.Cl100kBase)
+	if err != nil {
+		t.Fatalf("failed to get tokenizer: %v", err)
+	}
+	inputTokens := 0
+	for _, chunk := range chunks {
+		inputTokens += countTokens(enc, chunk)
+	}
+
+	// Without history the estimation assumes the model keeps everything
+	if ratio := expectedOutputRatio(opts, "test prompt"); ratio != defaultOutputRatio {
+		t.Errorf("Expected the default ratio without history, got %f", ratio)
+	}
+
+	mock := &mockChatGenerator{usage: openai.CompletionUsage{PromptTokens: 1000, CompletionTokens: 100}}
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+	expectedRatio := float64(100*len(chunks)) / float64(inputTokens)
+
+	var stdout bytes.Buffer
+	opts.EstimateOnly = true
+	opts.Stdout = &stdout
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	var estimation Estimation
+	if err := json.Unmarshal(stdout.Bytes(), &estimation); err != nil {
+		t.Fatalf("Expected JSON on stdout, got %q: %v", stdout.String(), err)
+	}
+	for _, row := range estimation.Comparison {
+		expected := float64(estimation.Tokens) * expectedRatio * modelOutputCosts[row.Model] / 1000000
+		if math.Abs(row.OutputCost-expected) > 1e-9 {
+			t.Errorf("%s: expected an output cost of $%f with the recorded ratio %f, got $%f", row.Model, expected, expectedRatio, row.OutputCost)
+		}
+	}
+
+	// Other prompts and configured ratios are not affected
+	if ratio := expectedOutputRatio(opts, "another prompt"); ratio != defaultOutputRatio {
+		t.Errorf("Expected the default ratio for another prompt, got %f", ratio)
+	}
+	opts.ExpectedOutputRatio = 0.3
+	if ratio := expectedOutputRatio(opts, "test prompt"); ratio != 0.3 {
+		t.Errorf("Expected the configured ratio to take precedence, got %f", ratio)
+	}
+}
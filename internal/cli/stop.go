@@ -0,0 +1,46 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxStopSequences is the number of stop sequences accepted by the API.
+const maxStopSequences = 4
+
+// stopPromptSuffix tells the model how to stop the processing of the chunks.
+const stopPromptSuffix = "\nIf this chunk contains what you are looking for, add a line with %s at the end of your answer."
+
+// stripStopSentinel removes the lines holding only the stop sentinel from the
+// output of a chunk and tells whether there was one. The sentinel within a
+// line is content, e.g. a quote of the input, and is kept.
+func stripStopSentinel(content, sentinel string) (string, bool) {
+	if !strings.Contains(content, sentinel) {
+		return content, false
+	}
+
+	lines := strings.SplitAfter(content, "\n")
+	kept := lines[:0]
+	stop := false
+	for _, line := range lines {
+		if strings.TrimSpace(line) == sentinel {
+			stop = true
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return strings.Join(kept, ""), stop
+}
+
+// checkStopSequences rejects the stop sequences the API would refuse.
+func checkStopSequences(sequences []string) error {
+	if len(sequences) > maxStopSequences {
+		return invalidConfig(fmt.Errorf("%d stop sequences given, at most %d are supported", len(sequences), maxStopSequences))
+	}
+	for _, sequence := range sequences {
+		if sequence == "" {
+			return invalidConfig(fmt.Errorf("a stop sequence must not be empty"))
+		}
+	}
+	return nil
+}
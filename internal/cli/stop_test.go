@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStripStopSentinel(t *testing.T) {
+	tests := []struct {
+		content  string
+		expected string
+		stop     bool
+	}{
+		{content: "apple\n", expected: "apple\n", stop: false},
+		{content: "apple\nSTOP\n", expected: "apple\n", stop: true},
+		{content: "apple STOP\n", expected: "apple STOP\n", stop: false},
+		{content: "STOPPED\n", expected: "STOPPED\n", stop: false},
+		{content: "apple\n  STOP \r\nbanana STOP\n", expected: "apple\nbanana STOP\n", stop: true},
+		{content: "STOP", expected: "", stop: true},
+	}
+	for _, tt := range tests {
+		got, stop := stripStopSentinel(tt.content, "STOP")
+		if got != tt.expected || stop != tt.stop {
+			t.Errorf("stripStopSentinel(%q) = %q, %v, expected %q, %v", tt.content, got, stop, tt.expected, tt.stop)
+		}
+	}
+}
+
+func TestProcessWithClient_StopSentinel(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "stop_test.txt")
+	if err := os.WriteFile(testFile, []byte(strings.Repeat("word ", 3000)), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.Concurrency = 1
+	opts.StopSentinel = "STOP"
+
+	mock := &mockChatGenerator{
+		responseFunc: func(callCount int) string {
+			if callCount == 2 {
+				return "found it\nSTOP\n"
+			}
+			return fmt.Sprintf("result %d\n", callCount)
+		},
+	}
+	if err := ProcessWithClientOptions(context.Background(), mock, "find it", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	if mock.callCount != 2 {
+		t.Errorf("Expected the chunks after the sentinel not to be dispatched, got %d requests", mock.callCount)
+	}
+	if prompt := systemContent(mock.params[0]); !strings.Contains(prompt, "add a line with STOP") {
+		t.Errorf("Expected the prompt to tell the model about the sentinel, got %q", prompt)
+	}
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, "stop_test.combined_results.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read combined results: %v", err)
+	}
+	if string(content) != "result 1\nfound it\n" {
+		t.Errorf("Expected the completed chunks without the sentinel, got %q", string(content))
+	}
+}
+
+func TestProcessWithClient_StopSequences(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "stop_sequences_test.txt")
+	if err := os.WriteFile(testFile, []byte("some content"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.StopSequences = []string{"\n---\n", "END"}
+
+	mock := &mockChatGenerator{}
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	if len(mock.params) != 1 {
+		t.Fatalf("Expected 1 request, got %d", len(mock.params))
+	}
+	if got := mock.params[0].Stop.OfStringArray; strings.Join(got, "|") != "\n---\n|END" {
+		t.Errorf("Expected the stop sequences to be forwarded, got %q", got)
+	}
+}
+
+func TestCheckStopSequences(t *testing.T) {
+	if err := checkStopSequences([]string{"a", "b", "c", "d"}); err != nil {
+		t.Errorf("Expected 4 stop sequences to be accepted, got %v", err)
+	}
+	for _, sequences := range [][]string{{"a", "b", "c", "d", "e"}, {""}} {
+		if err := checkStopSequences(sequences); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("checkStopSequences(%q): expected an invalid config error, got %v", sequences, err)
+		}
+	}
+}
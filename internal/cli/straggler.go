@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	myopenai "github.com/clems4ever/big-context/internal/openai"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/shared"
+)
+
+// errStraggler is the cause of the cancellation of a straggler request.
+var errStraggler = errors.New("straggler timeout")
+
+// stragglerMonitor cancels the requests still running after the timeout once
+// most of the chunks are complete, so that a few slow requests don't
+// dominate the wall time of the run. A nil monitor never cancels anything.
+type stragglerMonitor struct {
+	mu        sync.Mutex
+	threshold int
+	timeout   time.Duration
+	completed int
+	inflight  map[int]*stragglerRequest
+}
+
+// stragglerRequest is a request in flight.
+type stragglerRequest struct {
+	start  time.Time
+	cancel context.CancelCauseFunc
+	timer  *time.Timer
+}
+
+// newStragglerMonitor returns the monitor of a run, nil when the straggler
+// policy is disabled.
+func newStragglerMonitor(total int, opts Options) *stragglerMonitor {
+	if opts.StragglerAfter <= 0 || opts.StragglerTimeout <= 0 {
+		return nil
+	}
+	return &stragglerMonitor{
+		threshold: int(math.Ceil(opts.StragglerAfter * float64(total))),
+		timeout:   opts.StragglerTimeout,
+		inflight:  make(map[int]*stragglerRequest),
+	}
+}
+
+// Start registers the request of a chunk and returns its context, cancelled
+// with errStraggler if it becomes a straggler, and the function to call once
+// the request returned.
+func (m *stragglerMonitor) Start(ctx context.Context, i int) (context.Context, func()) {
+	if m == nil {
+		return ctx, func() {}
+	}
+
+	reqCtx, cancel := context.WithCancelCause(ctx)
+	r := &stragglerRequest{start: time.Now(), cancel: cancel}
+
+	m.mu.Lock()
+	m.inflight[i] = r
+	if m.completed >= m.threshold {
+		m.arm(r)
+	}
+	m.mu.Unlock()
+
+	return reqCtx, func() {
+		m.mu.Lock()
+		if r.timer != nil {
+			r.timer.Stop()
+		}
+		delete(m.inflight, i)
+		m.mu.Unlock()
+		cancel(nil)
+	}
+}
+
+// Complete counts a completed chunk and, once the threshold is reached,
+// applies the timeout to the requests in flight.
+func (m *stragglerMonitor) Complete() {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.completed++
+	if m.completed != m.threshold {
+		return
+	}
+	for _, r := range m.inflight {
+		m.arm(r)
+	}
+}
+
+// arm cancels the request once it has been running for the timeout.
+func (m *stragglerMonitor) arm(r *stragglerRequest) {
+	remaining := m.timeout - time.Since(r.start)
+	if remaining < 0 {
+		remaining = 0
+	}
+	r.timer = time.AfterFunc(remaining, func() { r.cancel(errStraggler) })
+}
+
+// generateChunk sends the request of a chunk. A request cancelled as a
+// straggler is sent again once, with the straggler model if any, and without
+// timeout so that the chunk completes. The model of the request that
+// succeeded is left in params.
+func (p *processor) generateChunk(ctx context.Context, i, attempt int, params *openai.ChatCompletionNewParams) (*openai.ChatCompletion, error) {
+	reqCtx, done := p.stragglers.Start(ctx, i)
+	res, err := p.generate(myopenai.WithIdempotencyKey(reqCtx, idempotencyKey(i, attempt, *params)), *params)
+	done()
+	if err == nil || ctx.Err() != nil || !errors.Is(context.Cause(reqCtx), errStraggler) {
+		return res, err
+	}
+
+	if p.opts.StragglerModel != "" {
+		params.Model = shared.ChatModel(p.opts.StragglerModel)
+	}
+	fmt.Fprintf(p.out, "Chunk %d: straggler cancelled after %s, retrying with %s\n", p.opts.chunkNumber(i), p.opts.StragglerTimeout, params.Model)
+	return p.generate(myopenai.WithIdempotencyKey(ctx, idempotencyKey(i, attempt, *params)), *params)
+}
@@ -0,0 +1,119 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/openai/openai-go"
+)
+
+// slowGenerator blocks the first request of a chunk until it is cancelled.
+type slowGenerator struct {
+	mockChatGenerator
+	slowChunk string
+	blocked   atomic.Bool
+	cancelled atomic.Bool
+}
+
+func (g *slowGenerator) GenerateChatCompletion(ctx context.Context, params openai.ChatCompletionNewParams) (*openai.ChatCompletion, error) {
+	if userContent(params) == g.slowChunk && g.blocked.CompareAndSwap(false, true) {
+		select {
+		case <-ctx.Done():
+			g.cancelled.Store(true)
+			return nil, ctx.Err()
+		case <-time.After(10 * time.Second):
+		}
+	}
+	return g.mockChatGenerator.GenerateChatCompletion(ctx, params)
+}
+
+func TestProcessWithClient_StragglerTimeout(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "straggler_test.txt")
+	var lines []string
+	for i := 0; i < 1000; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	text := strings.Join(lines, "\n")
+	if err := os.WriteFile(testFile, []byte(text), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.ChunkSize = 1000
+	opts.StragglerAfter = 0.5
+	opts.StragglerTimeout = 50 * time.Millisecond
+	opts.StragglerModel = ModelGPT5Mini
+
+	chunks, err := splitChunks(text, opts)
+	if err != nil {
+		t.Fatalf("splitChunks failed: %v", err)
+	}
+	if len(chunks) < 3 {
+		t.Fatalf("Expected at least 3 chunks, got %d", len(chunks))
+	}
+
+	mock := &slowGenerator{slowChunk: chunks[0]}
+	mock.requestFunc = func(params openai.ChatCompletionNewParams) string {
+		first, _, _ := strings.Cut(userContent(params), "\n")
+		return first + "\n"
+	}
+
+	start := time.Now()
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the straggler to be cancelled, the run took %s", elapsed)
+	}
+
+	if !mock.cancelled.Load() {
+		t.Error("Expected the slow request to be cancelled")
+	}
+
+	// The slow request never reached the mock, the retry did with the straggler model
+	retried := false
+	for _, params := range mock.params {
+		if userContent(params) == chunks[0] {
+			retried = true
+			if params.Model != string(ModelGPT5Mini) {
+				t.Errorf("Expected the straggler to be retried with %s, got %s", ModelGPT5Mini, params.Model)
+			}
+		} else if params.Model != string(ModelGPT5Nano) {
+			t.Errorf("Expected the other chunks to use %s, got %s", ModelGPT5Nano, params.Model)
+		}
+	}
+	if !retried {
+		t.Fatal("Expected the straggler to be retried")
+	}
+
+	content, err := os.ReadFile(filepath.Join(tmpDir, "straggler_test.combined_results.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read combined results: %v", err)
+	}
+	if !strings.HasPrefix(string(content), "line 0\n") {
+		t.Errorf("Expected the result of the straggler in the output, got %q", string(content))
+	}
+}
+
+func TestStragglerMonitor_Disabled(t *testing.T) {
+	if m := newStragglerMonitor(10, DefaultOptions()); m != nil {
+		t.Fatal("Expected no monitor by default")
+	}
+
+	// A nil monitor passes the context through
+	var m *stragglerMonitor
+	ctx, done := m.Start(context.Background(), 0)
+	done()
+	m.Complete()
+	if ctx.Err() != nil {
+		t.Errorf("Expected the context not to be cancelled, got %v", ctx.Err())
+	}
+}
@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/openai/openai-go"
+)
+
+// complete sends a single request, as a stream when Options.Stream is set.
+func (p *processor) complete(ctx context.Context, params openai.ChatCompletionNewParams) (*openai.ChatCompletion, error) {
+	if !p.opts.Stream {
+		return p.client.GenerateChatCompletion(ctx, params)
+	}
+	return p.completeStream(ctx, params)
+}
+
+// completeStream accumulates the events of a streamed completion into a
+// regular one. The usage isn't reported by default when streaming: it is
+// requested in the final event, which has no choice, so that the streamed
+// requests are accounted the same way as the others.
+func (p *processor) completeStream(ctx context.Context, params openai.ChatCompletionNewParams) (*openai.ChatCompletion, error) {
+	params.StreamOptions = openai.ChatCompletionStreamOptionsParam{IncludeUsage: openai.Bool(true)}
+
+	stream := p.client.GenerateChatCompletionStream(ctx, params)
+	if stream == nil {
+		return nil, fmt.Errorf("streaming is not supported by the client")
+	}
+	defer stream.Close()
+
+	var acc openai.ChatCompletionAccumulator
+	for stream.Next() {
+		chunk := stream.Current()
+		if !acc.AddChunk(chunk) {
+			return nil, fmt.Errorf("failed to accumulate the streamed completion %s", acc.ID)
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return nil, err
+	}
+	return &acc.ChatCompletion, nil
+}
+
+// transcript writes the outputs of the chunks one after the other, each one
+// on its own lines. Only the accepted output of a chunk is written, once it
+// completed: the raw deltas of an attempt may be retried, hold several
+// choices, a stop sentinel or justifications.
+type transcript struct {
+	w io.Writer
+	// open tells whether the last write didn't end a line
+	open bool
+}
+
+func (t *transcript) Write(b []byte) (int, error) {
+	if len(b) > 0 {
+		t.open = b[len(b)-1] != '\n'
+	}
+	return t.w.Write(b)
+}
+
+// EndChunk ends the line left open by the output of a chunk.
+func (t *transcript) EndChunk() {
+	if t.open {
+		t.Write([]byte("\n"))
+	}
+}
@@ -0,0 +1,266 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/packages/ssestream"
+)
+
+// eventsDecoder replays server-sent events.
+type eventsDecoder struct {
+	events []ssestream.Event
+	cur    ssestream.Event
+	// delay is waited before each event
+	delay   time.Duration
+	onClose func()
+}
+
+func (d *eventsDecoder) Next() bool {
+	if len(d.events) == 0 {
+		return false
+	}
+	time.Sleep(d.delay)
+	d.cur, d.events = d.events[0], d.events[1:]
+	return true
+}
+
+func (d *eventsDecoder) Event() ssestream.Event { return d.cur }
+func (d *eventsDecoder) Err() error             { return nil }
+
+func (d *eventsDecoder) Close() error {
+	if d.onClose != nil {
+		d.onClose()
+	}
+	return nil
+}
+
+// streamEvents turns a completion into the events the API streams: a chunk
+// per word of each choice and, when the usage is requested, a final chunk
+// without choice carrying the usage.
+func streamEvents(res *openai.ChatCompletion, includeUsage bool) *eventsDecoder {
+	var events []ssestream.Event
+	add := func(chunk map[string]any) {
+		chunk["id"] = "chatcmpl-mock"
+		chunk["object"] = "chat.completion.chunk"
+		data, _ := json.Marshal(chunk)
+		events = append(events, ssestream.Event{Data: data})
+	}
+
+	for i, choice := range res.Choices {
+		words := splitAfterSpaces(choice.Message.Content)
+		if len(words) == 0 {
+			words = []string{""}
+		}
+		for j, word := range words {
+			delta := map[string]any{"role": "assistant", "content": word}
+			finishReason := ""
+			if j == len(words)-1 {
+				delta["refusal"] = choice.Message.Refusal
+				finishReason = string(choice.FinishReason)
+			}
+			add(map[string]any{"choices": []map[string]any{{
+				"index":         i,
+				"finish_reason": finishReason,
+				"delta":         delta,
+			}}})
+		}
+	}
+	if includeUsage {
+		add(map[string]any{"choices": []any{}, "usage": map[string]any{
+			"prompt_tokens":     res.Usage.PromptTokens,
+			"completion_tokens": res.Usage.CompletionTokens,
+			"total_tokens":      res.Usage.PromptTokens + res.Usage.CompletionTokens,
+		}})
+	}
+	events = append(events, ssestream.Event{Data: []byte("[DONE]")})
+	return &eventsDecoder{events: events}
+}
+
+func TestProcessWithClient_StreamUsage(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "stream_test.txt")
+	content := "line one\nline two\nline three\n"
+	if err := os.WriteFile(testFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	var log bytes.Buffer
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.Stream = true
+	opts.ChunkSize = 5
+	opts.Log = &log
+
+	mock := &mockChatGenerator{
+		responseFunc: func(int) string { return "kept line\n" },
+		usage:        openai.CompletionUsage{PromptTokens: 100, CompletionTokens: 10},
+	}
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	for _, params := range mock.params {
+		if !params.StreamOptions.IncludeUsage.Value {
+			t.Errorf("Expected the usage to be requested in the final event of the stream")
+		}
+	}
+	if mock.callCount < 2 {
+		t.Fatalf("Expected several chunks, got %d requests", mock.callCount)
+	}
+
+	output, err := os.ReadFile(filepath.Join(tmpDir, "stream_test.combined_results.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read combined output: %v", err)
+	}
+	if string(output) != strings.Repeat("kept line\n", mock.callCount) {
+		t.Errorf("Expected the streamed content to be accumulated, got %q", output)
+	}
+
+	prompt, completion := int64(100*mock.callCount), int64(10*mock.callCount)
+	summary := fmt.Sprintf("Token usage: %d prompt + %d completion tokens ($%.4f)", prompt, completion, usageCost(opts.Model, prompt, completion))
+	if !strings.Contains(log.String(), summary) {
+		t.Errorf("Expected the streamed usage in the totals %q, got:\n%s", summary, log.String())
+	}
+}
+
+// inFlightStreamGenerator streams the responses of the mock slowly, recording
+// the maximum number of concurrent streams.
+type inFlightStreamGenerator struct {
+	mockChatGenerator
+
+	streams     sync.Mutex
+	inFlight    int
+	maxInFlight int
+}
+
+func (g *inFlightStreamGenerator) GenerateChatCompletionStream(ctx context.Context, params openai.ChatCompletionNewParams) *ssestream.Stream[openai.ChatCompletionChunk] {
+	g.streams.Lock()
+	g.inFlight++
+	g.maxInFlight = max(g.maxInFlight, g.inFlight)
+	g.streams.Unlock()
+
+	res, err := g.GenerateChatCompletion(ctx, params)
+	if err != nil {
+		return ssestream.NewStream[openai.ChatCompletionChunk](nil, err)
+	}
+	events := streamEvents(res, params.StreamOptions.IncludeUsage.Value)
+	events.delay = time.Millisecond
+	events.onClose = func() {
+		g.streams.Lock()
+		g.inFlight--
+		g.streams.Unlock()
+	}
+	return ssestream.NewStream[openai.ChatCompletionChunk](events, nil)
+}
+
+func TestProcessWithClient_SequentialStream(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "sequential_test.txt")
+	var content strings.Builder
+	for i := 0; i < 30; i++ {
+		fmt.Fprintf(&content, "line %d of the document\n", i)
+	}
+	if err := os.WriteFile(testFile, []byte(content.String()), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.Sequential = true
+	opts.Stream = true
+	opts.Concurrency = 8
+	opts.ChunkSize = 30
+	opts.Log = &bytes.Buffer{}
+
+	chunks, err := splitChunks(content.String(), opts)
+	if err != nil {
+		t.Fatalf("splitChunks failed: %v", err)
+	}
+	if len(chunks) < 4 {
+		t.Fatalf("Expected several chunks, got %d", len(chunks))
+	}
+	// The outputs don't end their line, the transcript does
+	var expected strings.Builder
+	for _, chunk := range chunks {
+		fmt.Fprintf(&expected, "seen %s\n", strings.SplitN(chunk, "\n", 2)[0])
+	}
+
+	gen := &inFlightStreamGenerator{mockChatGenerator: mockChatGenerator{
+		requestFunc: func(params openai.ChatCompletionNewParams) string {
+			return "seen " + strings.SplitN(userContent(params), "\n", 2)[0]
+		},
+	}}
+
+	var stdout bytes.Buffer
+	opts.Stdout = &stdout
+	if err := ProcessWithClientOptions(context.Background(), gen, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+	if gen.maxInFlight != 1 {
+		t.Errorf("Expected a single chunk in flight at a time, got %d", gen.maxInFlight)
+	}
+	if stdout.String() != expected.String() {
+		t.Errorf("Expected the outputs streamed in order:\n%s\ngot:\n%s", expected.String(), stdout.String())
+	}
+
+	// The cached chunks are printed whole among the streamed ones
+	if err := os.Remove(filepath.Join(tmpDir, "sequential_test", "result2.txt")); err != nil {
+		t.Fatalf("Failed to remove a result: %v", err)
+	}
+	stdout.Reset()
+	opts.IfExists = IfExistsOverwrite
+	if err := ProcessWithClientOptions(context.Background(), gen, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+	if gen.callCount != len(chunks)+1 {
+		t.Errorf("Expected only the uncached chunk to be requested again, got %d requests", gen.callCount-len(chunks))
+	}
+	if stdout.String() != expected.String() {
+		t.Errorf("Expected the cached and streamed outputs in order:\n%s\ngot:\n%s", expected.String(), stdout.String())
+	}
+}
+
+func TestProcessWithClient_SequentialStreamPrintsAcceptedOutput(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "sequential_sentinel_test.txt")
+	var content strings.Builder
+	for i := 0; i < 30; i++ {
+		fmt.Fprintf(&content, "line %d of the document\n", i)
+	}
+	if err := os.WriteFile(testFile, []byte(content.String()), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.Sequential = true
+	opts.Stream = true
+	opts.ChunkSize = 30
+	opts.StopSentinel = "STOP"
+	opts.Log = &bytes.Buffer{}
+
+	gen := &inFlightStreamGenerator{mockChatGenerator: mockChatGenerator{
+		requestFunc: func(params openai.ChatCompletionNewParams) string {
+			return "seen " + strings.SplitN(userContent(params), "\n", 2)[0] + "\nSTOP"
+		},
+	}}
+
+	var stdout bytes.Buffer
+	opts.Stdout = &stdout
+	if err := ProcessWithClientOptions(context.Background(), gen, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+	if stdout.String() != "seen line 0 of the document\n" {
+		t.Errorf("Expected the output of the first chunk without the sentinel, got %q", stdout.String())
+	}
+}
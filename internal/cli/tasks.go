@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	myopenai "github.com/clems4ever/big-context/internal/openai"
+)
+
+// Task is a named prompt run over the chunks of a file alongside other tasks.
+type Task struct {
+	Name   string
+	Prompt string
+	// OutputRatio is the expected output ratio of the task. When zero, it is
+	// resolved like Options.ExpectedOutputRatio from the past runs of the
+	// prompt of the task.
+	OutputRatio float64
+}
+
+// ParseTask parses a task given as name=prompt.
+func ParseTask(s string) (Task, error) {
+	name, prompt, ok := strings.Cut(s, "=")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" || prompt == "" {
+		return Task{}, invalidConfig(fmt.Errorf("invalid task %q (expected name=prompt)", s))
+	}
+	if name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return Task{}, invalidConfig(fmt.Errorf("invalid task name %q: it must be a plain file name", name))
+	}
+	return Task{Name: name, Prompt: prompt}, nil
+}
+
+// taskCombinedFilePath returns the path of the combined output of a task,
+// e.g. report.summary.combined_results.txt.
+func taskCombinedFilePath(filePath, name string) string {
+	filePathWithoutExt := strings.TrimSuffix(filePath, filepath.Ext(filePath))
+	return fmt.Sprintf("%s.%s.combined_results.txt", filePathWithoutExt, name)
+}
+
+// taskCacheLabel returns the cache label of a task so that each task has its
+// own results, nested under the label of the run if any.
+func taskCacheLabel(label, name string) string {
+	if label == "" {
+		return "task-" + name
+	}
+	return label + "-task-" + name
+}
+
+// resolveTaskOutputRatios returns the tasks with the expected output ratio of
+// each one resolved from its own prompt, and their average as the expected
+// output ratio of the run.
+func resolveTaskOutputRatios(opts Options) ([]Task, float64) {
+	tasks := make([]Task, len(opts.Tasks))
+	total := 0.0
+	for i, task := range opts.Tasks {
+		if task.OutputRatio <= 0 {
+			task.OutputRatio = expectedOutputRatio(opts, task.Prompt)
+		}
+		tasks[i] = task
+		total += task.OutputRatio
+	}
+	return tasks, total / float64(len(tasks))
+}
+
+// processTasks runs each task over the chunks in turn, the chunks of a task
+// being processed in parallel, and writes a combined output per task. The
+// tasks don't run concurrently: each one already has as many requests in
+// flight as Options.Concurrency allows, and its progress and reduce step
+// are reported under its own header.
+func processTasks(ctx context.Context, client myopenai.ChatGenerator, out *syncWriter, filePath string, chunks []textChunk, opts Options) error {
+	seen := make(map[string]bool)
+	for _, task := range opts.Tasks {
+		if seen[task.Name] {
+			return invalidConfig(fmt.Errorf("duplicate task name %q", task.Name))
+		}
+		seen[task.Name] = true
+	}
+
+	for n, task := range opts.Tasks {
+		if deadlineReached(ctx) {
+			fmt.Fprintf(out, "\nDeadline of %s reached: %d tasks not run\n", opts.Deadline, len(opts.Tasks)-n)
+			break
+		}
+		fmt.Fprintf(out, "\n=== Task %s (%d/%d) ===\n", task.Name, n+1, len(opts.Tasks))
+
+		combinedFileName := opts.combinedOutputPath(taskCombinedFilePath(filePath, task.Name))
+		if !opts.PrefetchOnly {
+			skip, err := checkExistingOutputs(out, opts.outputPaths(combinedFileName), opts.IfExists)
+			if err != nil {
+				return err
+			}
+			if skip {
+				continue
+			}
+		}
+
+		taskOpts := opts
+		taskOpts.Tasks = nil
+		taskOpts.ExpectedOutputRatio = task.OutputRatio
+		taskOpts.CacheLabel = taskCacheLabel(opts.CacheLabel, task.Name)
+		if err := processChunks(ctx, client, out, task.Prompt, filePath, chunks, combinedFileName, taskOpts); err != nil {
+			return fmt.Errorf("task %s: %w", task.Name, err)
+		}
+	}
+	return nil
+}
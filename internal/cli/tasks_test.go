@@ -0,0 +1,146 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/openai/openai-go"
+)
+
+func TestParseTask(t *testing.T) {
+	task, err := ParseTask("risks=List the risks = and their owners")
+	if err != nil {
+		t.Fatalf("ParseTask failed: %v", err)
+	}
+	if task.Name != "risks" || task.Prompt != "List the risks = and their owners" {
+		t.Errorf("Unexpected task %+v", task)
+	}
+
+	for _, s := range []string{"no prompt", "=prompt", "name=", "a/b=prompt", "..=prompt"} {
+		if _, err := ParseTask(s); err == nil {
+			t.Errorf("Expected an error for %q", s)
+		}
+	}
+}
+
+func TestProcessWithClient_Tasks(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "tasks_test.txt")
+	var lines []string
+	for i := 0; i < 600; i++ {
+		lines = append(lines, fmt.Sprintf("meeting note %d", i))
+	}
+	text := strings.Join(lines, "\n")
+	if err := os.WriteFile(testFile, []byte(text), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.ChunkSize = 1000
+	opts.Tasks = []Task{
+		{Name: "summary", Prompt: "Summarize the notes"},
+		{Name: "actions", Prompt: "Extract the action items"},
+	}
+
+	chunks, err := splitChunks(text, opts)
+	if err != nil {
+		t.Fatalf("splitChunks failed: %v", err)
+	}
+	if len(chunks) < 2 {
+		t.Fatalf("Expected at least 2 chunks, got %d", len(chunks))
+	}
+
+	mock := &mockChatGenerator{
+		requestFunc: func(params openai.ChatCompletionNewParams) string {
+			task, _, _ := strings.Cut(systemContent(params), " ")
+			return task + " result\n"
+		},
+	}
+	if err := ProcessWithClientOptions(context.Background(), mock, "", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	if expected := len(opts.Tasks) * len(chunks); mock.callCount != expected {
+		t.Errorf("Expected %d calls (one per task per chunk), got %d", expected, mock.callCount)
+	}
+
+	for _, tc := range []struct{ task, word string }{{"summary", "Summarize"}, {"actions", "Extract"}} {
+		combined, err := os.ReadFile(filepath.Join(tmpDir, "tasks_test."+tc.task+".combined_results.txt"))
+		if err != nil {
+			t.Fatalf("Failed to read the combined output of %s: %v", tc.task, err)
+		}
+		expected := strings.Repeat(tc.word+" result\n", len(chunks))
+		if string(combined) != expected {
+			t.Errorf("Task %s: expected %q, got %q", tc.task, expected, string(combined))
+		}
+
+		// Each task has its own cache
+		if _, err := os.Stat(filepath.Join(tmpDir, "tasks_test", "task-"+tc.task, "result1.txt")); err != nil {
+			t.Errorf("Expected the results of %s to be cached in their own directory: %v", tc.task, err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(tmpDir, "tasks_test.combined_results.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected no combined output outside of the tasks, got %v", err)
+	}
+
+	// A rerun is served from the per-task caches
+	callsBefore := mock.callCount
+	if err := ProcessWithClientOptions(context.Background(), mock, "", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed on rerun: %v", err)
+	}
+	if mock.callCount != callsBefore {
+		t.Errorf("Expected the rerun to use the cache, got %d new calls", mock.callCount-callsBefore)
+	}
+}
+
+func TestResolveTaskOutputRatios(t *testing.T) {
+	statsFile := filepath.Join(t.TempDir(), "output_ratios.json")
+	stats := outputStats{Prompts: map[string]outputRatio{
+		promptKey("Summarize the notes"):      {Runs: 1, Ratio: 0.2},
+		promptKey("Extract the action items"): {Runs: 1, Ratio: 0.6},
+	}}
+	b, err := json.Marshal(stats)
+	if err != nil {
+		t.Fatalf("Failed to marshal the statistics: %v", err)
+	}
+	if err := os.WriteFile(statsFile, b, 0644); err != nil {
+		t.Fatalf("Failed to write the statistics: %v", err)
+	}
+
+	opts := DefaultOptions()
+	opts.Model = ModelGPT5Mini
+	opts.StatsFile = statsFile
+	opts.Tasks = []Task{
+		{Name: "summary", Prompt: "Summarize the notes"},
+		{Name: "actions", Prompt: "Extract the action items"},
+		{Name: "risks", Prompt: "List the risks", OutputRatio: 0.1},
+	}
+
+	tasks, average := resolveTaskOutputRatios(opts)
+	for i, expected := range []float64{0.2, 0.6, 0.1} {
+		if tasks[i].OutputRatio != expected {
+			t.Errorf("Expected the ratio %f for task %s, got %f", expected, tasks[i].Name, tasks[i].OutputRatio)
+		}
+	}
+	if math.Abs(average-0.3) > 1e-9 {
+		t.Errorf("Expected the average ratio 0.3, got %f", average)
+	}
+	if opts.Tasks[0].OutputRatio != 0 {
+		t.Error("Expected the tasks of the options to be left untouched")
+	}
+
+	// Each task is estimated with its own ratio
+	opts.Tasks, opts.ExpectedOutputRatio = tasks, average
+	expected := usageCost(ModelGPT5Mini, 1000000, 200000) + usageCost(ModelGPT5Mini, 1000000, 600000) + usageCost(ModelGPT5Mini, 1000000, 100000)
+	if got := estimatedRunCost(1000000, 10, opts); math.Abs(got-expected) > 1e-9 {
+		t.Errorf("Expected $%.4f for the tasks, got $%.4f", expected, got)
+	}
+}
@@ -0,0 +1,151 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// tuiMaxListedChunks bounds the number of chunks listed individually.
+const tuiMaxListedChunks = 20
+
+// tuiModel is the state of the terminal progress view, updated from the
+// progress events of the workers.
+type tuiModel struct {
+	statuses []ChunkStatus
+	spent    float64
+	start    time.Time
+	now      func() time.Time
+
+	// first is the number of the first chunk
+	first int
+}
+
+func newTUIModel(total int) *tuiModel {
+	statuses := make([]ChunkStatus, total)
+	for i := range statuses {
+		statuses[i] = ChunkPending
+	}
+	return &tuiModel{
+		statuses: statuses,
+		first:    1,
+		start:    time.Now(),
+		now:      time.Now,
+	}
+}
+
+// Update applies a progress event to the model.
+func (m *tuiModel) Update(event ProgressEvent) {
+	if event.Chunk < 0 || event.Chunk >= len(m.statuses) {
+		return
+	}
+	m.statuses[event.Chunk] = event.Status
+	m.spent += event.Usage.Cost
+}
+
+// Count returns the number of chunks with the given status.
+func (m *tuiModel) Count(status ChunkStatus) int {
+	count := 0
+	for _, s := range m.statuses {
+		if s == status {
+			count++
+		}
+	}
+	return count
+}
+
+// Finished returns the number of chunks that won't be processed anymore.
+func (m *tuiModel) Finished() int {
+	return m.Count(ChunkDone) + m.Count(ChunkCached) + m.Count(ChunkError)
+}
+
+// ETA estimates the remaining time from the pace of the chunks processed by
+// the API, cached ones being instantaneous. It returns false when unknown.
+func (m *tuiModel) ETA() (time.Duration, bool) {
+	done := m.Count(ChunkDone)
+	remaining := len(m.statuses) - m.Finished()
+	if done == 0 {
+		return 0, remaining == 0
+	}
+	perChunk := m.now().Sub(m.start) / time.Duration(done)
+	return perChunk * time.Duration(remaining), true
+}
+
+// View renders the model.
+func (m *tuiModel) View() string {
+	var sb strings.Builder
+
+	total := len(m.statuses)
+	finished := m.Finished()
+	progress := 100.0
+	if total > 0 {
+		progress = float64(finished) / float64(total) * 100
+	}
+
+	eta := "unknown"
+	if d, ok := m.ETA(); ok {
+		eta = d.Round(time.Second).String()
+	}
+
+	fmt.Fprintf(&sb, "Progress: %d/%d chunks (%.1f%%)  spent: $%.4f  ETA: %s\n", finished, total, progress, m.spent, eta)
+	fmt.Fprintf(&sb, "pending: %d  running: %d  cached: %d  done: %d  error: %d\n",
+		m.Count(ChunkPending), m.Count(ChunkRunning), m.Count(ChunkCached), m.Count(ChunkDone), m.Count(ChunkError))
+
+	listed := 0
+	for i, status := range m.statuses {
+		if status != ChunkRunning && status != ChunkError {
+			continue
+		}
+		if listed == tuiMaxListedChunks {
+			sb.WriteString("  ...\n")
+			break
+		}
+		fmt.Fprintf(&sb, "  chunk %d: %s\n", m.first+i, status)
+		listed++
+	}
+
+	return sb.String()
+}
+
+// tui redraws the model in place on a terminal after each event.
+type tui struct {
+	w     io.Writer
+	model *tuiModel
+	lines int
+}
+
+func newTUI(w io.Writer, total int) *tui {
+	return &tui{w: w, model: newTUIModel(total)}
+}
+
+// Handle updates the model with the event and redraws the view.
+func (t *tui) Handle(event ProgressEvent) {
+	t.model.Update(event)
+	t.render()
+}
+
+func (t *tui) render() {
+	if t.lines > 0 {
+		// Move the cursor back to the beginning of the previous view and clear it
+		fmt.Fprintf(t.w, "\033[%dA\033[J", t.lines)
+	}
+	view := t.model.View()
+	fmt.Fprint(t.w, view)
+	t.lines = strings.Count(view, "\n")
+}
+
+// isTerminal tells whether the writer is an interactive terminal. It is a
+// variable so that tests can simulate a terminal.
+var isTerminal = func(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,117 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTUIModel_Update(t *testing.T) {
+	model := newTUIModel(4)
+	now := model.start
+	model.now = func() time.Time { return now }
+
+	if _, ok := model.ETA(); ok {
+		t.Error("Expected the ETA to be unknown before any chunk is done")
+	}
+
+	model.Update(ProgressEvent{Chunk: 0, Status: ChunkCached})
+	model.Update(ProgressEvent{Chunk: 1, Status: ChunkRunning})
+	model.Update(ProgressEvent{Chunk: 1, Status: ChunkDone, Usage: Usage{Cost: 0.25}})
+	model.Update(ProgressEvent{Chunk: 2, Status: ChunkError, Err: errors.New("boom")})
+	model.Update(ProgressEvent{Chunk: 3, Status: ChunkRunning})
+	// Out of range events are ignored
+	model.Update(ProgressEvent{Chunk: 10, Status: ChunkDone})
+
+	if got := model.Finished(); got != 3 {
+		t.Errorf("Expected 3 finished chunks, got %d", got)
+	}
+	if got := model.Count(ChunkRunning); got != 1 {
+		t.Errorf("Expected 1 running chunk, got %d", got)
+	}
+
+	now = now.Add(10 * time.Second)
+	eta, ok := model.ETA()
+	if !ok || eta != 10*time.Second {
+		t.Errorf("Expected an ETA of 10s, got %s (known=%v)", eta, ok)
+	}
+
+	view := model.View()
+	for _, expected := range []string{"3/4 chunks (75.0%)", "spent: $0.2500", "ETA: 10s", "chunk 3: error", "chunk 4: running"} {
+		if !strings.Contains(view, expected) {
+			t.Errorf("Expected the view to contain %q, got:\n%s", expected, view)
+		}
+	}
+}
+
+func TestProcessWithClient_ProgressEvents(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "progress_test.txt")
+	if err := os.WriteFile(testFile, []byte(strings.Repeat("word ", 3000)), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	var mu sync.Mutex
+	var events []ProgressEvent
+
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.Log = &bytes.Buffer{}
+	opts.ProgressFunc = func(event ProgressEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	}
+
+	if err := ProcessWithClientOptions(context.Background(), &mockChatGenerator{}, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	model := newTUIModel(events[0].Total)
+	for _, event := range events {
+		model.Update(event)
+	}
+	if model.Count(ChunkDone) != events[0].Total {
+		t.Errorf("Expected all %d chunks to be done, got %d", events[0].Total, model.Count(ChunkDone))
+	}
+
+	// A second run only reports cached chunks
+	events = nil
+	opts.IfExists = IfExistsOverwrite
+	if err := ProcessWithClientOptions(context.Background(), &mockChatGenerator{}, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+	for _, event := range events {
+		if event.Status != ChunkCached {
+			t.Errorf("Expected only cached events on the second run, got %s for chunk %d", event.Status, event.Chunk)
+		}
+	}
+}
+
+func TestProcessWithClient_TUIFallsBackWithoutTerminal(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "tui_test.txt")
+	if err := os.WriteFile(testFile, []byte("Some content"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	var log bytes.Buffer
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.TUI = true
+	opts.Log = &log
+
+	if err := ProcessWithClientOptions(context.Background(), &mockChatGenerator{}, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	if !strings.Contains(log.String(), "Progress: 1/1 chunks completed") {
+		t.Errorf("Expected plain progress messages, got:\n%s", log.String())
+	}
+}
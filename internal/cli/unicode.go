@@ -0,0 +1,9 @@
+package cli
+
+import "golang.org/x/text/unicode/norm"
+
+// normalizeUnicode converts the text to the NFC normalization form so that the
+// same logical text always tokenizes the same way.
+func normalizeUnicode(text string) string {
+	return norm.NFC.String(text)
+}
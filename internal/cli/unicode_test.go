@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEstimate_NormalizeUnicode(t *testing.T) {
+	tmpDir := t.TempDir()
+	// "café naïve résumé" with combining accents (NFD) and precomposed (NFC)
+	nfd := "cafe\u0301 nai\u0308ve re\u0301sume\u0301\n"
+	nfc := "caf\u00e9 na\u00efve r\u00e9sum\u00e9\n"
+
+	nfdFile := filepath.Join(tmpDir, "nfd.txt")
+	nfcFile := filepath.Join(tmpDir, "nfc.txt")
+	if err := os.WriteFile(nfdFile, []byte(nfd), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	if err := os.WriteFile(nfcFile, []byte(nfc), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	opts := DefaultOptions()
+	nfcEstimation, err := Estimate(nfcFile, opts)
+	if err != nil {
+		t.Fatalf("Estimate failed: %v", err)
+	}
+	rawEstimation, err := Estimate(nfdFile, opts)
+	if err != nil {
+		t.Fatalf("Estimate failed: %v", err)
+	}
+	if rawEstimation.Tokens == nfcEstimation.Tokens {
+		t.Fatalf("Expected the NFD text to tokenize differently, got %d tokens for both", nfcEstimation.Tokens)
+	}
+
+	opts.NormalizeUnicode = true
+	normalized, err := Estimate(nfdFile, opts)
+	if err != nil {
+		t.Fatalf("Estimate failed: %v", err)
+	}
+	if normalized.Tokens != nfcEstimation.Tokens {
+		t.Errorf("Expected %d tokens once normalized, got %d", nfcEstimation.Tokens, normalized.Tokens)
+	}
+}
@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// tokenDiscrepancy summarizes the difference between the prompt tokens billed
+// by the API and our estimate, over the chunks sent to the API.
+type tokenDiscrepancy struct {
+	Chunks int
+	// Min, Max, Mean and Median are in tokens, billed minus estimated.
+	Min    int64
+	Max    int64
+	Mean   float64
+	Median float64
+	// MeanRelative is the mean of the differences relative to the estimates.
+	MeanRelative float64
+}
+
+// computeTokenDiscrepancy compares the estimated and billed prompt tokens of
+// the results that were not served from the cache.
+func computeTokenDiscrepancy(results []chunkResult) tokenDiscrepancy {
+	var diffs []int64
+	var sum, sumRelative float64
+
+	for _, result := range results {
+		if result.Cached || result.EstimatedPromptTokens == 0 {
+			continue
+		}
+		diff := result.Usage.PromptTokens - result.EstimatedPromptTokens
+		diffs = append(diffs, diff)
+		sum += float64(diff)
+		sumRelative += float64(diff) / float64(result.EstimatedPromptTokens)
+	}
+
+	if len(diffs) == 0 {
+		return tokenDiscrepancy{}
+	}
+
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i] < diffs[j] })
+
+	median := float64(diffs[len(diffs)/2])
+	if len(diffs)%2 == 0 {
+		median = float64(diffs[len(diffs)/2-1]+diffs[len(diffs)/2]) / 2
+	}
+
+	return tokenDiscrepancy{
+		Chunks:       len(diffs),
+		Min:          diffs[0],
+		Max:          diffs[len(diffs)-1],
+		Mean:         sum / float64(len(diffs)),
+		Median:       median,
+		MeanRelative: sumRelative / float64(len(diffs)),
+	}
+}
+
+// printTokenDiscrepancy reports the discrepancy distribution.
+func printTokenDiscrepancy(w io.Writer, d tokenDiscrepancy) {
+	if d.Chunks == 0 {
+		fmt.Fprintln(w, "Token verification: no chunk was sent to the API")
+		return
+	}
+
+	fmt.Fprintf(w, "Token verification over %d chunks (billed - estimated prompt tokens):\n", d.Chunks)
+	fmt.Fprintf(w, "  min: %+d, median: %+.1f, mean: %+.1f, max: %+d\n", d.Min, d.Median, d.Mean, d.Max)
+	fmt.Fprintf(w, "  mean relative difference: %+.2f%%\n", d.MeanRelative*100)
+	if math.Abs(d.MeanRelative) > 0.05 {
+		fmt.Fprintln(w, "  Warning: the estimates drift by more than 5% from the billed tokens")
+	}
+}
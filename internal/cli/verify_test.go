@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/openai/openai-go"
+	"github.com/tiktoken-go/tokenizer"
+)
+
+func TestComputeTokenDiscrepancy(t *testing.T) {
+	results := []chunkResult{
+		{Usage: Usage{PromptTokens: 110}, EstimatedPromptTokens: 100},
+		{Usage: Usage{PromptTokens: 90}, EstimatedPromptTokens: 100},
+		{Usage: Usage{PromptTokens: 130}, EstimatedPromptTokens: 100},
+		// Cached results were not billed and are ignored
+		{Cached: true, EstimatedPromptTokens: 100},
+	}
+
+	d := computeTokenDiscrepancy(results)
+	if d.Chunks != 3 {
+		t.Fatalf("Expected 3 chunks, got %d", d.Chunks)
+	}
+	if d.Min != -10 || d.Max != 30 {
+		t.Errorf("Expected min -10 and max 30, got %d and %d", d.Min, d.Max)
+	}
+	if d.Median != 10 {
+		t.Errorf("Expected a median of 10, got %f", d.Median)
+	}
+	if d.Mean != 10 {
+		t.Errorf("Expected a mean of 10, got %f", d.Mean)
+	}
+	if math.Abs(d.MeanRelative-0.1) > 1e-9 {
+		t.Errorf("Expected a mean relative difference of 0.1, got %f", d.MeanRelative)
+	}
+}
+
+func TestProcessWithClient_VerifyTokens(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "verify_test.txt")
+	if err := os.WriteFile(testFile, []byte("Some content"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	enc, err := tokenizer.Get(tokenizer.Cl100kBase)
+	if err != nil {
+		t.Fatalf("Failed to get tokenizer: %v", err)
+	}
+	estimated := countTokens(enc, "test prompt\nReturn the lines that you want to keep.") + countTokens(enc, "Some content")
+
+	// The API bills the message overhead on top of the content
+	mock := &mockChatGenerator{
+		usage: openai.CompletionUsage{PromptTokens: int64(estimated + 7)},
+	}
+
+	var log bytes.Buffer
+	opts := DefaultOptions()
+	opts.RequireConfirmation = false
+	opts.VerifyTokens = true
+	opts.Log = &log
+
+	if err := ProcessWithClientOptions(context.Background(), mock, "test prompt", testFile, opts); err != nil {
+		t.Fatalf("ProcessWithClientOptions failed: %v", err)
+	}
+
+	output := log.String()
+	if !strings.Contains(output, "Token verification over 1 chunks") {
+		t.Errorf("Expected the verification report, got:\n%s", output)
+	}
+	if !strings.Contains(output, "min: +7, median: +7.0, mean: +7.0, max: +7") {
+		t.Errorf("Expected a discrepancy of 7 tokens, got:\n%s", output)
+	}
+	expectedRelative := fmt.Sprintf("%+.2f%%", 7/float64(estimated)*100)
+	if !strings.Contains(output, expectedRelative) {
+		t.Errorf("Expected a relative difference of %s, got:\n%s", expectedRelative, output)
+	}
+}
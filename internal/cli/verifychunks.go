@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ErrChunksMismatch is returned when the chunks don't reconstruct the input.
+var ErrChunksMismatch = errors.New("the chunks don't cover the input")
+
+// verifyChunks checks that the chunks reconstruct the input with no gap nor
+// overlap and reports the offset of the first divergence in the input. The
+// chunks must be an exact partition when the input structure is preserved,
+// otherwise they are joined with the line delimiter and the whitespace is
+// ignored since long lines are split on words.
+func verifyChunks(text string, chunks []string, delimiter string, exact bool) error {
+	if exact {
+		joined := strings.Join(chunks, "")
+		if joined == text {
+			return nil
+		}
+		offset := 0
+		for offset < len(text) && offset < len(joined) && text[offset] == joined[offset] {
+			offset++
+		}
+		return chunksDivergence(text, offset)
+	}
+
+	joined := strings.Join(chunks, delimiter)
+	i, j := 0, 0
+	for {
+		i = skipSpaces(text, i)
+		j = skipSpaces(joined, j)
+		if i == len(text) || j == len(joined) {
+			break
+		}
+
+		r1, size1 := utf8.DecodeRuneInString(text[i:])
+		r2, size2 := utf8.DecodeRuneInString(joined[j:])
+		if r1 != r2 {
+			return chunksDivergence(text, i)
+		}
+		i += size1
+		j += size2
+	}
+	if i != len(text) || j != len(joined) {
+		return chunksDivergence(text, i)
+	}
+	return nil
+}
+
+func skipSpaces(s string, i int) int {
+	for i < len(s) {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		i += size
+	}
+	return i
+}
+
+// chunksDivergence describes the input where the chunks diverge from it.
+func chunksDivergence(text string, offset int) error {
+	excerpt := text[offset:]
+	if len(excerpt) > 40 {
+		excerpt = prefixRunes(excerpt, 40)
+	}
+	return fmt.Errorf("%w: first divergence at byte %d of %d (%q)", ErrChunksMismatch, offset, len(text), excerpt)
+}
@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestVerifyChunks_SplittersCoverInput(t *testing.T) {
+	inputs := map[string]string{
+		"paragraphs":  strings.Repeat("A short line.\nAnother one.\n\n", 200),
+		"long line":   "intro\n" + strings.Repeat("a long line made of many words ", 300) + "\noutro\n",
+		"medium line": "intro\n" + strings.Repeat("a medium line ", 60) + "\noutro\n",
+		"long word":   "before\n" + strings.Repeat("x9Y", 2000) + "\nafter",
+		"unicode":     strings.Repeat("héllo wörld ✓\n", 300),
+	}
+
+	for name, text := range inputs {
+		for _, preserve := range []bool{false, true} {
+			for _, ceiling := range []int{0, 400} {
+				opts := DefaultOptions()
+				opts.ChunkSize = 100
+				opts.MaxChunkSize = ceiling
+				opts.PreserveInputStructure = preserve
+				opts.VerifyChunks = true
+				if _, err := splitChunks(text, opts); err != nil {
+					t.Errorf("%s (preserve %v, ceiling %d): %v", name, preserve, ceiling, err)
+				}
+			}
+		}
+	}
+}
+
+func TestVerifyChunks_FlagsCorruptedSplitter(t *testing.T) {
+	text := "first line\nsecond line\nthird line\nfourth line"
+	textChunks, err := splitIntoTokenChunks(text, 5)
+	if err != nil {
+		t.Fatalf("splitIntoTokenChunks failed: %v", err)
+	}
+	chunks := chunkTexts(textChunks)
+	if len(chunks) < 3 {
+		t.Fatalf("Expected at least 3 chunks, got %v", chunks)
+	}
+	if err := verifyChunks(text, chunks, "\n", false); err != nil {
+		t.Fatalf("Expected the chunks to cover the input: %v", err)
+	}
+
+	// A splitter dropping a chunk leaves a gap
+	gap := append([]string{chunks[0]}, chunks[2:]...)
+	err = verifyChunks(text, gap, "\n", false)
+	if !errors.Is(err, ErrChunksMismatch) {
+		t.Fatalf("Expected ErrChunksMismatch for a gap, got %v", err)
+	}
+	offset := len(chunks[0]) + 1
+	if !strings.Contains(err.Error(), fmt.Sprintf("byte %d ", offset)) {
+		t.Errorf("Expected the divergence at byte %d, got %v", offset, err)
+	}
+
+	// A splitter repeating a chunk overlaps
+	overlap := append([]string{chunks[0], chunks[0]}, chunks[1:]...)
+	if err := verifyChunks(text, overlap, "\n", false); !errors.Is(err, ErrChunksMismatch) {
+		t.Errorf("Expected ErrChunksMismatch for an overlap, got %v", err)
+	}
+
+	// A splitter losing the end of the input
+	if err := verifyChunks(text, chunks[:len(chunks)-1], "\n", false); !errors.Is(err, ErrChunksMismatch) {
+		t.Errorf("Expected ErrChunksMismatch for a truncated input, got %v", err)
+	}
+
+	// In exact mode, whitespace matters
+	exact, err := splitPreservingStructure(text, 5)
+	if err != nil {
+		t.Fatalf("splitPreservingStructure failed: %v", err)
+	}
+	exact[1] = strings.Replace(exact[1], "\n", " \n", 1)
+	err = verifyChunks(text, exact, "\n", true)
+	if !errors.Is(err, ErrChunksMismatch) {
+		t.Fatalf("Expected ErrChunksMismatch for changed spacing, got %v", err)
+	}
+	offset = len(exact[0]) + strings.Index(exact[1], " \n")
+	if !strings.Contains(err.Error(), fmt.Sprintf("byte %d ", offset)) {
+		t.Errorf("Expected the divergence at byte %d, got %v", offset, err)
+	}
+}
@@ -23,11 +23,18 @@ type clientImpl struct {
 }
 
 // NewClient creates a new clientImpl using the OPENAI_API_KEY environment variable.
+// The headers are added to every request, e.g. API version or beta headers.
 // Returns an error if the API key is not set.
-func NewClient(apiKey string, httpClient *http.Client) (*clientImpl, error) {
+func NewClient(apiKey string, httpClient *http.Client, headers map[string]string) (*clientImpl, error) {
 	clientOpts := []option.RequestOption{
 		option.WithAPIKey(apiKey),
 		option.WithRequestTimeout(5 * time.Minute),
+		// Retries are handled by the caller so that they can be coordinated across requests.
+		option.WithMaxRetries(0),
+	}
+
+	for key, value := range headers {
+		clientOpts = append(clientOpts, option.WithHeader(key, value))
 	}
 
 	if httpClient != nil {
@@ -39,9 +46,18 @@ func NewClient(apiKey string, httpClient *http.Client) (*clientImpl, error) {
 }
 
 func (o *clientImpl) GenerateChatCompletion(ctx context.Context, body openai.ChatCompletionNewParams) (*openai.ChatCompletion, error) {
-	return o.client.Chat.Completions.New(ctx, body)
+	return o.client.Chat.Completions.New(ctx, body, requestOptions(ctx)...)
 }
 
 func (o *clientImpl) GenerateChatCompletionStream(ctx context.Context, body openai.ChatCompletionNewParams) *ssestream.Stream[openai.ChatCompletionChunk] {
-	return o.client.Chat.Completions.NewStreaming(ctx, body)
+	return o.client.Chat.Completions.NewStreaming(ctx, body, requestOptions(ctx)...)
+}
+
+// requestOptions returns the per-request options carried by the context.
+func requestOptions(ctx context.Context) []option.RequestOption {
+	var opts []option.RequestOption
+	if key := IdempotencyKey(ctx); key != "" {
+		opts = append(opts, option.WithHeader(IdempotencyKeyHeader, key))
+	}
+	return opts
 }
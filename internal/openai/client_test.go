@@ -0,0 +1,47 @@
+package myopenai
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/openai/openai-go"
+)
+
+func TestNewClient_CustomHeaders(t *testing.T) {
+	var received http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"1","object":"chat.completion","choices":[{"index":0,"finish_reason":"stop","message":{"role":"assistant","content":"ok"}}]}`))
+	}))
+	defer server.Close()
+	t.Setenv("OPENAI_BASE_URL", server.URL)
+
+	client, err := NewClient("test-key", nil, map[string]string{
+		"OpenAI-Beta": "assistants=v2",
+		"Api-Version": "2024-10-21",
+	})
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+
+	_, err = client.GenerateChatCompletion(context.Background(), openai.ChatCompletionNewParams{
+		Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage("hello")},
+		Model:    "gpt-5-nano",
+	})
+	if err != nil {
+		t.Fatalf("GenerateChatCompletion failed: %v", err)
+	}
+
+	if got := received.Get("OpenAI-Beta"); got != "assistants=v2" {
+		t.Errorf("Expected OpenAI-Beta header, got %q", got)
+	}
+	if got := received.Get("Api-Version"); got != "2024-10-21" {
+		t.Errorf("Expected Api-Version header, got %q", got)
+	}
+	if got := received.Get("Authorization"); got != "Bearer test-key" {
+		t.Errorf("Expected the API key to be kept, got %q", got)
+	}
+}